@@ -3,9 +3,13 @@ package config
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -17,14 +21,44 @@ type Config struct {
 	JWT      JWTConfig
 	Security SecurityConfig
 	Login    LoginSecurityConfig
+	Notify   NotificationConfig
+	Cleanup  CleanupConfig
+	Backup   BackupConfig
+	TLS      TLSConfig
+	Format   FormatConfig
+
+	// DataDir roots relative file paths (database, backups, logs, admin
+	// password file); empty keeps them relative to the working directory
+	DataDir string
 }
 
+// Server modes; production refuses insecure development fallbacks
+const (
+	ServerModeDevelopment = "development"
+	ServerModeProduction  = "production"
+)
+
 type ServerConfig struct {
+	Mode            string // SERVER_MODE: development or production
 	Port            string
 	Host            string
 	ReadTimeout     time.Duration
 	WriteTimeout    time.Duration
-	ShutdownTimeout time.Duration
+	ShutdownTimeout time.Duration // for HTTP connections to close
+	DrainTimeout    time.Duration // for backups and imports to finish, before ShutdownTimeout starts
+	MetricsAddr     string        // separate listener for /metrics; "off" disables
+
+	// Response compression; level -1 is the gzip default and 0 disables it
+	GzipLevel     int
+	GzipMinLength int
+
+	// FrontendDevURL proxies the UI routes to a dev server (e.g. Vite) instead
+	// of the embedded build; empty serves the embedded build
+	FrontendDevURL string
+
+	// Headless runs Monex as a server (e.g. behind nginx or Caddy): no
+	// self-signed certificate, no browser auto-open, no console prompts
+	Headless bool
 }
 
 type DatabaseConfig struct {
@@ -33,19 +67,101 @@ type DatabaseConfig struct {
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
 	BusyTimeout     int
+	// SlowQueryMS logs statements taking longer, in milliseconds (0 disables)
+	SlowQueryMS int
+	// AdminPasswordFile receives the generated password of the initial admin
+	AdminPasswordFile string
+	// Initial admin account; with AdminPassword set no password file is written
+	AdminUsername string
+	AdminEmail    string
+	AdminPassword string
 }
 
 type JWTConfig struct {
 	Secret          string
 	AccessDuration  time.Duration
 	RefreshDuration time.Duration
+	// Admin token lifetimes; 0 falls back to AccessDuration/RefreshDuration
+	AdminAccessDuration  time.Duration
+	AdminRefreshDuration time.Duration
+	PrivateKeyFile       string // RS256 signing key (PEM); HS256 with Secret when unset
+	PublicKeyFile        string // RS256 verification key (PEM)
+
+	// Refresh token lifetimes for logins that set remember_me to true or
+	// false; logins without it get RefreshDuration
+	RememberMeDuration   time.Duration
+	NoRememberMeDuration time.Duration
+
+	// PreviousSecret still verifies HS256 tokens after Secret is rotated, so
+	// the rotation doesn't log everyone out; nothing is signed with it
+	PreviousSecret string
 }
 
 type SecurityConfig struct {
-	BcryptCost      int
-	RateLimit       int
-	RateLimitWindow time.Duration
-	AllowedOrigins  []string
+	BcryptCost       int
+	RateLimit        int
+	RateLimitWindow  time.Duration
+	RegisterLimit    int // registrations per RegisterWindow per IP
+	RegisterWindow   time.Duration
+	RefreshLimit     int // token refreshes per RefreshWindow per IP
+	RefreshWindow    time.Duration
+	AllowedOrigins   []string
+	IdleTimeout      time.Duration // 0 disables idle-session expiry
+	AdminIPAllowlist []string      // CIDRs allowed to reach admin routes; empty allows all
+	TrustedProxies   []string      // CIDRs whose X-Forwarded-For is honored for the client IP
+	ActiveWindow     time.Duration // sessions seen within this window are reported as active now
+	// Extra request-body keys redacted from audit logs
+	AuditRedactFields []string
+	// Usernames new accounts can't take, compared case-insensitively
+	ReservedUsernames []string
+	// In-memory rate limiter stores (endpoint limiters and login tracker)
+	RateLimitEntryTTL   time.Duration // idle entries expire individually after this
+	RateLimitMaxEntries int           // per store; the least recently seen entry is evicted when full
+	// Longest transaction/recurring note accepted, in characters
+	MaxNoteLength int
+	// Accepted range of a transaction's created_at around now; 0 MaxPast is unlimited
+	TransactionMaxFuture time.Duration
+	TransactionMaxPast   time.Duration
+	// Open SSE/WebSocket notification streams re-validate their token this often
+	NotificationRecheck time.Duration
+	// Session invalidation long-poll limits
+	SessionPollTimeout    time.Duration
+	SessionPollMaxWaiters int // concurrent long-polls per user
+	SessionMaxTracked     int // sessions tracked by the invalidation hub
+	PasswordPolicy        PasswordPolicyConfig
+
+	RequireEmailVerification bool          // unverified users may log in but not modify data
+	EmailVerificationTTL     time.Duration // lifetime of an email verification token
+	EmailVerificationKey     string        // HMAC key of verification tokens, independent of the JWT keys
+
+	PasswordResetTTL            time.Duration // lifetime of a forgot-password token
+	PasswordResetRevokeSessions bool          // log the user out everywhere after a reset
+	ForgotPasswordLimit         int           // forgot-password requests per ForgotPasswordWindow per IP
+	ForgotPasswordWindow        time.Duration
+
+	// Set device_id as an httpOnly cookie at login; the X-Device-ID header still works
+	DeviceIDCookie bool
+
+	// Per-type note and amount rules for created and updated transactions
+	TransactionRules TransactionRulesConfig
+
+	// How far back POST /api/transactions/undo reaches
+	TransactionUndoWindow time.Duration
+
+	// Compare requests with the device and network their session was created on
+	FingerprintCheck      bool // flag mismatching sessions as suspicious
+	StrictFingerprint     bool // end mismatching sessions instead (implies FingerprintCheck)
+	FingerprintIPv4Prefix int  // addresses within the same /N count as one network; 0 ignores IP changes
+	FingerprintIPv6Prefix int
+}
+
+type PasswordPolicyConfig struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	RejectCommon  bool // reject passwords on the embedded common-password list
+	HistorySize   int  // previous passwords that can't be reused; 0 disables the check
 }
 
 type LoginSecurityConfig struct {
@@ -53,6 +169,80 @@ type LoginSecurityConfig struct {
 	TempBanDuration   time.Duration
 	MaxTempBans       int
 	AutoUnlockEnabled bool
+
+	ChallengeEnabled    bool          // require proof-of-work after repeated failures
+	ChallengeThreshold  int           // failed logins from one IP before a challenge is required
+	ChallengeDifficulty int           // leading zero bits the solution hash must have
+	ChallengeTTL        time.Duration // how long an issued challenge stays valid
+
+	// Push an account_status event to the user's live connections when failed logins block them
+	NotifyLockout bool
+
+	// Answer disabled and locked accounts like a wrong password
+	HideUserEnumeration bool
+
+	// Flag a user's recent sessions when SessionBurstThreshold new sessions
+	// are created within SessionBurstWindow; 0 disables the check
+	SessionBurstThreshold int
+	SessionBurstWindow    time.Duration
+	SessionBurstLock      bool // also lock the account until an admin unlocks it
+}
+
+type NotificationConfig struct {
+	WebhookURL     string
+	WebhookTimeout time.Duration
+	WebhookRetries int
+}
+
+type CleanupConfig struct {
+	SessionInterval      time.Duration // expired sessions and DB blacklist entries
+	BlacklistInterval    time.Duration // in-memory token blacklist
+	InvalidationInterval time.Duration // stale session invalidation channels
+	AutoUnlockInterval   time.Duration // expired temporary locks (when AUTO_UNLOCK_ENABLED)
+
+	AuditRetentionDays         int // audit rows older than this are purged; 0 keeps them forever
+	AuditCriticalRetentionDays int // separate retention for critical rows; 0 keeps them forever
+}
+
+// TLS modes
+const (
+	TLSModeAuto     = "auto"     // use the configured pair, generating a self-signed one if it is missing or invalid
+	TLSModeProvided = "provided" // use the configured pair; refuse to start without it
+	TLSModeDisabled = "disabled" // plain HTTP, e.g. behind a TLS-terminating reverse proxy
+	TLSModeACME     = "acme"     // obtain and renew trusted certificates from Let's Encrypt
+)
+
+type TLSConfig struct {
+	Mode            string
+	CertFile        string
+	KeyFile         string
+	SelfSignedHosts []string // DNS names and IPs put in generated certificates
+
+	// ACME mode
+	ACMEDomains  []string // only these hosts get certificates
+	ACMEEmail    string   // contact for expiry and account notices
+	ACMECacheDir string   // account key and issued certificates
+	ACMEHTTPAddr string   // listener for HTTP-01 challenges (must be reachable on port 80)
+}
+
+// Enabled reports whether the server serves HTTPS
+func (c *TLSConfig) Enabled() bool {
+	return c.Mode != TLSModeDisabled
+}
+
+// FormatConfig tells clients how to display amounts. Amounts are stored as
+// integers in the smallest unit, so DecimalPlaces > 0 means minor units.
+type FormatConfig struct {
+	BaseCurrency       string // ISO 4217 code, or IRT for toman
+	Locale             string // BCP 47 tag, e.g. fa-IR
+	DecimalPlaces      int
+	ThousandsSeparator string
+}
+
+type BackupConfig struct {
+	AutoInterval time.Duration // 0 disables scheduled backups
+	Dir          string
+	Keep         int // number of scheduled backups to retain
 }
 
 func Load() *Config {
@@ -60,37 +250,124 @@ func Load() *Config {
 		log.Println("⚠️ No .env file found, using environment variables or defaults")
 	}
 
-	return &Config{
+	// ✅ Optional YAML/JSON config file, overlaid under env and .env
+	if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
+		if err := loadConfigFile(configFile); err != nil {
+			log.Fatalf("[CRITICAL] Failed to load CONFIG_FILE %s: %v", configFile, err)
+		}
+		log.Printf("✅ Loaded config file %s", configFile)
+	}
+
+	dataDir := getEnv("DATA_DIR", "")
+	if err := EnsureDataDir(dataDir); err != nil {
+		log.Fatalf("[CRITICAL] Failed to create DATA_DIR %s: %v", dataDir, err)
+	}
+
+	serverMode := strings.ToLower(strings.TrimSpace(getEnv("SERVER_MODE", ServerModeDevelopment)))
+	if serverMode != ServerModeDevelopment && serverMode != ServerModeProduction {
+		log.Printf("⚠️ WARNING: SERVER_MODE=%q is not one of development, production; using development", serverMode)
+		serverMode = ServerModeDevelopment
+	}
+
+	jwtSecret, err := getJWTSecret(secretPath(dataDir, ".jwt-secret"), serverMode == ServerModeProduction)
+	if err != nil {
+		log.Fatalf("🛑 CRITICAL: %v", err)
+	}
+
+	cfg := &Config{
+		DataDir: dataDir,
 		Server: ServerConfig{
+			Mode:            serverMode,
 			Port:            getEnv("PORT", "3040"),
 			Host:            getEnv("HOST", "localhost"),
 			ReadTimeout:     getDurationEnv("READ_TIMEOUT", 10*time.Second),
 			WriteTimeout:    getDurationEnv("WRITE_TIMEOUT", 10*time.Second),
 			ShutdownTimeout: getDurationEnv("SHUTDOWN_TIMEOUT", 15*time.Second),
+			DrainTimeout:    getDurationEnv("SHUTDOWN_DRAIN_TIMEOUT", 2*time.Minute),
+			MetricsAddr:     getEnv("METRICS_ADDR", "127.0.0.1:9091"),
+
+			GzipLevel:     getIntEnv("GZIP_LEVEL", -1),
+			GzipMinLength: getIntEnv("GZIP_MIN_LENGTH", 1024),
+
+			FrontendDevURL: getEnv("FRONTEND_DEV_URL", ""),
+
+			Headless: getBoolEnv("HEADLESS", false),
 		},
 
 		Database: DatabaseConfig{
-			Path:            getEnv("DB_PATH", "./data.db"),
-			MaxOpenConns:    getIntEnv("DB_MAX_OPEN_CONNS", 25),
-			MaxIdleConns:    getIntEnv("DB_MAX_IDLE_CONNS", 5),
-			ConnMaxLifetime: getDurationEnv("DB_CONN_MAX_LIFETIME", 5*time.Minute),
-			BusyTimeout:     getIntEnv("DB_BUSY_TIMEOUT", 5000),
+			Path:              ResolveDataPath(dataDir, getEnv("DB_PATH", "./data.db")),
+			MaxOpenConns:      getIntEnv("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:      getIntEnv("DB_MAX_IDLE_CONNS", 5),
+			ConnMaxLifetime:   getDurationEnv("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+			BusyTimeout:       getIntEnv("DB_BUSY_TIMEOUT", 5000),
+			SlowQueryMS:       getIntEnv("SLOW_QUERY_MS", 250),
+			AdminPasswordFile: ResolveDataPath(dataDir, ".admin-password.txt"),
+			AdminUsername:     getEnv("ADMIN_USERNAME", "admin"),
+			AdminEmail:        strings.ToLower(strings.TrimSpace(getEnv("ADMIN_EMAIL", "admin@monex.local"))),
+			AdminPassword:     getEnv("ADMIN_PASSWORD", ""),
 		},
 
 		JWT: JWTConfig{
-			Secret:          getJWTSecret(),
-			AccessDuration:  getDurationEnv("JWT_ACCESS_DURATION", 15*time.Minute),
-			RefreshDuration: getDurationEnv("JWT_REFRESH_DURATION", 168*time.Hour),
+			Secret:               jwtSecret,
+			PreviousSecret:       getEnv("JWT_SECRET_PREVIOUS", ""),
+			AccessDuration:       getDurationEnv("JWT_ACCESS_DURATION", 15*time.Minute),
+			RefreshDuration:      getDurationEnv("JWT_REFRESH_DURATION", 168*time.Hour),
+			AdminAccessDuration:  getDurationEnv("JWT_ADMIN_ACCESS_DURATION", 0),
+			AdminRefreshDuration: getDurationEnv("JWT_ADMIN_REFRESH_DURATION", 0),
+			RememberMeDuration:   getDurationEnv("JWT_REMEMBER_ME_DURATION", 720*time.Hour),
+			NoRememberMeDuration: getDurationEnv("JWT_NO_REMEMBER_ME_DURATION", 24*time.Hour),
+			PrivateKeyFile:       getEnv("JWT_PRIVATE_KEY_FILE", ""),
+			PublicKeyFile:        getEnv("JWT_PUBLIC_KEY_FILE", ""),
 		},
 
 		Security: SecurityConfig{
-			BcryptCost:      getIntEnv("BCRYPT_COST", 12),
-			RateLimit:       getIntEnv("RATE_LIMIT", 100),
-			RateLimitWindow: getDurationEnv("RATE_LIMIT_WINDOW", 1*time.Minute),
-			AllowedOrigins: []string{
-				"http://localhost:3040",
-				"http://localhost:3000",
+			BcryptCost:            getIntEnv("BCRYPT_COST", 12),
+			RateLimit:             getIntEnv("RATE_LIMIT", 100),
+			RateLimitWindow:       getDurationEnv("RATE_LIMIT_WINDOW", 1*time.Minute),
+			RegisterLimit:         getIntEnv("REGISTER_RATE_LIMIT", 5),
+			RegisterWindow:        getDurationEnv("REGISTER_RATE_WINDOW", 1*time.Hour),
+			RefreshLimit:          getIntEnv("REFRESH_RATE_LIMIT", 30),
+			RefreshWindow:         getDurationEnv("REFRESH_RATE_WINDOW", 1*time.Minute),
+			IdleTimeout:           getDurationEnv("IDLE_TIMEOUT", 0),
+			AdminIPAllowlist:      getListEnv("ADMIN_IP_ALLOWLIST", ""),
+			AuditRedactFields:     getListEnv("AUDIT_REDACT_FIELDS", ""),
+			ReservedUsernames:     getListEnv("RESERVED_USERNAMES", "admin,administrator,root,system,api,support,monex,superuser,moderator,null,undefined"),
+			TrustedProxies:        getListEnv("TRUSTED_PROXIES", "127.0.0.0/8,::1/128"),
+			ActiveWindow:          getDurationEnv("SESSION_ACTIVE_WINDOW", 5*time.Minute),
+			RateLimitEntryTTL:     getDurationEnv("RATE_LIMIT_ENTRY_TTL", 1*time.Hour),
+			RateLimitMaxEntries:   getIntEnv("RATE_LIMIT_MAX_ENTRIES", 10000),
+			SessionPollTimeout:    getDurationEnv("SESSION_POLL_TIMEOUT", 30*time.Second),
+			SessionPollMaxWaiters: getIntEnv("SESSION_POLL_MAX_WAITERS", 5),
+			SessionMaxTracked:     getIntEnv("SESSION_INVALIDATION_MAX_TRACKED", 10000),
+			NotificationRecheck:   getDurationEnv("NOTIFICATION_RECHECK_INTERVAL", 30*time.Second),
+			MaxNoteLength:         getIntEnv("MAX_NOTE_LENGTH", 1000),
+			TransactionMaxFuture:  getDurationEnv("TRANSACTION_MAX_FUTURE", 24*time.Hour),
+			TransactionMaxPast:    getDurationEnv("TRANSACTION_MAX_PAST", 0),
+			DeviceIDCookie:        getBoolEnv("DEVICE_ID_COOKIE", true),
+			TransactionRules:      loadTransactionRules(),
+			TransactionUndoWindow: getDurationEnv("TRANSACTION_UNDO_WINDOW", 10*time.Minute),
+			FingerprintCheck:      getBoolEnv("FINGERPRINT_CHECK", false),
+			StrictFingerprint:     getBoolEnv("STRICT_FINGERPRINT", false),
+			FingerprintIPv4Prefix: getIntEnv("FINGERPRINT_IPV4_PREFIX", 16),
+			FingerprintIPv6Prefix: getIntEnv("FINGERPRINT_IPV6_PREFIX", 48),
+			PasswordPolicy: PasswordPolicyConfig{
+				MinLength:     getIntEnv("PASSWORD_MIN_LENGTH", 8),
+				RequireUpper:  getBoolEnv("PASSWORD_REQUIRE_UPPER", false),
+				RequireDigit:  getBoolEnv("PASSWORD_REQUIRE_DIGIT", false),
+				RequireSymbol: getBoolEnv("PASSWORD_REQUIRE_SYMBOL", false),
+				RejectCommon:  getBoolEnv("PASSWORD_REJECT_COMMON", false),
+				HistorySize:   getIntEnv("PASSWORD_HISTORY_SIZE", 5),
 			},
+			RequireEmailVerification: getBoolEnv("REQUIRE_EMAIL_VERIFICATION", false),
+			EmailVerificationTTL:     getDurationEnv("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+			EmailVerificationKey: getEmailVerificationKey(secretPath(dataDir, ".email-verification-key"),
+				serverMode == ServerModeProduction),
+
+			PasswordResetTTL:            getDurationEnv("PASSWORD_RESET_TTL", 1*time.Hour),
+			PasswordResetRevokeSessions: getBoolEnv("PASSWORD_RESET_REVOKE_SESSIONS", true),
+			ForgotPasswordLimit:         getIntEnv("FORGOT_PASSWORD_RATE_LIMIT", 5),
+			ForgotPasswordWindow:        getDurationEnv("FORGOT_PASSWORD_RATE_WINDOW", 1*time.Hour),
+			AllowedOrigins:              getListEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3040,http://localhost:3000"),
 		},
 
 		Login: LoginSecurityConfig{
@@ -98,8 +375,204 @@ func Load() *Config {
 			TempBanDuration:   time.Duration(getIntEnv("TEMP_BAN_DURATION", 15)) * time.Minute,
 			MaxTempBans:       getIntEnv("MAX_TEMP_BANS", 3),
 			AutoUnlockEnabled: getBoolEnv("AUTO_UNLOCK_ENABLED", true),
+
+			ChallengeEnabled:    getBoolEnv("LOGIN_CHALLENGE_ENABLED", false),
+			ChallengeThreshold:  getIntEnv("LOGIN_CHALLENGE_THRESHOLD", 3),
+			ChallengeDifficulty: getIntEnv("LOGIN_CHALLENGE_DIFFICULTY", 16),
+			ChallengeTTL:        getDurationEnv("LOGIN_CHALLENGE_TTL", 5*time.Minute),
+
+			NotifyLockout: getBoolEnv("LOGIN_LOCKOUT_NOTIFY", true),
+
+			HideUserEnumeration: getBoolEnv("HIDE_USER_ENUMERATION", false),
+
+			SessionBurstThreshold: getIntEnv("SESSION_BURST_THRESHOLD", 10),
+			SessionBurstWindow:    getDurationEnv("SESSION_BURST_WINDOW", 10*time.Minute),
+			SessionBurstLock:      getBoolEnv("SESSION_BURST_LOCK", false),
+		},
+
+		Notify: NotificationConfig{
+			WebhookURL:     getEnv("SECURITY_WEBHOOK_URL", ""),
+			WebhookTimeout: getDurationEnv("SECURITY_WEBHOOK_TIMEOUT", 5*time.Second),
+			WebhookRetries: getIntEnv("SECURITY_WEBHOOK_RETRIES", 2),
+		},
+
+		Cleanup: CleanupConfig{
+			SessionInterval:      getDurationEnv("SESSION_CLEANUP_INTERVAL", 1*time.Hour),
+			BlacklistInterval:    getDurationEnv("BLACKLIST_CLEANUP_INTERVAL", 10*time.Minute),
+			InvalidationInterval: getDurationEnv("INVALIDATION_CLEANUP_INTERVAL", 1*time.Hour),
+			AutoUnlockInterval:   getDurationEnv("AUTO_UNLOCK_INTERVAL", 1*time.Minute),
+
+			AuditRetentionDays:         getIntEnv("AUDIT_RETENTION_DAYS", 0),
+			AuditCriticalRetentionDays: getIntEnv("AUDIT_CRITICAL_RETENTION_DAYS", 0),
+		},
+
+		Backup: BackupConfig{
+			AutoInterval: getDurationEnv("AUTO_BACKUP_INTERVAL", 0),
+			Dir:          ResolveDataPath(dataDir, getEnv("BACKUP_DIR", "./backups")),
+			Keep:         getIntEnv("BACKUP_KEEP", 7),
+		},
+
+		TLS: TLSConfig{
+			Mode:            strings.ToLower(getEnv("TLS_MODE", TLSModeDisabled)),
+			CertFile:        ResolveDataPath(dataDir, getEnv("TLS_CERT_FILE", "./certs/server.crt")),
+			KeyFile:         ResolveDataPath(dataDir, getEnv("TLS_KEY_FILE", "./certs/server.key")),
+			SelfSignedHosts: getListEnv("TLS_SELF_SIGNED_HOSTS", "localhost,127.0.0.1,::1"),
+			ACMEDomains:     getListEnv("ACME_DOMAINS", ""),
+			ACMEEmail:       getEnv("ACME_EMAIL", ""),
+			ACMECacheDir:    ResolveDataPath(dataDir, getEnv("ACME_CACHE_DIR", "./acme-cache")),
+			ACMEHTTPAddr:    getEnv("ACME_HTTP_ADDR", ":80"),
+		},
+
+		Format: FormatConfig{
+			BaseCurrency:       strings.ToUpper(getEnv("BASE_CURRENCY", "IRT")),
+			Locale:             getEnv("LOCALE", "fa-IR"),
+			DecimalPlaces:      getIntEnv("CURRENCY_DECIMAL_PLACES", 0),
+			ThousandsSeparator: getEnv("THOUSANDS_SEPARATOR", ","),
 		},
 	}
+
+	if err := cfg.Server.normalize(); err != nil {
+		log.Fatalf("🛑 CRITICAL: %v", err)
+	}
+
+	// compress/gzip accepts -2 (Huffman only) through 9
+	if cfg.Server.GzipLevel < -2 || cfg.Server.GzipLevel > 9 {
+		log.Printf("⚠️ WARNING: GZIP_LEVEL=%d is outside the valid range -2 to 9, using -1", cfg.Server.GzipLevel)
+		cfg.Server.GzipLevel = -1
+	}
+	if cfg.Server.GzipMinLength < 0 {
+		cfg.Server.GzipMinLength = 0
+	}
+
+	if cfg.Database.SlowQueryMS < 0 {
+		log.Printf("⚠️ WARNING: SLOW_QUERY_MS=%d is negative, disabling slow-query logging", cfg.Database.SlowQueryMS)
+		cfg.Database.SlowQueryMS = 0
+	}
+
+	switch cfg.TLS.Mode {
+	case TLSModeAuto, TLSModeProvided, TLSModeDisabled, TLSModeACME:
+	default:
+		log.Printf("⚠️ WARNING: TLS_MODE=%q is not one of auto, provided, acme, disabled; using disabled", cfg.TLS.Mode)
+		cfg.TLS.Mode = TLSModeDisabled
+	}
+
+	// A headless server sits behind a TLS-terminating proxy; never generate a
+	// self-signed certificate for it
+	if cfg.Server.Headless && cfg.TLS.Mode == TLSModeAuto {
+		log.Printf("⚠️ WARNING: TLS_MODE=auto generates self-signed certificates, which HEADLESS=true doesn't use; using disabled")
+		cfg.TLS.Mode = TLSModeDisabled
+	}
+
+	if cfg.Format.DecimalPlaces < 0 || cfg.Format.DecimalPlaces > 4 {
+		log.Printf("⚠️ WARNING: CURRENCY_DECIMAL_PLACES=%d is outside the valid range 0-4, using 0", cfg.Format.DecimalPlaces)
+		cfg.Format.DecimalPlaces = 0
+	}
+
+	// bcrypt only accepts costs between 4 and 31
+	if cfg.Security.BcryptCost < 4 || cfg.Security.BcryptCost > 31 {
+		log.Printf("⚠️ WARNING: BCRYPT_COST=%d is outside the valid range 4-31, using 12", cfg.Security.BcryptCost)
+		cfg.Security.BcryptCost = 12
+	}
+
+	// Each extra bit doubles the client's work; beyond ~24 bits logins take too long in a browser
+	if cfg.Login.ChallengeDifficulty < 1 || cfg.Login.ChallengeDifficulty > 24 {
+		log.Printf("⚠️ WARNING: LOGIN_CHALLENGE_DIFFICULTY=%d is outside the valid range 1-24, using 16", cfg.Login.ChallengeDifficulty)
+		cfg.Login.ChallengeDifficulty = 16
+	}
+
+	// bcrypt ignores bytes beyond 72, so longer minimums can't be enforced meaningfully
+	if cfg.Security.PasswordPolicy.MinLength < 1 || cfg.Security.PasswordPolicy.MinLength > 72 {
+		log.Printf("⚠️ WARNING: PASSWORD_MIN_LENGTH=%d is outside the valid range 1-72, using 8", cfg.Security.PasswordPolicy.MinLength)
+		cfg.Security.PasswordPolicy.MinLength = 8
+	}
+	if cfg.Security.PasswordPolicy.HistorySize < 0 {
+		cfg.Security.PasswordPolicy.HistorySize = 0
+	}
+
+	if cfg.Security.MaxNoteLength < 1 {
+		log.Printf("⚠️ WARNING: MAX_NOTE_LENGTH must be positive, using 1000")
+		cfg.Security.MaxNoteLength = 1000
+	}
+
+	// An explicit "none" allows every username
+	if len(cfg.Security.ReservedUsernames) == 1 && strings.EqualFold(cfg.Security.ReservedUsernames[0], "none") {
+		cfg.Security.ReservedUsernames = nil
+	}
+
+	if cfg.JWT.PreviousSecret != "" && len(cfg.JWT.PreviousSecret) < 32 {
+		log.Printf("⚠️ WARNING: JWT_SECRET_PREVIOUS is shorter than 32 characters, ignoring it")
+		cfg.JWT.PreviousSecret = ""
+	}
+	if cfg.JWT.PreviousSecret == cfg.JWT.Secret {
+		cfg.JWT.PreviousSecret = ""
+	}
+
+	if cfg.JWT.RememberMeDuration <= 0 {
+		log.Printf("⚠️ WARNING: JWT_REMEMBER_ME_DURATION must be positive, using JWT_REFRESH_DURATION")
+		cfg.JWT.RememberMeDuration = cfg.JWT.RefreshDuration
+	}
+	if cfg.JWT.NoRememberMeDuration <= 0 {
+		log.Printf("⚠️ WARNING: JWT_NO_REMEMBER_ME_DURATION must be positive, using JWT_REFRESH_DURATION")
+		cfg.JWT.NoRememberMeDuration = cfg.JWT.RefreshDuration
+	}
+
+	if cfg.Login.SessionBurstThreshold < 0 {
+		log.Printf("⚠️ WARNING: SESSION_BURST_THRESHOLD must not be negative, disabling the check")
+		cfg.Login.SessionBurstThreshold = 0
+	}
+	if cfg.Login.SessionBurstWindow <= 0 {
+		log.Printf("⚠️ WARNING: SESSION_BURST_WINDOW must be positive, using 10m")
+		cfg.Login.SessionBurstWindow = 10 * time.Minute
+	}
+
+	if cfg.Security.StrictFingerprint {
+		cfg.Security.FingerprintCheck = true
+	}
+	if cfg.Security.FingerprintIPv4Prefix < 0 || cfg.Security.FingerprintIPv4Prefix > 32 {
+		log.Printf("⚠️ WARNING: FINGERPRINT_IPV4_PREFIX=%d must be between 0 and 32, using 16", cfg.Security.FingerprintIPv4Prefix)
+		cfg.Security.FingerprintIPv4Prefix = 16
+	}
+	if cfg.Security.FingerprintIPv6Prefix < 0 || cfg.Security.FingerprintIPv6Prefix > 128 {
+		log.Printf("⚠️ WARNING: FINGERPRINT_IPV6_PREFIX=%d must be between 0 and 128, using 48", cfg.Security.FingerprintIPv6Prefix)
+		cfg.Security.FingerprintIPv6Prefix = 48
+	}
+
+	if cfg.Security.TransactionUndoWindow <= 0 {
+		log.Printf("⚠️ WARNING: TRANSACTION_UNDO_WINDOW must be positive, using 10m")
+		cfg.Security.TransactionUndoWindow = 10 * time.Minute
+	}
+
+	if cfg.Security.TransactionMaxFuture < 0 {
+		cfg.Security.TransactionMaxFuture = 0
+	}
+	if cfg.Security.TransactionMaxPast < 0 {
+		cfg.Security.TransactionMaxPast = 0
+	}
+
+	if cfg.Security.NotificationRecheck <= 0 {
+		log.Printf("⚠️ WARNING: NOTIFICATION_RECHECK_INTERVAL must be positive, using 30s")
+		cfg.Security.NotificationRecheck = 30 * time.Second
+	}
+
+	return cfg
+}
+
+// EnsureDataDir creates dataDir with owner-only permissions; an empty
+// dataDir is a no-op
+func EnsureDataDir(dataDir string) error {
+	if dataDir == "" {
+		return nil
+	}
+	return os.MkdirAll(dataDir, 0700)
+}
+
+// ResolveDataPath places a relative path under dataDir. Absolute paths, and
+// every path when dataDir is empty, are returned unchanged.
+func ResolveDataPath(dataDir, path string) string {
+	if dataDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dataDir, path)
 }
 
 func getEnv(key, defaultValue string) string {
@@ -133,25 +606,131 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
-func getJWTSecret() string {
+// getListEnv splits a comma-separated value, dropping empty entries
+func getListEnv(key, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getJWTSecret returns JWT_SECRET. Without it, development falls back to a
+// secret persisted in secretFile while production refuses to start.
+func getJWTSecret(secretFile string, production bool) (string, error) {
 	secret := os.Getenv("JWT_SECRET")
 
 	if secret == "" {
-		log.Println("⚠️ WARNING: JWT_SECRET not set, generating temporary secret")
-		secret = generateSecureSecret()
-		log.Printf("Generated JWT_SECRET=%s\n", secret)
+		if production {
+			return "", errJWTSecretRequired
+		}
+		secret = loadDevJWTSecret(secretFile)
 	}
 
 	if len(secret) < 32 {
-		log.Fatalf("🛑 CRITICAL: JWT_SECRET must be at least 32 characters")
+		return "", errors.New("JWT_SECRET must be at least 32 characters")
+	}
+	return secret, nil
+}
+
+var errJWTSecretRequired = errors.New("JWT_SECRET must be set when SERVER_MODE=production")
+
+// loadDevJWTSecret returns the secret saved in path, generating and saving
+// one on first use so restarts don't log everyone out. When it can't be
+// saved, the secret only lasts until the next restart.
+func loadDevJWTSecret(path string) string {
+	secret, created, err := loadSecretFile(path)
+	switch {
+	case err != nil:
+		log.Printf("⚠️ WARNING: JWT_SECRET not set and the development secret could not be saved (%v), using a temporary secret", err)
+	case created:
+		log.Printf("⚠️ WARNING: JWT_SECRET not set, generated a development secret in %s (0600 permissions). Set JWT_SECRET in production", path)
+	default:
+		log.Printf("⚠️ WARNING: JWT_SECRET not set, using the development secret in %s. Set JWT_SECRET in production", path)
 	}
 	return secret
 }
 
+// secretPath returns where the generated secret name is kept: in dataDir,
+// or in Monex under the user's config directory (e.g. ~/.config/Monex) when
+// DATA_DIR is unset. Never the working directory, which is often a source
+// checkout the secret would get committed from. It is empty when there is
+// no such directory.
+func secretPath(dataDir, name string) string {
+	if dataDir != "" {
+		return filepath.Join(dataDir, name)
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		log.Printf("⚠️ WARNING: No user config directory for %s (%v), set DATA_DIR to keep it", name, err)
+		return ""
+	}
+	dir = filepath.Join(dir, "Monex")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("⚠️ WARNING: Failed to create %s for %s: %v", dir, name, err)
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// getEmailVerificationKey returns EMAIL_VERIFICATION_KEY, or a key generated
+// once and kept in keyFile. It is separate from JWT_SECRET so that RS256
+// setups (no secret) can't have tokens forged with an empty key, and so a
+// JWT rotation doesn't break the links already emailed. Production refuses to
+// start when the key can't be persisted, since every restart would then
+// invalidate outstanding links.
+func getEmailVerificationKey(keyFile string, production bool) string {
+	if key := os.Getenv("EMAIL_VERIFICATION_KEY"); key != "" {
+		if len(key) < 32 {
+			log.Fatalf("🛑 CRITICAL: EMAIL_VERIFICATION_KEY must be at least 32 characters")
+		}
+		return key
+	}
+
+	key, created, err := loadSecretFile(keyFile)
+	if err != nil {
+		if production {
+			log.Fatalf("🛑 CRITICAL: EMAIL_VERIFICATION_KEY is not set and the generated key could not be saved: %v", err)
+		}
+		log.Printf("⚠️ WARNING: EMAIL_VERIFICATION_KEY not set and the generated key could not be saved (%v), verification links stop working on restart", err)
+	} else if created {
+		log.Printf("✅ Generated an email verification key in %s (0600 permissions)", keyFile)
+	}
+	if key == "" {
+		log.Fatalf("🛑 CRITICAL: No email verification key available")
+	}
+	return key
+}
+
+// loadSecretFile returns the secret saved in path, generating one on first
+// use. created reports a new secret; err is set when it couldn't be saved, in
+// which case the returned secret only lasts until the next restart.
+func loadSecretFile(path string) (secret string, created bool, err error) {
+	if path == "" {
+		return generateSecureSecret(), true, errors.New("no DATA_DIR or user config directory to save it in")
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if secret := strings.TrimSpace(string(data)); len(secret) >= 32 {
+			return secret, false, nil
+		}
+		log.Printf("⚠️ WARNING: %s does not hold a usable secret, generating a new one", path)
+	} else if !os.IsNotExist(err) {
+		log.Printf("⚠️ WARNING: Failed to read %s: %v", path, err)
+	}
+
+	secret = generateSecureSecret()
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0600); err != nil {
+		return secret, true, fmt.Errorf("%s: %w", path, err)
+	}
+	return secret, true, nil
+}
+
 func generateSecureSecret() string {
 	b := make([]byte, 64)
 	if _, err := rand.Read(b); err != nil {
-		log.Fatalf("Failed to generate JWT secret: %v", err)
+		log.Fatalf("Failed to generate secret: %v", err)
 	}
 	return base64.StdEncoding.EncodeToString(b)
 }
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDevJWTSecretStableAcrossLoads(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("DATA_DIR", dataDir)
+	t.Setenv("JWT_SECRET", "")
+
+	first, second := Load(), Load()
+	if first.JWT.Secret != second.JWT.Secret {
+		t.Fatal("development JWT secret changed between loads")
+	}
+	if len(first.JWT.Secret) < 32 {
+		t.Fatalf("development JWT secret is %d characters", len(first.JWT.Secret))
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, ".jwt-secret")); err != nil {
+		t.Fatalf("secret not kept in DATA_DIR: %v", err)
+	}
+}
+
+func TestSecretsNeverInWorkingDirectory(t *testing.T) {
+	configHome, workDir := t.TempDir(), t.TempDir()
+	t.Setenv("DATA_DIR", "")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("EMAIL_VERIFICATION_KEY", "")
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("HOME", configHome)
+	t.Chdir(workDir)
+
+	Load()
+
+	for _, name := range []string{".jwt-secret", ".email-verification-key"} {
+		if _, err := os.Stat(filepath.Join(workDir, name)); err == nil {
+			t.Errorf("%s written to the working directory", name)
+		}
+	}
+	userDir, err := os.UserConfigDir()
+	if err != nil {
+		t.Fatalf("UserConfigDir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(userDir, "Monex", ".jwt-secret")); err != nil {
+		t.Fatalf("secret not kept in the user config directory: %v", err)
+	}
+}
+
+func TestProductionRequiresJWTSecret(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	secretFile := filepath.Join(t.TempDir(), ".jwt-secret")
+
+	if _, err := getJWTSecret(secretFile, true); !errors.Is(err, errJWTSecretRequired) {
+		t.Fatalf("getJWTSecret in production = %v, want errJWTSecretRequired", err)
+	}
+	if _, err := os.Stat(secretFile); err == nil {
+		t.Fatal("production generated a development secret")
+	}
+
+	t.Setenv("JWT_SECRET", "too-short")
+	if _, err := getJWTSecret(secretFile, true); err == nil {
+		t.Fatal("short JWT_SECRET accepted")
+	}
+}
+
+func TestHeadlessDisablesAutoTLS(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("JWT_SECRET", "test-secret-0123456789abcdef0123456789abcdef")
+	t.Setenv("HEADLESS", "true")
+	t.Setenv("TLS_MODE", "auto")
+
+	cfg := Load()
+	if !cfg.Server.Headless {
+		t.Fatal("HEADLESS=true not loaded")
+	}
+	if cfg.TLS.Mode != TLSModeDisabled || cfg.TLS.Enabled() {
+		t.Fatalf("TLS mode = %q, want %q", cfg.TLS.Mode, TLSModeDisabled)
+	}
+
+	t.Setenv("HEADLESS", "false")
+	if cfg := Load(); cfg.TLS.Mode != TLSModeAuto {
+		t.Fatalf("TLS mode without HEADLESS = %q, want %q", cfg.TLS.Mode, TLSModeAuto)
+	}
+}
+
+func TestDataDirRootsFilePaths(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "monex-data")
+	t.Setenv("DATA_DIR", dataDir)
+	t.Setenv("DB_PATH", "")
+	t.Setenv("BACKUP_DIR", "")
+
+	cfg := Load()
+	info, err := os.Stat(dataDir)
+	if err != nil {
+		t.Fatalf("DATA_DIR not created: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("DATA_DIR permissions = %o, want 700", perm)
+	}
+	for name, path := range map[string]string{
+		"database":            cfg.Database.Path,
+		"backups":             cfg.Backup.Dir,
+		"admin password file": cfg.Database.AdminPasswordFile,
+	} {
+		if filepath.Dir(path) != dataDir {
+			t.Errorf("%s at %s, want it directly under %s", name, path, dataDir)
+		}
+	}
+
+	// Absolute paths are kept as configured
+	dbPath := filepath.Join(t.TempDir(), "elsewhere.db")
+	t.Setenv("DB_PATH", dbPath)
+	if got := Load().Database.Path; got != dbPath {
+		t.Errorf("absolute DB_PATH resolved to %s, want %s", got, dbPath)
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfigFile reads a YAML or JSON file of the same KEY: value pairs as
+// the environment and exports each value that isn't already set, so real
+// environment variables (and .env) always win over the file. Lists are
+// joined with commas, matching the comma-separated list variables.
+func loadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// YAML is a superset of JSON, so one parser handles both formats
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("invalid config file: %w", err)
+	}
+
+	for key, raw := range values {
+		value, err := configFileValue(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		key = strings.ToUpper(strings.TrimSpace(key))
+		if os.Getenv(key) != "" {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// configFileValue converts a parsed scalar or list to its env var form
+func configFileValue(raw interface{}) (string, error) {
+	switch v := raw.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			value, err := configFileValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, value)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		return "", fmt.Errorf("nested sections are not supported, use flat KEY: value pairs")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigFileUnderEnv(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("JWT_SECRET", "test-secret-0123456789abcdef0123456789abcdef")
+	// Registered so the values the file exports are undone after the test
+	for _, key := range []string{"PORT", "RATE_LIMIT_WINDOW", "ADMIN_IP_ALLOWLIST", "CSP_ENABLED"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("RATE_LIMIT", "9")
+
+	path := filepath.Join(t.TempDir(), "monex.yaml")
+	yaml := `
+port: 4050
+RATE_LIMIT: 7
+RATE_LIMIT_WINDOW: 2m
+ADMIN_IP_ALLOWLIST:
+  - 10.0.0.0/8
+  - 192.168.1.0/24
+`
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg := Load()
+	if cfg.Server.Port != "4050" {
+		t.Errorf("PORT = %q, want 4050 from the file", cfg.Server.Port)
+	}
+	if cfg.Security.RateLimitWindow != 2*time.Minute {
+		t.Errorf("RATE_LIMIT_WINDOW = %v, want 2m from the file", cfg.Security.RateLimitWindow)
+	}
+	if got := cfg.Security.AdminIPAllowlist; len(got) != 2 || got[0] != "10.0.0.0/8" || got[1] != "192.168.1.0/24" {
+		t.Errorf("ADMIN_IP_ALLOWLIST = %v, want both CIDRs from the file", got)
+	}
+	if cfg.Security.RateLimit != 9 {
+		t.Errorf("RATE_LIMIT = %d, want 9 from the environment over the file's 7", cfg.Security.RateLimit)
+	}
+
+	// JSON parses the same way; nested sections are refused
+	jsonPath := filepath.Join(t.TempDir(), "monex.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"PORT": 4060, "CSP_ENABLED": false}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PORT", "")
+	if err := loadConfigFile(jsonPath); err != nil {
+		t.Fatalf("loadConfigFile(json): %v", err)
+	}
+	if os.Getenv("PORT") != "4060" || os.Getenv("CSP_ENABLED") != "false" {
+		t.Errorf("json values PORT=%q CSP_ENABLED=%q, want 4060 and false", os.Getenv("PORT"), os.Getenv("CSP_ENABLED"))
+	}
+	nested := filepath.Join(t.TempDir(), "nested.yaml")
+	if err := os.WriteFile(nested, []byte("server:\n  port: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfigFile(nested); err == nil {
+		t.Error("nested section accepted")
+	}
+}
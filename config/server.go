@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Addr is the host:port the HTTP(S) server listens on
+func (s *ServerConfig) Addr() string {
+	return net.JoinHostPort(s.Host, s.Port)
+}
+
+// LocalAddr is the server's port on localhost, used to open the browser and
+// to reach an already running instance
+func (s *ServerConfig) LocalAddr() string {
+	return net.JoinHostPort("localhost", s.Port)
+}
+
+// normalize validates HOST and PORT and rewrites them in canonical form, so
+// a bad value fails at startup instead of deep inside the listener
+func (s *ServerConfig) normalize() error {
+	if err := s.normalizeFrontendDevURL(); err != nil {
+		return err
+	}
+
+	port, err := strconv.Atoi(strings.TrimSpace(s.Port))
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("PORT=%q must be a number between 1 and 65535", s.Port)
+	}
+	s.Port = strconv.Itoa(port)
+
+	host := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s.Host), "["), "]")
+	if ip := net.ParseIP(host); ip != nil {
+		s.Host = ip.String()
+		return nil
+	}
+	if !isValidHostname(host) {
+		return fmt.Errorf("HOST=%q must be a hostname or an IP address", s.Host)
+	}
+	s.Host = strings.ToLower(host)
+	return nil
+}
+
+// normalizeFrontendDevURL requires FRONTEND_DEV_URL, when set, to be an
+// absolute http(s) URL
+func (s *ServerConfig) normalizeFrontendDevURL() error {
+	s.FrontendDevURL = strings.TrimSpace(s.FrontendDevURL)
+	if s.FrontendDevURL == "" {
+		return nil
+	}
+	u, err := url.Parse(s.FrontendDevURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("FRONTEND_DEV_URL=%q must be an http(s) URL such as http://localhost:3000", s.FrontendDevURL)
+	}
+	s.FrontendDevURL = strings.TrimSuffix(u.String(), "/")
+	return nil
+}
+
+// isValidHostname checks RFC 1123 hostname syntax: dot-separated labels of
+// letters, digits and inner hyphens, each at most 63 characters
+func isValidHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
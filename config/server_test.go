@@ -0,0 +1,47 @@
+package config
+
+import "testing"
+
+func TestServerNormalize(t *testing.T) {
+	valid := []struct {
+		host, port         string
+		wantHost, wantAddr string
+	}{
+		{"localhost", "3040", "localhost", "localhost:3040"},
+		{" Monex.Example.COM ", " 08080 ", "monex.example.com", "monex.example.com:8080"},
+		{"0.0.0.0", "1", "0.0.0.0", "0.0.0.0:1"},
+		{"[::1]", "65535", "::1", "[::1]:65535"},
+		{"2001:DB8::1", "443", "2001:db8::1", "[2001:db8::1]:443"},
+	}
+	for _, tt := range valid {
+		s := &ServerConfig{Host: tt.host, Port: tt.port}
+		if err := s.normalize(); err != nil {
+			t.Errorf("HOST=%q PORT=%q: %v", tt.host, tt.port, err)
+			continue
+		}
+		if s.Host != tt.wantHost || s.Addr() != tt.wantAddr {
+			t.Errorf("HOST=%q PORT=%q: host %q, addr %q; want %q, %q", tt.host, tt.port, s.Host, s.Addr(), tt.wantHost, tt.wantAddr)
+		}
+	}
+
+	invalid := []struct{ host, port string }{
+		{"localhost", ""},
+		{"localhost", "0"},
+		{"localhost", "65536"},
+		{"localhost", "-1"},
+		{"localhost", "http"},
+		{"", "3040"},
+		{"bad host", "3040"},
+		{"-leading.example.com", "3040"},
+		{"trailing-.example.com", "3040"},
+		{"a..b", "3040"},
+		{"localhost:3040", "3040"},
+		{"http://localhost", "3040"},
+	}
+	for _, tt := range invalid {
+		s := &ServerConfig{Host: tt.host, Port: tt.port}
+		if err := s.normalize(); err == nil {
+			t.Errorf("HOST=%q PORT=%q accepted as %s", tt.host, tt.port, s.Addr())
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+// transactionTypes are the types the rules can name
+var transactionTypes = map[string]bool{"deposit": true, "withdraw": true, "expense": true}
+
+// TransactionRulesConfig holds per-type bookkeeping rules enforced when a
+// transaction is created or updated
+type TransactionRulesConfig struct {
+	RequireNoteFor map[string]bool // types that must carry a note
+	MaxAmount      map[string]int  // largest amount per type; absent types are unlimited
+}
+
+// loadTransactionRules reads TRANSACTION_REQUIRE_NOTE_FOR (a list of types)
+// and TRANSACTION_MAX_AMOUNT (type:amount pairs), skipping invalid entries
+// with a warning
+func loadTransactionRules() TransactionRulesConfig {
+	rules := TransactionRulesConfig{
+		RequireNoteFor: make(map[string]bool),
+		MaxAmount:      make(map[string]int),
+	}
+
+	for _, txType := range getListEnv("TRANSACTION_REQUIRE_NOTE_FOR", "") {
+		txType = strings.ToLower(txType)
+		if !transactionTypes[txType] {
+			log.Printf("⚠️ WARNING: TRANSACTION_REQUIRE_NOTE_FOR: unknown transaction type %q, ignoring", txType)
+			continue
+		}
+		rules.RequireNoteFor[txType] = true
+	}
+
+	for _, entry := range getListEnv("TRANSACTION_MAX_AMOUNT", "") {
+		txType, value, _ := strings.Cut(entry, ":")
+		txType = strings.ToLower(strings.TrimSpace(txType))
+		if !transactionTypes[txType] {
+			log.Printf("⚠️ WARNING: TRANSACTION_MAX_AMOUNT: unknown transaction type in %q, ignoring", entry)
+			continue
+		}
+		amount, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || amount < 1 {
+			log.Printf("⚠️ WARNING: TRANSACTION_MAX_AMOUNT: %q needs a positive amount (type:amount), ignoring", entry)
+			continue
+		}
+		rules.MaxAmount[txType] = amount
+	}
+
+	return rules
+}
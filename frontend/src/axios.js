@@ -10,6 +10,16 @@ export const setAxiosLoggingOut = (state) => {
   console.log("[Axios] Logging out state:", state);
 };
 
+// ✅ Every token refresh is announced so open notification streams can be
+// handed the new token (see useSSENotifications)
+export const TOKEN_REFRESHED_EVENT = "monex:token-refreshed";
+
+export const announceTokenRefresh = (accessToken) => {
+  window.dispatchEvent(
+    new CustomEvent(TOKEN_REFRESHED_EVENT, { detail: accessToken })
+  );
+};
+
 axios.interceptors.response.use(
   (response) => response,
   async (error) => {
@@ -66,6 +76,7 @@ axios.interceptors.response.use(
           "Authorization"
         ] = `Bearer ${access_token}`;
         originalRequest.headers["Authorization"] = `Bearer ${access_token}`;
+        announceTokenRefresh(access_token);
 
         return axios(originalRequest);
       } catch (refreshError) {
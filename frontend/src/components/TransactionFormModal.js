@@ -145,6 +145,8 @@ const TransactionFormModal = ({ visible, onClose, record, onSuccess }) => {
       setLoading(true);
 
       if (record) {
+        // Send the version we edited so concurrent edits are detected (409)
+        payload.updated_at = record.updated_at;
         await updateTransaction(record.id, payload);
         message.success("تراکنش با موفقیت ویرایش شد");
       } else {
@@ -156,6 +158,11 @@ const TransactionFormModal = ({ visible, onClose, record, onSuccess }) => {
       onSuccess?.();
     } catch (err) {
       if (err?.errorFields) return;
+      if (err?.response?.status === 409) {
+        message.warning(err.response.data?.message);
+        onSuccess?.(); // Reload so the latest version is shown
+        return;
+      }
       message.error(err?.response?.data?.message || "خطا در ذخیره تراکنش");
     } finally {
       setLoading(false);
@@ -339,6 +346,7 @@ const TransactionFormModal = ({ visible, onClose, record, onSuccess }) => {
           >
             <Input.TextArea
               rows={3}
+              maxLength={1000} // matches the server's default MAX_NOTE_LENGTH
               style={{
                 borderRadius: 10,
                 padding: "8px 12px",
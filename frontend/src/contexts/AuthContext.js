@@ -8,7 +8,8 @@ import React, {
 } from "react";
 import axios from "axios";
 import { message, ConfigProvider } from "antd";
-import { setAxiosLoggingOut } from "../axios";
+import { setAxiosLoggingOut, announceTokenRefresh } from "../axios";
+import { solveChallenge } from "../utils/solveChallenge";
 
 const AuthContext = createContext(null);
 
@@ -114,6 +115,7 @@ export const AuthProvider = ({ children }) => {
       axios.defaults.headers.common["Authorization"] = `Bearer ${access_token}`;
 
       setToken(access_token);
+      announceTokenRefresh(access_token);
 
       scheduleTokenRefresh(access_token);
 
@@ -241,6 +243,7 @@ export const AuthProvider = ({ children }) => {
               "Authorization"
             ] = `Bearer ${access_token}`;
             originalRequest.headers["Authorization"] = `Bearer ${access_token}`;
+            announceTokenRefresh(access_token);
 
             return axios(originalRequest);
           } catch (refreshError) {
@@ -277,11 +280,31 @@ export const AuthProvider = ({ children }) => {
 
       console.log("[Auth] Login with device_id:", deviceID);
 
-      // ✅ Send device_id as query parameter
-      const res = await axios.post(`/api/auth/login?device_id=${deviceID}`, {
-        username,
-        password,
-      });
+      // ✅ Send device_id as a header; the server also sets it as an httpOnly cookie
+      const credentials = { username, password };
+      const loginConfig = { headers: { "X-Device-ID": deviceID } };
+      let res;
+      try {
+        res = await axios.post("/api/auth/login", credentials, loginConfig);
+      } catch (error) {
+        // ✅ After repeated failures the server requires a proof-of-work
+        const challenge = error.response?.data?.challenge;
+        if (error.response?.status !== 428 || !challenge) throw error;
+
+        message.loading({ content: "در حال بررسی امنیتی...", key: "challenge" });
+        const solution = await solveChallenge(challenge);
+        message.destroy("challenge");
+
+        res = await axios.post(
+          "/api/auth/login",
+          {
+            ...credentials,
+            challenge_token: challenge.token,
+            challenge_solution: solution,
+          },
+          loginConfig
+        );
+      }
 
       // ✅ Verify response contains session_id
       if (!res.data.session_id || !res.data.device_id) {
@@ -504,6 +527,7 @@ export const AuthProvider = ({ children }) => {
     sessionInitialized: sessionInitializedRef.current,
     setUser,
     setToken,
+    refreshToken: performTokenRefresh,
     // ✅ NEW: Expose logout flag for components to check
     isLoggingOut: () => isLoggingOutRef.current,
   };
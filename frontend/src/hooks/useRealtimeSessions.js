@@ -22,7 +22,7 @@ export const useRealtimeSessions = (userID) => {
     try {
       const deviceID = localStorage.getItem("device_id");
       const res = await axios.get("/api/sessions", {
-        params: { device_id: deviceID },
+        headers: deviceID ? { "X-Device-ID": deviceID } : {},
       });
 
       if (isMountedRef.current) {
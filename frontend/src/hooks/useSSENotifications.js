@@ -2,16 +2,18 @@
 import { useEffect, useRef, useCallback } from "react";
 import { message, notification } from "antd";
 import { useAuth } from "../contexts/AuthContext";
+import axios, { TOKEN_REFRESHED_EVENT } from "../axios";
 
 /**
  * Hook for Server-Sent Events (SSE) notifications
  * Replaces polling with event-driven architecture
  */
 export const useSSENotifications = () => {
-  const { user, logout, isLoggingOut } = useAuth();
+  const { user, logout, isLoggingOut, refreshToken } = useAuth();
   const eventSourceRef = useRef(null);
   const reconnectTimeoutRef = useRef(null);
   const reconnectAttemptsRef = useRef(0);
+  const streamIdRef = useRef(null); // from the "connected" event, for reauth
   const maxReconnectAttempts = 5;
 
   const connect = useCallback(() => {
@@ -57,6 +59,7 @@ export const useSSENotifications = () => {
         console.error("[SSE] Connection error:", error);
         eventSource.close();
         eventSourceRef.current = null;
+        streamIdRef.current = null;
 
         // Attempt reconnection with exponential backoff
         if (reconnectAttemptsRef.current < maxReconnectAttempts) {
@@ -92,6 +95,7 @@ export const useSSENotifications = () => {
     switch (type) {
       case "connected":
         console.log("[SSE] Connection confirmed");
+        streamIdRef.current = data?.stream_id || null;
         break;
 
       case "heartbeat":
@@ -110,6 +114,14 @@ export const useSSENotifications = () => {
         handleSessionInvalidated(msg);
         break;
 
+      case "token_expired":
+        handleTokenExpired();
+        break;
+
+      case "server_shutdown":
+        // EventSource reconnects on its own once the server is back
+        break;
+
       default:
         console.log("[SSE] Unknown notification type:", type);
     }
@@ -184,6 +196,20 @@ export const useSSENotifications = () => {
     }, 1500);
   };
 
+  // ✅ The stream's token expired but the login is still valid: refresh and
+  // reconnect with the new token instead of logging out
+  const handleTokenExpired = async () => {
+    if (eventSourceRef.current) {
+      eventSourceRef.current.close();
+      eventSourceRef.current = null;
+    }
+    streamIdRef.current = null;
+    if (await refreshToken()) {
+      reconnectAttemptsRef.current = 0;
+      connect();
+    }
+  };
+
   const disconnect = useCallback(() => {
     if (reconnectTimeoutRef.current) {
       clearTimeout(reconnectTimeoutRef.current);
@@ -195,8 +221,36 @@ export const useSSENotifications = () => {
       eventSourceRef.current.close();
       eventSourceRef.current = null;
     }
+    streamIdRef.current = null;
   }, []);
 
+  // ✅ Hand a refreshed token to the open stream, so it isn't closed when the
+  // token it connected with expires
+  useEffect(() => {
+    const reauth = async (event) => {
+      const streamId = streamIdRef.current;
+      if (!streamId || !eventSourceRef.current) {
+        return;
+      }
+      try {
+        await axios.post(
+          "/api/notifications/reauth",
+          { stream_id: streamId },
+          { headers: { Authorization: `Bearer ${event.detail}` } }
+        );
+        console.log("[SSE] Stream reauthenticated");
+      } catch (error) {
+        // The stream is gone (e.g. server restarted): open a new one
+        console.warn("[SSE] Reauth failed, reconnecting:", error);
+        disconnect();
+        connect();
+      }
+    };
+
+    window.addEventListener(TOKEN_REFRESHED_EVENT, reauth);
+    return () => window.removeEventListener(TOKEN_REFRESHED_EVENT, reauth);
+  }, [connect, disconnect]);
+
   // Auto-connect when user logs in
   useEffect(() => {
     if (user && !isLoggingOut()) {
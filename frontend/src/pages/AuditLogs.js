@@ -156,7 +156,8 @@ const AuditLogs = () => {
 
       const excelData = logs.map((log) => ({
         شناسه: log.id,
-        "شناسه کاربر": log.user_id || "Anonymous",
+        "شناسه کاربر": log.user_id ?? "سیستم",
+        "سطح اهمیت": log.severity,
         عملیات: log.action,
         منبع: log.resource,
         "IP Address": log.ip_address,
@@ -205,7 +206,24 @@ const AuditLogs = () => {
       align: "center",
       width: 100,
       sorter: true,
-      render: (id) => id || "Anonymous",
+      render: (id) => (id == null ? <Tag>سیستم</Tag> : id),
+    },
+    {
+      title: "سطح اهمیت",
+      dataIndex: "severity",
+      key: "severity",
+      align: "center",
+      width: 100,
+      sorter: true,
+      render: (severity) => {
+        const colorMap = {
+          info: "default",
+          warning: "orange",
+          error: "red",
+          critical: "magenta",
+        };
+        return <Tag color={colorMap[severity] || "default"}>{severity}</Tag>;
+      },
     },
     {
       title: "عملیات",
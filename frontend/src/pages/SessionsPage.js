@@ -144,7 +144,12 @@ const SessionsPage = () => {
         let statusColor = "#52c41a";
         let statusText = "فعال";
 
-        if (diffMinutes > 30) {
+        if (record.is_active_now !== undefined) {
+          if (!record.is_active_now) {
+            statusColor = diffMinutes > 30 ? "#ff4d4f" : "#faad14";
+            statusText = record.last_seen_human || "غیرفعال";
+          }
+        } else if (diffMinutes > 30) {
           statusColor = "#ff4d4f";
           statusText = "غیرفعال";
         } else if (diffMinutes > 10) {
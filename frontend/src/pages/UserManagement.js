@@ -35,6 +35,8 @@ import {
   ReloadOutlined,
   UserOutlined,
   MailOutlined,
+  StopOutlined,
+  CheckCircleOutlined,
 } from "@ant-design/icons";
 import axios from "axios";
 import moment from "moment";
@@ -82,6 +84,9 @@ const UserManagement = () => {
   });
   const [selectedUserId, setSelectedUserId] = useState(null);
 
+  const [deleteTarget, setDeleteTarget] = useState(null);
+  const [deletePassword, setDeletePassword] = useState("");
+
   const [lockedUsersCountdown, setLockedUsersCountdown] = useState({});
   const isMountedRef = useRef(true);
 
@@ -242,10 +247,13 @@ const UserManagement = () => {
     }
   };
 
-  const handleDeleteUser = async (id) => {
+  const handleToggleActive = async (record) => {
+    const action = record.active ? "deactivate" : "reactivate";
     try {
-      await axios.delete(`/api/admin/users/${id}`);
-      message.success("کاربر حذف شد");
+      await axios.post(`/api/admin/users/${record.id}/${action}`);
+      message.success(
+        record.active ? "حساب کاربر غیرفعال شد" : "حساب کاربر فعال شد"
+      );
       fetchUsers(
         pagination.current,
         pagination.pageSize,
@@ -254,7 +262,35 @@ const UserManagement = () => {
         searchText
       );
     } catch {
-      message.error("خطا در حذف کاربر");
+      message.error("خطا در تغییر وضعیت کاربر");
+    }
+  };
+
+  const openDeleteModal = (record) => {
+    setDeleteTarget(record);
+    setDeletePassword("");
+  };
+
+  const handleDeleteUser = async () => {
+    if (!deletePassword) {
+      message.error("کلمه عبور خود را وارد کنید");
+      return;
+    }
+    try {
+      await axios.delete(`/api/admin/users/${deleteTarget.id}`, {
+        data: { password: deletePassword },
+      });
+      message.success("کاربر حذف شد");
+      setDeleteTarget(null);
+      fetchUsers(
+        pagination.current,
+        pagination.pageSize,
+        sorter.field,
+        sorter.order,
+        searchText
+      );
+    } catch (err) {
+      message.error(err.response?.data?.message || "خطا در حذف کاربر");
     }
   };
 
@@ -463,20 +499,27 @@ const UserManagement = () => {
           )}
           <Popconfirm
             title={
-              <div>
-                <div style={{ fontWeight: "bold", marginBottom: 8 }}>
-                  حذف کاربر
-                </div>
-                <div>آیا از حذف کاربر اطمینان دارید؟</div>
-              </div>
+              record.active
+                ? "حساب کاربر غیرفعال شود؟ اطلاعات کاربر حفظ می‌شود"
+                : "حساب کاربر دوباره فعال شود؟"
             }
-            onConfirm={() => handleDeleteUser(record.id)}
-            okButtonProps={{ danger: true }}
+            onConfirm={() => handleToggleActive(record)}
           >
-            <Tooltip title="حذف" placement="bottom">
-              <Button danger shape="circle" icon={<DeleteOutlined />} />
+            <Tooltip title={record.active ? "غیرفعال کردن" : "فعال کردن"}>
+              <Button
+                shape="circle"
+                icon={record.active ? <StopOutlined /> : <CheckCircleOutlined />}
+              />
             </Tooltip>
           </Popconfirm>
+          <Tooltip title="حذف دائمی" placement="bottom">
+            <Button
+              danger
+              shape="circle"
+              icon={<DeleteOutlined />}
+              onClick={() => openDeleteModal(record)}
+            />
+          </Tooltip>
         </Space>
       ),
     },
@@ -870,6 +913,34 @@ const UserManagement = () => {
               </div>
             </Space>
           </Modal>
+
+          {/* Permanent Delete Modal */}
+          <Modal
+            title="حذف دائمی کاربر"
+            open={!!deleteTarget}
+            onCancel={() => setDeleteTarget(null)}
+            onOk={handleDeleteUser}
+            okText="حذف دائمی"
+            cancelText="انصراف"
+            okButtonProps={{ danger: true }}
+            width={450}
+          >
+            <Space direction="vertical" size={12} style={{ width: "100%" }}>
+              <div>
+                حذف کاربر <b>{deleteTarget?.username}</b> تمام تراکنش‌ها، نشست‌ها
+                و تنظیمات او را برای همیشه پاک می‌کند. برای حفظ اطلاعات، حساب را
+                غیرفعال کنید.
+              </div>
+              <Input.Password
+                prefix={<LockOutlined />}
+                placeholder="کلمه عبور خود را برای تایید وارد کنید"
+                value={deletePassword}
+                onChange={(e) => setDeletePassword(e.target.value)}
+                onPressEnter={handleDeleteUser}
+                size="large"
+              />
+            </Space>
+          </Modal>
         </div>
       </div>
     </ConfigProvider>
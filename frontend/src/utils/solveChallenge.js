@@ -0,0 +1,27 @@
+// Solves the server's proof-of-work login challenge: finds a solution such
+// that SHA-256(token + ":" + solution) starts with `difficulty` zero bits.
+
+const leadingZeroBits = (bytes) => {
+  let count = 0;
+  for (const byte of bytes) {
+    if (byte === 0) {
+      count += 8;
+      continue;
+    }
+    return count + Math.clz32(byte) - 24;
+  }
+  return count;
+};
+
+export const solveChallenge = async ({ token, difficulty }) => {
+  const encoder = new TextEncoder();
+  for (let nonce = 0; ; nonce++) {
+    const digest = await crypto.subtle.digest(
+      "SHA-256",
+      encoder.encode(`${token}:${nonce}`)
+    );
+    if (leadingZeroBits(new Uint8Array(digest)) >= difficulty) {
+      return String(nonce);
+    }
+  }
+};
@@ -5,11 +5,12 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
 	"Monex/config"
+	"Monex/internal/logger"
 
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
@@ -17,16 +18,35 @@ import (
 
 type DB struct {
 	*sql.DB
+
+	// Path is the database file on disk (used for backups)
+	Path string
+
+	// adminPasswordFile receives the generated initial admin password
+	adminPasswordFile string
+
+	// Initial admin account; adminPassword is empty unless set via ADMIN_PASSWORD
+	adminUsername string
+	adminEmail    string
+	adminPassword string
+
+	// FTSEnabled reports whether the transactions_fts index is available
+	// (requires building with -tags sqlite_fts5)
+	FTSEnabled bool
+
+	// slow logs statements slower than SLOW_QUERY_MS and counts them
+	slow slowQueryLog
 }
 
-// New creates and initializes the database with secure defaults
-func New(cfg *config.DatabaseConfig) *DB {
-	dsn := fmt.Sprintf("%s?_busy_timeout=%d&_journal_mode=WAL&_foreign_keys=ON",
+// New opens the database with secure defaults and applies pending migrations
+func New(cfg *config.DatabaseConfig) (*DB, error) {
+	// _loc=UTC makes the driver return every scanned datetime in UTC
+	dsn := fmt.Sprintf("%s?_busy_timeout=%d&_journal_mode=WAL&_foreign_keys=ON&_loc=UTC",
 		cfg.Path, cfg.BusyTimeout)
 
 	sqlDB, err := sql.Open("sqlite3", dsn)
 	if err != nil {
-		log.Fatalf("[CRITICAL] Failed to open database: %v", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Configure connection pool with secure defaults
@@ -43,150 +63,44 @@ func New(cfg *config.DatabaseConfig) *DB {
 
 	// Test connection
 	if err := sqlDB.Ping(); err != nil {
-		log.Fatalf("[CRITICAL] Failed to ping database: %v", err)
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	db := &DB{DB: sqlDB}
+	db := &DB{
+		DB:                sqlDB,
+		Path:              cfg.Path,
+		adminPasswordFile: cfg.AdminPasswordFile,
+		adminUsername:     cfg.AdminUsername,
+		adminEmail:        cfg.AdminEmail,
+		adminPassword:     cfg.AdminPassword,
+	}
+	db.slow.threshold = time.Duration(cfg.SlowQueryMS) * time.Millisecond
+	if db.adminUsername == "" {
+		db.adminUsername = "admin"
+	}
+	if db.adminEmail == "" {
+		db.adminEmail = "admin@monex.local"
+	}
 
 	// Initialize schema with security enhancements
 	if err := db.initSchema(); err != nil {
-		log.Fatalf("[CRITICAL] Failed to initialize schema: %v", err)
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
-	log.Println("[OK] Database initialized successfully with security features")
-	return db
+	slog.Info("Database initialized")
+	return db, nil
 }
 
-// initSchema creates all necessary tables with enhanced security
+// initSchema applies pending migrations and prepares runtime-dependent objects
 func (db *DB) initSchema() error {
-	schema := `
-	PRAGMA foreign_keys = ON;
-
-	-- Users table with enhanced security fields
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT NOT NULL UNIQUE COLLATE NOCASE,
-		email TEXT NOT NULL UNIQUE COLLATE NOCASE,
-		password TEXT NOT NULL,
-		role TEXT NOT NULL DEFAULT 'user' CHECK(role IN ('admin', 'user')),
-		active BOOLEAN NOT NULL DEFAULT 1,
-		locked BOOLEAN NOT NULL DEFAULT 0,
-		failed_attempts INTEGER NOT NULL DEFAULT 0,
-		temp_bans_count INTEGER NOT NULL DEFAULT 0,
-		locked_until DATETIME,
-		permanently_locked BOOLEAN NOT NULL DEFAULT 0,
-		last_password_change DATETIME, -- NEW: Track password changes
-		mfa_enabled BOOLEAN NOT NULL DEFAULT 0, -- NEW: MFA support
-		mfa_secret TEXT, -- NEW: TOTP secret
-		password_change_required TEXT,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);
-
-	-- Transactions table with audit fields
-	CREATE TABLE IF NOT EXISTS transactions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		type TEXT NOT NULL CHECK(type IN ('deposit', 'withdraw', 'expense')),
-		amount INTEGER NOT NULL CHECK(amount > 0),
-		note TEXT,
-		is_edited BOOLEAN NOT NULL DEFAULT 0,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		created_by_ip TEXT, -- NEW: Track creation IP
-		updated_by_ip TEXT, -- NEW: Track update IP
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	-- Enhanced sessions table
-	CREATE TABLE IF NOT EXISTS sessions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		device_id TEXT NOT NULL UNIQUE,
-		device_name TEXT NOT NULL,
-		browser TEXT NOT NULL,
-		os TEXT NOT NULL,
-		ip_address TEXT NOT NULL,
-		refresh_token_hash TEXT NOT NULL,
-		access_token_hash TEXT NOT NULL,
-		last_activity DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		expires_at DATETIME NOT NULL,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		is_suspicious BOOLEAN NOT NULL DEFAULT 0, -- NEW: Flag suspicious sessions
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-		UNIQUE(user_id, device_id)
-	);
-
-	-- Token blacklist with enhanced tracking
-	CREATE TABLE IF NOT EXISTS token_blacklist (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER,
-		token_hash TEXT NOT NULL UNIQUE,
-		token_type TEXT NOT NULL CHECK(token_type IN ('access', 'refresh', 'all')),
-		expires_at DATETIME NOT NULL,
-		blacklisted_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		reason TEXT NOT NULL, -- Now required
-		blacklisted_by INTEGER, -- NEW: Track who blacklisted
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-		FOREIGN KEY (blacklisted_by) REFERENCES users(id) ON DELETE SET NULL
-	);
-
-	-- Audit logs with enhanced fields
-	-- Audit logs with enhanced fields (ALLOW NULL user_id)
-	CREATE TABLE IF NOT EXISTS audit_logs (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER,
-		action TEXT NOT NULL,
-		resource TEXT NOT NULL,
-		ip_address TEXT,
-		user_agent TEXT,
-		success BOOLEAN NOT NULL,
-		details TEXT,
-		severity TEXT NOT NULL DEFAULT 'info' CHECK(severity IN ('info', 'warning', 'error', 'critical')),
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL  -- ✅ Changed to SET NULL
-	);
-
-	-- NEW: Password history table (prevent reuse)
-	CREATE TABLE IF NOT EXISTS password_history (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		password_hash TEXT NOT NULL,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	-- NEW: Login attempts tracking (for analytics)
-	CREATE TABLE IF NOT EXISTS login_attempts (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT NOT NULL,
-		ip_address TEXT NOT NULL,
-		user_agent TEXT,
-		success BOOLEAN NOT NULL,
-		failure_reason TEXT,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);
-
-	-- Indexes for performance
-	CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
-	CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
-	CREATE INDEX IF NOT EXISTS idx_users_active ON users(active);
-	CREATE INDEX IF NOT EXISTS idx_users_locked ON users(locked);
-	CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
-	CREATE INDEX IF NOT EXISTS idx_sessions_device_id ON sessions(device_id);
-	CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
-	CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs(user_id);
-	CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);
-	CREATE INDEX IF NOT EXISTS idx_audit_logs_severity ON audit_logs(severity);
-	CREATE INDEX IF NOT EXISTS idx_token_blacklist_expires_at ON token_blacklist(expires_at);
-	CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username);
-	CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address);
-	CREATE INDEX IF NOT EXISTS idx_login_attempts_created ON login_attempts(created_at);
-	`
+	if err := db.runMigrations(); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
 
-	if _, err := db.Exec(schema); err != nil {
-		return fmt.Errorf("failed to create schema: %w", err)
+	if err := db.initFullTextSearch(); err != nil {
+		return fmt.Errorf("failed to initialize full-text search: %w", err)
 	}
 
 	// Create default admin with secure password
@@ -197,11 +111,66 @@ func (db *DB) initSchema() error {
 	return nil
 }
 
-// createDefaultAdmin creates admin user with randomly generated password
-// createDefaultAdmin creates admin user with randomly generated password
+// initFullTextSearch sets up the FTS5 index over transaction notes. When the
+// binary was built without FTS5 the index is skipped (search falls back to
+// LIKE) and any triggers left by an FTS-enabled build are dropped so writes
+// to transactions keep working.
+func (db *DB) initFullTextSearch() error {
+	triggers := []string{"transactions_fts_ai", "transactions_fts_ad", "transactions_fts_au"}
+
+	// Missing triggers mean the index is new or was not maintained by a
+	// previous non-FTS build, so it must be (re)built from transactions
+	var existingTriggers int
+	if err := db.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'transactions_fts_%'",
+	).Scan(&existingTriggers); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS transactions_fts
+		USING fts5(note, content='transactions', content_rowid='id')`); err != nil {
+		slog.Warn("FTS5 not available, transaction search will use LIKE", "error", err)
+		for _, trigger := range triggers {
+			if _, err := db.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	schema := `
+	CREATE TRIGGER IF NOT EXISTS transactions_fts_ai AFTER INSERT ON transactions BEGIN
+		INSERT INTO transactions_fts(rowid, note) VALUES (new.id, new.note);
+	END;
+	CREATE TRIGGER IF NOT EXISTS transactions_fts_ad AFTER DELETE ON transactions BEGIN
+		INSERT INTO transactions_fts(transactions_fts, rowid, note) VALUES ('delete', old.id, old.note);
+	END;
+	CREATE TRIGGER IF NOT EXISTS transactions_fts_au AFTER UPDATE OF note ON transactions BEGIN
+		INSERT INTO transactions_fts(transactions_fts, rowid, note) VALUES ('delete', old.id, old.note);
+		INSERT INTO transactions_fts(rowid, note) VALUES (new.id, new.note);
+	END;
+	`
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+
+	if existingTriggers < len(triggers) {
+		if _, err := db.Exec("INSERT INTO transactions_fts(transactions_fts) VALUES ('rebuild')"); err != nil {
+			return err
+		}
+		slog.Info("Built full-text index for transaction notes")
+	}
+
+	db.FTSEnabled = true
+	return nil
+}
+
+// createDefaultAdmin creates the admin user with the ADMIN_PASSWORD from the
+// environment, or else with a randomly generated password written to the
+// admin password file
 func (db *DB) createDefaultAdmin() error {
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE username = 'admin'").Scan(&count)
+	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", db.adminUsername).Scan(&count)
 	if err != nil {
 		return err
 	}
@@ -209,72 +178,92 @@ func (db *DB) createDefaultAdmin() error {
 	if count > 0 {
 		// ✅ Check if admin is still using default password
 		var adminPasswordHash string
-		err = db.QueryRow("SELECT password FROM users WHERE username = 'admin'").Scan(&adminPasswordHash)
+		err = db.QueryRow("SELECT password FROM users WHERE username = ?", db.adminUsername).Scan(&adminPasswordHash)
 		if err == nil {
 			// Check if it's the known weak default
 			if bcrypt.CompareHashAndPassword([]byte(adminPasswordHash), []byte("admin123")) == nil {
-				log.Println("╔════════════════════════════════════════════════════════╗")
-				log.Println("║  ⚠️  SECURITY WARNING: DEFAULT PASSWORD DETECTED      ║")
-				log.Println("╠════════════════════════════════════════════════════════╣")
-				log.Println("║  Admin account is using the default password!         ║")
-				log.Println("║  This is a CRITICAL security risk!                    ║")
-				log.Println("║  Change it immediately after login.                   ║")
-				log.Println("╚════════════════════════════════════════════════════════╝")
+				logger.Security("Admin account is using the default password, change it immediately after login",
+					"username", db.adminUsername)
 			}
 		}
 		return nil // Admin already exists
 	}
 
-	// ✅ Generate secure random password
-	randomPassword, err := generateSecurePassword(16)
-	if err != nil {
-		return fmt.Errorf("failed to generate admin password: %w", err)
+	// ✅ A renamed ADMIN_USERNAME must not seed a second admin next to the
+	// existing one (whose default email the new one would also take)
+	var admins int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'admin'").Scan(&admins); err != nil {
+		return err
+	}
+	if admins > 0 {
+		slog.Info("Skipping admin seeding: an admin account already exists", "admin_username", db.adminUsername, "admins", admins)
+		return nil
+	}
+
+	// ✅ Use the configured password, otherwise generate a secure random one
+	adminPassword := db.adminPassword
+	if adminPassword == "" {
+		adminPassword, err = generateSecurePassword(16)
+		if err != nil {
+			return fmt.Errorf("failed to generate admin password: %w", err)
+		}
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), 12)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(adminPassword), 12)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	// ✅ Create admin user
-	now := time.Now()
+	now := time.Now().UTC()
 	_, err = db.Exec(`
 		INSERT INTO users (
-			username, email, password, role, active, 
+			username, email, password, role, active, email_verified,
 			password_change_required, last_password_change,
 			created_at, updated_at
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, "admin", "admin@monex.local", string(hashedPassword), "admin", true,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, db.adminUsername, db.adminEmail, string(hashedPassword), "admin", true, true,
 		false, now, now, now) // ✅ Changed password_change_required to FALSE
 
 	if err != nil {
 		return fmt.Errorf("failed to create admin user: %w", err)
 	}
 
-	// ✅ Display password ONCE with enhanced security notice
-	log.Println("╔════════════════════════════════════════════════════════╗")
-	log.Println("║     🔐 INITIAL ADMIN CREDENTIALS - READ CAREFULLY      ║")
-	log.Println("╠════════════════════════════════════════════════════════╣")
-	log.Printf(" ║ Username: admin                                        ║\n")
-	log.Printf(" ║ Password: %-42s║\n", randomPassword)
-	log.Println("╠════════════════════════════════════════════════════════╣")
-	log.Println("║ 🚨 CRITICAL SECURITY REQUIREMENTS:                    ║")
-	log.Println("║                                                        ║")
-	log.Println("║ 1. SAVE this password immediately                     ║")
-	log.Println("║ 2. This password will NOT be shown again              ║")
-	log.Println("║ 3. Password saved to: .admin-password.txt             ║")
-	log.Println("║ 4. Delete .admin-password.txt after copying           ║")
-	log.Println("╚════════════════════════════════════════════════════════╝")
+	// ✅ The operator already knows a configured password; never echo or store it
+	if db.adminPassword != "" {
+		slog.Info("Admin user created with the password from ADMIN_PASSWORD", "username", db.adminUsername)
+		return nil
+	}
+
+	// ✅ Display password ONCE on the console. It goes straight to stderr, not
+	// through the logger, so it never ends up in shipped or rotated log files.
+	fmt.Fprintln(os.Stderr, "╔════════════════════════════════════════════════════════╗")
+	fmt.Fprintln(os.Stderr, "║     🔐 INITIAL ADMIN CREDENTIALS - READ CAREFULLY      ║")
+	fmt.Fprintln(os.Stderr, "╠════════════════════════════════════════════════════════╣")
+	fmt.Fprintf(os.Stderr, "║ Username: %-44s ║\n", db.adminUsername)
+	fmt.Fprintf(os.Stderr, "║ Password: %-44s ║\n", adminPassword)
+	fmt.Fprintln(os.Stderr, "╠════════════════════════════════════════════════════════╣")
+	fmt.Fprintln(os.Stderr, "║ 🚨 CRITICAL SECURITY REQUIREMENTS:                    ║")
+	fmt.Fprintln(os.Stderr, "║                                                        ║")
+	fmt.Fprintln(os.Stderr, "║ 1. SAVE this password immediately                     ║")
+	fmt.Fprintln(os.Stderr, "║ 2. This password will NOT be shown again              ║")
+	fmt.Fprintln(os.Stderr, "║ 3. Password saved to the admin password file (below)  ║")
+	fmt.Fprintln(os.Stderr, "║ 4. Delete that file after copying                     ║")
+	fmt.Fprintln(os.Stderr, "╚════════════════════════════════════════════════════════╝")
+	slog.Warn("Initial admin credentials printed to the console", "username", db.adminUsername)
 
 	// ✅ Write to secure file with restrictive permissions
-	passwordFile := ".admin-password.txt"
+	passwordFile := db.adminPasswordFile
+	if passwordFile == "" {
+		passwordFile = ".admin-password.txt"
+	}
 	passwordContent := fmt.Sprintf(
 		"╔════════════════════════════════════════════════════════╗\n"+
 		"║     ADMIN CREDENTIALS - DELETE AFTER USE               ║\n"+
 		"╠════════════════════════════════════════════════════════╣\n"+
 		"║ Generated: %-44s║\n"+
-		"║ Username:  admin                                       ║\n"+
+		"║ Username:  %-44s║\n"+
 		"║ Password:  %-44s║\n"+
 		"╠════════════════════════════════════════════════════════╣\n"+
 		"║ ⚠️ SECURITY NOTICE:                                    ║\n"+
@@ -283,14 +272,14 @@ func (db *DB) createDefaultAdmin() error {
 		"║ - Change password after first login (recommended)     ║\n"+
 		"╚════════════════════════════════════════════════════════╝\n",
 		time.Now().Format("2006-01-02 15:04:05"),
-		randomPassword,
+		db.adminUsername,
+		adminPassword,
 	)
 
 	if err := os.WriteFile(passwordFile, []byte(passwordContent), 0600); err != nil {
-		log.Printf("[WARNING] Could not save password to file: %v", err)
-		log.Printf("[WARNING] PLEASE COPY THE PASSWORD FROM CONSOLE NOW!")
+		slog.Warn("Could not save admin password to file, copy it from the console now", "path", passwordFile, "error", err)
 	} else {
-		log.Printf("[INFO] ✅ Password saved to: %s (0600 permissions)", passwordFile)
+		slog.Info("Admin password saved", "path", passwordFile, "mode", "0600")
 	}
 
 	return nil
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"Monex/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testConfig points a database at a fresh file under t.TempDir()
+func testConfig(t *testing.T) *config.DatabaseConfig {
+	t.Helper()
+	dir := t.TempDir()
+	return &config.DatabaseConfig{
+		Path:              filepath.Join(dir, "data.db"),
+		MaxOpenConns:      1,
+		MaxIdleConns:      1,
+		BusyTimeout:       5000,
+		AdminPasswordFile: filepath.Join(dir, ".admin-password.txt"),
+		AdminUsername:     "admin",
+		AdminEmail:        "admin@monex.local",
+	}
+}
+
+// openDB opens the database described by cfg, failing the test on error
+func openDB(t *testing.T, cfg *config.DatabaseConfig) *DB {
+	t.Helper()
+	db, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return db
+}
+
+func TestRenamedAdminUsernameDoesNotSeedSecondAdmin(t *testing.T) {
+	cfg := testConfig(t)
+	openDB(t, cfg).Close()
+
+	cfg.AdminUsername = "root"
+	db := openDB(t, cfg)
+	defer db.Close()
+
+	var admins int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'admin'").Scan(&admins); err != nil {
+		t.Fatalf("count admins: %v", err)
+	}
+	if admins != 1 {
+		t.Fatalf("%d admins after renaming ADMIN_USERNAME, want 1", admins)
+	}
+}
+
+func TestConfiguredAdminPasswordIsNotWritten(t *testing.T) {
+	const password = "Conf1gured!Admin"
+	cfg := testConfig(t)
+	cfg.AdminPassword = password
+	db := openDB(t, cfg)
+	defer db.Close()
+
+	if _, err := os.Stat(cfg.AdminPasswordFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("admin password file written for a configured password (stat: %v)", err)
+	}
+
+	var hash string
+	if err := db.QueryRow("SELECT password FROM users WHERE username = ?", cfg.AdminUsername).Scan(&hash); err != nil {
+		t.Fatalf("load admin: %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		t.Fatalf("seeded admin hash doesn't match ADMIN_PASSWORD: %v", err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	cfg := testConfig(t)
+
+	// appliedMigrations returns how many migrations db has recorded and its version
+	appliedMigrations := func(db *DB) (int, int) {
+		t.Helper()
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count); err != nil {
+			t.Fatalf("count schema_migrations: %v", err)
+		}
+		version, err := db.SchemaVersion()
+		if err != nil {
+			t.Fatalf("SchemaVersion: %v", err)
+		}
+		return count, version
+	}
+
+	// A fresh database runs every migration once
+	db := openDB(t, cfg)
+	if count, version := appliedMigrations(db); count != len(migrations) || version != LatestSchemaVersion() {
+		t.Fatalf("fresh database: %d migrations recorded at version %d, want %d at %d",
+			count, version, len(migrations), LatestSchemaVersion())
+	}
+	db.Close()
+
+	// Reopening an up-to-date database applies nothing
+	db = openDB(t, cfg)
+	defer db.Close()
+	if count, version := appliedMigrations(db); count != len(migrations) || version != LatestSchemaVersion() {
+		t.Fatalf("reopened database: %d migrations recorded at version %d, want %d at %d",
+			count, version, len(migrations), LatestSchemaVersion())
+	}
+
+	// A database one version behind advances by exactly the missing migration
+	if _, err := db.Exec("DELETE FROM schema_migrations WHERE version = ?", LatestSchemaVersion()); err != nil {
+		t.Fatalf("roll back version: %v", err)
+	}
+	if err := db.runMigrations(); err != nil {
+		t.Fatalf("runMigrations on an older database: %v", err)
+	}
+	if count, version := appliedMigrations(db); count != len(migrations) || version != LatestSchemaVersion() {
+		t.Fatalf("older database: %d migrations recorded at version %d, want %d at %d",
+			count, version, len(migrations), LatestSchemaVersion())
+	}
+}
+
+func TestExecWithRetryWaitsOutWriteLock(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BusyTimeout = 0 // fail fast so the retry loop does the waiting
+	db := openDB(t, cfg)
+	defer db.Close()
+	other := openDB(t, cfg)
+	defer other.Close()
+
+	if _, err := db.Exec("CREATE TABLE contention (n INTEGER)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	// Another connection holds the write lock for a while
+	tx, err := other.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO contention (n) VALUES (1)"); err != nil {
+		t.Fatalf("insert under lock: %v", err)
+	}
+
+	if _, err := db.Exec("INSERT INTO contention (n) VALUES (2)"); !IsBusyError(err) {
+		t.Fatalf("plain Exec under lock: %v, want a busy error", err)
+	}
+
+	released := make(chan error, 1)
+	go func() {
+		time.Sleep(2 * busyRetryBaseWait)
+		released <- tx.Commit()
+	}()
+	if _, err := db.ExecWithRetry("INSERT INTO contention (n) VALUES (3)"); err != nil {
+		t.Fatalf("ExecWithRetry under lock: %v", err)
+	}
+	if err := <-released; err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	var rows int
+	if err := db.QueryRow("SELECT COUNT(*) FROM contention").Scan(&rows); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if rows != 2 {
+		t.Fatalf("%d rows, want the locked insert and the retried one", rows)
+	}
+}
+
+func TestSlowQueriesAreLogged(t *testing.T) {
+	db := openDB(t, testConfig(t))
+	defer db.Close()
+
+	var logged bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logged, nil)))
+	defer slog.SetDefault(previous)
+
+	const slowQuery = `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < ?)
+		SELECT COUNT(*) FROM c`
+	runSlowQuery := func() {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(slowQuery, 1234567).Scan(&n); err != nil {
+			t.Fatalf("slow query: %v", err)
+		}
+	}
+
+	// Disabled by default
+	runSlowQuery()
+	if db.SlowQueries() != 0 || strings.Contains(logged.String(), "Slow query") {
+		t.Fatalf("slow query reported with the threshold disabled: %d, %q", db.SlowQueries(), logged.String())
+	}
+
+	db.slow.threshold = time.Millisecond
+	runSlowQuery()
+	if db.SlowQueries() != 1 {
+		t.Fatalf("SlowQueries() = %d, want 1", db.SlowQueries())
+	}
+	line := logged.String()
+	if !strings.Contains(line, "Slow query") || !strings.Contains(line, "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL") {
+		t.Fatalf("slow query not logged with its statement: %q", line)
+	}
+	if strings.Contains(line, "1234567") {
+		t.Fatalf("slow query log leaks the statement's arguments: %q", line)
+	}
+}
@@ -0,0 +1,430 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// migration is a single schema change. Migrations run in order, each inside
+// its own transaction, and are recorded in schema_migrations once applied.
+// Append new migrations to the end of the list; never edit or reorder
+// migrations that have shipped.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{1, "initial schema", migrateInitialSchema},
+	{2, "app settings", migrateAppSettings},
+	{3, "email verification", migrateEmailVerification},
+	{4, "password resets", migratePasswordResets},
+	{5, "normalize emails", migrateNormalizeEmails},
+	{6, "utc timestamps", migrateUTCTimestamps},
+	{7, "audit transaction changes", migrateAuditChanges},
+	{8, "suspicious sessions", migrateSuspiciousSessions},
+}
+
+// runMigrations applies every migration newer than the recorded schema version
+func (db *DB) runMigrations() error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", m.version, err)
+		}
+
+		if err := m.up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+
+		if _, err := tx.Exec(
+			"INSERT INTO schema_migrations (version, name) VALUES (?, ?)",
+			m.version, m.name,
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", m.version, err)
+		}
+
+		slog.Info("Applied migration", "version", m.version, "name", m.name)
+	}
+
+	return nil
+}
+
+// LatestSchemaVersion returns the schema version this binary migrates to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion returns the highest applied migration version (0 for a new database)
+func (db *DB) SchemaVersion() (int, error) {
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrateInitialSchema creates the baseline schema. It stays idempotent
+// (IF NOT EXISTS, ensureColumn) because databases created before versioning
+// already contain some or all of these objects.
+func migrateInitialSchema(tx *sql.Tx) error {
+	if _, err := tx.Exec(initialSchema); err != nil {
+		return err
+	}
+
+	// Columns added to existing tables before migrations were versioned
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"sessions", "access_jti", "TEXT"},
+		{"sessions", "refresh_jti", "TEXT"},
+		{"token_blacklist", "jti", "TEXT"},
+	}
+
+	for _, col := range columns {
+		if err := ensureColumn(tx, col.table, col.column, col.definition); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_token_blacklist_jti ON token_blacklist(jti)")
+	return err
+}
+
+// migrateAppSettings adds a key/value table for server-wide state that must
+// survive restarts
+func migrateAppSettings(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS app_settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	return err
+}
+
+// migrateEmailVerification tracks whether a user confirmed their email.
+// Accounts that predate verification are treated as verified.
+func migrateEmailVerification(tx *sql.Tx) error {
+	if err := ensureColumn(tx, "users", "email_verified", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE users SET email_verified = 1")
+	return err
+}
+
+// migratePasswordResets stores self-service reset tokens. Only a SHA-256 hash
+// of each token is kept, so a leaked database can't be used to reset passwords.
+func migratePasswordResets(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS password_resets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			requested_ip TEXT,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets(user_id);
+		CREATE INDEX IF NOT EXISTS idx_password_resets_expires_at ON password_resets(expires_at);
+	`)
+	return err
+}
+
+// migrateNormalizeEmails stores every email trimmed and lowercased, matching
+// models.NormalizeEmail. Rows whose normalized email would collide with
+// another account are left as-is and logged for manual review.
+func migrateNormalizeEmails(tx *sql.Tx) error {
+	if _, err := tx.Exec(`
+		UPDATE users SET email = LOWER(TRIM(email))
+		WHERE email != LOWER(TRIM(email))
+		  AND NOT EXISTS (
+			SELECT 1 FROM users other
+			WHERE other.id != users.id AND LOWER(TRIM(other.email)) = LOWER(TRIM(users.email))
+		  )
+	`); err != nil {
+		return err
+	}
+
+	var conflicts int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE email != LOWER(TRIM(email))").Scan(&conflicts); err != nil {
+		return err
+	}
+	if conflicts > 0 {
+		slog.Warn("User emails could not be normalized because they collide with another account", "count", conflicts)
+	}
+	return nil
+}
+
+// driverTimestampColumns are written as Go time.Time values, which the driver
+// stores with the server's zone offset. They keep the driver's layout but with
+// a +00:00 offset, preserving the sub-second precision used for optimistic
+// locking on transactions.
+var driverTimestampColumns = []struct{ table, column string }{
+	{"transactions", "created_at"},
+	{"transactions", "updated_at"},
+	{"users", "created_at"},
+	{"users", "updated_at"},
+	{"users", "locked_until"},
+	{"users", "last_password_change"},
+	{"notifications", "created_at"},
+}
+
+// migrateUTCTimestamps rewrites datetimes stored with a non-UTC zone offset
+// in UTC, so string comparison and ORDER BY agree with the actual instant.
+// Token blacklist expiries are compared against CURRENT_TIMESTAMP and are
+// stored in its plain UTC text format.
+func migrateUTCTimestamps(tx *sql.Tx) error {
+	for _, c := range driverTimestampColumns {
+		if _, err := tx.Exec(fmt.Sprintf(`
+			UPDATE %[1]s SET %[2]s = strftime('%%Y-%%m-%%d %%H:%%M:%%f', %[2]s) || '+00:00'
+			WHERE substr(%[2]s, -6, 1) IN ('+', '-') AND substr(%[2]s, -6) != '+00:00'
+			  AND strftime('%%Y-%%m-%%d %%H:%%M:%%f', %[2]s) IS NOT NULL
+		`, c.table, c.column)); err != nil {
+			return fmt.Errorf("%s.%s: %w", c.table, c.column, err)
+		}
+	}
+
+	_, err := tx.Exec(`
+		UPDATE token_blacklist SET expires_at = datetime(expires_at)
+		WHERE datetime(expires_at) IS NOT NULL AND expires_at != datetime(expires_at)
+	`)
+	return err
+}
+
+// migrateAuditChanges lets audit entries for transaction mutations carry the
+// row's state before and after as JSON, which undo restores from
+func migrateAuditChanges(tx *sql.Tx) error {
+	if err := ensureColumn(tx, "audit_logs", "changes", "TEXT"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_audit_logs_user_changes ON audit_logs(user_id, created_at) WHERE changes IS NOT NULL")
+	return err
+}
+
+// migrateSuspiciousSessions records when a session was first used from a
+// device or network that doesn't match the one it was created on
+func migrateSuspiciousSessions(tx *sql.Tx) error {
+	return ensureColumn(tx, "sessions", "suspicious_at", "DATETIME")
+}
+
+// ensureColumn adds a column to a table if it does not exist yet
+func ensureColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+
+	slog.Info("Added column", "table", table, "column", column)
+	return nil
+}
+
+const initialSchema = `
+	-- Users table with enhanced security fields
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		email TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		password TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'user' CHECK(role IN ('admin', 'user')),
+		active BOOLEAN NOT NULL DEFAULT 1,
+		locked BOOLEAN NOT NULL DEFAULT 0,
+		failed_attempts INTEGER NOT NULL DEFAULT 0,
+		temp_bans_count INTEGER NOT NULL DEFAULT 0,
+		locked_until DATETIME,
+		permanently_locked BOOLEAN NOT NULL DEFAULT 0,
+		last_password_change DATETIME, -- NEW: Track password changes
+		mfa_enabled BOOLEAN NOT NULL DEFAULT 0, -- NEW: MFA support
+		mfa_secret TEXT, -- NEW: TOTP secret
+		password_change_required TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Transactions table with audit fields
+	CREATE TABLE IF NOT EXISTS transactions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		type TEXT NOT NULL CHECK(type IN ('deposit', 'withdraw', 'expense')),
+		amount INTEGER NOT NULL CHECK(amount > 0),
+		note TEXT,
+		is_edited BOOLEAN NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		created_by_ip TEXT, -- NEW: Track creation IP
+		updated_by_ip TEXT, -- NEW: Track update IP
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	-- Enhanced sessions table
+	CREATE TABLE IF NOT EXISTS sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		device_id TEXT NOT NULL UNIQUE,
+		device_name TEXT NOT NULL,
+		browser TEXT NOT NULL,
+		os TEXT NOT NULL,
+		ip_address TEXT NOT NULL,
+		refresh_token_hash TEXT NOT NULL,
+		access_token_hash TEXT NOT NULL,
+		access_jti TEXT,
+		refresh_jti TEXT,
+		last_activity DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		is_suspicious BOOLEAN NOT NULL DEFAULT 0, -- NEW: Flag suspicious sessions
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		UNIQUE(user_id, device_id)
+	);
+
+	-- Token blacklist with enhanced tracking
+	CREATE TABLE IF NOT EXISTS token_blacklist (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		token_hash TEXT NOT NULL UNIQUE,
+		jti TEXT, -- JWT ID of the revoked token (NULL for legacy hash-only entries)
+		token_type TEXT NOT NULL CHECK(token_type IN ('access', 'refresh', 'all')),
+		expires_at DATETIME NOT NULL,
+		blacklisted_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		reason TEXT NOT NULL, -- Now required
+		blacklisted_by INTEGER, -- NEW: Track who blacklisted
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (blacklisted_by) REFERENCES users(id) ON DELETE SET NULL
+	);
+
+	-- Audit logs with enhanced fields
+	-- Audit logs with enhanced fields (ALLOW NULL user_id)
+	CREATE TABLE IF NOT EXISTS audit_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		action TEXT NOT NULL,
+		resource TEXT NOT NULL,
+		ip_address TEXT,
+		user_agent TEXT,
+		success BOOLEAN NOT NULL,
+		details TEXT,
+		severity TEXT NOT NULL DEFAULT 'info' CHECK(severity IN ('info', 'warning', 'error', 'critical')),
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL  -- ✅ Changed to SET NULL
+	);
+
+	-- NEW: Password history table (prevent reuse)
+	CREATE TABLE IF NOT EXISTS password_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		password_hash TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	-- Persisted notifications (replayed to SSE clients via Last-Event-ID)
+	CREATE TABLE IF NOT EXISTS notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		severity TEXT NOT NULL DEFAULT 'info',
+		data TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	-- Recurring transaction rules processed by the background scheduler
+	CREATE TABLE IF NOT EXISTS recurring_transactions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		type TEXT NOT NULL CHECK(type IN ('deposit', 'withdraw', 'expense')),
+		amount INTEGER NOT NULL CHECK(amount > 0),
+		note TEXT NOT NULL DEFAULT '',
+		interval TEXT NOT NULL CHECK(interval IN ('daily', 'weekly', 'monthly')),
+		next_run DATETIME NOT NULL,
+		anchor_day INTEGER NOT NULL DEFAULT 0,
+		active BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	-- NEW: Login attempts tracking (for analytics)
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL,
+		ip_address TEXT NOT NULL,
+		user_agent TEXT,
+		success BOOLEAN NOT NULL,
+		failure_reason TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Indexes for performance
+	CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+	CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+	CREATE INDEX IF NOT EXISTS idx_users_active ON users(active);
+	CREATE INDEX IF NOT EXISTS idx_users_locked ON users(locked);
+	CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+	CREATE INDEX IF NOT EXISTS idx_sessions_device_id ON sessions(device_id);
+	CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs(user_id);
+	CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_logs_severity ON audit_logs(severity);
+	CREATE INDEX IF NOT EXISTS idx_token_blacklist_expires_at ON token_blacklist(expires_at);
+	CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, id);
+	CREATE INDEX IF NOT EXISTS idx_recurring_due ON recurring_transactions(active, next_run);
+	CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username);
+	CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address);
+	CREATE INDEX IF NOT EXISTS idx_login_attempts_created ON login_attempts(created_at);
+`
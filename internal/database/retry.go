@@ -0,0 +1,42 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	busyRetryAttempts = 4
+	busyRetryBaseWait = 25 * time.Millisecond
+)
+
+// IsBusyError reports whether err is a transient SQLITE_BUSY/SQLITE_LOCKED
+// error that is worth retrying (as opposed to a constraint or syntax error)
+func IsBusyError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// ExecWithRetry runs a write statement, retrying with exponential backoff when
+// SQLite reports the database as busy or locked despite busy_timeout
+func (db *DB) ExecWithRetry(query string, args ...interface{}) (sql.Result, error) {
+	wait := busyRetryBaseWait
+
+	for attempt := 1; ; attempt++ {
+		result, err := db.Exec(query, args...)
+		if err == nil || !IsBusyError(err) || attempt == busyRetryAttempts {
+			return result, err
+		}
+
+		slog.Warn("Database busy, retrying write", "attempt", attempt, "wait", wait, "error", err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
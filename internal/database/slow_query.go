@@ -0,0 +1,110 @@
+package database
+
+import (
+	"database/sql"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxQueryLabelLength caps how much of a statement a slow-query log shows
+const maxQueryLabelLength = 120
+
+// slowQueryLog times statements run through DB and reports those slower
+// than threshold (0 disables it)
+type slowQueryLog struct {
+	threshold time.Duration
+	count     atomic.Uint64
+}
+
+// observe logs the statement query if it took longer than the threshold.
+// Only the statement is logged, never its arguments.
+func (l *slowQueryLog) observe(query string, start time.Time) {
+	if l.threshold <= 0 {
+		return
+	}
+	elapsed := time.Since(start)
+	if elapsed < l.threshold {
+		return
+	}
+	l.count.Add(1)
+	slog.Warn("Slow query", "duration", elapsed, "query", queryLabel(query))
+}
+
+// queryLabel turns a statement into a short single-line label
+func queryLabel(query string) string {
+	label := strings.Join(strings.Fields(query), " ")
+	if len(label) > maxQueryLabelLength {
+		label = label[:maxQueryLabelLength] + "..."
+	}
+	return label
+}
+
+// Rows wraps sql.Rows to time a query until its rows are closed. SQLite
+// does the work while rows are read, so that is when a query is slow.
+type Rows struct {
+	*sql.Rows
+	query  string
+	start  time.Time
+	slow   *slowQueryLog
+	closed bool
+}
+
+// Close closes the rows and logs the query when it was slow
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.slow.observe(r.query, r.start)
+	}
+	return err
+}
+
+// Row wraps sql.Row to time a query until it is scanned
+type Row struct {
+	*sql.Row
+	query string
+	start time.Time
+	slow  *slowQueryLog
+}
+
+// Scan copies the row into dest and logs the query when it was slow
+func (r *Row) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	r.slow.observe(r.query, r.start)
+	return err
+}
+
+// Query runs a query like sql.DB.Query; it is timed until the rows close
+func (db *DB) Query(query string, args ...interface{}) (*Rows, error) {
+	start := time.Now()
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		db.slow.observe(query, start)
+		return nil, err
+	}
+	return &Rows{Rows: rows, query: query, start: start, slow: &db.slow}, nil
+}
+
+// QueryRow runs a query like sql.DB.QueryRow; it is timed until scanned
+func (db *DB) QueryRow(query string, args ...interface{}) *Row {
+	start := time.Now()
+	return &Row{Row: db.DB.QueryRow(query, args...), query: query, start: start, slow: &db.slow}
+}
+
+// Exec runs a statement like sql.DB.Exec, logging it when slow
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer db.slow.observe(query, time.Now())
+	return db.DB.Exec(query, args...)
+}
+
+// SlowQueries returns how many statements exceeded SLOW_QUERY_MS
+func (db *DB) SlowQueries() uint64 {
+	return db.slow.count.Load()
+}
+
+// SlowQueryThreshold returns the slow-query threshold (0 when disabled)
+func (db *DB) SlowQueryThreshold() time.Duration {
+	return db.slow.threshold
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"Monex/internal/database"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// adminOverviewTTL is how long a computed overview is served from memory, so
+// refreshing the admin dashboard doesn't rerun the counts every time
+const adminOverviewTTL = 10 * time.Second
+
+type AdminOverviewHandler struct {
+	userRepo        *repository.UserRepository
+	transactionRepo *repository.TransactionRepository
+	sessionRepo     *repository.SessionRepository
+	auditRepo       *repository.AuditRepository
+	db              *database.DB
+	startTime       time.Time
+
+	mu        sync.Mutex
+	cached    *AdminOverviewResponse
+	expiresAt time.Time
+}
+
+func NewAdminOverviewHandler(
+	userRepo *repository.UserRepository,
+	transactionRepo *repository.TransactionRepository,
+	sessionRepo *repository.SessionRepository,
+	auditRepo *repository.AuditRepository,
+	db *database.DB,
+) *AdminOverviewHandler {
+	return &AdminOverviewHandler{
+		userRepo:        userRepo,
+		transactionRepo: transactionRepo,
+		sessionRepo:     sessionRepo,
+		auditRepo:       auditRepo,
+		db:              db,
+		startTime:       time.Now(),
+	}
+}
+
+// AdminOverviewResponse is the system-wide summary shown to admins
+type AdminOverviewResponse struct {
+	Users           *models.UserCounts `json:"users"`
+	Transactions    int                `json:"transactions"`
+	ActiveSessions  int                `json:"active_sessions"`
+	AuditLogs       int                `json:"audit_logs"`
+	DatabaseSize    int64              `json:"database_size_bytes"`
+	OpenConnections int                `json:"open_connections"`
+	Uptime          string             `json:"uptime"`
+	UptimeSeconds   int64              `json:"uptime_seconds"`
+	GeneratedAt     time.Time          `json:"generated_at"`
+}
+
+// GetOverview returns user, transaction, session and audit totals plus
+// database size and uptime. Results are cached for adminOverviewTTL.
+func (h *AdminOverviewHandler) GetOverview(c echo.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cached == nil || time.Now().After(h.expiresAt) {
+		overview, err := h.buildOverview()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت آمار سیستم")
+		}
+		h.cached = overview
+		h.expiresAt = time.Now().Add(adminOverviewTTL)
+	}
+
+	return c.JSON(http.StatusOK, h.cached)
+}
+
+func (h *AdminOverviewHandler) buildOverview() (*AdminOverviewResponse, error) {
+	users, err := h.userRepo.CountByStatus()
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := h.transactionRepo.CountAll()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := h.sessionRepo.CountAllActiveSessions()
+	if err != nil {
+		return nil, err
+	}
+	auditLogs, err := h.auditRepo.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	// ✅ Size of the main database file; WAL/SHM files are not included
+	var size int64
+	if info, err := os.Stat(h.db.Path); err == nil {
+		size = info.Size()
+	}
+
+	uptime := time.Since(h.startTime)
+	return &AdminOverviewResponse{
+		Users:           users,
+		Transactions:    transactions,
+		ActiveSessions:  sessions,
+		AuditLogs:       auditLogs,
+		DatabaseSize:    size,
+		OpenConnections: h.db.Stats().OpenConnections,
+		Uptime:          uptime.Truncate(time.Second).String(),
+		UptimeSeconds:   int64(uptime.Seconds()),
+		GeneratedAt:     time.Now().UTC(),
+	}, nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+	"Monex/internal/repository"
+)
+
+func TestOverviewMatchesSeededData(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	bob := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	carol := env.createUser(t, "carol", "Str0ng!Passw0rd", models.RoleUser)
+
+	transactions := repository.NewTransactionRepository(env.db)
+	for _, owner := range []int{alice.ID, alice.ID, alice.ID, bob.ID} {
+		if err := transactions.Create(&models.Transaction{UserID: owner, Type: "deposit", Amount: 100, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	loginSession(t, env, alice, "203.0.113.7")
+	loginSession(t, env, alice, "203.0.113.8")
+	_, _, expired := loginSession(t, env, bob, "203.0.113.9")
+	if _, err := env.db.Exec("UPDATE sessions SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Hour).UTC(), expired); err != nil {
+		t.Fatalf("expire session: %v", err)
+	}
+
+	// bob is locked; carol is locked too but disabled, which takes precedence
+	until := time.Now().Add(time.Hour)
+	for _, user := range []*models.User{bob, carol} {
+		user.Locked, user.LockedUntil = true, &until
+		if err := env.users.UpdateLockStatus(user); err != nil {
+			t.Fatalf("UpdateLockStatus: %v", err)
+		}
+	}
+	if err := env.users.SetActive(carol.ID, false); err != nil {
+		t.Fatalf("SetActive: %v", err)
+	}
+
+	if _, err := env.db.Exec("DELETE FROM audit_logs"); err != nil {
+		t.Fatalf("clear audit logs: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := env.audit.LogAction(alice.ID, "view", "test", "203.0.113.7", "test", true, ""); err != nil {
+			t.Fatalf("LogAction: %v", err)
+		}
+	}
+
+	h := NewAdminOverviewHandler(env.users, transactions, env.sessions, env.audit, env.db)
+	e := newEcho()
+	e.GET("/admin/overview", h.GetOverview, withUser(env.admin(t)))
+	rec := doJSON(e, http.MethodGet, "/admin/overview", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	var overview AdminOverviewResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &overview); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+
+	// The seeded admin and alice are active
+	wantUsers := models.UserCounts{Total: 4, Active: 2, Locked: 1, Disabled: 1}
+	if overview.Users == nil || *overview.Users != wantUsers {
+		t.Errorf("users = %+v, want %+v", overview.Users, wantUsers)
+	}
+	if overview.Transactions != 4 {
+		t.Errorf("transactions = %d, want 4", overview.Transactions)
+	}
+	if overview.ActiveSessions != 2 {
+		t.Errorf("active sessions = %d, want 2", overview.ActiveSessions)
+	}
+	if overview.AuditLogs != 5 {
+		t.Errorf("audit logs = %d, want 5", overview.AuditLogs)
+	}
+	if overview.DatabaseSize <= 0 {
+		t.Errorf("database size = %d, want the file size", overview.DatabaseSize)
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Monex/internal/logger"
+	"Monex/internal/middleware"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AdminSecurityHandler struct {
+	sessionRepo        *repository.SessionRepository
+	tokenBlacklistRepo *repository.TokenBlacklistRepository
+	settingsRepo       *repository.SettingsRepository
+	auditRepo          *repository.AuditRepository
+	jwtManager         *middleware.JWTManager
+}
+
+func NewAdminSecurityHandler(
+	sessionRepo *repository.SessionRepository,
+	tokenBlacklistRepo *repository.TokenBlacklistRepository,
+	settingsRepo *repository.SettingsRepository,
+	auditRepo *repository.AuditRepository,
+	jwtManager *middleware.JWTManager,
+) *AdminSecurityHandler {
+	return &AdminSecurityHandler{
+		sessionRepo:        sessionRepo,
+		tokenBlacklistRepo: tokenBlacklistRepo,
+		settingsRepo:       settingsRepo,
+		auditRepo:          auditRepo,
+		jwtManager:         jwtManager,
+	}
+}
+
+// LoadTokensNotBefore applies a persisted global revocation cutoff to the JWT manager
+func LoadTokensNotBefore(settingsRepo *repository.SettingsRepository, jwtManager *middleware.JWTManager) error {
+	value, err := settingsRepo.Get(repository.SettingTokensNotBefore)
+	if err != nil || value == "" {
+		return err
+	}
+
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s setting %q: %w", repository.SettingTokensNotBefore, value, err)
+	}
+
+	jwtManager.SetTokensNotBefore(time.Unix(unix, 0))
+	return nil
+}
+
+// RevokeAllTokens logs out every user on every device. Besides blacklisting
+// the tokens of known sessions, it persists a "tokens not before" cutoff that
+// ValidateToken enforces, so tokens the server has no record of (e.g. minted
+// with a leaked secret) are rejected as well.
+func (h *AdminSecurityHandler) RevokeAllTokens(c echo.Context) error {
+	adminID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	// iat has second precision, so round up: a token issued earlier in the
+	// current second must not survive the cutoff
+	cutoff := time.Now().Truncate(time.Second).Add(time.Second)
+
+	if err := h.settingsRepo.Set(repository.SettingTokensNotBefore, strconv.FormatInt(cutoff.Unix(), 10)); err != nil {
+		slog.Error("Failed to persist token cutoff", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ابطال توکن‌ها")
+	}
+	h.jwtManager.SetTokensNotBefore(cutoff)
+
+	blacklisted, err := h.tokenBlacklistRepo.BlacklistAllSessionTokens("Global revocation by admin", adminID)
+	if err != nil {
+		// The cutoff already rejects these tokens; the blacklist is defense in depth
+		slog.Warn("Failed to blacklist session tokens", "error", err)
+	}
+
+	sessionIDs, err := h.sessionRepo.DeleteAllSessions()
+	if err != nil {
+		slog.Error("Failed to delete sessions", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ابطال سشن‌ها")
+	}
+
+	for _, sessionID := range sessionIDs {
+		InvalidationHub.InvalidateSession(sessionID)
+		InvalidationHub.CleanupSession(sessionID)
+	}
+
+	GlobalNotificationHub.BroadcastToAll(NotificationEvent{
+		Type:      "session_invalidated",
+		Message:   "تمام نشست‌ها توسط مدیر سیستم باطل شدند. لطفا دوباره وارد شوید",
+		Severity:  "critical",
+		Timestamp: time.Now().UTC(),
+	})
+
+	details := fmt.Sprintf("Revoked all tokens: %d sessions deleted, %d tokens blacklisted, cutoff %s",
+		len(sessionIDs), blacklisted, cutoff.UTC().Format(time.RFC3339))
+	logger.Security("Global token revocation", "admin_id", adminID, "sessions", len(sessionIDs),
+		"blacklisted", blacklisted, "cutoff", cutoff)
+	_ = h.auditRepo.LogActionWithSeverity(
+		adminID,
+		"revoke_all_tokens",
+		"security",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		details,
+		"critical",
+	)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":            "تمام توکن‌ها با موفقیت ابطال شدند",
+		"sessions_revoked":   len(sessionIDs),
+		"tokens_blacklisted": blacklisted,
+		"tokens_not_before":  cutoff,
+	})
+}
+
+// ListBlacklist pages through the database token blacklist, newest first,
+// and reports how many tokens each blacklist holds. The in-memory blacklist
+// holds no user or reason, so only its size is shown.
+func (h *AdminSecurityHandler) ListBlacklist(c echo.Context) error {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	pageSize, _ := strconv.Atoi(c.QueryParam("pageSize"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	entries, total, err := h.tokenBlacklistRepo.List(pageSize, (page-1)*pageSize)
+	if err != nil {
+		slog.Error("Failed to list blacklist", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت لیست سیاه توکن‌ها")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":     entries,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+		"counts": map[string]int{
+			"memory":   middleware.Blacklist.Len(),
+			"database": total,
+		},
+	})
+}
+
+// DeleteBlacklistEntry removes a mistaken blacklist entry from the database
+// and, by its jti, from the in-memory blacklist, so its token works again
+// until it expires. Entries of tokens issued without a jti can't be matched
+// in memory and stay rejected there until the next restart.
+func (h *AdminSecurityHandler) DeleteBlacklistEntry(c echo.Context) error {
+	adminID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه نامعتبر")
+	}
+
+	entry, err := h.tokenBlacklistRepo.Delete(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "مورد یافت نشد")
+	}
+	if err != nil {
+		slog.Error("Failed to delete blacklist entry", "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در حذف از لیست سیاه")
+	}
+
+	if entry.JTI != "" {
+		middleware.Blacklist.Remove(entry.JTI)
+	}
+
+	user := "none"
+	if entry.UserID != nil {
+		user = strconv.Itoa(*entry.UserID)
+	}
+	logger.Security("Blacklist entry removed", "admin_id", adminID, "entry_id", entry.ID, "user_id", user)
+	_ = h.auditRepo.LogActionWithSeverity(
+		adminID,
+		"delete_blacklist_entry",
+		"security",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Removed blacklist entry %d (user: %s, type: %s, reason: %s)", entry.ID, user, entry.TokenType, entry.Reason),
+		"warning",
+	)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "توکن از لیست سیاه حذف شد"})
+}
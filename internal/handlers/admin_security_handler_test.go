@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"Monex/internal/middleware"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRevokeAllTokensRejectsEarlierTokens(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.admin(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", "user")
+	_, _, sessionID := loginSession(t, env, user, "203.0.113.7")
+
+	before, err := env.jwt.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	if _, err := env.jwt.ValidateTokenType(before, middleware.TokenTypeAccess); err != nil {
+		t.Fatalf("token rejected before revocation: %v", err)
+	}
+
+	h := NewAdminSecurityHandler(env.sessions, env.blacklist, env.settings, env.audit, env.jwt)
+	e := newEcho()
+	e.POST("/revoke-all", h.RevokeAllTokens, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user_id", admin.ID)
+			return next(c)
+		}
+	})
+	if rec := doJSON(e, http.MethodPost, "/revoke-all", "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("revoke-all: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	if _, err := env.jwt.ValidateTokenType(before, middleware.TokenTypeAccess); err == nil {
+		t.Fatal("token issued before the cutoff still validates")
+	}
+	if _, err := env.sessions.GetSessionByID(sessionID, user.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("session after revoke-all: %v, want ErrNotFound", err)
+	}
+
+	// The cutoff survives a restart
+	restarted, err := middleware.NewJWTManager(&env.cfg.JWT, env.blacklist)
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+	if err := LoadTokensNotBefore(env.settings, restarted); err != nil {
+		t.Fatalf("LoadTokensNotBefore: %v", err)
+	}
+	if _, err := restarted.ValidateTokenType(before, middleware.TokenTypeAccess); err == nil {
+		t.Fatal("token issued before the cutoff validates after a restart")
+	}
+}
+
+func TestDeleteBlacklistEntryRestoresToken(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.admin(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", "user")
+	access, _, sessionID := loginSession(t, env, user, "203.0.113.7")
+
+	// Revoke the session the way logout does: in the database and in memory
+	claims, err := env.jwt.ValidateTokenType(access, middleware.TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("token rejected before revocation: %v", err)
+	}
+	if err := env.blacklist.BlacklistBySessionID(sessionID, user.ID); err != nil {
+		t.Fatalf("BlacklistBySessionID: %v", err)
+	}
+	middleware.Blacklist.AddClaims(access, claims)
+	if _, err := env.jwt.ValidateTokenType(access, middleware.TokenTypeAccess); err == nil {
+		t.Fatal("revoked token still validates")
+	}
+
+	h := NewAdminSecurityHandler(env.sessions, env.blacklist, env.settings, env.audit, env.jwt)
+	e := newEcho()
+	e.GET("/blacklist", h.ListBlacklist, withUser(admin))
+	e.DELETE("/blacklist/:id", h.DeleteBlacklistEntry, withUser(admin))
+
+	rec := doJSON(e, http.MethodGet, "/blacklist", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: status %d, body %s", rec.Code, rec.Body)
+	}
+	var list struct {
+		Data []struct {
+			ID        int    `json:"id"`
+			UserID    *int   `json:"user_id"`
+			TokenType string `json:"token_type"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	accessEntry := 0
+	for _, entry := range list.Data {
+		if entry.TokenType == middleware.TokenTypeAccess && entry.UserID != nil && *entry.UserID == user.ID {
+			accessEntry = entry.ID
+		}
+	}
+	if accessEntry == 0 {
+		t.Fatalf("no access token entry for user %d in %s", user.ID, rec.Body)
+	}
+
+	rec = doJSON(e, http.MethodDelete, fmt.Sprintf("/blacklist/%d", accessEntry), "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d, body %s", rec.Code, rec.Body)
+	}
+	if _, err := env.jwt.ValidateTokenType(access, middleware.TokenTypeAccess); err != nil {
+		t.Fatalf("token still rejected after its entry was removed: %v", err)
+	}
+	if rec := doJSON(e, http.MethodDelete, fmt.Sprintf("/blacklist/%d", accessEntry), "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("deleting the entry again: status %d, want 404", rec.Code)
+	}
+}
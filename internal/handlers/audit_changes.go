@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"Monex/internal/middleware"
+)
+
+// auditRedacted replaces the values of sensitive fields in change records
+const auditRedacted = "***REDACTED***"
+
+// fieldChange is one changed field in an audit change record
+type fieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// changeRecord is what update operations write to the audit details: the
+// ID of the updated resource and the fields that changed, keyed by their
+// JSON name
+type changeRecord struct {
+	ID      int                    `json:"id"`
+	Changes map[string]fieldChange `json:"changes"`
+}
+
+// diffFields compares the JSON forms of before and after and returns the
+// fields whose values differ, except the ignored ones. Fields matching
+// middleware.DefaultRedactFields are reported as changed with both values
+// redacted.
+func diffFields(before, after interface{}, ignore ...string) map[string]fieldChange {
+	oldFields, newFields := jsonFields(before), jsonFields(after)
+
+	skip := make(map[string]bool, len(ignore))
+	for _, field := range ignore {
+		skip[field] = true
+	}
+
+	changes := make(map[string]fieldChange)
+	for key, newValue := range newFields {
+		oldValue := oldFields[key]
+		if skip[key] || reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if isSensitiveAuditField(key) {
+			oldValue, newValue = auditRedacted, auditRedacted
+		}
+		changes[key] = fieldChange{Old: oldValue, New: newValue}
+	}
+	return changes
+}
+
+// changeDetails renders the audit details of an update of resource id
+func changeDetails(id int, before, after interface{}, ignore ...string) string {
+	details, _ := json.Marshal(changeRecord{ID: id, Changes: diffFields(before, after, ignore...)})
+	return string(details)
+}
+
+// jsonFields decodes v's JSON form into a field map
+func jsonFields(v interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if data, err := json.Marshal(v); err == nil {
+		_ = json.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+func isSensitiveAuditField(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range middleware.DefaultRedactFields {
+		if strings.Contains(key, field) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+	"Monex/internal/repository"
+)
+
+func TestUpdateRecordsExactDiff(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+	tx := &models.Transaction{UserID: user.ID, Type: "expense", Amount: 1000, Note: "coffee", CreatedAt: time.Now().Add(-time.Hour)}
+	if err := transactions.Create(tx); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	h := NewTransactionHandler(transactions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.PUT("/transactions/:id", h.UpdateTransaction, withUser(user))
+	rec := doJSON(e, http.MethodPut, fmt.Sprintf("/transactions/%d", tx.ID), `{"amount":2500,"note":"coffee"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	var details string
+	if err := env.db.QueryRow("SELECT details FROM audit_logs WHERE action = 'update_transaction'").Scan(&details); err != nil {
+		t.Fatalf("read audit entry: %v", err)
+	}
+	var got changeRecord
+	if err := json.Unmarshal([]byte(details), &got); err != nil {
+		t.Fatalf("decode details %s: %v", details, err)
+	}
+	// Only the amount changed; the note was resent as is and updated_at/is_edited are ignored
+	want := changeRecord{ID: tx.ID, Changes: map[string]fieldChange{"amount": {Old: float64(1000), New: float64(2500)}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("details %s, want only amount 1000 -> 2500 for id %d", details, tx.ID)
+	}
+}
+
+func TestDiffFieldsRedactsSensitiveValues(t *testing.T) {
+	type account struct {
+		Email        string    `json:"email"`
+		PasswordHash string    `json:"password_hash"`
+		APIKey       string    `json:"api_key"`
+		UpdatedAt    time.Time `json:"updated_at"`
+	}
+	before := account{Email: "a@example.com", PasswordHash: "old", APIKey: "same", UpdatedAt: time.Unix(0, 0)}
+	after := account{Email: "b@example.com", PasswordHash: "new", APIKey: "same", UpdatedAt: time.Now()}
+
+	got := diffFields(before, after, "updated_at")
+	want := map[string]fieldChange{
+		"email":         {Old: "a@example.com", New: "b@example.com"},
+		"password_hash": {Old: auditRedacted, New: auditRedacted},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("diffFields = %v, want %v", got, want)
+	}
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"Monex/internal/middleware"
 	"Monex/internal/models"
@@ -37,7 +39,10 @@ func (h *AuditHandler) GetAuditLogs(c echo.Context) error {
 	offset := (page - 1) * pageSize
 
 	// Build filters
-	filters := make(map[string]interface{})
+	filters, err := parseAuditFilters(c)
+	if err != nil {
+		return err
+	}
 	if sortField := c.QueryParam("sortField"); sortField != "" {
 		filters["sortField"] = sortField
 	}
@@ -50,14 +55,14 @@ func (h *AuditHandler) GetAuditLogs(c echo.Context) error {
 
 	logs, total, err := h.auditRepo.GetAuditLogs(pageSize, offset, filters)
 	if err != nil {
-		log.Printf("[ERROR] GetAuditLogs failed: %v", err)
+		slog.Error("Failed to get audit logs", "error", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, map[string]interface{}{
 			"message": "خطا در دریافت لاگ‌های سیستم",
 			"error":   err.Error(),
 		})
 	}
 
-	log.Printf("[DEBUG] GetAuditLogs - Found %d logs (total: %d)", len(logs), total)
+	slog.Debug("Audit logs loaded", "count", len(logs), "total", total)
 
 	// ✅ Always return valid array, never null
 	if logs == nil {
@@ -72,6 +77,125 @@ func (h *AuditHandler) GetAuditLogs(c echo.Context) error {
 	})
 }
 
+// GetUserAuditLogs returns the audit history of one user, i.e. the actions
+// they performed, newest first by default (admin only). It accepts the same
+// filters and pagination as GetAuditLogs.
+func (h *AuditHandler) GetUserAuditLogs(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || userID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه کاربر نامعتبر است")
+	}
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	pageSize, _ := strconv.Atoi(c.QueryParam("pageSize"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	filters, err := parseAuditFilters(c)
+	if err != nil {
+		return err
+	}
+	filters["user_id"] = userID
+	filters["sortField"] = "created_at"
+	if sortOrder := c.QueryParam("sortOrder"); sortOrder != "" {
+		filters["sortOrder"] = sortOrder
+	}
+
+	logs, total, err := h.auditRepo.GetAuditLogs(pageSize, (page-1)*pageSize, filters)
+	if err != nil {
+		slog.Error("Failed to get user audit logs", "user_id", userID, "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت لاگ‌های کاربر")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":     logs,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+		"user_id":  userID,
+	})
+}
+
+// auditSeverities are the values allowed by the audit_logs severity column
+var auditSeverities = map[string]bool{"info": true, "warning": true, "error": true, "critical": true}
+
+// parseAuditFilters reads the optional filters shared by the audit endpoints:
+// user_id, action, resource, success (true/false), severity, and from/to as
+// YYYY-MM-DD dates (to is inclusive) or RFC 3339 timestamps
+func parseAuditFilters(c echo.Context) (map[string]interface{}, error) {
+	filters := make(map[string]interface{})
+
+	if value := c.QueryParam("user_id"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil || userID < 1 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "شناسه کاربر نامعتبر است")
+		}
+		filters["user_id"] = userID
+	}
+
+	if action := strings.TrimSpace(c.QueryParam("action")); action != "" {
+		filters["action"] = action
+	}
+	if resource := strings.TrimSpace(c.QueryParam("resource")); resource != "" {
+		filters["resource"] = resource
+	}
+
+	if value := c.QueryParam("success"); value != "" {
+		success, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "مقدار success باید true یا false باشد")
+		}
+		filters["success"] = success
+	}
+
+	if severity := c.QueryParam("severity"); severity != "" {
+		if !auditSeverities[severity] {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "سطح اهمیت نامعتبر است (info, warning, error, critical)")
+		}
+		filters["severity"] = severity
+	}
+
+	var from, to time.Time
+	if value := c.QueryParam("from"); value != "" {
+		parsed, _, err := parseAuditTime(value)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "تاریخ شروع نامعتبر است (YYYY-MM-DD یا RFC3339)")
+		}
+		from = parsed
+		filters["from"] = from
+	}
+	if value := c.QueryParam("to"); value != "" {
+		parsed, dateOnly, err := parseAuditTime(value)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "تاریخ پایان نامعتبر است (YYYY-MM-DD یا RFC3339)")
+		}
+		if dateOnly {
+			parsed = parsed.AddDate(0, 0, 1) // include the whole day
+		}
+		to = parsed
+		filters["to"] = to
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "تاریخ شروع باید قبل از تاریخ پایان باشد")
+	}
+
+	return filters, nil
+}
+
+// parseAuditTime accepts a UTC date or an RFC 3339 timestamp
+func parseAuditTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
 // DeleteAllAuditLogs deletes all audit logs (admin only)
 func (h *AuditHandler) DeleteAllAuditLogs(c echo.Context) error {
 	userID, err := middleware.GetUserID(c)
@@ -107,8 +231,13 @@ func (h *AuditHandler) ExportAuditLogs(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
 	}
 
-	// Get all logs without pagination
-	logs, _, err := h.auditRepo.GetAuditLogs(100000, 0, nil)
+	filters, err := parseAuditFilters(c)
+	if err != nil {
+		return err
+	}
+
+	// Get all matching logs without pagination
+	logs, _, err := h.auditRepo.GetAuditLogs(100000, 0, filters)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت لاگ‌ها")
 	}
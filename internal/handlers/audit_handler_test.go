@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseAuditFilters(t *testing.T) {
+	e := echo.New()
+	parse := func(query string) (map[string]interface{}, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/audit-logs?"+query, nil)
+		return parseAuditFilters(e.NewContext(req, httptest.NewRecorder()))
+	}
+
+	filters, err := parse("user_id=7&action=login&resource=auth&success=false&severity=warning&from=2025-03-01&to=2025-03-02")
+	if err != nil {
+		t.Fatalf("parseAuditFilters: %v", err)
+	}
+	want := map[string]interface{}{
+		"user_id":  7,
+		"action":   "login",
+		"resource": "auth",
+		"success":  false,
+		"severity": "warning",
+		"from":     time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		"to":       time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), // a date-only end includes that day
+	}
+	if len(filters) != len(want) {
+		t.Fatalf("filters = %v, want %v", filters, want)
+	}
+	for key, value := range want {
+		if filters[key] != value {
+			t.Errorf("%s = %v, want %v", key, filters[key], value)
+		}
+	}
+
+	filters, err = parse("to=2025-03-02T10:00:00Z")
+	if err != nil || filters["to"] != time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC) {
+		t.Errorf("RFC 3339 end = %v, %v; want it unchanged", filters["to"], err)
+	}
+
+	for _, query := range []string{
+		"user_id=0",
+		"user_id=abc",
+		"success=maybe",
+		"severity=debug",
+		"from=03/01/2025",
+		"to=tomorrow",
+		"from=2025-03-02&to=2025-03-01",
+		"from=2025-03-02T00:00:00Z&to=2025-03-02T00:00:00Z",
+	} {
+		_, err := parse(query)
+		he, ok := err.(*echo.HTTPError)
+		if !ok || he.Code != http.StatusBadRequest {
+			t.Errorf("%s: err = %v, want 400", query, err)
+		}
+	}
+}
+
+func TestUserAuditLogsReturnsOnlyThatUser(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	bob := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	for _, userID := range []int{alice.ID, bob.ID, alice.ID, bob.ID} {
+		if err := env.audit.LogAction(userID, "login", "auth", "203.0.113.7", "test", true, "login"); err != nil {
+			t.Fatalf("LogAction: %v", err)
+		}
+	}
+	if err := env.audit.LogActionWithNullUser("login_rate_limited", "auth", "203.0.113.7", "test", false, "anonymous"); err != nil {
+		t.Fatalf("LogActionWithNullUser: %v", err)
+	}
+
+	h := NewAuditHandler(env.audit)
+	e := newEcho()
+	e.GET("/users/:id/audit-logs", h.GetUserAuditLogs, withUser(env.admin(t)))
+
+	// A user_id in the query must not widen the history to someone else
+	path := fmt.Sprintf("/users/%d/audit-logs?user_id=%d", alice.ID, bob.ID)
+	rec := doJSON(e, http.MethodGet, path, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data  []models.AuditLog `json:"data"`
+		Total int               `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Total != 2 || len(resp.Data) != 2 {
+		t.Fatalf("got %d of %d rows, want 2 of 2", len(resp.Data), resp.Total)
+	}
+	for _, log := range resp.Data {
+		if log.UserID == nil || *log.UserID != alice.ID {
+			t.Errorf("row %d belongs to %v, want %d", log.ID, log.UserID, alice.ID)
+		}
+	}
+
+	if rec := doJSON(e, http.MethodGet, "/users/0/audit-logs", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid id: status %d, want 400", rec.Code)
+	}
+}
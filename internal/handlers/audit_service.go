@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"Monex/internal/middleware"
 	"Monex/internal/repository"
 
 	"github.com/labstack/echo/v4"
@@ -31,7 +32,7 @@ func (s *AuditService) LogAction(
 	userAgent := c.Request().Header.Get("User-Agent")
 
 	// Log to database
-	return s.auditRepo.LogAction(userID, action, resource, ipAddress, userAgent, success, details)
+	return s.auditRepo.LogAction(userID, action, resource, ipAddress, userAgent, success, withRequestID(c, details))
 }
 
 // LogActionNoAuth logs actions for non-authenticated requests (login attempts)
@@ -45,5 +46,13 @@ func (s *AuditService) LogActionNoAuth(
 	ipAddress := c.RealIP()
 	userAgent := c.Request().Header.Get("User-Agent")
 
-	return s.auditRepo.LogAction(0, action, resource, ipAddress, userAgent, success, details)
+	return s.auditRepo.LogAction(0, action, resource, ipAddress, userAgent, success, withRequestID(c, details))
+}
+
+// withRequestID prefixes audit details with the request id so rows can be matched to logs
+func withRequestID(c echo.Context, details string) string {
+	if requestID := middleware.GetRequestID(c); requestID != "" {
+		return "RequestID: " + requestID + ", " + details
+	}
+	return details
 }
@@ -2,20 +2,28 @@
 package handlers
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/mail"
 	"strings"
 	"sync"
 	"time"
 
 	"Monex/config"
+	"Monex/internal/challenge"
+	"Monex/internal/logger"
+	"Monex/internal/metrics"
 	"Monex/internal/middleware"
 	"Monex/internal/models"
+	"Monex/internal/notifier"
 	"Monex/internal/repository"
+	"Monex/internal/useragent"
 
 	"github.com/labstack/echo/v4"
 	"golang.org/x/time/rate"
@@ -23,8 +31,11 @@ import (
 
 // ✅ ENHANCED: Global login attempt tracker with IP + Username combination
 type LoginAttemptTracker struct {
-	mu       sync.RWMutex
-	attempts map[string]*AttemptInfo // key: "ip:username"
+	mu         sync.RWMutex
+	attempts   map[string]*AttemptInfo // key: "ip:username"
+	ipFailures map[string]*AttemptInfo // key: ip, across all usernames
+	ttl        time.Duration           // entries idle this long are dropped
+	maxEntries int                     // per map
 }
 
 type AttemptInfo struct {
@@ -34,12 +45,34 @@ type AttemptInfo struct {
 	limiter      *rate.Limiter
 }
 
+// loginAttemptBurst is how many logins an IP+username pair may try in quick
+// succession; one more attempt is allowed every 10 seconds
+const loginAttemptBurst = 3
+
 var globalLoginTracker = &LoginAttemptTracker{
-	attempts: make(map[string]*AttemptInfo),
+	attempts:   make(map[string]*AttemptInfo),
+	ipFailures: make(map[string]*AttemptInfo),
+	ttl:        time.Hour,
+	maxEntries: 10000,
 }
 
+// ConfigureLoginTracker sets how long login attempts are remembered and how
+// many keys are tracked. Values <= 0 keep the current setting.
+func ConfigureLoginTracker(ttl time.Duration, maxEntries int) {
+	globalLoginTracker.mu.Lock()
+	defer globalLoginTracker.mu.Unlock()
+
+	if ttl > 0 {
+		globalLoginTracker.ttl = ttl
+	}
+	if maxEntries > 0 {
+		globalLoginTracker.maxEntries = maxEntries
+	}
+}
+
+// getKey identifies an IP+username pair; IPv6 clients are tracked per /64
 func (lt *LoginAttemptTracker) getKey(ip, username string) string {
-	return fmt.Sprintf("%s:%s", ip, username)
+	return fmt.Sprintf("%s:%s", middleware.RateLimitKey(ip), username)
 }
 
 func (lt *LoginAttemptTracker) isBlocked(ip, username string) (bool, time.Duration) {
@@ -60,7 +93,9 @@ func (lt *LoginAttemptTracker) isBlocked(ip, username string) (bool, time.Durati
 	return false, 0
 }
 
-func (lt *LoginAttemptTracker) recordFailure(ip, username string) {
+// recordFailure counts a failed login and returns the block it started, or 0
+// when this failure didn't block the IP+username pair
+func (lt *LoginAttemptTracker) recordFailure(ip, username string) time.Duration {
 	lt.mu.Lock()
 	defer lt.mu.Unlock()
 
@@ -68,8 +103,9 @@ func (lt *LoginAttemptTracker) recordFailure(ip, username string) {
 	info, exists := lt.attempts[key]
 
 	if !exists {
+		lt.makeRoom(lt.attempts)
 		info = &AttemptInfo{
-			limiter: rate.NewLimiter(rate.Every(10*time.Second), 3),
+			limiter: rate.NewLimiter(rate.Every(10*time.Second), loginAttemptBurst),
 		}
 		lt.attempts[key] = info
 	}
@@ -77,24 +113,54 @@ func (lt *LoginAttemptTracker) recordFailure(ip, username string) {
 	info.count++
 	info.lastAttempt = time.Now()
 
+	ipKey := middleware.RateLimitKey(ip)
+	ipInfo, exists := lt.ipFailures[ipKey]
+	if !exists {
+		lt.makeRoom(lt.ipFailures)
+		ipInfo = &AttemptInfo{}
+		lt.ipFailures[ipKey] = ipInfo
+	}
+	ipInfo.count++
+	ipInfo.lastAttempt = time.Now()
+
 	// Progressive blocking
+	var block time.Duration
 	if info.count >= 5 {
-		info.blockedUntil = time.Now().Add(15 * time.Minute)
-		log.Printf("[SECURITY] Login blocked - IP: %s, Username: %s, Attempts: %d", ip, username, info.count)
+		block = 15 * time.Minute
+		logger.Security("Login blocked", "ip", ip, "username", username, "attempts", info.count)
 	} else if info.count >= 3 {
-		info.blockedUntil = time.Now().Add(5 * time.Minute)
+		block = 5 * time.Minute
+	}
+	if block > 0 {
+		info.blockedUntil = time.Now().Add(block)
 	}
+	return block
 }
 
+// resetAttempts forgets the failures of an IP+username pair after a
+// successful login. The IP's failures across usernames are left to expire, so
+// an attacker can't clear them by logging into an account of their own.
 func (lt *LoginAttemptTracker) resetAttempts(ip, username string) {
 	lt.mu.Lock()
 	defer lt.mu.Unlock()
 
-	key := lt.getKey(ip, username)
-	delete(lt.attempts, key)
+	delete(lt.attempts, lt.getKey(ip, username))
+}
+
+// failuresFromIP returns the recent failed logins from ip across all usernames
+func (lt *LoginAttemptTracker) failuresFromIP(ip string) int {
+	lt.mu.RLock()
+	defer lt.mu.RUnlock()
+
+	if info, exists := lt.ipFailures[middleware.RateLimitKey(ip)]; exists {
+		return info.count
+	}
+	return 0
 }
 
-func (lt *LoginAttemptTracker) checkRateLimit(ip, username string) bool {
+// checkRateLimit spends one login attempt for the IP+username pair and
+// returns the attempts left
+func (lt *LoginAttemptTracker) checkRateLimit(ip, username string) (bool, middleware.RateLimitStatus) {
 	lt.mu.Lock()
 	defer lt.mu.Unlock()
 
@@ -102,35 +168,79 @@ func (lt *LoginAttemptTracker) checkRateLimit(ip, username string) bool {
 	info, exists := lt.attempts[key]
 
 	if !exists {
+		lt.makeRoom(lt.attempts)
 		info = &AttemptInfo{
-			limiter: rate.NewLimiter(rate.Every(10*time.Second), 3),
+			limiter: rate.NewLimiter(rate.Every(10*time.Second), loginAttemptBurst),
 		}
 		lt.attempts[key] = info
 	}
+	info.lastAttempt = time.Now() // keeps the limiter alive until its own TTL
 
-	return info.limiter.Allow()
+	allowed := info.limiter.Allow()
+	return allowed, middleware.LimiterStatus(info.limiter)
 }
 
-// Cleanup old entries
+// Cleanup old entries, each on its own TTL
 func (lt *LoginAttemptTracker) cleanup() {
 	lt.mu.Lock()
 	defer lt.mu.Unlock()
 
+	lt.dropExpired(lt.attempts)
+	lt.dropExpired(lt.ipFailures)
+}
+
+// dropExpired removes entries idle past the TTL that aren't blocking anyone.
+// Callers must hold lt.mu.
+func (lt *LoginAttemptTracker) dropExpired(entries map[string]*AttemptInfo) {
 	now := time.Now()
-	for key, info := range lt.attempts {
-		if now.Sub(info.lastAttempt) > 1*time.Hour {
-			delete(lt.attempts, key)
+	for key, info := range entries {
+		if now.Sub(info.lastAttempt) > lt.ttl && now.After(info.blockedUntil) {
+			delete(entries, key)
 		}
 	}
 }
 
-func init() {
-	// Start cleanup routine
+// makeRoom frees a slot when entries is full. Expired entries go first, then
+// the least recently seen one that isn't blocked, so flooding the tracker with
+// new keys can't lift existing blocks. Callers must hold lt.mu.
+func (lt *LoginAttemptTracker) makeRoom(entries map[string]*AttemptInfo) {
+	if len(entries) < lt.maxEntries {
+		return
+	}
+
+	lt.dropExpired(entries)
+	if len(entries) < lt.maxEntries {
+		return
+	}
+
+	now := time.Now()
+	var oldestKey string
+	var oldest time.Time
+	for key, info := range entries {
+		if now.Before(info.blockedUntil) {
+			continue
+		}
+		if oldestKey == "" || info.lastAttempt.Before(oldest) {
+			oldestKey, oldest = key, info.lastAttempt
+		}
+	}
+	if oldestKey != "" {
+		delete(entries, oldestKey)
+	}
+}
+
+// StartLoginTrackerCleanup periodically drops stale login attempts until ctx is cancelled
+func StartLoginTrackerCleanup(ctx context.Context, interval time.Duration) {
 	go func() {
-		ticker := time.NewTicker(15 * time.Minute)
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
-		for range ticker.C {
-			globalLoginTracker.cleanup()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				globalLoginTracker.cleanup()
+			}
 		}
 	}()
 }
@@ -140,8 +250,15 @@ type AuthHandler struct {
 	auditRepo          *repository.AuditRepository
 	sessionRepo        *repository.SessionRepository
 	tokenBlacklistRepo *repository.TokenBlacklistRepository
+	loginAttemptRepo   *repository.LoginAttemptRepository
 	jwtManager         *middleware.JWTManager
+	notifier           notifier.Notifier
+	challenge          *challenge.Issuer // nil when login challenges are disabled
 	config             *config.Config
+
+	// Unknown usernames are checked against this hash so they cost the same
+	// bcrypt work as real accounts and can't be told apart by response time
+	dummyUser *models.User
 }
 
 func NewAuthHandler(
@@ -149,22 +266,52 @@ func NewAuthHandler(
 	auditRepo *repository.AuditRepository,
 	sessionRepo *repository.SessionRepository,
 	tokenBlacklistRepo *repository.TokenBlacklistRepository,
+	loginAttemptRepo *repository.LoginAttemptRepository,
 	jwtManager *middleware.JWTManager,
+	securityNotifier notifier.Notifier,
 	cfg *config.Config,
-) *AuthHandler {
+) (*AuthHandler, error) {
+	var challengeIssuer *challenge.Issuer
+	if cfg.Login.ChallengeEnabled {
+		issuer, err := challenge.NewIssuer(cfg.Login.ChallengeDifficulty, cfg.Login.ChallengeTTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize login challenges: %w", err)
+		}
+		challengeIssuer = issuer
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to prepare dummy password hash: %w", err)
+	}
+	dummyUser := &models.User{}
+	if err := dummyUser.SetPassword(hex.EncodeToString(secret), cfg.Security.BcryptCost); err != nil {
+		return nil, fmt.Errorf("failed to prepare dummy password hash: %w", err)
+	}
+
 	return &AuthHandler{
 		userRepo:           userRepo,
 		auditRepo:          auditRepo,
 		sessionRepo:        sessionRepo,
 		tokenBlacklistRepo: tokenBlacklistRepo,
+		loginAttemptRepo:   loginAttemptRepo,
 		jwtManager:         jwtManager,
+		notifier:           securityNotifier,
+		challenge:          challengeIssuer,
 		config:             cfg,
-	}
+		dummyUser:          dummyUser,
+	}, nil
 }
 
 type LoginRequest struct {
-	Username string `json:"username" validate:"required"`
-	Password string `json:"password" validate:"required"`
+	Username          string `json:"username" validate:"required"`
+	Password          string `json:"password" validate:"required"`
+	ChallengeToken    string `json:"challenge_token"`    // required after repeated failures
+	ChallengeSolution string `json:"challenge_solution"` // proof-of-work for ChallengeToken
+
+	// Longer-lived refresh token when true, shorter when false; omitted
+	// keeps JWT_REFRESH_DURATION
+	RememberMe *bool `json:"remember_me"`
 }
 
 type LoginResponse struct {
@@ -174,6 +321,9 @@ type LoginResponse struct {
 	ExpiresIn    int                  `json:"expires_in"`
 	SessionID    int                  `json:"session_id"`
 	DeviceID     string               `json:"device_id"`
+
+	// When the refresh token and the session expire
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
 }
 
 // ✅ ENHANCED: Login with comprehensive security checks
@@ -190,6 +340,8 @@ func (h *AuthHandler) Login(c echo.Context) error {
 
 	// ✅ Check if IP+Username is blocked
 	if blocked, remaining := globalLoginTracker.isBlocked(clientIP, username); blocked {
+		middleware.SetRateLimitHeaders(c, middleware.RateLimitStatus{Limit: loginAttemptBurst, Reset: remaining})
+		h.recordLoginAttempt(clientIP, userAgent, username, false, "blocked")
 		h.auditRepo.LogAction(0, "login_blocked", "auth", clientIP, userAgent, false,
 			fmt.Sprintf("Login blocked for %s - Remaining: %v", username, remaining))
 
@@ -197,8 +349,11 @@ func (h *AuthHandler) Login(c echo.Context) error {
 			fmt.Sprintf("تلاش‌های ناموفق زیاد. لطفا %d دقیقه صبر کنید", int(remaining.Minutes())+1))
 	}
 
-	// ✅ Rate limiting check
-	if !globalLoginTracker.checkRateLimit(clientIP, username) {
+	// ✅ Rate limiting check; the headers let the UI show the attempts left
+	allowed, status := globalLoginTracker.checkRateLimit(clientIP, username)
+	middleware.SetRateLimitHeaders(c, status)
+	if !allowed {
+		h.recordLoginAttempt(clientIP, userAgent, username, false, "rate_limited")
 		h.auditRepo.LogAction(0, "login_rate_limited", "auth", clientIP, userAgent, false,
 			fmt.Sprintf("Rate limit exceeded for %s", username))
 
@@ -206,47 +361,93 @@ func (h *AuthHandler) Login(c echo.Context) error {
 			"درخواست‌های متوالی زیاد. لطفا کمی صبر کنید")
 	}
 
+	// ✅ Proof-of-work after repeated failures from this IP, checked before the password
+	if h.challenge != nil && globalLoginTracker.failuresFromIP(clientIP) >= h.config.Login.ChallengeThreshold {
+		if err := h.challenge.Verify(req.ChallengeToken, req.ChallengeSolution, clientIP); err != nil {
+			return h.challengeRequired(c, clientIP, userAgent, username, req.ChallengeToken != "", err)
+		}
+	}
+
 	// ✅ Find user
 	user, err := h.userRepo.GetByUsername(username)
 	if err != nil {
+		h.dummyUser.CheckPassword(req.Password)
 		globalLoginTracker.recordFailure(clientIP, username)
 
+		h.recordLoginAttempt(clientIP, userAgent, username, false, "unknown_user")
 		h.auditRepo.LogAction(0, "login_failed", "auth", clientIP, userAgent, false,
 			fmt.Sprintf("User not found: %s", username))
 
-		return echo.NewHTTPError(http.StatusUnauthorized, "نام کاربری یا رمز عبور نادرست است")
+		return invalidCredentials()
 	}
 
 	// ✅ Validate password
 	if !user.CheckPassword(req.Password) {
-		globalLoginTracker.recordFailure(clientIP, username)
+		if block := globalLoginTracker.recordFailure(clientIP, username); block > 0 && h.config.Login.NotifyLockout {
+			h.notifyLockout(user.ID, clientIP, block)
+		}
+
+		// ✅ Counted atomically so parallel failures aren't lost. Failures
+		// against an account that is already locked don't add further bans.
+		lockedNow := user.PermanentlyLocked ||
+			(user.Locked && (user.LockedUntil == nil || time.Now().Before(*user.LockedUntil)))
+		if !lockedNow {
+			if count, err := h.userRepo.IncrementFailedAttempts(user.ID); err != nil {
+				slog.Warn("Failed to count failed login", "user_id", user.ID, "error", err)
+			} else if limit := h.config.Login.MaxFailedAttempts; limit > 0 && count >= limit {
+				h.lockAfterFailedAttempts(user, clientIP, userAgent, count)
+			}
+		}
 
+		h.recordLoginAttempt(clientIP, userAgent, username, false, "invalid_password")
 		h.auditRepo.LogAction(user.ID, "login_failed", "auth", clientIP, userAgent, false,
 			"Invalid password")
 
-		return echo.NewHTTPError(http.StatusUnauthorized, "نام کاربری یا رمز عبور نادرست است")
+		return invalidCredentials()
 	}
 
 	// ✅ Check if account is active
 	if !user.Active {
+		h.recordLoginAttempt(clientIP, userAgent, username, false, "account_disabled")
 		h.auditRepo.LogAction(user.ID, "login_rejected", "auth", clientIP, userAgent, false,
 			"Account disabled")
 
-		return echo.NewHTTPError(http.StatusForbidden,
+		return h.rejectAccount(clientIP, username, http.StatusForbidden,
 			"حساب کاربری شما غیرفعال است. با پشتیبانی تماس بگیرید")
 	}
 
 	// ✅ Check if permanently locked
 	if user.PermanentlyLocked {
+		h.recordLoginAttempt(clientIP, userAgent, username, false, "account_locked")
 		h.auditRepo.LogAction(user.ID, "login_rejected", "auth", clientIP, userAgent, false,
 			"Account permanently locked")
 
-		return echo.NewHTTPError(http.StatusForbidden,
+		return h.rejectAccount(clientIP, username, http.StatusForbidden,
 			"حساب کاربری شما به دلیل نقض امنیتی مسدود شده است")
 	}
 
+	// ✅ Temporary locks block new logins until they expire
+	if user.Locked && (user.LockedUntil == nil || time.Now().Before(*user.LockedUntil)) {
+		h.recordLoginAttempt(clientIP, userAgent, username, false, "account_locked")
+		h.auditRepo.LogAction(user.ID, "login_rejected", "auth", clientIP, userAgent, false,
+			"Account temporarily locked")
+
+		return h.rejectAccount(clientIP, username, http.StatusForbidden,
+			"حساب کاربری شما موقتاً قفل است. بعداً دوباره تلاش کنید")
+	}
+
 	// ✅ Reset login attempts on successful authentication
 	globalLoginTracker.resetAttempts(clientIP, username)
+	if user.FailedAttempts > 0 {
+		if err := h.userRepo.ResetFailedAttempts(user.ID); err != nil {
+			slog.Warn("Failed to reset failed logins", "user_id", user.ID, "error", err)
+		} else {
+			user.FailedAttempts = 0
+		}
+	}
+
+	// ✅ Upgrade hashes created with an older, weaker bcrypt cost
+	h.upgradePasswordHash(user, req.Password)
 
 	// ✅ Generate tokens
 	accessToken, err := h.jwtManager.GenerateAccessToken(user)
@@ -254,16 +455,16 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ایجاد توکن")
 	}
 
-	refreshToken, err := h.jwtManager.GenerateRefreshToken(user)
+	// ✅ remember_me picks the refresh lifetime; the session expires with it
+	refreshDuration := h.jwtManager.LoginRefreshDuration(user.Role, req.RememberMe)
+	refreshExpiresAt := time.Now().Add(refreshDuration).UTC()
+	refreshToken, err := h.jwtManager.GenerateRefreshToken(user, refreshDuration)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ایجاد توکن")
 	}
 
 	// ✅ Get or create device_id
-	deviceID := c.Request().Header.Get("X-Device-ID")
-	if deviceID == "" {
-		deviceID = c.QueryParam("device_id")
-	}
+	deviceID := middleware.DeviceID(c)
 	if deviceID == "" {
 		deviceID, err = generateSecureDeviceID()
 		if err != nil {
@@ -271,7 +472,7 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		}
 	}
 
-	deviceInfo := ParseUserAgent(userAgent)
+	deviceInfo := useragent.Parse(userAgent)
 
 	// ✅ Check for existing active sessions
 	existingSessions, _ := h.sessionRepo.GetUserSessions(user.ID)
@@ -283,29 +484,28 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		}
 	}
 
-	// ✅ Create or update session
-	session, err := h.sessionRepo.CreateOrUpdateSession(
-		user.ID,
-		deviceID,
-		deviceInfo.DeviceName,
-		deviceInfo.Browser,
-		deviceInfo.OS,
-		clientIP,
-		accessToken,
-		refreshToken,
-		time.Now().Add(h.jwtManager.Config().RefreshDuration),
-	)
+	// ✅ Create or update session; many new ones in a short time suggest
+	// stolen credentials
+	session, locked, err := h.createSession(user, deviceID, deviceInfo, clientIP, userAgent,
+		accessToken, refreshToken, refreshExpiresAt)
 	if err != nil {
+		h.recordLoginAttempt(clientIP, userAgent, username, false, "session_error")
 		h.auditRepo.LogAction(user.ID, "login_failed", "auth", clientIP, userAgent, false,
 			"Session creation failed: "+err.Error())
 
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ایجاد سشن")
 	}
+	if locked {
+		h.recordLoginAttempt(clientIP, userAgent, username, false, "session_burst")
+		return h.rejectAccount(clientIP, username, http.StatusForbidden,
+			"به دلیل ورودهای مشکوک، حساب کاربری شما تا بررسی مدیر مسدود شد")
+	}
 
 	// ✅ Register session for real-time tracking
 	InvalidationHub.RegisterSession(session.ID)
 
 	// ✅ Audit log
+	h.recordLoginAttempt(clientIP, userAgent, username, true, "")
 	h.auditRepo.LogAction(user.ID, "login_success", "auth", clientIP, userAgent, true,
 		fmt.Sprintf("Login successful from %s (%s)", deviceInfo.DeviceName, clientIP))
 
@@ -317,20 +517,149 @@ func (h *AuthHandler) Login(c echo.Context) error {
 			map[string]interface{}{
 				"device":     deviceInfo.DeviceName,
 				"ip_address": clientIP,
-				"timestamp":  time.Now(),
+				"timestamp":  time.Now().UTC(),
 			})
+
+		notifier.Dispatch(h.notifier, notifier.Event{
+			Type:      notifier.EventNewDeviceLogin,
+			UserID:    user.ID,
+			Username:  user.Username,
+			IPAddress: clientIP,
+		})
+	}
+
+	// A new session gets its own device_id, which the client must use from now on
+	if h.config.Security.DeviceIDCookie {
+		middleware.SetDeviceIDCookie(c, session.DeviceID, h.config.TLS.Enabled())
 	}
 
 	return c.JSON(http.StatusOK, LoginResponse{
 		User:         user.ToResponse(),
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    int(h.jwtManager.Config().AccessDuration.Seconds()),
+		ExpiresIn:    int(h.jwtManager.AccessDurationFor(user.Role).Seconds()),
 		SessionID:    session.ID,
-		DeviceID:     deviceID,
+		DeviceID:     session.DeviceID,
+
+		RefreshExpiresAt: refreshExpiresAt,
 	})
 }
 
+// invalidCredentials is the answer to a wrong username or password
+func invalidCredentials() error {
+	return echo.NewHTTPError(http.StatusUnauthorized, "نام کاربری یا رمز عبور نادرست است")
+}
+
+// rejectAccount refuses a correct login for an account that can't sign in.
+// With HideUserEnumeration it is indistinguishable from a wrong password,
+// including counting as a failure so rate limiting matches unknown users.
+func (h *AuthHandler) rejectAccount(clientIP, username string, status int, message string) error {
+	if !h.config.Login.HideUserEnumeration {
+		return echo.NewHTTPError(status, message)
+	}
+	globalLoginTracker.recordFailure(clientIP, username)
+	return invalidCredentials()
+}
+
+// challengeRequired rejects a login that lacks a valid proof-of-work and
+// hands out a fresh challenge to solve
+func (h *AuthHandler) challengeRequired(c echo.Context, clientIP, userAgent, username string, attempted bool, verifyErr error) error {
+	code := "challenge_required"
+	reason := "challenge_required"
+	if attempted {
+		code = "challenge_failed"
+		reason = "challenge_failed"
+		h.auditRepo.LogAction(0, "login_challenge_failed", "auth", clientIP, userAgent, false,
+			fmt.Sprintf("Invalid login challenge for %s: %v", username, verifyErr))
+	}
+	h.recordLoginAttempt(clientIP, userAgent, username, false, reason)
+
+	issued, err := h.challenge.Issue(clientIP)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ایجاد چالش امنیتی")
+	}
+
+	return echo.NewHTTPError(http.StatusPreconditionRequired, map[string]interface{}{
+		"message":   "برای ادامه، چالش امنیتی باید حل شود",
+		"code":      code,
+		"challenge": issued,
+	})
+}
+
+// recordLoginAttempt counts the attempt in metrics and persists it for login statistics
+func (h *AuthHandler) recordLoginAttempt(ip, userAgent, username string, success bool, reason string) {
+	metrics.RecordLogin(success)
+
+	if h.loginAttemptRepo == nil {
+		return
+	}
+	if err := h.loginAttemptRepo.Record(username, ip, userAgent, success, reason); err != nil {
+		slog.Warn("Failed to record login attempt", "error", err)
+	}
+}
+
+// notifyLockout tells the user's live connections that logins were blocked
+// after repeated failures, so the UI can show it without polling
+func (h *AuthHandler) notifyLockout(userID int, clientIP string, block time.Duration) {
+	lockedUntil := time.Now().Add(block)
+	SendAccountStatusChange(userID, "temporarily_locked",
+		fmt.Sprintf("به دلیل تلاش‌های ناموفق، ورود به حساب شما از %s به مدت %d دقیقه مسدود شد", clientIP, int(block.Minutes())),
+		map[string]interface{}{
+			"ip_address":        clientIP,
+			"locked_until":      lockedUntil.UTC(),
+			"remaining_seconds": int(block.Seconds()),
+		})
+}
+
+// lockAfterFailedAttempts locks the account once it reaches
+// MAX_FAILED_ATTEMPTS: for TEMP_BAN_DURATION, or permanently for a non-admin
+// reaching MAX_TEMP_BANS bans. Existing sessions keep working until the
+// user status check sees a permanent lock.
+func (h *AuthHandler) lockAfterFailedAttempts(user *models.User, clientIP, userAgent string, attempts int) {
+	banDuration := h.config.Login.TempBanDuration
+	permanent, err := h.userRepo.LockAfterFailedAttempts(user.ID, banDuration, h.config.Login.MaxTempBans)
+	if err != nil {
+		slog.Warn("Failed to lock account after failed logins", "user_id", user.ID, "error", err)
+		return
+	}
+
+	lockType := "temporarily"
+	if permanent {
+		lockType = "permanently"
+	}
+	logger.Security("Account locked after failed logins",
+		"user_id", user.ID, "ip", clientIP, "attempts", attempts, "permanent", permanent)
+	_ = h.auditRepo.LogActionWithSeverity(user.ID, "account_locked", "auth", clientIP, userAgent, true,
+		fmt.Sprintf("Account %s locked after %d failed logins", lockType, attempts), "warning")
+
+	notifier.Dispatch(h.notifier, notifier.Event{
+		Type:      notifier.EventAccountLocked,
+		UserID:    user.ID,
+		Username:  user.Username,
+		IPAddress: clientIP,
+	})
+}
+
+// upgradePasswordHash transparently rehashes the password at the configured cost
+func (h *AuthHandler) upgradePasswordHash(user *models.User, password string) {
+	cost := h.config.Security.BcryptCost
+	if !user.NeedsRehash(cost) {
+		return
+	}
+
+	if err := user.SetPassword(password, cost); err != nil {
+		slog.Warn("Failed to rehash password", "user_id", user.ID, "error", err)
+		return
+	}
+
+	if err := h.userRepo.UpdatePassword(user.ID, user.Password); err != nil {
+		slog.Warn("Failed to store rehashed password", "user_id", user.ID, "error", err)
+		return
+	}
+
+	logger.Security("Password hash upgraded", "user_id", user.ID, "cost", cost)
+}
+
 func generateSecureDeviceID() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
@@ -340,18 +669,269 @@ func generateSecureDeviceID() (string, error) {
 	return hex.EncodeToString(hash[:]), nil
 }
 
-// RefreshToken, Logout, Register methods remain similar but with enhanced logging
+// TokenIntrospectionResponse describes the caller's current access token
+type TokenIntrospectionResponse struct {
+	UserID           int       `json:"user_id"`
+	Username         string    `json:"username"`
+	Role             string    `json:"role"`
+	TokenID          string    `json:"jti,omitempty"`
+	Algorithm        string    `json:"algorithm"`
+	IssuedAt         time.Time `json:"issued_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	ExpiresInSeconds int       `json:"expires_in_seconds"`
+	Blacklisted      bool      `json:"blacklisted"`
+}
+
+// Introspect returns the claims of the token used for this request
+func (h *AuthHandler) Introspect(c echo.Context) error {
+	claims, ok := c.Get("claims").(*middleware.Claims)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	tokenString := middleware.ExtractBearerToken(c)
+
+	response := TokenIntrospectionResponse{
+		UserID:      claims.UserID,
+		Username:    claims.Username,
+		Role:        claims.Role,
+		TokenID:     claims.ID,
+		Algorithm:   h.jwtManager.SigningAlgorithm(),
+		Blacklisted: h.jwtManager.IsRevoked(tokenString, claims),
+	}
+
+	if claims.IssuedAt != nil {
+		response.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.ExpiresAt != nil {
+		response.ExpiresAt = claims.ExpiresAt.Time
+		response.ExpiresInSeconds = int(time.Until(claims.ExpiresAt.Time).Seconds())
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshResponse struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresIn        int       `json:"expires_in"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// RefreshToken trades a refresh token for a new access and refresh token
+// pair. Only refresh tokens are accepted, and each one only once: the
+// session's stored refresh token is rotated, and the session keeps its
+// original expiry so refreshing never extends a login.
 func (h *AuthHandler) RefreshToken(c echo.Context) error {
-	// Implementation with enhanced audit logging
-	return nil
+	clientIP := c.RealIP()
+	userAgent := c.Request().Header.Get("User-Agent")
+
+	var req RefreshRequest
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "توکن تازه‌سازی الزامی است")
+	}
+
+	claims, err := h.jwtManager.ValidateTokenType(req.RefreshToken, middleware.TokenTypeRefresh)
+	if errors.Is(err, middleware.ErrWrongTokenType) {
+		logger.Security("Non-refresh token used for refresh", "ip", clientIP)
+		return echo.NewHTTPError(http.StatusUnauthorized, map[string]interface{}{
+			"message": "نوع توکن نامعتبر است",
+			"code":    "wrong_token_type",
+		})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "توکن تازه‌سازی نامعتبر یا منقضی شده است")
+	}
+
+	// ✅ The token must still be the session's current refresh token
+	session, err := h.sessionRepo.GetByRefreshTokenHash(h.sessionRepo.HashToken(req.RefreshToken))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && session.UserID != claims.UserID) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "توکن تازه‌سازی نامعتبر یا منقضی شده است")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در تازه‌سازی توکن").SetInternal(err)
+	}
+
+	user, err := h.userRepo.GetByID(claims.UserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+	if !user.Active {
+		return echo.NewHTTPError(http.StatusForbidden, "حساب کاربری غیرفعال است")
+	}
+	if user.PermanentlyLocked {
+		return echo.NewHTTPError(http.StatusForbidden, "حساب کاربری مسدود شده است")
+	}
+
+	accessToken, err := h.jwtManager.GenerateAccessToken(user)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ایجاد توکن")
+	}
+	refreshToken, err := h.jwtManager.GenerateRefreshToken(user, time.Until(session.ExpiresAt))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ایجاد توکن")
+	}
+
+	err = h.sessionRepo.RotateTokens(session.ID, req.RefreshToken, accessToken, refreshToken,
+		h.jwtManager.TokenID(accessToken), h.jwtManager.TokenID(refreshToken))
+	if errors.Is(err, repository.ErrConflict) {
+		// A concurrent refresh spent this token first
+		return echo.NewHTTPError(http.StatusUnauthorized, "توکن تازه‌سازی نامعتبر یا منقضی شده است")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در تازه‌سازی توکن").SetInternal(err)
+	}
+
+	middleware.Blacklist.AddClaims(req.RefreshToken, claims)
+	if claims.ExpiresAt != nil {
+		if h.tokenBlacklistRepo != nil && claims.ID != "" {
+			if err := h.tokenBlacklistRepo.BlacklistJTI(user.ID, claims.ID, middleware.TokenTypeRefresh,
+				claims.ExpiresAt.Time, fmt.Sprintf("Refresh token spent for session %d", session.ID)); err != nil {
+				slog.Warn("Failed to blacklist spent refresh token", "session_id", session.ID, "error", err)
+			}
+		}
+	}
+
+	_ = h.auditRepo.LogAction(user.ID, "token_refresh", "auth", clientIP, userAgent, true,
+		fmt.Sprintf("Tokens refreshed for session %d", session.ID))
+
+	return c.JSON(http.StatusOK, RefreshResponse{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int(h.jwtManager.AccessDurationFor(user.Role).Seconds()),
+		RefreshExpiresAt: session.ExpiresAt,
+	})
 }
 
+// Logout ends the current device's session: its tokens are blacklisted, the
+// session is deleted and the device_id cookie is cleared. The device comes
+// from the cookie or X-Device-ID; the bearer token's session is used when
+// neither matches.
 func (h *AuthHandler) Logout(c echo.Context) error {
-	// Implementation with enhanced audit logging
-	return nil
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	token := middleware.ExtractBearerToken(c)
+	session, err := h.sessionRepo.GetByAccessTokenHash(h.sessionRepo.HashToken(token))
+	if err != nil {
+		if deviceID := middleware.DeviceID(c); deviceID != "" {
+			session, err = h.sessionRepo.FindExistingSession(userID, deviceID)
+		}
+	}
+
+	if err == nil && session != nil && session.UserID == userID {
+		if h.tokenBlacklistRepo != nil {
+			if err := h.tokenBlacklistRepo.BlacklistBySessionID(session.ID, userID); err != nil {
+				slog.Warn("Failed to blacklist session tokens", "session_id", session.ID, "error", err)
+			}
+		}
+		if err := h.sessionRepo.InvalidateSession(session.ID, userID); err != nil {
+			slog.Error("Failed to delete session on logout", "session_id", session.ID, "error", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "خطا در خروج از حساب")
+		}
+		InvalidationHub.CleanupSession(session.ID)
+	}
+
+	if claims, ok := c.Get("claims").(*middleware.Claims); ok && token != "" {
+		middleware.Blacklist.AddClaims(token, claims)
+	}
+
+	if h.config.Security.DeviceIDCookie {
+		middleware.ClearDeviceIDCookie(c, h.config.TLS.Enabled())
+	}
+
+	_ = h.auditRepo.LogAction(userID, "logout", "auth", c.RealIP(), c.Request().Header.Get("User-Agent"), true, "Logged out")
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "خروج با موفقیت انجام شد"})
+}
+
+// RegisterRequest represents self-service registration data
+type RegisterRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
+// Register creates a regular user account. The email starts unverified and a
+// verification token is delivered through the notifier; the client logs in
+// separately once registration succeeds.
 func (h *AuthHandler) Register(c echo.Context) error {
-	// Implementation with enhanced audit logging
-	return nil
+	req := new(RegisterRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "درخواست نامعتبر")
+	}
+
+	username := strings.TrimSpace(req.Username)
+	email := models.NormalizeEmail(req.Email)
+	if username == "" || email == "" || req.Password == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "نام کاربری، ایمیل و کلمه عبور را وارد نمایید")
+	}
+	if len(username) < 3 || len(username) > 50 {
+		return echo.NewHTTPError(http.StatusBadRequest, "نام کاربری باید بین 3 تا 50 کاراکتر باشد")
+	}
+	if isReservedUsername(username, h.config.Security.ReservedUsernames) {
+		return reservedUsernameError()
+	}
+	if _, err := mail.ParseAddress(email); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "ایمیل نامعتبر است")
+	}
+	if err := ValidatePasswordStrength(req.Password, &h.config.Security.PasswordPolicy); err != nil {
+		return passwordPolicyHTTPError(err)
+	}
+
+	exists, err := h.userRepo.ExistsByUsername(username)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بررسی نام کاربری")
+	}
+	if exists {
+		return echo.NewHTTPError(http.StatusConflict, "این نام کاربری از قبل در سیستم موجود است")
+	}
+
+	exists, err = h.userRepo.ExistsByEmail(email)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بررسی ایمیل")
+	}
+	if exists {
+		return echo.NewHTTPError(http.StatusConflict, "این ایمیل از قبل در سیستم موجود است")
+	}
+
+	user := &models.User{
+		Username: username,
+		Email:    email,
+		Role:     models.RoleUser,
+		Active:   true,
+	}
+	if err := user.SetPassword(req.Password, h.config.Security.BcryptCost); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در رمزگذاری کلمه عبور")
+	}
+
+	clientIP := c.RealIP()
+	if err := h.userRepo.Create(user); err != nil {
+		slog.Error("Registration failed", "username", username, "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ایجاد حساب کاربری")
+	}
+
+	_ = h.auditRepo.LogAction(
+		user.ID,
+		"register",
+		"user",
+		clientIP,
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Registered user: %s (ID: %d)", user.Username, user.ID),
+	)
+
+	sendVerificationEmail(h.notifier, &h.config.Security, user, clientIP)
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message":                     "ثبت نام با موفقیت انجام شد. لینک تایید به ایمیل شما ارسال شد",
+		"user":                        user.ToResponse(),
+		"email_verification_required": h.config.Security.RequireEmailVerification,
+	})
 }
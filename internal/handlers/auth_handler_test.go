@@ -0,0 +1,575 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"testing"
+	"time"
+
+	"Monex/internal/middleware"
+	"Monex/internal/models"
+	"Monex/internal/notifier"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// resetLoginTracker gives the test an empty global login tracker
+func resetLoginTracker(t *testing.T) {
+	t.Helper()
+	clear := func() {
+		globalLoginTracker.mu.Lock()
+		globalLoginTracker.attempts = make(map[string]*AttemptInfo)
+		globalLoginTracker.ipFailures = make(map[string]*AttemptInfo)
+		globalLoginTracker.mu.Unlock()
+	}
+	clear()
+	t.Cleanup(clear)
+}
+
+func TestResetAttemptsKeepsIPFailures(t *testing.T) {
+	lt := &LoginAttemptTracker{
+		attempts:   make(map[string]*AttemptInfo),
+		ipFailures: make(map[string]*AttemptInfo),
+		ttl:        time.Hour,
+		maxEntries: 100,
+	}
+	const ip = "203.0.113.7"
+
+	lt.recordFailure(ip, "victim1")
+	lt.recordFailure(ip, "victim2")
+	lt.recordFailure(ip, "attacker")
+
+	// Logging into the attacker's own account must not clear the IP's record
+	lt.resetAttempts(ip, "attacker")
+
+	if got := lt.failuresFromIP(ip); got != 3 {
+		t.Fatalf("failuresFromIP = %d after a successful login, want 3", got)
+	}
+	if _, ok := lt.attempts[lt.getKey(ip, "attacker")]; ok {
+		t.Fatal("attempts of the logged-in pair were not reset")
+	}
+	if _, ok := lt.attempts[lt.getKey(ip, "victim1")]; !ok {
+		t.Fatal("attempts of another username were reset")
+	}
+}
+
+// challengeZeros counts the leading zero bits the challenge hash of solution has
+func challengeZeros(token, solution string) int {
+	zeros := 0
+	for _, b := range sha256.Sum256([]byte(token + ":" + solution)) {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
+
+// findSolution returns the first number whose hash does, or doesn't, meet
+// difficulty; the frontend solves challenges the same way
+func findSolution(t *testing.T, token string, difficulty int, solved bool) string {
+	t.Helper()
+	for n := 0; n < 1<<24; n++ {
+		if solution := fmt.Sprint(n); (challengeZeros(token, solution) >= difficulty) == solved {
+			return solution
+		}
+	}
+	t.Fatal("no challenge solution found")
+	return ""
+}
+
+func TestLoginChallengeIssueAndVerify(t *testing.T) {
+	resetLoginTracker(t)
+	env := newTestEnv(t)
+	env.cfg.Login.ChallengeEnabled = true
+	env.cfg.Login.ChallengeThreshold = 1
+	env.cfg.Login.ChallengeDifficulty = 4
+	env.createUser(t, "alice", "Str0ng!Passw0rd", "user")
+
+	h := env.authHandler(t, nil, env.cfg)
+	e := newEcho()
+	e.POST("/login", h.Login)
+	from := http.Header{"X-Real-Ip": []string{"198.51.100.20"}}
+
+	login := func(body map[string]string) (int, map[string]interface{}) {
+		raw, _ := json.Marshal(body)
+		rec := doJSON(e, http.MethodPost, "/login", string(raw), from)
+		var out map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &out)
+		return rec.Code, out
+	}
+
+	if code, _ := login(map[string]string{"username": "nobody", "password": "wrong"}); code != http.StatusUnauthorized {
+		t.Fatalf("failed login: status %d, want 401", code)
+	}
+
+	// Past the threshold even the right password needs a challenge
+	code, body := login(map[string]string{"username": "alice", "password": "Str0ng!Passw0rd"})
+	if code != http.StatusPreconditionRequired || body["code"] != "challenge_required" {
+		t.Fatalf("login without challenge: status %d, body %v", code, body)
+	}
+	issued, _ := body["challenge"].(map[string]interface{})
+	token, _ := issued["token"].(string)
+	if token == "" {
+		t.Fatalf("no challenge token in %v", body)
+	}
+
+	code, body = login(map[string]string{
+		"username": "alice", "password": "Str0ng!Passw0rd",
+		"challenge_token": token, "challenge_solution": findSolution(t, token, 4, false),
+	})
+	if code != http.StatusPreconditionRequired || body["code"] != "challenge_failed" {
+		t.Fatalf("login with a wrong solution: status %d, body %v", code, body)
+	}
+
+	code, body = login(map[string]string{
+		"username": "alice", "password": "Str0ng!Passw0rd",
+		"challenge_token": token, "challenge_solution": findSolution(t, token, 4, true),
+	})
+	if code != http.StatusOK || body["access_token"] == nil {
+		t.Fatalf("login with a solved challenge: status %d, body %v", code, body)
+	}
+
+	// The IP's failure still counts after the successful login
+	if got := globalLoginTracker.failuresFromIP("198.51.100.20"); got != 1 {
+		t.Fatalf("failuresFromIP = %d after login, want 1", got)
+	}
+}
+
+// loginSession stores a session for user as a login would and returns its
+// access and refresh tokens
+func loginSession(t *testing.T, env *testEnv, user *models.User, ip string) (access, refresh string, sessionID int) {
+	t.Helper()
+	access, err := env.jwt.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	refresh, err = env.jwt.GenerateRefreshToken(user, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	session, err := env.sessions.CreateSession(user.ID, "Firefox on Linux", "Firefox", "Linux", ip,
+		access, refresh, env.jwt.TokenID(access), env.jwt.TokenID(refresh), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	return access, refresh, session.ID
+}
+
+func TestTokenTypesNotInterchangeable(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	access, refresh, _ := loginSession(t, env, user, "203.0.113.7")
+
+	auth := env.authHandler(t, make(captureNotifier, 4), env.cfg)
+	e := newEcho()
+	e.POST("/auth/refresh", auth.RefreshToken)
+	e.GET("/me", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }, env.jwt.AuthMiddleware())
+
+	rec := doJSON(e, http.MethodPost, "/auth/refresh", `{"refresh_token":"`+access+`"}`, nil)
+	if rec.Code != http.StatusUnauthorized || decodeCode(t, rec.Body.Bytes()) != "wrong_token_type" {
+		t.Fatalf("access token at /auth/refresh: status %d, body %s; want 401 wrong_token_type", rec.Code, rec.Body)
+	}
+
+	if rec := doJSON(e, http.MethodGet, "/me", "", bearer(refresh)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh token as bearer: status %d, want 401", rec.Code)
+	}
+	if rec := doJSON(e, http.MethodGet, "/me", "", bearer(access)); rec.Code != http.StatusNoContent {
+		t.Fatalf("access token as bearer: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRefreshKeepsSessionIP(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	_, refresh, sessionID := loginSession(t, env, user, "203.0.113.7")
+
+	auth := env.authHandler(t, make(captureNotifier, 4), env.cfg)
+	e := newEcho()
+	e.POST("/auth/refresh", auth.RefreshToken)
+
+	header := http.Header{"X-Real-Ip": []string{"198.51.100.9"}}
+	if rec := doJSON(e, http.MethodPost, "/auth/refresh", `{"refresh_token":"`+refresh+`"}`, header); rec.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	// A refresh from another network must not become the session's fingerprint
+	session, err := env.sessions.GetSessionByID(sessionID, user.ID)
+	if err != nil {
+		t.Fatalf("GetSessionByID: %v", err)
+	}
+	if session.IPAddress != "203.0.113.7" {
+		t.Fatalf("session IP = %s after refresh, want 203.0.113.7", session.IPAddress)
+	}
+}
+
+func TestLoginRehashesWeakPassword(t *testing.T) {
+	resetLoginTracker(t)
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	if err := user.SetPassword("Str0ng!Passw0rd", 10); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	if err := env.users.UpdatePassword(user.ID, user.Password); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	env.cfg.Security.BcryptCost = 12
+
+	h := env.authHandler(t, nil, env.cfg)
+	e := newEcho()
+	e.POST("/login", h.Login)
+	rec := doJSON(e, http.MethodPost, "/login", `{"username":"alice","password":"Str0ng!Passw0rd"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	stored, err := env.users.GetByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if cost, err := bcrypt.Cost([]byte(stored.Password)); err != nil || cost != 12 {
+		t.Fatalf("stored hash cost = %d (%v), want 12", cost, err)
+	}
+	if !stored.CheckPassword("Str0ng!Passw0rd") {
+		t.Fatal("rehashed password no longer verifies")
+	}
+}
+
+func TestDeviceIDCookie(t *testing.T) {
+	resetLoginTracker(t)
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+
+	auth := env.authHandler(t, make(captureNotifier, 8), env.cfg)
+	sessions := NewSessionHandler(env.sessions, env.audit, env.blacklist, time.Minute, time.Second)
+	e := newEcho()
+	e.POST("/login", auth.Login)
+	e.GET("/sessions", sessions.GetSessions, withUser(user))
+
+	login := func(header http.Header) *http.Cookie {
+		t.Helper()
+		rec := doJSON(e, http.MethodPost, "/login", `{"username":"alice","password":"Str0ng!Passw0rd"}`, header)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login: status %d, body %s", rec.Code, rec.Body)
+		}
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == middleware.DeviceIDCookie {
+				return cookie
+			}
+		}
+		t.Fatalf("login set no %s cookie", middleware.DeviceIDCookie)
+		return nil
+	}
+
+	cookie := login(nil)
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode || cookie.Value == "" {
+		t.Fatalf("device cookie %+v, want a non-empty httpOnly SameSite=Strict cookie", cookie)
+	}
+	withCookie := http.Header{"Cookie": []string{cookie.Name + "=" + cookie.Value}}
+
+	// The cookie alone identifies the current session
+	current := func(path string, header http.Header) []bool {
+		t.Helper()
+		rec := doJSON(e, http.MethodGet, path, "", header)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("sessions: status %d, body %s", rec.Code, rec.Body)
+		}
+		var list []models.SessionResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+		flags := make([]bool, len(list))
+		for i, s := range list {
+			flags[i] = s.IsCurrent
+		}
+		return flags
+	}
+	if got := current("/sessions", withCookie); len(got) != 1 || !got[0] {
+		t.Fatalf("sessions with the cookie: is_current %v, want [true]", got)
+	}
+	if got := current("/sessions?device_id="+cookie.Value, nil); len(got) != 1 || got[0] {
+		t.Fatalf("sessions with a device_id query parameter: is_current %v, want [false]", got)
+	}
+
+	// Logging in again from the same device reuses its session
+	if again := login(withCookie); again.Value != cookie.Value {
+		t.Fatalf("second login set device %q, want %q", again.Value, cookie.Value)
+	}
+	if count, err := env.sessions.CountActiveSessions(user.ID); err != nil || count != 1 {
+		t.Fatalf("active sessions = %d (%v), want 1", count, err)
+	}
+}
+
+func TestHideUserEnumeration(t *testing.T) {
+	resetLoginTracker(t)
+	env := newTestEnv(t)
+	env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	locked := env.createUser(t, "locked", "Str0ng!Passw0rd", models.RoleUser)
+	if err := env.users.LockPendingReview(locked.ID); err != nil {
+		t.Fatalf("LockPendingReview: %v", err)
+	}
+
+	e := newEcho()
+	for _, hide := range []bool{false, true} {
+		cfg := *env.cfg
+		cfg.Login.HideUserEnumeration = hide
+		h := env.authHandler(t, nil, &cfg)
+		path := fmt.Sprintf("/login/%t", hide)
+		e.POST(path, h.Login)
+
+		ip := 0
+		login := func(username, password string) (int, string) {
+			ip++
+			from := http.Header{"X-Real-Ip": []string{fmt.Sprintf("198.51.100.%d", ip)}}
+			rec := doJSON(e, http.MethodPost, path, fmt.Sprintf(`{"username":%q,"password":%q}`, username, password), from)
+			return rec.Code, rec.Body.String()
+		}
+
+		unknownCode, unknownBody := login("nobody", "Str0ng!Passw0rd")
+		wrongCode, wrongBody := login("alice", "wrong-password")
+		lockedCode, lockedBody := login("locked", "Str0ng!Passw0rd")
+
+		if unknownCode != http.StatusUnauthorized || unknownCode != wrongCode || unknownBody != wrongBody {
+			t.Fatalf("hide=%t: unknown user %d %s, wrong password %d %s; want identical 401s",
+				hide, unknownCode, unknownBody, wrongCode, wrongBody)
+		}
+		if hide && (lockedCode != unknownCode || lockedBody != unknownBody) {
+			t.Fatalf("locked account %d %s, unknown user %d %s; want identical responses",
+				lockedCode, lockedBody, unknownCode, unknownBody)
+		}
+		if !hide && lockedCode != http.StatusForbidden {
+			t.Fatalf("locked account without HIDE_USER_ENUMERATION: status %d, want 403", lockedCode)
+		}
+	}
+}
+
+func TestUnknownUserLoginRunsBcrypt(t *testing.T) {
+	resetLoginTracker(t)
+	env := newTestEnv(t)
+	env.cfg.Security.BcryptCost = 11
+	h := env.authHandler(t, nil, env.cfg)
+	e := newEcho()
+	e.POST("/login", h.Login)
+
+	if cost, err := bcrypt.Cost([]byte(h.dummyUser.Password)); err != nil || cost != 11 {
+		t.Fatalf("dummy hash cost = %d (%v), want the configured 11", cost, err)
+	}
+
+	// One comparison at the configured cost is the floor for any login
+	start := time.Now()
+	h.dummyUser.CheckPassword("Str0ng!Passw0rd")
+	compare := time.Since(start)
+
+	start = time.Now()
+	rec := doJSON(e, http.MethodPost, "/login", `{"username":"nobody","password":"Str0ng!Passw0rd"}`, nil)
+	elapsed := time.Since(start)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown user: status %d, body %s", rec.Code, rec.Body)
+	}
+	if elapsed < compare/2 {
+		t.Fatalf("unknown user answered in %v; a bcrypt comparison takes %v", elapsed, compare)
+	}
+}
+
+func TestFailedLoginsLockAccount(t *testing.T) {
+	resetLoginTracker(t)
+	env := newTestEnv(t)
+	env.cfg.Login.MaxFailedAttempts = 2
+	env.cfg.Login.MaxTempBans = 2
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	events := make(captureNotifier, 4)
+	h := env.authHandler(t, events, env.cfg)
+	e := newEcho()
+	e.POST("/login", h.Login)
+
+	// Each login comes from a new IP so the IP tracker never steps in
+	ip := 0
+	login := func(password string) int {
+		ip++
+		from := http.Header{"X-Real-Ip": []string{fmt.Sprintf("198.51.100.%d", ip)}}
+		return doJSON(e, http.MethodPost, "/login", fmt.Sprintf(`{"username":"alice","password":%q}`, password), from).Code
+	}
+	reload := func() *models.User {
+		t.Helper()
+		u, err := env.users.GetByID(user.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		return u
+	}
+
+	// Reaching MAX_FAILED_ATTEMPTS locks the account for TEMP_BAN_DURATION
+	login("wrong-password")
+	if u := reload(); u.Locked || u.FailedAttempts != 1 {
+		t.Fatalf("after one failure: locked=%t failed_attempts=%d, want unlocked with 1", u.Locked, u.FailedAttempts)
+	}
+	login("wrong-password")
+	u := reload()
+	if !u.Locked || u.PermanentlyLocked || u.LockedUntil == nil || u.FailedAttempts != 0 || u.TempBansCount != 1 {
+		t.Fatalf("after the limit: %+v, want a temporary lock with the count cleared", u)
+	}
+	if until := time.Until(*u.LockedUntil); until <= 0 || until > env.cfg.Login.TempBanDuration {
+		t.Fatalf("locked for %v, want up to %v", until, env.cfg.Login.TempBanDuration)
+	}
+	select {
+	case event := <-events:
+		if event.Type != notifier.EventAccountLocked || event.UserID != user.ID {
+			t.Fatalf("event = %+v, want account_locked for the user", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no account_locked event")
+	}
+	if code := login("Str0ng!Passw0rd"); code != http.StatusForbidden {
+		t.Fatalf("right password while locked: status %d, want 403", code)
+	}
+
+	// Failures while locked don't add further bans
+	login("wrong-password")
+	login("wrong-password")
+	if u := reload(); u.TempBansCount != 1 || u.PermanentlyLocked {
+		t.Fatalf("failures during the lock: temp_bans_count=%d permanent=%t, want 1 and false", u.TempBansCount, u.PermanentlyLocked)
+	}
+
+	// Once the ban expires, the ban that reaches MAX_TEMP_BANS is permanent
+	if _, err := env.db.Exec("UPDATE users SET locked_until = ? WHERE id = ?", time.Now().UTC().Add(-time.Minute), user.ID); err != nil {
+		t.Fatalf("expire lock: %v", err)
+	}
+	if _, err := env.users.AutoUnlockExpired(); err != nil {
+		t.Fatalf("AutoUnlockExpired: %v", err)
+	}
+	login("wrong-password")
+	login("wrong-password")
+	if u := reload(); !u.PermanentlyLocked || u.LockedUntil != nil || u.TempBansCount != 2 {
+		t.Fatalf("second ban: %+v, want a permanent lock", u)
+	}
+}
+
+func TestNewAuthHandlerReturnsDummyHashError(t *testing.T) {
+	env := newTestEnv(t)
+	cfg := *env.cfg
+	cfg.Security.BcryptCost = 32 // above bcrypt.MaxCost
+
+	h, err := NewAuthHandler(env.users, env.audit, env.sessions, env.blacklist, env.loginAttempts, env.jwt, nil, &cfg)
+	if err == nil || h != nil {
+		t.Fatalf("NewAuthHandler() = %v, %v, want an error", h, err)
+	}
+}
+
+func TestIntrospectReportsAccessDuration(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.JWT.AccessDuration = 37 * time.Minute
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	access, _, _ := loginSession(t, env, user, "203.0.113.7")
+
+	auth := env.authHandler(t, nil, env.cfg)
+	e := newEcho()
+	e.GET("/auth/introspect", auth.Introspect, env.jwt.AuthMiddleware())
+
+	rec := doJSON(e, http.MethodGet, "/auth/introspect", "", bearer(access))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("introspect: status %d, body %s", rec.Code, rec.Body)
+	}
+	var body TokenIntrospectionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if body.UserID != user.ID || body.Blacklisted {
+		t.Fatalf("introspection %+v, want user %d not blacklisted", body, user.ID)
+	}
+	if lifetime := body.ExpiresAt.Sub(body.IssuedAt); lifetime != env.cfg.JWT.AccessDuration {
+		t.Fatalf("expires_at - issued_at = %v, want AccessDuration %v", lifetime, env.cfg.JWT.AccessDuration)
+	}
+	if left := time.Duration(body.ExpiresInSeconds) * time.Second; left > env.cfg.JWT.AccessDuration || left < env.cfg.JWT.AccessDuration-5*time.Second {
+		t.Fatalf("expires_in_seconds = %d, want about %v", body.ExpiresInSeconds, env.cfg.JWT.AccessDuration)
+	}
+}
+
+func TestLockoutPushesAccountStatus(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.Login.MaxFailedAttempts = 100
+	env.cfg.Login.ChallengeThreshold = 100
+	user := env.createUser(t, "lockout", "Str0ng!Passw0rd", models.RoleUser)
+	h := env.authHandler(t, nil, env.cfg)
+	e := newEcho()
+	e.POST("/login", h.Login)
+
+	events := GlobalNotificationHub.Subscribe(user.ID)
+	t.Cleanup(func() { GlobalNotificationHub.Unsubscribe(user.ID, events) })
+
+	// The tracker blocks an IP+username pair after three failures
+	from := http.Header{"X-Real-Ip": []string{"198.51.100.77"}}
+	for i := 1; i <= 3; i++ {
+		doJSON(e, http.MethodPost, "/login", `{"username":"lockout","password":"wrong-password"}`, from)
+		if i < 3 && len(events) > 0 {
+			t.Fatalf("event after %d failures: %+v", i, <-events)
+		}
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != "account_status" || event.Data["status"] != "temporarily_locked" {
+			t.Fatalf("event = %+v, want account_status temporarily_locked", event)
+		}
+		if event.Data["ip_address"] != "198.51.100.77" || event.Data["remaining_seconds"] != 300 {
+			t.Errorf("event data = %v, want the IP and a 300s block", event.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no account_status event after the lockout")
+	}
+}
+
+func TestRememberMePicksRefreshLifetime(t *testing.T) {
+	resetLoginTracker(t)
+	env := newTestEnv(t)
+	env.cfg.JWT.RefreshDuration = 168 * time.Hour
+	env.cfg.JWT.RememberMeDuration = 720 * time.Hour
+	env.cfg.JWT.NoRememberMeDuration = 12 * time.Hour
+	env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+
+	h := env.authHandler(t, nil, env.cfg)
+	e := newEcho()
+	e.POST("/login", h.Login)
+
+	for _, tt := range []struct {
+		name       string
+		rememberMe string
+		want       time.Duration
+	}{
+		{"remember me", `,"remember_me":true`, 720 * time.Hour},
+		{"don't remember me", `,"remember_me":false`, 12 * time.Hour},
+		{"no choice", "", 168 * time.Hour},
+	} {
+		start := time.Now()
+		rec := doJSON(e, http.MethodPost, "/login", `{"username":"alice","password":"Str0ng!Passw0rd"`+tt.rememberMe+`}`, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: login status %d, body %s", tt.name, rec.Code, rec.Body)
+		}
+		var body LoginResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: decode %s: %v", tt.name, rec.Body, err)
+		}
+
+		claims, err := env.jwt.ValidateTokenType(body.RefreshToken, "refresh")
+		if err != nil {
+			t.Fatalf("%s: ValidateTokenType: %v", tt.name, err)
+		}
+		if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != tt.want {
+			t.Errorf("%s: refresh token lives %v, want %v", tt.name, lifetime, tt.want)
+		}
+
+		// The session and the reported expiry follow the refresh token
+		session, err := env.sessions.GetSessionByID(body.SessionID, body.User.ID)
+		if err != nil {
+			t.Fatalf("%s: GetSessionByID: %v", tt.name, err)
+		}
+		for what, expiresAt := range map[string]time.Time{"session": session.ExpiresAt, "refresh_expires_at": body.RefreshExpiresAt} {
+			if left := expiresAt.Sub(start); left < tt.want-time.Second || left > tt.want+2*time.Second {
+				t.Errorf("%s: %s %v after login, want %v", tt.name, what, left, tt.want)
+			}
+		}
+	}
+}
@@ -17,6 +17,20 @@ import (
 // BackupHandler creates a database backup
 func BackupHandler(db *database.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		done, ok := LongOperations.Begin("backup_download")
+		if !ok {
+			return errShuttingDown()
+		}
+		defer done()
+
+		if !backupRunning.CompareAndSwap(false, true) {
+			return echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
+				"message": "پشتیبان گیری دیگری در حال انجام است. لطفا بعدا تلاش کنید",
+				"code":    "backup_in_progress",
+			})
+		}
+		defer backupRunning.Store(false)
+
 		// Create temporary directory for backup
 		tempDir := filepath.Join(os.TempDir(), fmt.Sprintf("monex_backup_%d", time.Now().Unix()))
 		if err := os.MkdirAll(tempDir, 0755); err != nil {
@@ -24,16 +38,8 @@ func BackupHandler(db *database.DB) echo.HandlerFunc {
 		}
 		defer os.RemoveAll(tempDir)
 
-		// Get database file path (assuming SQLite)
-		dbPath := "./data.db"
-
-		// Check if database file exists
-		if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-			return echo.NewHTTPError(http.StatusNotFound, "فایل دیتابیس پیدا نشد")
-		}
-
 		// Create backup filename with timestamp
-		timestamp := time.Now().Format("2006-01-02_15-04-05")
+		timestamp := time.Now().UTC().Format("2006-01-02_15-04-05")
 		backupFilename := fmt.Sprintf("backup_%s.zip", timestamp)
 		backupPath := filepath.Join(tempDir, backupFilename)
 
@@ -44,27 +50,10 @@ func BackupHandler(db *database.DB) echo.HandlerFunc {
 		}
 		defer zipFile.Close()
 
-		zipWriter := zip.NewWriter(zipFile)
-		defer zipWriter.Close()
-
-		// Add database file to zip
-		if err := addFileToZip(zipWriter, dbPath, "data.db"); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "خطا در اضافه کردن دیتابیس به بکاپ")
-		}
-
-		// Add WAL and SHM files if they exist
-		walPath := dbPath + "-wal"
-		if _, err := os.Stat(walPath); err == nil {
-			addFileToZip(zipWriter, walPath, "data.db-wal")
-		}
-
-		shmPath := dbPath + "-shm"
-		if _, err := os.Stat(shmPath); err == nil {
-			addFileToZip(zipWriter, shmPath, "data.db-shm")
-		}
-
-		// Close zip writer before sending
-		if err := zipWriter.Close(); err != nil {
+		if err := WriteBackup(db, zipFile); err != nil {
+			if os.IsNotExist(err) {
+				return echo.NewHTTPError(http.StatusNotFound, "فایل دیتابیس پیدا نشد")
+			}
 			return echo.NewHTTPError(http.StatusInternalServerError, "پشتیبان گیری نهایی نشد")
 		}
 
@@ -73,6 +62,42 @@ func BackupHandler(db *database.DB) echo.HandlerFunc {
 	}
 }
 
+// WriteBackup checkpoints the WAL and writes a zip of the database files to w
+func WriteBackup(db *database.DB, w io.Writer) error {
+	dbPath := db.Path
+
+	// Check if database file exists
+	if _, err := os.Stat(dbPath); err != nil {
+		return err
+	}
+
+	// Flush the WAL into the main file so data.db alone is consistent
+	if _, err := db.Exec("PRAGMA wal_checkpoint(FULL)"); err != nil {
+		return fmt.Errorf("failed to checkpoint WAL: %w", err)
+	}
+
+	zipWriter := zip.NewWriter(w)
+
+	// Add database file to zip
+	if err := addFileToZip(zipWriter, dbPath, "data.db"); err != nil {
+		zipWriter.Close()
+		return fmt.Errorf("failed to add database to backup: %w", err)
+	}
+
+	// Add WAL and SHM files if they exist
+	walPath := dbPath + "-wal"
+	if _, err := os.Stat(walPath); err == nil {
+		addFileToZip(zipWriter, walPath, "data.db-wal")
+	}
+
+	shmPath := dbPath + "-shm"
+	if _, err := os.Stat(shmPath); err == nil {
+		addFileToZip(zipWriter, shmPath, "data.db-shm")
+	}
+
+	return zipWriter.Close()
+}
+
 // addFileToZip adds a file to the zip archive
 func addFileToZip(zipWriter *zip.Writer, filePath, zipPath string) error {
 	file, err := os.Open(filePath)
@@ -102,4 +127,3 @@ func addFileToZip(zipWriter *zip.Writer, filePath, zipPath string) error {
 	_, err = io.Copy(writer, file)
 	return err
 }
-
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"Monex/internal/database"
+)
+
+const scheduledBackupPrefix = "monex_backup_"
+
+// backupRunning is held by whichever backup, scheduled or downloaded, is
+// writing; two concurrent WAL checkpoints and zips of the same file only
+// slow each other down
+var backupRunning atomic.Bool
+
+// BackupScheduler writes periodic backup zips into a directory and prunes old ones
+type BackupScheduler struct {
+	db   *database.DB
+	dir  string
+	keep int
+}
+
+func NewBackupScheduler(db *database.DB, dir string, keep int) *BackupScheduler {
+	if keep < 1 {
+		keep = 1
+	}
+	return &BackupScheduler{db: db, dir: dir, keep: keep}
+}
+
+// Start runs a backup every interval until ctx is cancelled
+func (s *BackupScheduler) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.RunOnce(); err != nil {
+					slog.Error("Scheduled backup failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// RunOnce writes one backup and prunes old ones. It returns "" without error
+// when another backup is still in progress.
+func (s *BackupScheduler) RunOnce() (string, error) {
+	if !backupRunning.CompareAndSwap(false, true) {
+		slog.Warn("Skipping scheduled backup: another backup still running")
+		return "", nil
+	}
+	defer backupRunning.Store(false)
+
+	done, ok := LongOperations.Begin("scheduled_backup")
+	if !ok {
+		slog.Warn("Skipping scheduled backup: server is shutting down")
+		return "", nil
+	}
+	defer done()
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup dir: %w", err)
+	}
+
+	name := scheduledBackupPrefix + time.Now().UTC().Format("2006-01-02_15-04-05") + ".zip"
+	path := filepath.Join(s.dir, name)
+
+	// Write to a temp name so a crash never leaves a truncated zip that looks valid
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+
+	if err := WriteBackup(s.db, file); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to finalize backup file: %w", err)
+	}
+
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	slog.Info("Backup created", "path", path, "size_bytes", size)
+
+	s.prune()
+	return path, nil
+}
+
+// prune deletes scheduled backups beyond the retention count, oldest first
+func (s *BackupScheduler) prune() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		slog.Warn("Failed to list backups for pruning", "dir", s.dir, "error", err)
+		return
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, scheduledBackupPrefix) && strings.HasSuffix(name, ".zip") {
+			backups = append(backups, name)
+		}
+	}
+
+	// Timestamped names sort chronologically
+	sort.Strings(backups)
+	for len(backups) > s.keep {
+		oldest := filepath.Join(s.dir, backups[0])
+		if err := os.Remove(oldest); err != nil {
+			slog.Warn("Failed to delete old backup", "path", oldest, "error", err)
+		} else {
+			slog.Info("Deleted old backup", "path", oldest)
+		}
+		backups = backups[1:]
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"Monex/internal/models"
+)
+
+func TestBackupSchedulerRunOnce(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+
+	// Older scheduled backups, plus a file that isn't one
+	dir := t.TempDir()
+	old := []string{"monex_backup_2020-01-01_00-00-00.zip", "monex_backup_2020-01-02_00-00-00.zip", "monex_backup_2020-01-03_00-00-00.zip"}
+	for _, name := range append(old, "notes.txt") {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("old"), 0600); err != nil {
+			t.Fatalf("seed %s: %v", name, err)
+		}
+	}
+
+	path, err := NewBackupScheduler(env.db, dir, 2).RunOnce()
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	// Retention keeps the new backup and the newest old one
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{old[2], filepath.Base(path), "notes.txt"}
+	sort.Strings(want)
+	if len(names) != len(want) {
+		t.Fatalf("backup dir holds %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("backup dir holds %v, want %v", names, want)
+		}
+	}
+
+	// The zip holds a database with the seeded user
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	defer archive.Close()
+	restored := filepath.Join(t.TempDir(), "data.db")
+	for _, file := range archive.File {
+		if file.Name != "data.db" {
+			continue
+		}
+		src, err := file.Open()
+		if err != nil {
+			t.Fatalf("open data.db: %v", err)
+		}
+		data, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			t.Fatalf("read data.db: %v", err)
+		}
+		if err := os.WriteFile(restored, data, 0600); err != nil {
+			t.Fatalf("write data.db: %v", err)
+		}
+	}
+	db, err := sql.Open("sqlite3", restored)
+	if err != nil {
+		t.Fatalf("open restored database: %v", err)
+	}
+	defer db.Close()
+	var users int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE username = 'alice'").Scan(&users); err != nil || users != 1 {
+		t.Fatalf("restored database has %d alice rows (%v), want 1", users, err)
+	}
+}
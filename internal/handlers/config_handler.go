@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"Monex/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ConfigHandler exposes the non-secret settings clients need to render data
+type ConfigHandler struct {
+	format *config.FormatConfig
+}
+
+func NewConfigHandler(format *config.FormatConfig) *ConfigHandler {
+	return &ConfigHandler{format: format}
+}
+
+// FormattingResponse describes how amounts should be displayed
+type FormattingResponse struct {
+	BaseCurrency       string `json:"base_currency"`
+	Locale             string `json:"locale"`
+	DecimalPlaces      int    `json:"decimal_places"`
+	ThousandsSeparator string `json:"thousands_separator"`
+}
+
+// GetFormatting returns the server's amount formatting settings (public)
+func (h *ConfigHandler) GetFormatting(c echo.Context) error {
+	return c.JSON(http.StatusOK, FormattingResponse{
+		BaseCurrency:       h.format.BaseCurrency,
+		Locale:             h.format.Locale,
+		DecimalPlaces:      h.format.DecimalPlaces,
+		ThousandsSeparator: h.format.ThousandsSeparator,
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"Monex/config"
+)
+
+func TestFormattingReturnsConfiguredValues(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	t.Setenv("BASE_CURRENCY", "usd")
+	t.Setenv("LOCALE", "en-US")
+	t.Setenv("CURRENCY_DECIMAL_PLACES", "2")
+	t.Setenv("THOUSANDS_SEPARATOR", "٬")
+
+	formatting := func() FormattingResponse {
+		t.Helper()
+		e := newEcho()
+		e.GET("/config/formatting", NewConfigHandler(&config.Load().Format).GetFormatting)
+		rec := doJSON(e, http.MethodGet, "/config/formatting", "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+		}
+		var resp FormattingResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+		return resp
+	}
+
+	want := FormattingResponse{BaseCurrency: "USD", Locale: "en-US", DecimalPlaces: 2, ThousandsSeparator: "٬"}
+	if got := formatting(); got != want {
+		t.Fatalf("formatting = %+v, want %+v", got, want)
+	}
+
+	// Decimal places outside 0-4 fall back to whole units
+	t.Setenv("CURRENCY_DECIMAL_PLACES", "7")
+	if got := formatting().DecimalPlaces; got != 0 {
+		t.Fatalf("decimal_places = %d with an invalid setting, want 0", got)
+	}
+}
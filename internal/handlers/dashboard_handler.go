@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"Monex/internal/middleware"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultDashboardRecent = 5
+	maxDashboardRecent     = 20
+)
+
+type DashboardHandler struct {
+	userRepo        *repository.UserRepository
+	transactionRepo *repository.TransactionRepository
+	sessionRepo     *repository.SessionRepository
+}
+
+func NewDashboardHandler(
+	userRepo *repository.UserRepository,
+	transactionRepo *repository.TransactionRepository,
+	sessionRepo *repository.SessionRepository,
+) *DashboardHandler {
+	return &DashboardHandler{
+		userRepo:        userRepo,
+		transactionRepo: transactionRepo,
+		sessionRepo:     sessionRepo,
+	}
+}
+
+// DashboardAccountStatus holds the account flags shown on the dashboard
+type DashboardAccountStatus struct {
+	Active                 bool `json:"active"`
+	Locked                 bool `json:"locked"`
+	PermanentlyLocked      bool `json:"permanently_locked"`
+	PasswordChangeRequired bool `json:"password_change_required"`
+	FailedAttempts         int  `json:"failed_attempts"`
+}
+
+// DashboardResponse aggregates everything the dashboard needs in one call
+type DashboardResponse struct {
+	Stats                  *models.TransactionStats `json:"stats"`
+	RecentTransactions     []*models.Transaction    `json:"recent_transactions"`
+	ActiveSessions         int                      `json:"active_sessions"`
+	UnreadSecurityWarnings int                      `json:"unread_security_warnings"`
+	Account                DashboardAccountStatus   `json:"account"`
+}
+
+// GetDashboard returns stats, recent transactions, session and security summary for the current user
+func (h *DashboardHandler) GetDashboard(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	recent, _ := strconv.Atoi(c.QueryParam("recent"))
+	if recent < 1 {
+		recent = defaultDashboardRecent
+	}
+	if recent > maxDashboardRecent {
+		recent = maxDashboardRecent
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+
+	stats, err := h.transactionRepo.GetStats(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت آمار")
+	}
+
+	transactions, _, err := h.transactionRepo.List(userID, recent, 0, map[string]interface{}{
+		"sortField": "created_at",
+		"sortOrder": "desc",
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت تراکنش‌ها")
+	}
+
+	activeSessions, err := h.sessionRepo.CountActiveSessions(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت سشن‌ها")
+	}
+
+	unread := 0
+	for _, warning := range buildSecurityWarnings(user) {
+		if !warning.Read {
+			unread++
+		}
+	}
+
+	return c.JSON(http.StatusOK, amountsView(c, DashboardResponse{
+		Stats:                  stats,
+		RecentTransactions:     transactions,
+		ActiveSessions:         activeSessions,
+		UnreadSecurityWarnings: unread,
+		Account: DashboardAccountStatus{
+			Active:                 user.Active,
+			Locked:                 user.Locked,
+			PermanentlyLocked:      user.PermanentlyLocked,
+			PasswordChangeRequired: user.PasswordChangeRequired,
+			FailedAttempts:         user.FailedAttempts,
+		},
+	}))
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+	"Monex/internal/repository"
+)
+
+func TestDashboardMatchesSeededData(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	other := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+
+	start := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	seed := []struct {
+		kind   string
+		amount int
+	}{
+		{"deposit", 10000}, {"expense", 1200}, {"withdraw", 3000}, {"expense", 800}, {"deposit", 2500}, {"expense", 450},
+	}
+	for i, row := range seed {
+		tx := &models.Transaction{UserID: user.ID, Type: row.kind, Amount: row.amount, CreatedAt: start.Add(time.Duration(i) * time.Hour)}
+		if err := transactions.Create(tx); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if err := transactions.Create(&models.Transaction{UserID: other.ID, Type: "deposit", Amount: 99999, CreatedAt: start}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Two live sessions and an expired one; bob's doesn't count
+	loginSession(t, env, user, "203.0.113.7")
+	loginSession(t, env, user, "203.0.113.8")
+	_, _, expired := loginSession(t, env, user, "203.0.113.9")
+	if _, err := env.db.Exec("UPDATE sessions SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Minute).UTC(), expired); err != nil {
+		t.Fatalf("expire session: %v", err)
+	}
+	loginSession(t, env, other, "198.51.100.1")
+
+	// A temporary lock and failed attempts raise three unread warnings: the
+	// lock, its remaining time and the attempt count
+	if _, err := env.db.Exec("UPDATE users SET locked = 1, locked_until = ?, failed_attempts = 3 WHERE id = ?",
+		time.Now().Add(time.Hour).UTC(), user.ID); err != nil {
+		t.Fatalf("lock user: %v", err)
+	}
+
+	h := NewDashboardHandler(env.users, transactions, env.sessions)
+	e := newEcho()
+	e.GET("/dashboard", h.GetDashboard, withUser(user))
+	rec := doJSON(e, http.MethodGet, "/dashboard?recent=4", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dashboard: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	var shape map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &shape); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	var keys []string
+	for key := range shape {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	want := []string{"account", "active_sessions", "recent_transactions", "stats", "unread_security_warnings"}
+	if len(keys) != len(want) {
+		t.Fatalf("dashboard keys %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("dashboard keys %v, want %v", keys, want)
+		}
+	}
+
+	var body DashboardResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	wantStats := models.TransactionStats{TotalDeposit: 12500, TotalWithdraw: 3000, TotalExpense: 2450, Balance: 7050, Transactions: 6}
+	if body.Stats == nil || *body.Stats != wantStats {
+		t.Fatalf("stats %+v, want %+v", body.Stats, wantStats)
+	}
+	if len(body.RecentTransactions) != 4 {
+		t.Fatalf("%d recent transactions, want 4", len(body.RecentTransactions))
+	}
+	for i, tx := range body.RecentTransactions {
+		if tx.UserID != user.ID || tx.Amount != seed[len(seed)-1-i].amount {
+			t.Fatalf("recent transaction %d = %d for user %d, want the newest first", i, tx.Amount, tx.UserID)
+		}
+	}
+	if body.ActiveSessions != 2 {
+		t.Fatalf("active_sessions = %d, want 2", body.ActiveSessions)
+	}
+	if body.UnreadSecurityWarnings != 3 {
+		t.Fatalf("unread_security_warnings = %d, want 3", body.UnreadSecurityWarnings)
+	}
+	if !body.Account.Active || !body.Account.Locked || body.Account.FailedAttempts != 3 {
+		t.Fatalf("account %+v, want active, locked, 3 failed attempts", body.Account)
+	}
+}
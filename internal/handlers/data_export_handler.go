@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"Monex/internal/middleware"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxExportAuditLogs bounds the audit entries included in a personal export
+const maxExportAuditLogs = 100000
+
+type DataExportHandler struct {
+	userRepo        *repository.UserRepository
+	transactionRepo *repository.TransactionRepository
+	sessionRepo     *repository.SessionRepository
+	auditRepo       *repository.AuditRepository
+}
+
+func NewDataExportHandler(
+	userRepo *repository.UserRepository,
+	transactionRepo *repository.TransactionRepository,
+	sessionRepo *repository.SessionRepository,
+	auditRepo *repository.AuditRepository,
+) *DataExportHandler {
+	return &DataExportHandler{
+		userRepo:        userRepo,
+		transactionRepo: transactionRepo,
+		sessionRepo:     sessionRepo,
+		auditRepo:       auditRepo,
+	}
+}
+
+// ExportUserData downloads everything stored about the current user as one
+// JSON document: profile, active sessions, audit entries and transactions.
+// Only public response types are used, so password and token hashes never
+// leave the server. Transactions are streamed row by row.
+func (h *DataExportHandler) ExportUserData(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+
+	sessions, err := h.sessionRepo.GetUserSessions(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت سشن‌ها")
+	}
+
+	sessionResponses := make([]*models.SessionResponse, len(sessions))
+	for i, session := range sessions {
+		sessionResponses[i] = &models.SessionResponse{
+			ID:           session.ID,
+			DeviceID:     session.DeviceID,
+			DeviceName:   session.DeviceName,
+			Browser:      session.Browser,
+			OS:           session.OS,
+			IPAddress:    session.IPAddress,
+			LastActivity: session.LastActivity,
+			ExpiresAt:    session.ExpiresAt,
+			CreatedAt:    session.CreatedAt,
+		}
+	}
+
+	auditLogs, _, err := h.auditRepo.GetAuditLogs(maxExportAuditLogs, 0, map[string]interface{}{
+		"user_id": userID,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت لاگ‌ها")
+	}
+
+	_ = h.auditRepo.LogAction(
+		userID,
+		"export_user_data",
+		"profile",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Exported personal data (%d sessions, %d audit entries)", len(sessionResponses), len(auditLogs)),
+	)
+
+	filename := fmt.Sprintf("monex_export_%s_%s.json", user.Username, time.Now().UTC().Format("2006-01-02"))
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure from here on can only be logged
+	if err := h.writeExport(c.Response(), user, sessionResponses, auditLogs); err != nil {
+		slog.Error("User data export failed", "user_id", userID, "error", err)
+	}
+	return nil
+}
+
+// writeExport writes the export document, streaming the transactions array
+func (h *DataExportHandler) writeExport(
+	w io.Writer,
+	user *models.User,
+	sessions []*models.SessionResponse,
+	auditLogs []*models.AuditLog,
+) error {
+	header := map[string]interface{}{
+		"exported_at": time.Now().UTC(),
+		"profile":     user.ToResponse(),
+		"sessions":    sessions,
+		"audit_logs":  auditLogs,
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	// Reopen the object to append the streamed transactions array
+	if _, err := w.Write(headerJSON[:len(headerJSON)-1]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"transactions":[`); err != nil {
+		return err
+	}
+
+	first := true
+	err = h.transactionRepo.ForEachByUser(user.ID, func(transaction *models.Transaction) error {
+		data, err := json.Marshal(transaction)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]}")
+	return err
+}
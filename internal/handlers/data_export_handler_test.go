@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+	"Monex/internal/repository"
+)
+
+func TestExportHoldsOnlyPublicUserData(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	other := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+	for i, owner := range []int{user.ID, user.ID, other.ID, user.ID} {
+		tx := &models.Transaction{UserID: owner, Type: "deposit", Amount: 100 * (i + 1), Note: "note", CreatedAt: time.Now().Add(-time.Hour)}
+		if err := transactions.Create(tx); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	access, refresh, _ := loginSession(t, env, user, "203.0.113.7")
+	stored, err := env.users.GetByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	h := NewDataExportHandler(env.users, transactions, env.sessions, env.audit)
+	e := newEcho()
+	e.GET("/export", h.ExportUserData, withUser(user))
+	rec := doJSON(e, http.MethodGet, "/export", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	var export struct {
+		Profile      map[string]interface{}   `json:"profile"`
+		Sessions     []map[string]interface{} `json:"sessions"`
+		Transactions []*models.Transaction    `json:"transactions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &export); err != nil {
+		t.Fatalf("export is not valid JSON: %v", err)
+	}
+	if export.Profile["username"] != "alice" || len(export.Sessions) != 1 {
+		t.Fatalf("export profile %v with %d sessions, want alice with 1", export.Profile, len(export.Sessions))
+	}
+	if len(export.Transactions) != 3 {
+		t.Fatalf("%d transactions exported, want alice's 3", len(export.Transactions))
+	}
+	for _, tx := range export.Transactions {
+		if tx.UserID != user.ID {
+			t.Fatalf("exported transaction %d of user %d", tx.ID, tx.UserID)
+		}
+	}
+
+	body := rec.Body.String()
+	secrets := map[string]string{
+		"password hash":      stored.Password,
+		"access token":       access,
+		"refresh token":      refresh,
+		"access token hash":  env.sessions.HashToken(access),
+		"refresh token hash": env.sessions.HashToken(refresh),
+	}
+	for name, secret := range secrets {
+		if secret == "" || strings.Contains(body, secret) {
+			t.Errorf("export contains the %s", name)
+		}
+	}
+	if _, ok := export.Profile["password"]; ok {
+		t.Error("export profile has a password field")
+	}
+}
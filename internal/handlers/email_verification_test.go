@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"Monex/internal/notifier"
+
+	"github.com/labstack/echo/v4"
+)
+
+// captureNotifier hands every event to a channel
+type captureNotifier chan notifier.Event
+
+func (n captureNotifier) Notify(_ context.Context, event notifier.Event) error {
+	n <- event
+	return nil
+}
+
+func TestCreatedUserGetsVerificationLink(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.admin(t)
+	events := make(captureNotifier, 4)
+
+	users := NewUserHandler(env.users, env.audit, env.sessions, env.blacklist, env.passwordHistory, events, env.cfg)
+	auth := env.authHandler(t, events, env.cfg)
+	e := newEcho()
+	e.POST("/users", users.CreateUser, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user_id", admin.ID)
+			return next(c)
+		}
+	})
+	e.GET("/verify-email", auth.VerifyEmail)
+
+	rec := doJSON(e, http.MethodPost, "/users",
+		`{"username":"bob","email":"bob@example.com","password":"Str0ng!Passw0rd","role":"user"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create user: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	var event notifier.Event
+	select {
+	case event = <-events:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no verification email for the created user")
+	}
+	if event.Type != notifier.EventEmailVerification || event.Email != "bob@example.com" || event.Token == "" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	// A link signed with the JWT secret, as before, must not verify
+	forged := newEmailVerificationToken(env.cfg.JWT.Secret, event.UserID, event.Email, time.Now().Add(time.Hour))
+	if rec := doJSON(e, http.MethodGet, "/verify-email?token="+url.QueryEscape(forged), "", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("JWT-secret token: status %d, want 400", rec.Code)
+	}
+
+	if rec := doJSON(e, http.MethodGet, "/verify-email?token="+url.QueryEscape(event.Token), "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("verify: status %d, body %s", rec.Code, rec.Body)
+	}
+	bob, err := env.users.GetByUsername("bob")
+	if err != nil || !bob.EmailVerified {
+		t.Fatalf("bob not verified: %+v, %v", bob, err)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// hashedAssetPattern matches build outputs with a content hash in the name,
+// e.g. main.3f2a9c1b.js; they never change and can be cached for good
+var hashedAssetPattern = regexp.MustCompile(`\.[0-9a-f]{8,}\.(chunk\.)?[a-z0-9]+$`)
+
+// frontendPlaceholder is served instead of index.html when the binary was
+// built without the UI, which is normal during backend-only development
+const frontendPlaceholder = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Monex - UI not built</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 40rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+code, pre { background: #f3f3f3; border-radius: 4px; }
+pre { padding: .75rem 1rem; }
+</style>
+</head>
+<body>
+<h1>The Monex API is running, but the UI isn't embedded</h1>
+<p>This binary was built without <code>frontend/build/index.html</code>. The API under <code>/api</code> works normally.</p>
+<p>To embed the UI, build the frontend and rebuild the server:</p>
+<pre>cd frontend &amp;&amp; npm install &amp;&amp; npm run build
+cd .. &amp;&amp; go build</pre>
+<p>Or, while working on the frontend, start its dev server and point Monex at it:</p>
+<pre>FRONTEND_DEV_URL=http://localhost:3000</pre>
+</body>
+</html>
+`
+
+// FrontendHandler serves the embedded single-page app. index.html is read
+// once at startup and served from memory with an ETag, so navigation only
+// costs a 304 once the browser has it.
+type FrontendHandler struct {
+	index     []byte // nil when the UI wasn't built into the binary
+	indexETag string
+	loadedAt  time.Time // Last-Modified; embedded files carry no mod time
+	static    http.Handler
+
+	// devProxy forwards every UI route to FRONTEND_DEV_URL when set
+	devProxy *httputil.ReverseProxy
+}
+
+// NewFrontendHandler serves files, or proxies to devURL when it is non-nil
+func NewFrontendHandler(files fs.FS, devURL *url.URL) *FrontendHandler {
+	h := &FrontendHandler{
+		loadedAt: time.Now(),
+		static:   http.FileServer(http.FS(files)),
+	}
+
+	if devURL != nil {
+		h.devProxy = httputil.NewSingleHostReverseProxy(devURL)
+		director := h.devProxy.Director
+		h.devProxy.Director = func(req *http.Request) {
+			director(req)
+			req.Host = devURL.Host
+			// Drop the browser's encodings (e.g. br); the transport negotiates gzip
+			// itself and decompresses, so our gzip middleware compresses once
+			req.Header.Del("Accept-Encoding")
+		}
+	}
+
+	if index, err := fs.ReadFile(files, "index.html"); err == nil {
+		sum := sha256.Sum256(index)
+		h.index = index
+		h.indexETag = `"` + hex.EncodeToString(sum[:8]) + `"`
+	}
+	return h
+}
+
+// Embedded reports whether the binary carries a built UI
+func (h *FrontendHandler) Embedded() bool {
+	return h.index != nil
+}
+
+// Index answers every non-API route with index.html so client-side routing
+// works; If-None-Match and If-Modified-Since get a 304
+func (h *FrontendHandler) Index(c echo.Context) error {
+	if h.devProxy != nil {
+		h.devProxy.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+	if h.index == nil {
+		c.Response().Header().Set("Cache-Control", "no-store")
+		return c.HTML(http.StatusOK, frontendPlaceholder)
+	}
+
+	header := c.Response().Header()
+	header.Set("ETag", h.indexETag)
+	header.Set("Cache-Control", "no-cache") // always revalidate, the next build changes it
+	header.Set(echo.HeaderContentType, "text/html; charset=utf-8")
+
+	http.ServeContent(c.Response(), c.Request(), "index.html", h.loadedAt, bytes.NewReader(h.index))
+	return nil
+}
+
+// Static serves /static/* from the build; content-hashed assets are cached
+// for a year, anything else is revalidated
+func (h *FrontendHandler) Static(c echo.Context) error {
+	if h.devProxy != nil {
+		h.devProxy.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+
+	if hashedAssetPattern.MatchString(path.Base(c.Request().URL.Path)) {
+		c.Response().Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Response().Header().Set("Cache-Control", "no-cache")
+	}
+
+	h.static.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIndexRevalidatesWithETag(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":                 {Data: []byte("<!DOCTYPE html><title>Monex</title>")},
+		"static/js/main.js":          {Data: []byte("console.log('main')")},
+		"static/js/main.3f2a9c1b.js": {Data: []byte("console.log('hashed')")},
+	}
+	h := NewFrontendHandler(files, nil)
+	e := newEcho()
+	e.GET("/static/*", h.Static)
+	e.GET("/*", h.Index)
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		return doJSON(e, http.MethodGet, path, "", header)
+	}
+
+	rec := get("/transactions", nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Body.String() != "<!DOCTYPE html><title>Monex</title>" {
+		t.Fatalf("client route: status %d, etag %q, body %q; want index.html with an ETag", rec.Code, etag, rec.Body)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("index Cache-Control %q, want no-cache", cc)
+	}
+
+	rec = get("/", http.Header{"If-None-Match": {etag}})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("matching If-None-Match: status %d, %d bytes; want empty 304", rec.Code, rec.Body.Len())
+	}
+
+	rec = get("/", http.Header{"If-None-Match": {`"stale"`}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stale If-None-Match: status %d, want 200", rec.Code)
+	}
+
+	rec = get("/static/js/main.3f2a9c1b.js", nil)
+	if cc := rec.Header().Get("Cache-Control"); rec.Code != http.StatusOK || cc != "public, max-age=31536000, immutable" {
+		t.Errorf("hashed asset: status %d, Cache-Control %q; want 200 immutable", rec.Code, cc)
+	}
+	rec = get("/static/js/main.js", nil)
+	if cc := rec.Header().Get("Cache-Control"); rec.Code != http.StatusOK || cc != "no-cache" {
+		t.Errorf("unhashed asset: status %d, Cache-Control %q; want 200 no-cache", rec.Code, cc)
+	}
+}
+
+func TestPlaceholderWithoutEmbeddedUI(t *testing.T) {
+	h := NewFrontendHandler(fstest.MapFS{"static/js/main.js": {Data: []byte("//")}}, nil)
+	if h.Embedded() {
+		t.Fatal("Embedded() true without index.html")
+	}
+	e := newEcho()
+	e.GET("/*", h.Index)
+
+	rec := doJSON(e, http.MethodGet, "/dashboard", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "the UI isn't embedded") {
+		t.Fatalf("status %d, body %q; want 200 with the placeholder page", rec.Code, rec.Body)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("placeholder Cache-Control %q, want no-store", cc)
+	}
+	if rec.Header().Get("ETag") != "" {
+		t.Error("placeholder carries an ETag")
+	}
+}
+
+func TestDevURLProxiesUIRoutes(t *testing.T) {
+	dev := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("dev server " + r.URL.Path))
+	}))
+	defer dev.Close()
+	devURL, err := url.Parse(dev.URL)
+	if err != nil {
+		t.Fatalf("parse dev url: %v", err)
+	}
+
+	h := NewFrontendHandler(fstest.MapFS{"index.html": {Data: []byte("embedded")}}, devURL)
+	e := newEcho()
+	e.GET("/static/*", h.Static)
+	e.GET("/*", h.Index)
+
+	for _, path := range []string{"/settings", "/static/js/main.js"} {
+		rec := doJSON(e, http.MethodGet, path, "", nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != "dev server "+path {
+			t.Errorf("GET %s: status %d, body %q; want it proxied to the dev server", path, rec.Code, rec.Body)
+		}
+	}
+}
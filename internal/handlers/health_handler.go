@@ -36,6 +36,16 @@ type DatabaseHealth struct {
 	Status      string `json:"status"`
 	Ping        string `json:"ping"`
 	Connections int    `json:"open_connections"`
+	InUse       int    `json:"in_use_connections"`
+	Idle        int    `json:"idle_connections"`
+	WaitCount   int64  `json:"wait_count"`
+
+	// Statements slower than SLOW_QUERY_MS since startup
+	SlowQueries uint64 `json:"slow_queries"`
+
+	// Applied schema version and the version this binary migrates to
+	SchemaVersion         int `json:"schema_version"`
+	ExpectedSchemaVersion int `json:"expected_schema_version"`
 }
 
 type SystemHealth struct {
@@ -49,7 +59,7 @@ type SystemHealth struct {
 func (h *HealthHandler) HealthCheck(c echo.Context) error {
 	response := &HealthResponse{
 		Status:    "healthy",
-		Timestamp: time.Now(),
+		Timestamp: time.Now().UTC(),
 		Uptime:    time.Since(h.startTime).String(),
 	}
 
@@ -102,6 +112,18 @@ func (h *HealthHandler) checkDatabase() DatabaseHealth {
 	// Get connection stats
 	stats := h.db.Stats()
 	health.Connections = stats.OpenConnections
+	health.InUse = stats.InUse
+	health.Idle = stats.Idle
+	health.WaitCount = stats.WaitCount
+	health.SlowQueries = h.db.SlowQueries()
+
+	// ✅ A schema that differs from the binary's migrations is degraded
+	health.ExpectedSchemaVersion = database.LatestSchemaVersion()
+	version, err := h.db.SchemaVersion()
+	health.SchemaVersion = version
+	if err != nil || version != health.ExpectedSchemaVersion {
+		health.Status = "degraded"
+	}
 
 	return health
 }
@@ -124,7 +146,7 @@ func (h *HealthHandler) SimpleHealthCheck(c echo.Context) error {
 	// Just check if server is responding
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"status":    "ok",
-		"timestamp": time.Now(),
+		"timestamp": time.Now().UTC(),
 	})
 }
 
@@ -138,8 +160,31 @@ func (h *HealthHandler) ReadinessCheck(c echo.Context) error {
 		})
 	}
 
+	// ✅ Don't take traffic until the schema matches this binary (e.g. mid rolling deploy)
+	expected := database.LatestSchemaVersion()
+	version, err := h.db.SchemaVersion()
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "not_ready",
+			"reason": "schema version unavailable",
+		})
+	}
+	if version != expected {
+		reason := "schema migrations pending"
+		if version > expected {
+			reason = "database schema is newer than this binary"
+		}
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"status":                  "not_ready",
+			"reason":                  reason,
+			"schema_version":          version,
+			"expected_schema_version": expected,
+		})
+	}
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"status": "ready",
+		"status":         "ready",
+		"schema_version": version,
 	})
 }
 
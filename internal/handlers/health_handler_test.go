@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"Monex/internal/database"
+)
+
+func TestReadinessFollowsSchemaVersion(t *testing.T) {
+	env := newTestEnv(t)
+	h := NewHealthHandler(env.db)
+	e := newEcho()
+	e.GET("/ready", h.ReadinessCheck)
+	latest := database.LatestSchemaVersion()
+
+	ready := func() (int, map[string]interface{}) {
+		t.Helper()
+		rec := doJSON(e, http.MethodGet, "/ready", "", nil)
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+		return rec.Code, body
+	}
+
+	if code, body := ready(); code != http.StatusOK || body["schema_version"] != float64(latest) {
+		t.Fatalf("migrated database: status %d, body %v; want 200 at version %d", code, body, latest)
+	}
+
+	// The latest migration not applied yet
+	if _, err := env.db.Exec("DELETE FROM schema_migrations WHERE version = ?", latest); err != nil {
+		t.Fatalf("drop migration record: %v", err)
+	}
+	if code, body := ready(); code != http.StatusServiceUnavailable || body["reason"] != "schema migrations pending" {
+		t.Fatalf("pending migration: status %d, body %v; want 503 pending", code, body)
+	}
+
+	// A newer binary already migrated the database
+	if _, err := env.db.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, 'future'), (?, 'restored')", latest+1, latest); err != nil {
+		t.Fatalf("record future migration: %v", err)
+	}
+	code, body := ready()
+	if code != http.StatusServiceUnavailable || body["reason"] != "database schema is newer than this binary" {
+		t.Fatalf("newer schema: status %d, body %v; want 503 newer", code, body)
+	}
+	if body["schema_version"] != float64(latest+1) || body["expected_schema_version"] != float64(latest) {
+		t.Errorf("versions reported %v/%v, want %d/%d", body["schema_version"], body["expected_schema_version"], latest+1, latest)
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"Monex/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// numbersAsStrings reports whether the client asked for amounts as strings.
+// JavaScript numbers lose precision above 2^53, so clients that may see huge
+// balances send numbersAsStrings=true.
+func numbersAsStrings(c echo.Context) bool {
+	value, _ := strconv.ParseBool(c.QueryParam("numbersAsStrings"))
+	return value
+}
+
+// amountsView wraps v for serialization so amounts, balances and stats
+// totals become strings when the client asked for them; otherwise v is
+// returned unchanged
+func amountsView(c echo.Context, v interface{}) interface{} {
+	if !numbersAsStrings(c) {
+		return v
+	}
+
+	switch value := v.(type) {
+	case *models.Transaction:
+		return stringAmountTransaction{value}
+	case []*models.Transaction:
+		return stringAmountTransactions(value)
+	case *models.TransactionStats:
+		return stringAmountStats{value}
+	case DashboardResponse:
+		return stringAmountDashboard{value}
+	default:
+		return v
+	}
+}
+
+// stringAmountTransaction serializes a transaction with string amounts
+type stringAmountTransaction struct {
+	*models.Transaction
+}
+
+func stringAmountTransactions(transactions []*models.Transaction) []stringAmountTransaction {
+	wrapped := make([]stringAmountTransaction, len(transactions))
+	for i, transaction := range transactions {
+		wrapped[i] = stringAmountTransaction{transaction}
+	}
+	return wrapped
+}
+
+func (t stringAmountTransaction) MarshalJSON() ([]byte, error) {
+	// plain drops the method set so Marshal doesn't recurse; the outer
+	// fields shadow the embedded numeric ones
+	type plain models.Transaction
+
+	var balanceAfter *string
+	if t.BalanceAfter != nil {
+		balance := strconv.Itoa(*t.BalanceAfter)
+		balanceAfter = &balance
+	}
+
+	return json.Marshal(struct {
+		*plain
+		Amount       string  `json:"amount"`
+		BalanceAfter *string `json:"balance_after,omitempty"`
+	}{
+		plain:        (*plain)(t.Transaction),
+		Amount:       strconv.Itoa(t.Amount),
+		BalanceAfter: balanceAfter,
+	})
+}
+
+// stringAmountDashboard serializes the dashboard with string stats and
+// transaction amounts
+type stringAmountDashboard struct {
+	DashboardResponse
+}
+
+func (d stringAmountDashboard) MarshalJSON() ([]byte, error) {
+	type plain DashboardResponse
+	return json.Marshal(struct {
+		plain
+		Stats              stringAmountStats         `json:"stats"`
+		RecentTransactions []stringAmountTransaction `json:"recent_transactions"`
+	}{
+		plain:              plain(d.DashboardResponse),
+		Stats:              stringAmountStats{d.Stats},
+		RecentTransactions: stringAmountTransactions(d.RecentTransactions),
+	})
+}
+
+// stringAmountStats serializes stats with string totals; the transaction
+// count stays a number
+type stringAmountStats struct {
+	*models.TransactionStats
+}
+
+func (s stringAmountStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TotalDeposit  string `json:"totalDeposit"`
+		TotalWithdraw string `json:"totalWithdraw"`
+		TotalExpense  string `json:"totalExpense"`
+		Balance       string `json:"balance"`
+		Transactions  int    `json:"transactions"`
+	}{
+		TotalDeposit:  strconv.Itoa(s.TotalDeposit),
+		TotalWithdraw: strconv.Itoa(s.TotalWithdraw),
+		TotalExpense:  strconv.Itoa(s.TotalExpense),
+		Balance:       strconv.Itoa(s.Balance),
+		Transactions:  s.Transactions,
+	})
+}
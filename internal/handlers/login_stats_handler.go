@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultLoginStatsDays = 30
+	maxLoginStatsDays     = 366 // caps the number of daily buckets
+	defaultLoginStatsTop  = 10
+	maxLoginStatsTop      = 50
+)
+
+type LoginStatsHandler struct {
+	loginAttemptRepo *repository.LoginAttemptRepository
+}
+
+func NewLoginStatsHandler(loginAttemptRepo *repository.LoginAttemptRepository) *LoginStatsHandler {
+	return &LoginStatsHandler{loginAttemptRepo: loginAttemptRepo}
+}
+
+// GetLoginStats returns daily success/failure counts, top offending IPs and
+// most-targeted usernames. from/to are inclusive UTC dates (YYYY-MM-DD) and
+// default to the last 30 days.
+func (h *LoginStatsHandler) GetLoginStats(c echo.Context) error {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	to := today
+	if toParam := c.QueryParam("to"); toParam != "" {
+		parsed, err := time.Parse("2006-01-02", toParam)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "تاریخ پایان نامعتبر است (YYYY-MM-DD)")
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -(defaultLoginStatsDays - 1))
+	if fromParam := c.QueryParam("from"); fromParam != "" {
+		parsed, err := time.Parse("2006-01-02", fromParam)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "تاریخ شروع نامعتبر است (YYYY-MM-DD)")
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		return echo.NewHTTPError(http.StatusBadRequest, "تاریخ شروع باید قبل از تاریخ پایان باشد")
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxLoginStatsDays {
+		return echo.NewHTTPError(http.StatusBadRequest, "بازه زمانی حداکثر ۳۶۶ روز است")
+	}
+
+	top, _ := strconv.Atoi(c.QueryParam("top"))
+	if top < 1 {
+		top = defaultLoginStatsTop
+	}
+	if top > maxLoginStatsTop {
+		top = maxLoginStatsTop
+	}
+
+	// to is inclusive, so query up to the start of the following day
+	stats, err := h.loginAttemptRepo.GetStats(from, to.AddDate(0, 0, 1), top)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت آمار ورود")
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// LongOperations tracks backups and imports that must not be cut off
+// mid-write; shutdown drains it before the server stops
+var LongOperations = NewOperationTracker()
+
+// OperationTracker counts in-flight long operations by name. Once draining
+// starts no new operation is admitted, so the wait can't be extended forever.
+type OperationTracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	running  map[string]int
+	draining bool
+}
+
+func NewOperationTracker() *OperationTracker {
+	return &OperationTracker{running: make(map[string]int)}
+}
+
+// Begin registers an operation. The returned done must be called exactly
+// once when it finishes; ok is false while the server is shutting down.
+func (t *OperationTracker) Begin(name string) (done func(), ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return nil, false
+	}
+	t.running[name]++
+	t.wg.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			if t.running[name]--; t.running[name] == 0 {
+				delete(t.running, name)
+			}
+			t.mu.Unlock()
+			t.wg.Done()
+		})
+	}, true
+}
+
+// Drain stops admitting operations and waits for the running ones to
+// finish, or for ctx to end, in which case the operations still running are
+// logged and ctx's error returned
+func (t *OperationTracker) Drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		still := make(map[string]int, len(t.running))
+		for name, n := range t.running {
+			still[name] = n
+		}
+		t.mu.Unlock()
+		slog.Warn("Shutdown timeout reached with operations still running", "operations", still)
+		return ctx.Err()
+	}
+}
+
+// Running reports how many operations are in flight
+func (t *OperationTracker) Running() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, count := range t.running {
+		n += count
+	}
+	return n
+}
+
+// errShuttingDown answers requests for long operations during shutdown
+func errShuttingDown() error {
+	return echo.NewHTTPError(http.StatusServiceUnavailable, map[string]interface{}{
+		"message": "سرور در حال خاموش شدن است. لطفا بعدا تلاش کنید",
+		"code":    "shutting_down",
+	})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDrainWaitsForOperations(t *testing.T) {
+	tracker := NewOperationTracker()
+	done, ok := tracker.Begin("backup_download")
+	if !ok {
+		t.Fatal("Begin refused before shutdown")
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- tracker.Drain(context.Background()) }()
+
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain returned %v with a backup still running", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Draining refuses new operations, so the wait can't be extended
+	if _, ok := tracker.Begin("user_import"); ok {
+		t.Fatal("Begin admitted an operation while draining")
+	}
+
+	done()
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatalf("Drain: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Drain still waiting after the operation finished")
+	}
+	if n := tracker.Running(); n != 0 {
+		t.Fatalf("Running = %d after drain", n)
+	}
+}
+
+func TestDrainGivesUpAtDeadline(t *testing.T) {
+	tracker := NewOperationTracker()
+	done, _ := tracker.Begin("scheduled_backup")
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := tracker.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain = %v, want DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"Monex/internal/middleware"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	errStreamNotFound     = errors.New("notification stream not found")
+	errStreamTokenInvalid = errors.New("token is not valid for this stream")
+)
+
+// streamAuth holds the credentials an open notification stream is
+// revalidated with. The token starts as the one the stream connected with
+// and is replaced on reauth, so a stream outlives its first access token.
+type streamAuth struct {
+	id     string
+	userID int
+
+	mu        sync.Mutex
+	token     string
+	sessionID int
+}
+
+func (s *streamAuth) credentials() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token, s.sessionID
+}
+
+func (s *streamAuth) replace(token string, sessionID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token, s.sessionID = token, sessionID
+}
+
+// newStreamID returns a random, unguessable stream ID
+func newStreamID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// openStream makes stream reachable by its ID for reauth
+func (h *NotificationHub) openStream(stream *streamAuth) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.streams[stream.id] = stream
+}
+
+// closeStream forgets a stream once its connection ends
+func (h *NotificationHub) closeStream(stream *streamAuth) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.streams, stream.id)
+}
+
+// reauthorize moves the stream streamID of userID onto token, which must be
+// a valid access token of the same user. Other users' streams are reported
+// as not found.
+func (v *streamRevalidator) reauthorize(streamID string, userID int, token string) error {
+	if middleware.Blacklist.Contains(token) {
+		return errStreamTokenInvalid
+	}
+	claims, err := v.jwtManager.ValidateTokenType(token, middleware.TokenTypeAccess)
+	if err != nil || claims.UserID != userID {
+		return errStreamTokenInvalid
+	}
+
+	v.hub.mu.RLock()
+	stream, ok := v.hub.streams[streamID]
+	v.hub.mu.RUnlock()
+	if !ok || stream.userID != userID {
+		return errStreamNotFound
+	}
+
+	stream.replace(token, v.sessionFor(token))
+	return nil
+}
+
+// reauthEvent acknowledges a WebSocket reauth frame
+func reauthEvent(err error) NotificationEvent {
+	if err != nil {
+		return NotificationEvent{
+			Type:      "reauth_failed",
+			Message:   "توکن جدید پذیرفته نشد",
+			Severity:  "warning",
+			Timestamp: time.Now().UTC(),
+		}
+	}
+	return NotificationEvent{
+		Type:      "reauthenticated",
+		Message:   "توکن اتصال به‌روزرسانی شد",
+		Severity:  "info",
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// ReauthStreamRequest names the open stream to move onto the request's token
+type ReauthStreamRequest struct {
+	StreamID string `json:"stream_id"`
+}
+
+// ReauthStream hands the access token of this request to an open SSE or
+// WebSocket notification stream, identified by the stream_id of its
+// connected event. Clients call it after refreshing their token so the
+// stream isn't closed when the token it connected with expires.
+func (h *SSEHandler) ReauthStream(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	var req ReauthStreamRequest
+	if err := c.Bind(&req); err != nil || req.StreamID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه اتصال الزامی است")
+	}
+
+	err = h.revalidator.reauthorize(req.StreamID, userID, middleware.ExtractBearerToken(c))
+	if errors.Is(err, errStreamNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, map[string]string{
+			"message": "اتصال اعلان یافت نشد",
+			"code":    "stream_not_found",
+		})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "توکن نامعتبر است")
+	}
+
+	slog.Info("Notification stream reauthenticated", "user_id", userID)
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "توکن اتصال به‌روزرسانی شد",
+	})
+}
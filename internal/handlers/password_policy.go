@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"Monex/config"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password policy violation codes, returned to the client so the UI can
+// highlight the unmet requirement
+const (
+	PasswordTooShort      = "password_too_short"
+	PasswordMissingUpper  = "password_missing_upper"
+	PasswordMissingDigit  = "password_missing_digit"
+	PasswordMissingSymbol = "password_missing_symbol"
+	PasswordTooCommon     = "password_too_common"
+	PasswordReused        = "password_reused"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsData string
+
+// commonPasswords holds the embedded list, lowercased
+var commonPasswords = func() map[string]bool {
+	set := make(map[string]bool)
+	for _, line := range strings.Split(commonPasswordsData, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			set[strings.ToLower(line)] = true
+		}
+	}
+	return set
+}()
+
+// PasswordPolicyError lists every rule a password failed
+type PasswordPolicyError struct {
+	Violations []string
+	Message    string // description of the first violation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Message
+}
+
+// ValidatePasswordStrength checks pw against the policy and returns a
+// *PasswordPolicyError describing all failed rules, or nil
+func ValidatePasswordStrength(pw string, policy *config.PasswordPolicyConfig) error {
+	var violations, messages []string
+	fail := func(code, message string) {
+		violations = append(violations, code)
+		messages = append(messages, message)
+	}
+
+	if len([]rune(pw)) < policy.MinLength {
+		fail(PasswordTooShort, fmt.Sprintf("کلمه عبور بایستی حداقل %d کاراکتر باشد", policy.MinLength))
+	}
+
+	var hasUpper, hasDigit, hasSymbol bool
+	for _, r := range pw {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	if policy.RequireUpper && !hasUpper {
+		fail(PasswordMissingUpper, "کلمه عبور بایستی حداقل یک حرف بزرگ داشته باشد")
+	}
+	if policy.RequireDigit && !hasDigit {
+		fail(PasswordMissingDigit, "کلمه عبور بایستی حداقل یک عدد داشته باشد")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		fail(PasswordMissingSymbol, "کلمه عبور بایستی حداقل یک نماد (مانند !@#) داشته باشد")
+	}
+	if policy.RejectCommon && commonPasswords[strings.ToLower(pw)] {
+		fail(PasswordTooCommon, "این کلمه عبور بسیار رایج است. کلمه عبور دیگری انتخاب کنید")
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return &PasswordPolicyError{Violations: violations, Message: messages[0]}
+}
+
+// temporaryPasswordLength is the minimum length of generated passwords
+const temporaryPasswordLength = 16
+
+// generateTemporaryPassword returns a random password that satisfies every
+// rule of the policy: at least one upper, lower, digit and symbol character
+// and at least temporaryPasswordLength (or the policy minimum) long
+func generateTemporaryPassword(policy *config.PasswordPolicyConfig) (string, error) {
+	classes := []string{
+		"ABCDEFGHJKLMNPQRSTUVWXYZ",
+		"abcdefghijkmnopqrstuvwxyz",
+		"23456789",
+		"!@#$%^&*-_=+?",
+	}
+	all := strings.Join(classes, "")
+
+	length := temporaryPasswordLength
+	if policy.MinLength > length {
+		length = policy.MinLength
+	}
+
+	pick := func(charset string) (byte, error) {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		if err != nil {
+			return 0, err
+		}
+		return charset[n.Int64()], nil
+	}
+
+	password := make([]byte, 0, length)
+	for len(password) < length {
+		charset := all
+		if len(password) < len(classes) {
+			charset = classes[len(password)]
+		}
+		c, err := pick(charset)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// Shuffle so the guaranteed classes aren't always first
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+// checkPasswordReuse rejects pw if it is the user's current password or one
+// of their last policy.HistorySize passwords
+func checkPasswordReuse(
+	pw string,
+	user *models.User,
+	historyRepo *repository.PasswordHistoryRepository,
+	policy *config.PasswordPolicyConfig,
+) error {
+	if policy.HistorySize == 0 {
+		return nil
+	}
+
+	reused := &PasswordPolicyError{
+		Violations: []string{PasswordReused},
+		Message:    fmt.Sprintf("کلمه عبور جدید نباید با %d کلمه عبور اخیر شما یکسان باشد", policy.HistorySize),
+	}
+
+	if user.CheckPassword(pw) {
+		return reused
+	}
+
+	// The current password counts as one of the remembered ones
+	hashes, err := historyRepo.Recent(user.ID, policy.HistorySize-1)
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil {
+			return reused
+		}
+	}
+	return nil
+}
+
+// passwordPolicyHTTPError converts a policy failure into a 400 response
+// carrying the first violation as code and the full list as violations
+func passwordPolicyHTTPError(err error) *echo.HTTPError {
+	policyErr, ok := err.(*PasswordPolicyError)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+		"message":    policyErr.Message,
+		"code":       policyErr.Violations[0],
+		"violations": policyErr.Violations,
+	})
+}
+
+// maxPasswordHistoryEntries bounds the password changes listed at once
+const maxPasswordHistoryEntries = 100
+
+// listPasswordChanges returns the user's password change times, newest first
+func listPasswordChanges(historyRepo *repository.PasswordHistoryRepository, userID int) ([]models.PasswordChange, error) {
+	times, err := historyRepo.ChangeTimes(userID, maxPasswordHistoryEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]models.PasswordChange, len(times))
+	for i, changedAt := range times {
+		changes[i] = models.PasswordChange{ChangedAt: changedAt}
+	}
+	return changes, nil
+}
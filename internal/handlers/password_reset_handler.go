@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"Monex/config"
+	"Monex/internal/logger"
+	"Monex/internal/models"
+	"Monex/internal/notifier"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+type PasswordResetHandler struct {
+	userRepo           *repository.UserRepository
+	resetRepo          *repository.PasswordResetRepository
+	historyRepo        *repository.PasswordHistoryRepository
+	sessionRepo        *repository.SessionRepository
+	tokenBlacklistRepo *repository.TokenBlacklistRepository
+	auditRepo          *repository.AuditRepository
+	notifier           notifier.Notifier
+	config             *config.SecurityConfig
+}
+
+func NewPasswordResetHandler(
+	userRepo *repository.UserRepository,
+	resetRepo *repository.PasswordResetRepository,
+	historyRepo *repository.PasswordHistoryRepository,
+	sessionRepo *repository.SessionRepository,
+	tokenBlacklistRepo *repository.TokenBlacklistRepository,
+	auditRepo *repository.AuditRepository,
+	securityNotifier notifier.Notifier,
+	cfg *config.SecurityConfig,
+) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		userRepo:           userRepo,
+		resetRepo:          resetRepo,
+		historyRepo:        historyRepo,
+		sessionRepo:        sessionRepo,
+		tokenBlacklistRepo: tokenBlacklistRepo,
+		auditRepo:          auditRepo,
+		notifier:           securityNotifier,
+		config:             cfg,
+	}
+}
+
+// ForgotPasswordRequest identifies the account by username or email
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// ResetPasswordRequest carries the emailed token and the new password
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+// ForgotPassword emails a single-use reset token through the notifier. The
+// response is identical whether or not the account exists, so the endpoint
+// can't be used to discover usernames or emails.
+func (h *PasswordResetHandler) ForgotPassword(c echo.Context) error {
+	req := new(ForgotPasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "درخواست نامعتبر")
+	}
+
+	username := strings.TrimSpace(req.Username)
+	email := models.NormalizeEmail(req.Email)
+	if username == "" && email == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "نام کاربری یا ایمیل را وارد کنید")
+	}
+
+	response := map[string]string{
+		"message": "در صورت وجود حساب کاربری، لینک بازیابی کلمه عبور به ایمیل آن ارسال می‌شود",
+	}
+
+	var user *models.User
+	var err error
+	if email != "" {
+		user, err = h.userRepo.GetByEmail(email)
+	} else {
+		user, err = h.userRepo.GetByUsername(username)
+	}
+	if err != nil || !user.Active || user.PermanentlyLocked {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		slog.Error("Failed to generate reset token", "error", err)
+		return c.JSON(http.StatusOK, response)
+	}
+	token := hex.EncodeToString(tokenBytes)
+	expiresAt := time.Now().Add(h.config.PasswordResetTTL).UTC()
+
+	clientIP := c.RealIP()
+	if err := h.resetRepo.Create(user.ID, token, clientIP, expiresAt); err != nil {
+		slog.Error("Failed to store reset token", "user_id", user.ID, "error", err)
+		return c.JSON(http.StatusOK, response)
+	}
+
+	notifier.Dispatch(h.notifier, notifier.Event{
+		Type:      notifier.EventPasswordReset,
+		UserID:    user.ID,
+		Username:  user.Username,
+		IPAddress: clientIP,
+		Email:     user.Email,
+		Token:     token,
+		ExpiresAt: &expiresAt,
+	})
+
+	_ = h.auditRepo.LogAction(user.ID, "forgot_password", "user", clientIP,
+		c.Request().Header.Get("User-Agent"), true, "Password reset requested")
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword
+func (h *PasswordResetHandler) ResetPassword(c echo.Context) error {
+	req := new(ResetPasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "درخواست نامعتبر")
+	}
+	if req.Token == "" || req.NewPassword == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "توکن و کلمه عبور جدید را وارد کنید")
+	}
+
+	// Check the policy first so a weak password doesn't burn the token
+	if err := ValidatePasswordStrength(req.NewPassword, &h.config.PasswordPolicy); err != nil {
+		return passwordPolicyHTTPError(err)
+	}
+
+	clientIP := c.RealIP()
+	userAgent := c.Request().Header.Get("User-Agent")
+
+	userID, err := h.resetRepo.Validate(req.Token)
+	if err != nil {
+		if errors.Is(err, repository.ErrResetTokenExpired) {
+			return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+				"message": "لینک بازیابی کلمه عبور منقضی شده است. دوباره درخواست دهید",
+				"code":    "reset_token_expired",
+			})
+		}
+		if !errors.Is(err, repository.ErrResetTokenInvalid) {
+			slog.Error("Failed to validate reset token", "error", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بازیابی کلمه عبور")
+		}
+		logger.Security("Invalid password reset token", "ip", clientIP)
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+			"message": "لینک بازیابی کلمه عبور نامعتبر است",
+			"code":    "reset_token_invalid",
+		})
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+
+	if err := checkPasswordReuse(req.NewPassword, user, h.historyRepo, &h.config.PasswordPolicy); err != nil {
+		var policyErr *PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return passwordPolicyHTTPError(err)
+		}
+		slog.Error("Failed to check password history", "user_id", user.ID, "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بازیابی کلمه عبور")
+	}
+
+	// Consume only now so a rejected password doesn't burn the token; this also
+	// fails if a concurrent request used the token in the meantime
+	if _, err := h.resetRepo.Consume(req.Token); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+			"message": "لینک بازیابی کلمه عبور نامعتبر است",
+			"code":    "reset_token_invalid",
+		})
+	}
+
+	previousHash := user.Password
+	if err := user.SetPassword(req.NewPassword, h.config.BcryptCost); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در رمزگذاری کلمه عبور")
+	}
+	if err := h.userRepo.UpdatePassword(user.ID, user.Password); err != nil {
+		slog.Error("Failed to reset password", "user_id", user.ID, "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بازیابی کلمه عبور")
+	}
+	if err := h.historyRepo.Add(user.ID, previousHash); err != nil {
+		slog.Warn("Failed to record password history", "user_id", user.ID, "error", err)
+	}
+
+	if h.config.PasswordResetRevokeSessions {
+		if err := revokeUserSessions(h.sessionRepo, h.tokenBlacklistRepo, user.ID, "Password reset"); err != nil {
+			slog.Warn("Failed to revoke sessions after password reset", "user_id", user.ID, "error", err)
+		}
+	}
+
+	logger.Security("Password reset via token", "user_id", user.ID, "ip", clientIP)
+	_ = h.auditRepo.LogActionWithSeverity(user.ID, "reset_password_token", "user", clientIP, userAgent, true,
+		fmt.Sprintf("Password reset via emailed token (sessions revoked: %t)", h.config.PasswordResetRevokeSessions),
+		"warning")
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "کلمه عبور با موفقیت تغییر کرد. اکنون وارد شوید"})
+}
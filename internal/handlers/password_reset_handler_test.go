@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"Monex/internal/notifier"
+)
+
+func TestPasswordResetCycle(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "carol", "Str0ng!Passw0rd", "user")
+	events := make(captureNotifier, 4)
+
+	h := NewPasswordResetHandler(env.users, env.passwordResets, env.passwordHistory,
+		env.sessions, env.blacklist, env.audit, events, &env.cfg.Security)
+	e := newEcho()
+	e.POST("/forgot", h.ForgotPassword)
+	e.POST("/reset", h.ResetPassword)
+
+	// Unknown accounts get the same answer and no email
+	unknown := doJSON(e, http.MethodPost, "/forgot", `{"username":"nobody"}`, nil)
+	known := doJSON(e, http.MethodPost, "/forgot", `{"email":"carol@example.com"}`, nil)
+	if unknown.Code != http.StatusOK || known.Code != http.StatusOK || unknown.Body.String() != known.Body.String() {
+		t.Fatalf("forgot-password answers differ: %d %s / %d %s", unknown.Code, unknown.Body, known.Code, known.Body)
+	}
+
+	var event notifier.Event
+	select {
+	case event = <-events:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no reset email sent")
+	}
+	if event.Type != notifier.EventPasswordReset || event.Username != "carol" || event.Token == "" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	select {
+	case extra := <-events:
+		t.Fatalf("email sent for an unknown account: %+v", extra)
+	default:
+	}
+
+	body, _ := json.Marshal(map[string]string{"token": event.Token, "new_password": "N3w!Passw0rd-x"})
+	if rec := doJSON(e, http.MethodPost, "/reset", string(body), nil); rec.Code != http.StatusOK {
+		t.Fatalf("reset: status %d, body %s", rec.Code, rec.Body)
+	}
+	carol, err := env.users.GetByUsername("carol")
+	if err != nil {
+		t.Fatalf("GetByUsername: %v", err)
+	}
+	if !carol.CheckPassword("N3w!Passw0rd-x") || carol.CheckPassword("Str0ng!Passw0rd") {
+		t.Fatal("password was not replaced")
+	}
+
+	// The token is single-use
+	body, _ = json.Marshal(map[string]string{"token": event.Token, "new_password": "An0ther!Passw0rd"})
+	rec := doJSON(e, http.MethodPost, "/reset", string(body), nil)
+	if rec.Code != http.StatusBadRequest || decodeCode(t, rec.Body.Bytes()) != "reset_token_invalid" {
+		t.Fatalf("reused token: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestPasswordResetExpiredToken(t *testing.T) {
+	env := newTestEnv(t)
+	dave := env.createUser(t, "dave", "Str0ng!Passw0rd", "user")
+
+	const token = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	if err := env.passwordResets.Create(dave.ID, token, "127.0.0.1", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	h := NewPasswordResetHandler(env.users, env.passwordResets, env.passwordHistory,
+		env.sessions, env.blacklist, env.audit, nil, &env.cfg.Security)
+	e := newEcho()
+	e.POST("/reset", h.ResetPassword)
+
+	body, _ := json.Marshal(map[string]string{"token": token, "new_password": "N3w!Passw0rd-x"})
+	rec := doJSON(e, http.MethodPost, "/reset", string(body), nil)
+	if rec.Code != http.StatusBadRequest || decodeCode(t, rec.Body.Bytes()) != "reset_token_expired" {
+		t.Fatalf("expired token: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	dave, _ = env.users.GetByUsername("dave")
+	if !dave.CheckPassword("Str0ng!Passw0rd") {
+		t.Fatal("expired token changed the password")
+	}
+}
@@ -1,26 +1,41 @@
 package handlers
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"Monex/config"
 	"Monex/internal/middleware"
+	"Monex/internal/models"
 	"Monex/internal/repository"
 
 	"github.com/labstack/echo/v4"
 )
 
 type ProfileHandler struct {
-	userRepo *repository.UserRepository
-	config   *config.SecurityConfig
+	userRepo    *repository.UserRepository
+	historyRepo *repository.PasswordHistoryRepository
+	sessionRepo *repository.SessionRepository
+	auditRepo   *repository.AuditRepository
+	config      *config.SecurityConfig
 }
 
-func NewProfileHandler(userRepo *repository.UserRepository, cfg *config.SecurityConfig) *ProfileHandler {
+func NewProfileHandler(
+	userRepo *repository.UserRepository,
+	historyRepo *repository.PasswordHistoryRepository,
+	sessionRepo *repository.SessionRepository,
+	auditRepo *repository.AuditRepository,
+	cfg *config.SecurityConfig,
+) *ProfileHandler {
 	return &ProfileHandler{
-		userRepo: userRepo,
-		config:   cfg,
+		userRepo:    userRepo,
+		historyRepo: historyRepo,
+		sessionRepo: sessionRepo,
+		auditRepo:   auditRepo,
+		config:      cfg,
 	}
 }
 
@@ -32,7 +47,7 @@ type UpdateProfileRequest struct {
 // ChangePasswordRequest represents password change data
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" validate:"required"`
-	NewPassword string `json:"new_password" validate:"required,min=8"`
+	NewPassword string `json:"new_password" validate:"required"`
 }
 
 // GetProfile returns the current user's profile
@@ -44,12 +59,95 @@ func (h *ProfileHandler) GetProfile(c echo.Context) error {
 
 	user, err := h.userRepo.GetByID(userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
 	}
 
 	return c.JSON(http.StatusOK, user.ToResponse())
 }
 
+// GetPasswordHistory lists when the current user changed their password
+func (h *ProfileHandler) GetPasswordHistory(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	changes, err := listPasswordChanges(h.historyRepo, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت تاریخچه کلمه عبور")
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"data":  changes,
+		"total": len(changes),
+	})
+}
+
+// Permissions are UI hints derived from the role; the server still enforces
+// every check on its own routes
+type Permissions struct {
+	CanManageUsers       bool `json:"can_manage_users"`
+	CanViewAuditLogs     bool `json:"can_view_audit_logs"`
+	CanViewLoginStats    bool `json:"can_view_login_stats"`
+	CanRevokeAllSessions bool `json:"can_revoke_all_sessions"`
+	CanShutdown          bool `json:"can_shutdown"`
+}
+
+func permissionsForRole(role string) Permissions {
+	isAdmin := role == models.RoleAdmin
+	return Permissions{
+		CanManageUsers:       isAdmin,
+		CanViewAuditLogs:     isAdmin,
+		CanViewLoginStats:    isAdmin,
+		CanRevokeAllSessions: isAdmin,
+		CanShutdown:          isAdmin,
+	}
+}
+
+// MeSession identifies the session behind the presented access token
+type MeSession struct {
+	ID       int    `json:"id"`
+	DeviceID string `json:"device_id"`
+}
+
+// MeResponse is the consolidated view of the current user
+type MeResponse struct {
+	User                      *models.UserResponse `json:"user"`
+	Permissions               Permissions          `json:"permissions"`
+	Session                   *MeSession           `json:"session"` // null when the token has no live session
+	PasswordChangeRequired    bool                 `json:"password_change_required"`
+	EmailVerificationRequired bool                 `json:"email_verification_required"`
+}
+
+// GetMe returns the profile together with role-derived permissions and the
+// current session, so clients don't have to hardcode role checks
+func (h *ProfileHandler) GetMe(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+
+	response := MeResponse{
+		User:                      user.ToResponse(),
+		Permissions:               permissionsForRole(user.Role),
+		PasswordChangeRequired:    user.PasswordChangeRequired,
+		EmailVerificationRequired: h.config.RequireEmailVerification && !user.EmailVerified,
+	}
+
+	// AuthMiddleware has already validated the header
+	token := strings.TrimSpace(strings.SplitN(c.Request().Header.Get("Authorization"), " ", 2)[1])
+	if session, err := h.sessionRepo.GetByAccessTokenHash(h.sessionRepo.HashToken(token)); err == nil && session.UserID == userID {
+		response.Session = &MeSession{ID: session.ID, DeviceID: session.DeviceID}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
 // UpdateProfile updates the current user's profile
 func (h *ProfileHandler) UpdateProfile(c echo.Context) error {
 	userID, err := middleware.GetUserID(c)
@@ -64,26 +162,38 @@ func (h *ProfileHandler) UpdateProfile(c echo.Context) error {
 
 	user, err := h.userRepo.GetByID(userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
 	}
+	before := *user
 
 	// Update email if provided
-	if req.Email != "" && req.Email != user.Email {
+	if email := models.NormalizeEmail(req.Email); email != "" && email != models.NormalizeEmail(user.Email) {
 		// Check if email exists
-		exists, err := h.userRepo.ExistsByEmail(strings.TrimSpace(req.Email))
+		exists, err := h.userRepo.ExistsByEmail(email)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بررسی ایمیل")
 		}
 		if exists {
 			return echo.NewHTTPError(http.StatusConflict, "ایمیل وارد شده از قبل موجود است")
 		}
-		user.Email = strings.TrimSpace(req.Email)
+		user.Email = email
+		user.EmailVerified = false // the new address must be confirmed again
 	}
 
 	if err := h.userRepo.Update(user); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بروز رسانی حساب کاربری")
 	}
 
+	_ = h.auditRepo.LogAction(
+		userID,
+		"update_profile",
+		"user",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		changeDetails(userID, &before, user, "updated_at"),
+	)
+
 	return c.JSON(http.StatusOK, user.ToResponse())
 }
 
@@ -103,13 +213,13 @@ func (h *ProfileHandler) ChangePassword(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "کلمه عبور قبلی و جدید را وارد کنید")
 	}
 
-	if len(req.NewPassword) < 8 {
-		return echo.NewHTTPError(http.StatusBadRequest, "کلمه عبور جدید بایستی حداقل 8 کاراکتر باشد")
+	if err := ValidatePasswordStrength(req.NewPassword, &h.config.PasswordPolicy); err != nil {
+		return passwordPolicyHTTPError(err)
 	}
 
 	user, err := h.userRepo.GetByID(userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
 	}
 
 	// ✅ For first-time password change, allow skipping old password check
@@ -119,6 +229,16 @@ func (h *ProfileHandler) ChangePassword(c echo.Context) error {
 		}
 	}
 
+	if err := checkPasswordReuse(req.NewPassword, user, h.historyRepo, &h.config.PasswordPolicy); err != nil {
+		var policyErr *PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return passwordPolicyHTTPError(err)
+		}
+		slog.Error("Failed to check password history", "user_id", user.ID, "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در تغییر رمز عبور")
+	}
+	previousHash := user.Password
+
 	// Set new password
 	if err := user.SetPassword(req.NewPassword, h.config.BcryptCost); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در رمزگذاری کلمه عبور")
@@ -126,13 +246,17 @@ func (h *ProfileHandler) ChangePassword(c echo.Context) error {
 
 	// ✅ Clear password change requirement
 	user.PasswordChangeRequired = false
-	now := time.Now()
+	now := time.Now().UTC()
 	user.LastPasswordChange = &now
 
 	if err := h.userRepo.Update(user); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در تغییر رمز عبور")
 	}
 
+	if err := h.historyRepo.Add(user.ID, previousHash); err != nil {
+		slog.Warn("Failed to record password history", "user_id", user.ID, "error", err)
+	}
+
 	return c.JSON(http.StatusOK, map[string]string{
 		"message": "کلمه عبور با موفقیت تغییر کرد",
 	})
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"Monex/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestMePermissionsFollowRole(t *testing.T) {
+	env := newTestEnv(t)
+	h := NewProfileHandler(env.users, env.passwordHistory, env.sessions, env.audit, &env.cfg.Security)
+
+	for _, tt := range []struct {
+		role string
+		want bool
+	}{
+		{models.RoleAdmin, true},
+		{models.RoleUser, false},
+	} {
+		user := env.createUser(t, "me-"+tt.role, "Str0ng!Passw0rd", tt.role)
+		access, _, sessionID := loginSession(t, env, user, "203.0.113.7")
+
+		e := newEcho()
+		e.GET("/me", h.GetMe, withUser(user))
+		rec := doJSON(e, http.MethodGet, "/me", "", bearer(access))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", tt.role, rec.Code, rec.Body)
+		}
+		var me MeResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &me); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+
+		want := Permissions{tt.want, tt.want, tt.want, tt.want, tt.want}
+		if me.Permissions != want {
+			t.Errorf("%s: permissions = %+v, want %+v", tt.role, me.Permissions, want)
+		}
+		if me.User == nil || me.User.ID != user.ID {
+			t.Errorf("%s: user = %+v, want id %d", tt.role, me.User, user.ID)
+		}
+		if me.Session == nil || me.Session.ID != sessionID {
+			t.Errorf("%s: session = %+v, want id %d", tt.role, me.Session, sessionID)
+		}
+	}
+}
+
+func TestPasswordHistoryListsOnlyOwnerTimestamps(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	bob := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	for userID, changes := range map[int]int{alice.ID: 2, bob.ID: 3} {
+		for i := 0; i < changes; i++ {
+			if err := env.passwordHistory.Add(userID, "$2a$04$secret-hash-of-an-old-password"); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+		}
+	}
+
+	// history returns the entries of a password history response as raw objects
+	history := func(e *echo.Echo, path string) []map[string]any {
+		t.Helper()
+		rec := doJSON(e, http.MethodGet, path, "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", path, rec.Code, rec.Body)
+		}
+		if strings.Contains(rec.Body.String(), "$2a$") {
+			t.Fatalf("%s: response holds a password hash: %s", path, rec.Body)
+		}
+		var resp struct {
+			Data []map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+		for _, entry := range resp.Data {
+			if len(entry) != 1 || entry["changed_at"] == nil {
+				t.Fatalf("%s: entry %v, want only changed_at", path, entry)
+			}
+		}
+		return resp.Data
+	}
+
+	profile := NewProfileHandler(env.users, env.passwordHistory, env.sessions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.GET("/profile/password-history", profile.GetPasswordHistory, withUser(alice))
+	if got := history(e, "/profile/password-history"); len(got) != 2 {
+		t.Errorf("own history has %d entries, want 2", len(got))
+	}
+
+	users := NewUserHandler(env.users, env.audit, env.sessions, env.blacklist, env.passwordHistory, nil, env.cfg)
+	e = newEcho()
+	e.GET("/users/:id/password-history", users.GetUserPasswordHistory, withUser(env.admin(t)))
+	if got := history(e, fmt.Sprintf("/users/%d/password-history", bob.ID)); len(got) != 3 {
+		t.Errorf("bob's history has %d entries, want 3", len(got))
+	}
+	if rec := doJSON(e, http.MethodGet, "/users/9999/password-history", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status %d, want 404", rec.Code)
+	}
+}
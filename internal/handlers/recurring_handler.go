@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Monex/internal/middleware"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RecurringHandler struct {
+	recurringRepo *repository.RecurringRepository
+	auditRepo     *repository.AuditRepository
+	maxNoteLength int
+}
+
+func NewRecurringHandler(recurringRepo *repository.RecurringRepository, auditRepo *repository.AuditRepository, maxNoteLength int) *RecurringHandler {
+	return &RecurringHandler{
+		recurringRepo: recurringRepo,
+		auditRepo:     auditRepo,
+		maxNoteLength: maxNoteLength,
+	}
+}
+
+// RecurringRequest represents recurring rule create/update data
+type RecurringRequest struct {
+	Type     string    `json:"type"`
+	Amount   int       `json:"amount"`
+	Note     *string   `json:"note"` // Omitted on update keeps the stored note
+	Interval string    `json:"interval"`
+	NextRun  time.Time `json:"next_run"` // Optional; defaults to now on create
+	Active   *bool     `json:"active"`
+}
+
+// ListRecurring returns the current user's recurring rules
+func (h *RecurringHandler) ListRecurring(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	rules, err := h.recurringRepo.ListByUser(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت تراکنش‌های تکراری")
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"data":  rules,
+		"total": len(rules),
+	})
+}
+
+// GetRecurring returns a single recurring rule
+func (h *RecurringHandler) GetRecurring(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه تراکنش تکراری نامعتبر")
+	}
+
+	rule, err := h.recurringRepo.GetByID(id, userID)
+	if err != nil {
+		return repositoryError(err, "تراکنش تکراری یافت نشد", "خطا در دریافت تراکنش تکراری")
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// CreateRecurring creates a new recurring rule
+func (h *RecurringHandler) CreateRecurring(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	req := new(RecurringRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "درخواست نامعتبر")
+	}
+
+	if req.Type == "" || req.Amount <= 0 || req.Interval == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "نوع تراکنش، مبلغ و بازه تکرار را وارد کنید")
+	}
+	if !isValidType(req.Type) {
+		return echo.NewHTTPError(http.StatusBadRequest, "نوع تراکنش نامعتبر است")
+	}
+	if !models.IsValidInterval(req.Interval) {
+		return echo.NewHTTPError(http.StatusBadRequest, "بازه تکرار نامعتبر است")
+	}
+	var note string
+	if req.Note != nil {
+		if note, err = validateNote(*req.Note, h.maxNoteLength); err != nil {
+			return err
+		}
+	}
+
+	nextRun := req.NextRun
+	if nextRun.IsZero() {
+		nextRun = time.Now()
+	}
+
+	rule := &models.RecurringTransaction{
+		UserID:   userID,
+		Type:     req.Type,
+		Amount:   req.Amount,
+		Note:     note,
+		Interval: req.Interval,
+		NextRun:  nextRun.UTC(),
+		Active:   req.Active == nil || *req.Active,
+	}
+
+	if err := h.recurringRepo.Create(rule); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطایی در ایجاد تراکنش تکراری رخ داده است")
+	}
+
+	_ = h.auditRepo.LogAction(
+		userID,
+		"create_recurring_transaction",
+		"recurring_transaction",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Created %s %s rule: %d", rule.Interval, rule.Type, rule.Amount),
+	)
+
+	return c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRecurring updates a recurring rule
+func (h *RecurringHandler) UpdateRecurring(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه تراکنش تکراری نامعتبر")
+	}
+
+	req := new(RecurringRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "درخواست نامعتبر")
+	}
+
+	rule, err := h.recurringRepo.GetByID(id, userID)
+	if err != nil {
+		return repositoryError(err, "تراکنش تکراری یافت نشد", "خطا در دریافت تراکنش تکراری")
+	}
+	before := *rule
+
+	// ✅ Update fields - only if provided and valid
+	if req.Type != "" {
+		if !isValidType(req.Type) {
+			return echo.NewHTTPError(http.StatusBadRequest, "نوع تراکنش نامعتبر است")
+		}
+		rule.Type = req.Type
+	}
+	if req.Interval != "" {
+		if !models.IsValidInterval(req.Interval) {
+			return echo.NewHTTPError(http.StatusBadRequest, "بازه تکرار نامعتبر است")
+		}
+		rule.Interval = req.Interval
+	}
+	if req.Amount > 0 {
+		rule.Amount = req.Amount
+	}
+	if !req.NextRun.IsZero() {
+		rule.NextRun = req.NextRun.UTC()
+		rule.AnchorDay = rule.NextRun.Day()
+	}
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+	if req.Note != nil {
+		note, err := validateNote(*req.Note, h.maxNoteLength)
+		if err != nil {
+			return err
+		}
+		rule.Note = note
+	}
+
+	if err := h.recurringRepo.Update(rule); err != nil {
+		return repositoryError(err, "تراکنش تکراری یافت نشد", "خطایی در بروز رسانی تراکنش تکراری رخ داده است")
+	}
+
+	_ = h.auditRepo.LogAction(
+		userID,
+		"update_recurring_transaction",
+		"recurring_transaction",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		changeDetails(rule.ID, &before, rule, "updated_at"),
+	)
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRecurring deletes a recurring rule
+func (h *RecurringHandler) DeleteRecurring(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه تراکنش تکراری نامعتبر")
+	}
+
+	if err := h.recurringRepo.Delete(id, userID); err != nil {
+		return repositoryError(err, "تراکنش تکراری یافت نشد", "خطا در حذف تراکنش تکراری")
+	}
+
+	_ = h.auditRepo.LogAction(
+		userID,
+		"delete_recurring_transaction",
+		"recurring_transaction",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Deleted recurring rule %d", id),
+	)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "تراکنش تکراری با موفقیت حذف شد"})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"Monex/internal/models"
+	"Monex/internal/repository"
+)
+
+// RecurringScheduler creates transactions for due recurring rules
+type RecurringScheduler struct {
+	recurringRepo   *repository.RecurringRepository
+	transactionRepo *repository.TransactionRepository
+	auditRepo       *repository.AuditRepository
+	hub             *NotificationHub
+}
+
+func NewRecurringScheduler(
+	recurringRepo *repository.RecurringRepository,
+	transactionRepo *repository.TransactionRepository,
+	auditRepo *repository.AuditRepository,
+	hub *NotificationHub,
+) *RecurringScheduler {
+	return &RecurringScheduler{
+		recurringRepo:   recurringRepo,
+		transactionRepo: transactionRepo,
+		auditRepo:       auditRepo,
+		hub:             hub,
+	}
+}
+
+// Start runs due rules immediately (catching up after downtime) and then every interval until ctx is cancelled
+func (s *RecurringScheduler) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		s.RunDue(time.Now())
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.RunDue(now)
+			}
+		}
+	}()
+}
+
+// RunDue executes every rule due at now. Each rule fires at most once per
+// call: next_run jumps past now, so runs missed during downtime are not replayed.
+func (s *RecurringScheduler) RunDue(now time.Time) {
+	rules, err := s.recurringRepo.ListDue(now, 500)
+	if err != nil {
+		slog.Error("Failed to load due recurring transactions", "error", err)
+		return
+	}
+
+	for _, rule := range rules {
+		s.run(rule, now)
+	}
+}
+
+// run claims a single rule and creates its transaction
+func (s *RecurringScheduler) run(rule *models.RecurringTransaction, now time.Time) {
+	scheduledFor := rule.NextRun
+	next := rule.NextAfter(now)
+
+	// ✅ Advance first: if the process dies before the insert we skip one run
+	// rather than creating a duplicate on restart
+	claimed, err := s.recurringRepo.ClaimRun(rule.ID, scheduledFor, next)
+	if err != nil {
+		slog.Error("Failed to advance recurring transaction", "recurring_id", rule.ID, "error", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	transaction := &models.Transaction{
+		UserID:    rule.UserID,
+		Type:      rule.Type,
+		Amount:    rule.Amount,
+		Note:      rule.Note,
+		CreatedAt: scheduledFor,
+	}
+
+	if err := s.transactionRepo.Create(transaction); err != nil {
+		slog.Error("Failed to create recurring transaction", "recurring_id", rule.ID, "error", err)
+		_ = s.auditRepo.LogAction(
+			rule.UserID,
+			"recurring_transaction_run",
+			"transaction",
+			"",
+			"scheduler",
+			false,
+			fmt.Sprintf("Recurring rule %d failed: %v", rule.ID, err),
+		)
+		return
+	}
+
+	_ = s.auditRepo.LogAction(
+		rule.UserID,
+		"recurring_transaction_run",
+		"transaction",
+		"",
+		"scheduler",
+		true,
+		fmt.Sprintf("Recurring rule %d created %s transaction %d: %d (next run %s)",
+			rule.ID, transaction.Type, transaction.ID, transaction.Amount, next.Format(time.RFC3339)),
+	)
+
+	if s.hub != nil {
+		s.hub.Broadcast(rule.UserID, NotificationEvent{
+			Type:     "recurring_transaction",
+			Message:  "تراکنش تکراری به صورت خودکار ثبت شد",
+			Severity: "info",
+			Data: map[string]interface{}{
+				"recurring_id":   rule.ID,
+				"transaction_id": transaction.ID,
+				"type":           transaction.Type,
+				"amount":         transaction.Amount,
+				"next_run":       next,
+			},
+		})
+	}
+
+	slog.Info("Recurring transaction created", "recurring_id", rule.ID, "transaction_id", transaction.ID, "user_id", rule.UserID)
+}
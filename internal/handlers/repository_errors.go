@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// repositoryError answers a failed repository call by the kind of error:
+// 404 not_found with the notFound message, 409 conflict, 400
+// invalid_input, and otherwise 500 with the failed message, the cause being
+// logged by the error handler rather than shown to the user.
+func repositoryError(err error, notFound, failed string) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, map[string]interface{}{
+			"message": notFound,
+			"code":    "not_found",
+		})
+	case errors.Is(err, repository.ErrConflict):
+		return echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
+			"message": "این مورد همزمان تغییر کرده است. لطفا دوباره تلاش کنید",
+			"code":    "conflict",
+		})
+	case errors.Is(err, repository.ErrInvalidInput):
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+			"message": "درخواست نامعتبر",
+			"code":    "invalid_input",
+		})
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, failed).SetInternal(err)
+}
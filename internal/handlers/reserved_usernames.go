@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const reservedUsernameMessage = "این نام کاربری رزرو شده است و قابل استفاده نیست"
+
+// isReservedUsername reports whether username is on RESERVED_USERNAMES,
+// ignoring case. Only new accounts are checked; the seeded admin and other
+// existing accounts keep their names.
+func isReservedUsername(username string, reserved []string) bool {
+	for _, name := range reserved {
+		if strings.EqualFold(username, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// reservedUsernameError rejects a new account with a reserved username
+func reservedUsernameError() error {
+	return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+		"message": reservedUsernameMessage,
+		"code":    "username_reserved",
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"Monex/internal/middleware"
+	"Monex/internal/models"
 	"Monex/internal/repository"
 
 	"github.com/labstack/echo/v4"
@@ -47,9 +48,19 @@ func (h *SecurityWarningsHandler) GetSecurityWarnings(c echo.Context) error {
 	// Get user to check lock status
 	user, err := h.userRepo.GetByID(userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
 	}
 
+	warnings := buildSecurityWarnings(user)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"warnings": warnings,
+		"count":    len(warnings),
+	})
+}
+
+// buildSecurityWarnings derives the current security warnings from the user's lock state
+func buildSecurityWarnings(user *models.User) []SecurityWarning {
 	warnings := []SecurityWarning{}
 
 	// ✅ Check if account is locked (warning for active sessions)
@@ -57,23 +68,23 @@ func (h *SecurityWarningsHandler) GetSecurityWarnings(c echo.Context) error {
 		remaining := time.Until(*user.LockedUntil)
 		warnings = append(warnings, SecurityWarning{
 			ID:        1,
-			UserID:    userID,
+			UserID:    user.ID,
 			Type:      "account_locked",
 			Message:   "حساب شما به دلیل تلاش‌های ناموفق ورود موقتاً مسدود شده است. سشن فعلی شما همچنان فعال است",
 			Severity:  "warning",
 			Read:      false,
-			CreatedAt: time.Now(),
+			CreatedAt: time.Now().UTC(),
 		})
 
 		// Add time remaining info
 		warnings = append(warnings, SecurityWarning{
 			ID:        2,
-			UserID:    userID,
+			UserID:    user.ID,
 			Type:      "lock_duration",
 			Message:   "مدت زمان باقیمانده تا باز شدن حساب: " + formatDuration(remaining),
 			Severity:  "info",
 			Read:      false,
-			CreatedAt: time.Now(),
+			CreatedAt: time.Now().UTC(),
 		})
 	}
 
@@ -81,19 +92,16 @@ func (h *SecurityWarningsHandler) GetSecurityWarnings(c echo.Context) error {
 	if user.FailedAttempts > 0 {
 		warnings = append(warnings, SecurityWarning{
 			ID:        3,
-			UserID:    userID,
+			UserID:    user.ID,
 			Type:      "failed_login_attempts",
 			Message:   "تلاش‌های ناموفق ورود به حساب شما: " + formatInt(user.FailedAttempts) + " از 5",
 			Severity:  determineSeverity(user.FailedAttempts),
 			Read:      false,
-			CreatedAt: time.Now(),
+			CreatedAt: time.Now().UTC(),
 		})
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"warnings": warnings,
-		"count":    len(warnings),
-	})
+	return warnings
 }
 
 // GetAccountStatus provides detailed account security status
@@ -105,7 +113,7 @@ func (h *SecurityWarningsHandler) GetAccountStatus(c echo.Context) error {
 
 	user, err := h.userRepo.GetByID(userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
 	}
 
 	status := map[string]interface{}{
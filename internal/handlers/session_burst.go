@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"Monex/internal/logger"
+	"Monex/internal/models"
+	"Monex/internal/notifier"
+	"Monex/internal/repository"
+	"Monex/internal/useragent"
+)
+
+// createSession creates the session of a successful login, or reuses the
+// device's one, and runs the session burst check on it. locked reports that
+// the check locked the account, in which case the login must be refused.
+func (h *AuthHandler) createSession(
+	user *models.User,
+	deviceID string,
+	device useragent.Info,
+	clientIP, userAgent string,
+	accessToken, refreshToken string,
+	expiresAt time.Time,
+) (session *models.Session, locked bool, err error) {
+	session, err = h.sessionRepo.CreateOrUpdateSession(
+		user.ID,
+		deviceID,
+		device.DeviceName,
+		device.Browser,
+		device.OS,
+		clientIP,
+		accessToken,
+		refreshToken,
+		h.jwtManager.TokenID(accessToken),
+		h.jwtManager.TokenID(refreshToken),
+		expiresAt,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	return session, h.checkSessionBurst(user, clientIP, userAgent), nil
+}
+
+// checkSessionBurst runs after a login created or reused a session. Once
+// SESSION_BURST_THRESHOLD new sessions exist from within SESSION_BURST_WINDOW,
+// which is how stolen credentials used from many devices at once look, the
+// user's recent sessions are flagged suspicious and a critical warning goes
+// out. Sessions already flagged aren't reported again. With
+// SESSION_BURST_LOCK the account is also locked until an admin reviews it,
+// unless it is the last admin who can sign in: locking them would leave no
+// one to review it, so their sessions are only flagged. The return value
+// reports whether the account was locked.
+func (h *AuthHandler) checkSessionBurst(user *models.User, clientIP, userAgent string) bool {
+	threshold := h.config.Login.SessionBurstThreshold
+	if threshold == 0 {
+		return false
+	}
+	window := h.config.Login.SessionBurstWindow
+	since := time.Now().Add(-window)
+
+	count, err := h.sessionRepo.CountCreatedSince(user.ID, since)
+	if err != nil {
+		slog.Warn("Session burst check failed", "user_id", user.ID, "error", err)
+		return false
+	}
+	if count < threshold {
+		return false
+	}
+
+	flagged, err := h.sessionRepo.MarkCreatedSinceSuspicious(user.ID, since)
+	if err != nil {
+		slog.Warn("Failed to flag burst sessions", "user_id", user.ID, "error", err)
+		return false
+	}
+	if flagged == 0 {
+		return false
+	}
+
+	logger.Security("Session burst detected",
+		"user_id", user.ID, "sessions", count, "window", window.String(), "ip", clientIP)
+	details := fmt.Sprintf("%d new sessions within %s, latest from %s", count, window, clientIP)
+
+	SendSecurityWarning(user.ID,
+		fmt.Sprintf("در %d دقیقه گذشته %d ورود جدید به حساب شما ثبت شده است. اگر این ورودها از شما نیست، رمز عبور خود را تغییر دهید",
+			int(window.Minutes()), count),
+		"critical",
+		map[string]interface{}{
+			"sessions":   count,
+			"ip_address": clientIP,
+			"timestamp":  time.Now().UTC(),
+		})
+
+	if !h.config.Login.SessionBurstLock {
+		_ = h.auditRepo.LogActionWithSeverity(user.ID, "session_burst", "session",
+			clientIP, userAgent, true, details, "critical")
+		return false
+	}
+
+	if err := h.userRepo.LockPendingReview(user.ID); errors.Is(err, repository.ErrLastActiveAdmin) {
+		logger.Security("Session burst on the last active admin, account left unlocked", "user_id", user.ID)
+		_ = h.auditRepo.LogActionWithSeverity(user.ID, "session_burst", "session",
+			clientIP, userAgent, true, details+"; not locked: last active admin", "critical")
+		return false
+	} else if err != nil {
+		slog.Warn("Failed to lock user after session burst", "user_id", user.ID, "error", err)
+		_ = h.auditRepo.LogActionWithSeverity(user.ID, "session_burst", "session",
+			clientIP, userAgent, false, details+"; locking the account failed", "critical")
+		return false
+	}
+	user.Locked = true
+	user.PermanentlyLocked = true
+	user.LockedUntil = nil
+	_ = revokeUserSessions(h.sessionRepo, h.tokenBlacklistRepo, user.ID, "Session burst, account locked pending review")
+
+	notifier.Dispatch(h.notifier, notifier.Event{
+		Type:      notifier.EventAccountLocked,
+		UserID:    user.ID,
+		Username:  user.Username,
+		IPAddress: clientIP,
+	})
+
+	_ = h.auditRepo.LogActionWithSeverity(user.ID, "session_burst", "session",
+		clientIP, userAgent, true, details+"; account locked pending review", "critical")
+	return true
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+	"Monex/internal/useragent"
+)
+
+// burst creates n sessions for user from distinct devices and reports
+// whether the last one locked the account
+func burst(t *testing.T, auth *AuthHandler, env *testEnv, user *models.User, n int) bool {
+	t.Helper()
+	device := useragent.Info{DeviceName: "Firefox on Linux", Browser: "Firefox", OS: "Linux"}
+	var locked bool
+	for i := 0; i < n; i++ {
+		access, err := env.jwt.GenerateAccessToken(user)
+		if err != nil {
+			t.Fatalf("GenerateAccessToken: %v", err)
+		}
+		refresh, err := env.jwt.GenerateRefreshToken(user, time.Hour)
+		if err != nil {
+			t.Fatalf("GenerateRefreshToken: %v", err)
+		}
+		_, locked, err = auth.createSession(user, fmt.Sprintf("device-%d", i), device,
+			"203.0.113.7", "Firefox", access, refresh, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("createSession: %v", err)
+		}
+		if locked && i < n-1 {
+			t.Fatalf("locked after %d sessions, threshold is %d", i+1, n)
+		}
+	}
+	return locked
+}
+
+func TestSessionBurstFlagsAndLocks(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.Login.SessionBurstThreshold = 3
+	env.cfg.Login.SessionBurstLock = true
+	auth := env.authHandler(t, make(captureNotifier, 4), env.cfg)
+	user := env.createUser(t, "victim", "Str0ng!Passw0rd", models.RoleUser)
+
+	warnings := GlobalNotificationHub.Subscribe(user.ID)
+	defer GlobalNotificationHub.Unsubscribe(user.ID, warnings)
+
+	if !burst(t, auth, env, user, 3) {
+		t.Fatal("burst did not lock the account")
+	}
+
+	select {
+	case event := <-warnings:
+		if event.Type != "security_warning" || event.Severity != "critical" {
+			t.Fatalf("event = %s/%s, want a critical security_warning", event.Type, event.Severity)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no security warning for the burst")
+	}
+
+	stored, err := env.users.GetByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if !stored.PermanentlyLocked {
+		t.Fatal("account not locked pending review")
+	}
+}
+
+func TestSessionBurstSparesLastAdmin(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.Login.SessionBurstThreshold = 3
+	env.cfg.Login.SessionBurstLock = true
+	auth := env.authHandler(t, make(captureNotifier, 4), env.cfg)
+	admin := env.admin(t)
+
+	if burst(t, auth, env, admin, 3) {
+		t.Fatal("the last active admin was locked out")
+	}
+
+	stored, err := env.users.GetByID(admin.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.PermanentlyLocked || stored.Locked {
+		t.Fatal("the last active admin was locked out")
+	}
+	sessions, err := env.sessions.GetUserSessions(admin.ID)
+	if err != nil {
+		t.Fatalf("GetUserSessions: %v", err)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("%d sessions, want 3", len(sessions))
+	}
+	for _, session := range sessions {
+		if !session.Suspicious {
+			t.Fatalf("session %d not flagged", session.ID)
+		}
+	}
+}
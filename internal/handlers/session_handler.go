@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"Monex/internal/logger"
 	"Monex/internal/middleware"
 	"Monex/internal/models"
 	"Monex/internal/repository"
@@ -18,17 +20,23 @@ type SessionHandler struct {
 	sessionRepo        *repository.SessionRepository
 	auditRepo          *repository.AuditRepository
 	tokenBlacklistRepo *repository.TokenBlacklistRepository // ✅ NEW: Add blacklist repo
+	activeWindow       time.Duration
+	pollTimeout        time.Duration
 }
 
 func NewSessionHandler(
 	sessionRepo *repository.SessionRepository,
 	auditRepo *repository.AuditRepository,
 	tokenBlacklistRepo *repository.TokenBlacklistRepository, // ✅ NEW: Add parameter
+	activeWindow time.Duration,
+	pollTimeout time.Duration,
 ) *SessionHandler {
 	return &SessionHandler{
 		sessionRepo:        sessionRepo,
 		auditRepo:          auditRepo,
 		tokenBlacklistRepo: tokenBlacklistRepo,
+		activeWindow:       activeWindow,
+		pollTimeout:        pollTimeout,
 	}
 }
 
@@ -39,39 +47,92 @@ func (h *SessionHandler) GetSessions(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
 	}
 
-	currentDeviceID := c.QueryParam("device_id")
+	currentDeviceID := middleware.DeviceID(c)
 
-	log.Printf("[DEBUG] GetSessions - UserID: %d, CurrentDeviceID: %s", userID, currentDeviceID)
+	slog.Debug("Listing sessions", "user_id", userID)
 
-	sessions, err := h.sessionRepo.GetUserSessions(userID)
+	// ✅ Paging is opt-in; without page/pageSize the plain array is returned as before
+	paginated := c.QueryParam("page") != "" || c.QueryParam("pageSize") != ""
+	page, pageSize := 1, 0
+
+	var sessions []*models.Session
+	var total int
+	if paginated {
+		page, _ = strconv.Atoi(c.QueryParam("page"))
+		if page < 1 {
+			page = 1
+		}
+		pageSize, _ = strconv.Atoi(c.QueryParam("pageSize"))
+		if pageSize < 1 || pageSize > 100 {
+			pageSize = 10
+		}
+		sessions, total, err = h.sessionRepo.ListUserSessions(userID, pageSize, (page-1)*pageSize)
+	} else {
+		sessions, err = h.sessionRepo.GetUserSessions(userID)
+	}
 	if err != nil {
-		log.Printf("[ERROR] GetUserSessions failed: %v", err)
+		slog.Error("Failed to list sessions", "user_id", userID, "error", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت سشن‌ها")
 	}
 
-	log.Printf("[DEBUG] Found %d sessions for user %d", len(sessions), userID)
+	slog.Debug("Sessions loaded", "user_id", userID, "count", len(sessions))
 
+	now := time.Now()
 	responses := make([]*models.SessionResponse, len(sessions))
 	for i, session := range sessions {
-		isCurrent := session.DeviceID == currentDeviceID
-		responses[i] = &models.SessionResponse{
-			ID:           session.ID,
-			DeviceID:     session.DeviceID,
-			DeviceName:   session.DeviceName,
-			Browser:      session.Browser,
-			OS:           session.OS,
-			IPAddress:    session.IPAddress,
-			LastActivity: session.LastActivity,
-			ExpiresAt:    session.ExpiresAt,
-			CreatedAt:    session.CreatedAt,
-			IsCurrent:    isCurrent,
-		}
+		responses[i] = h.toSessionResponse(session, session.DeviceID == currentDeviceID, now)
 
 		// Register ALL sessions for invalidation tracking
 		InvalidationHub.RegisterSession(session.ID)
 	}
 
-	return c.JSON(http.StatusOK, responses)
+	if !paginated {
+		return c.JSON(http.StatusOK, responses)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"data":     responses,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// GetCurrentSession returns the session that issued the presented access
+// token, so a client that lost its device_id can find its session again
+func (h *SessionHandler) GetCurrentSession(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	// AuthMiddleware has already validated the header
+	token := strings.TrimSpace(strings.SplitN(c.Request().Header.Get("Authorization"), " ", 2)[1])
+
+	session, err := h.sessionRepo.GetByAccessTokenHash(h.sessionRepo.HashToken(token))
+	if err != nil || session.UserID != userID {
+		return echo.NewHTTPError(http.StatusNotFound, "سشن فعالی برای این توکن یافت نشد")
+	}
+
+	return c.JSON(http.StatusOK, h.toSessionResponse(session, true, time.Now()))
+}
+
+func (h *SessionHandler) toSessionResponse(session *models.Session, isCurrent bool, now time.Time) *models.SessionResponse {
+	idle := now.Sub(session.LastActivity)
+	return &models.SessionResponse{
+		ID:            session.ID,
+		DeviceID:      session.DeviceID,
+		DeviceName:    session.DeviceName,
+		Browser:       session.Browser,
+		OS:            session.OS,
+		IPAddress:     session.IPAddress,
+		LastActivity:  session.LastActivity,
+		ExpiresAt:     session.ExpiresAt,
+		CreatedAt:     session.CreatedAt,
+		IsCurrent:     isCurrent,
+		IsActiveNow:   idle < h.activeWindow,
+		LastSeenHuman: humanizeSince(idle),
+		Suspicious:    session.Suspicious,
+	}
 }
 
 // ✅ NEW: Blacklist session tokens to enforce immediate logout
@@ -87,9 +148,9 @@ func (h *SessionHandler) blacklistSessionTokens(sessionID int, userID int) error
 	if h.tokenBlacklistRepo != nil {
 		err = h.tokenBlacklistRepo.BlacklistBySessionID(sessionID, userID)
 		if err != nil {
-			log.Printf("[WARN] Failed to blacklist tokens for session %d: %v", sessionID, err)
+			slog.Warn("Failed to blacklist session tokens", "session_id", sessionID, "error", err)
 		} else {
-			log.Printf("[DEBUG] Blacklisted tokens for session %d", sessionID)
+			slog.Debug("Blacklisted session tokens", "session_id", sessionID)
 		}
 	}
 
@@ -111,34 +172,30 @@ func (h *SessionHandler) InvalidateSession(c echo.Context) error {
 	// Get session details before deletion
 	session, err := h.sessionRepo.GetSessionByID(sessionID, userID)
 	if err != nil {
-		log.Printf("[ERROR] GetSessionByID failed: %v", err)
-		return echo.NewHTTPError(http.StatusNotFound, "سشن یافت نشد")
+		slog.Warn("Failed to get session", "session_id", sessionID, "user_id", userID, "error", err)
+		return repositoryError(err, "سشن یافت نشد", "خطا در دریافت سشن")
 	}
 
-	log.Printf("[DEBUG] InvalidateSession - SessionID: %d, Device: %s", sessionID, session.DeviceName)
+	slog.Debug("Invalidating session", "session_id", sessionID, "device", session.DeviceName)
 
 	// ✅ STEP 1: BLACKLIST TOKENS FIRST (force immediate logout)
 	err = h.blacklistSessionTokens(sessionID, userID)
 	if err != nil {
-		log.Printf("[WARN] Failed to blacklist tokens: %v", err)
+		slog.Warn("Failed to blacklist session tokens", "session_id", sessionID, "error", err)
 	}
 
 	// ✅ STEP 2: DELETE FROM DATABASE
 	if err := h.sessionRepo.InvalidateSession(sessionID, userID); err != nil {
-		log.Printf("[ERROR] Failed to invalidate session: %v", err)
+		slog.Error("Failed to invalidate session", "session_id", sessionID, "error", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ابطال سشن")
 	}
 
 	// ✅ STEP 3: BROADCAST INVALIDATION (for real-time notification)
-	log.Printf("[DEBUG] Broadcasting invalidation to session %d", sessionID)
+	slog.Debug("Broadcasting session invalidation", "session_id", sessionID)
 	InvalidationHub.InvalidateSession(sessionID)
 
-	// ✅ STEP 4: CLEANUP AFTER 2 SECONDS (give time for notification)
-	go func() {
-		time.Sleep(2 * time.Second)
-		InvalidationHub.CleanupSession(sessionID)
-		log.Printf("[DEBUG] Cleaned up session %d after invalidation", sessionID)
-	}()
+	// ✅ STEP 4: CLEANUP NOW - closing the channel also wakes every waiter
+	InvalidationHub.CleanupSession(sessionID)
 
 	_ = h.auditRepo.LogAction(
 		userID,
@@ -162,49 +219,45 @@ func (h *SessionHandler) InvalidateAllSessions(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
 	}
 
-	log.Printf("[DEBUG] InvalidateAllSessions - UserID: %d", userID)
+	slog.Debug("Invalidating all sessions", "user_id", userID)
 
 	// Get all sessions before deletion
 	allSessions, err := h.sessionRepo.GetUserSessions(userID)
 	if err != nil {
-		log.Printf("[ERROR] Failed to get sessions: %v", err)
+		slog.Error("Failed to list sessions", "user_id", userID, "error", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بازیابی سشن‌ها")
 	}
 
-	log.Printf("[DEBUG] Found %d sessions to invalidate", len(allSessions))
+	slog.Debug("Sessions to invalidate", "user_id", userID, "count", len(allSessions))
 
 	// ✅ STEP 1: BLACKLIST ALL TOKENS (force immediate logout)
 	if h.tokenBlacklistRepo != nil {
 		err = h.tokenBlacklistRepo.BlacklistUserTokens(userID, "All sessions invalidated by user")
 		if err != nil {
-			log.Printf("[WARN] Failed to blacklist user tokens: %v", err)
+			slog.Warn("Failed to blacklist user tokens", "user_id", userID, "error", err)
 		} else {
-			log.Printf("[DEBUG] Blacklisted all tokens for user %d", userID)
+			slog.Debug("Blacklisted all user tokens", "user_id", userID)
 		}
 	}
 
 	// ✅ STEP 2: DELETE ALL FROM DATABASE
 	if err := h.sessionRepo.InvalidateAllUserSessions(userID); err != nil {
-		log.Printf("[ERROR] Failed to invalidate all sessions: %v", err)
+		slog.Error("Failed to invalidate all sessions", "user_id", userID, "error", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در ابطال سشن‌ها")
 	}
 
 	// ✅ STEP 3: BROADCAST INVALIDATION TO ALL SESSIONS
 	sessionCount := 0
 	for _, session := range allSessions {
-		log.Printf("[DEBUG] Broadcasting invalidation to session %d (device: %s)", session.ID, session.DeviceName)
+		slog.Debug("Broadcasting session invalidation", "session_id", session.ID, "device", session.DeviceName)
 		InvalidationHub.InvalidateSession(session.ID)
 		sessionCount++
 	}
 
-	// ✅ STEP 4: CLEANUP AFTER 2 SECONDS
-	go func() {
-		time.Sleep(2 * time.Second)
-		for _, session := range allSessions {
-			InvalidationHub.CleanupSession(session.ID)
-		}
-		log.Printf("[DEBUG] Cleaned up %d sessions after invalidation", len(allSessions))
-	}()
+	// ✅ STEP 4: CLEANUP NOW - closing the channels also wakes every waiter
+	for _, session := range allSessions {
+		InvalidationHub.CleanupSession(session.ID)
+	}
 
 	_ = h.auditRepo.LogAction(
 		userID,
@@ -236,7 +289,7 @@ func (h *SessionHandler) ValidateSession(c echo.Context) error {
 	// Verify session belongs to user
 	_, err = h.sessionRepo.GetSessionByID(sessionID, userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "سشن یافت نشد")
+		return repositoryError(err, "سشن یافت نشد", "خطا در دریافت سشن")
 	}
 
 	// Check if session is invalidated (non-blocking)
@@ -244,7 +297,7 @@ func (h *SessionHandler) ValidateSession(c echo.Context) error {
 
 	select {
 	case <-invalidationCh:
-		log.Printf("[DEBUG] Session %d is invalidated", sessionID)
+		slog.Debug("Session is invalidated", "session_id", sessionID)
 		return c.JSON(http.StatusOK, map[string]interface{}{
 			"valid":  false,
 			"reason": "سشن شما از یک دستگاه دیگر ابطال شده است",
@@ -271,33 +324,57 @@ func (h *SessionHandler) WaitForSessionInvalidation(c echo.Context) error {
 	// Verify session belongs to user
 	session, err := h.sessionRepo.GetSessionByID(sessionID, userID)
 	if err != nil {
-		log.Printf("[ERROR] Session %d not found for user %d", sessionID, userID)
-		return echo.NewHTTPError(http.StatusNotFound, "سشن یافت نشد")
+		slog.Warn("Session not found", "session_id", sessionID, "user_id", userID)
+		return repositoryError(err, "سشن یافت نشد", "خطا در دریافت سشن")
 	}
 
-	log.Printf("[DEBUG] Client waiting for invalidation - SessionID: %d, Device: %s", sessionID, session.DeviceName)
+	// ✅ Cap concurrent long-polls per user so one client can't exhaust goroutines
+	if !InvalidationHub.AcquireWaiter(userID) {
+		logger.Security("Too many session long-polls", "user_id", userID, "ip", c.RealIP())
+		return echo.NewHTTPError(http.StatusTooManyRequests, map[string]interface{}{
+			"message": "تعداد درخواست‌های همزمان بیش از حد مجاز است",
+			"code":    "too_many_waiters",
+		})
+	}
+	defer InvalidationHub.ReleaseWaiter(userID)
+
+	slog.Debug("Client waiting for invalidation", "session_id", sessionID, "device", session.DeviceName)
 
 	invalidationCh := InvalidationHub.GetInvalidationChannel(sessionID)
 
-	// Wait for invalidation with 30-second timeout
+	// Wait for invalidation until the configured poll timeout
 	select {
 	case <-invalidationCh:
-		log.Printf("[DEBUG] Session %d invalidation detected", sessionID)
+		slog.Debug("Session invalidation detected", "session_id", sessionID)
 		return c.JSON(http.StatusOK, map[string]interface{}{
 			"invalidated": true,
 			"reason":      "سشن شما از یک دستگاه دیگر ابطال شده است",
 		})
 
-	case <-time.After(30 * time.Second):
+	case <-time.After(h.pollTimeout):
 		// Timeout - session still valid, client will reconnect
-		log.Printf("[DEBUG] Session %d poll timeout (session still valid)", sessionID)
+		slog.Debug("Session poll timed out, still valid", "session_id", sessionID)
 		return c.JSON(http.StatusOK, map[string]interface{}{
 			"invalidated": false,
 		})
 
 	case <-c.Request().Context().Done():
 		// Client disconnected
-		log.Printf("[DEBUG] Client disconnected from session %d poll", sessionID)
+		slog.Debug("Client left session poll", "session_id", sessionID)
 		return nil
 	}
 }
+
+// humanizeSince renders how long ago something happened, in Persian
+func humanizeSince(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "همین حالا"
+	case d < time.Hour:
+		return fmt.Sprintf("%d دقیقه پیش", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d ساعت پیش", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%d روز پیش", int(d/(24*time.Hour)))
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+)
+
+func TestSessionActiveNowBoundary(t *testing.T) {
+	window := 5 * time.Minute
+	h := NewSessionHandler(nil, nil, nil, window, time.Second)
+	now := time.Now()
+
+	for _, tt := range []struct {
+		idle time.Duration
+		want bool
+	}{
+		{0, true},
+		{window - time.Second, true},
+		{window, false},
+		{window + time.Second, false},
+	} {
+		session := &models.Session{LastActivity: now.Add(-tt.idle)}
+		if got := h.toSessionResponse(session, false, now).IsActiveNow; got != tt.want {
+			t.Errorf("idle %v with a %v window: is_active_now = %t, want %t", tt.idle, window, got, tt.want)
+		}
+	}
+
+	// Through the listing, with the activity read back from the database
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	_, _, recent := loginSession(t, env, user, "203.0.113.7")
+	_, _, idle := loginSession(t, env, user, "203.0.113.8")
+	for id, lastActivity := range map[int]time.Time{recent: now.Add(-window + 30*time.Second), idle: now.Add(-window - 30*time.Second)} {
+		if _, err := env.db.Exec("UPDATE sessions SET last_activity = ? WHERE id = ?", lastActivity.UTC(), id); err != nil {
+			t.Fatalf("set last_activity: %v", err)
+		}
+	}
+
+	h = NewSessionHandler(env.sessions, env.audit, env.blacklist, window, time.Second)
+	e := newEcho()
+	e.GET("/sessions", h.GetSessions, withUser(user))
+	rec := doJSON(e, http.MethodGet, "/sessions", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("sessions: status %d, body %s", rec.Code, rec.Body)
+	}
+	var sessions []*models.SessionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &sessions); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	active := map[int]bool{}
+	for _, session := range sessions {
+		active[session.ID] = session.IsActiveNow
+	}
+	if len(active) != 2 || !active[recent] || active[idle] {
+		t.Fatalf("is_active_now by session %v, want %d active and %d not", active, recent, idle)
+	}
+}
+
+func TestLongPollWaitersCappedPerUser(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	_, _, sessionID := loginSession(t, env, user, "203.0.113.7")
+
+	h := NewSessionHandler(env.sessions, env.audit, env.blacklist, time.Minute, 5*time.Second)
+	e := newEcho()
+	e.GET("/sessions/:sessionId/wait-invalidation", h.WaitForSessionInvalidation, withUser(user))
+	path := fmt.Sprintf("/sessions/%d/wait-invalidation", sessionID)
+
+	waiters := func() int {
+		InvalidationHub.mu.Lock()
+		defer InvalidationHub.mu.Unlock()
+		return InvalidationHub.waiters[user.ID]
+	}
+	InvalidationHub.mu.Lock()
+	limit := InvalidationHub.maxWaitersPerUser
+	InvalidationHub.mu.Unlock()
+
+	codes := make(chan int, limit)
+	for i := 0; i < limit; i++ {
+		go func() { codes <- doJSON(e, http.MethodGet, path, "", nil).Code }()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for waiters() < limit {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d long-polls waiting", waiters(), limit)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rec := doJSON(e, http.MethodGet, path, "", nil)
+	if rec.Code != http.StatusTooManyRequests || decodeCode(t, rec.Body.Bytes()) != "too_many_waiters" {
+		t.Fatalf("long-poll over the cap: status %d, body %s; want 429 too_many_waiters", rec.Code, rec.Body)
+	}
+
+	// Invalidating the session wakes the waiters and frees their slots
+	for received := 0; received < limit; {
+		InvalidationHub.CleanupSession(sessionID)
+		select {
+		case code := <-codes:
+			if code != http.StatusOK {
+				t.Errorf("waiter: status %d, want 200", code)
+			}
+			received++
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	if n := waiters(); n != 0 {
+		t.Fatalf("%d slots still held after the long-polls returned", n)
+	}
+}
+
+func TestCurrentSessionMatchesBearerToken(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	bob := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	_, _, _ = loginSession(t, env, alice, "203.0.113.7")
+	access, _, sessionID := loginSession(t, env, alice, "203.0.113.8")
+	bobAccess, _, _ := loginSession(t, env, bob, "203.0.113.9")
+
+	h := NewSessionHandler(env.sessions, env.audit, env.blacklist, time.Minute, time.Second)
+	e := newEcho()
+	e.GET("/sessions/current", h.GetCurrentSession, withUser(alice))
+
+	rec := doJSON(e, http.MethodGet, "/sessions/current", "", bearer(access))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	var session models.SessionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &session); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if session.ID != sessionID || !session.IsCurrent || session.IPAddress != "203.0.113.8" {
+		t.Fatalf("got session %d (current %t, ip %s), want %d from 203.0.113.8", session.ID, session.IsCurrent, session.IPAddress, sessionID)
+	}
+
+	// Another user's token never resolves to their session
+	if rec := doJSON(e, http.MethodGet, "/sessions/current", "", bearer(bobAccess)); rec.Code != http.StatusNotFound {
+		t.Errorf("another user's token: status %d, want 404", rec.Code)
+	}
+}
+
+func TestSessionPagination(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	bob := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	want := map[int]bool{}
+	for i := 0; i < 5; i++ {
+		_, _, id := loginSession(t, env, alice, fmt.Sprintf("203.0.113.%d", i+1))
+		want[id] = true
+	}
+	loginSession(t, env, bob, "203.0.113.99")
+
+	h := NewSessionHandler(env.sessions, env.audit, env.blacklist, time.Minute, time.Second)
+	e := newEcho()
+	e.GET("/sessions", h.GetSessions, withUser(alice))
+
+	seen := map[int]bool{}
+	for page, size := range []int{2, 2, 1, 0} {
+		rec := doJSON(e, http.MethodGet, fmt.Sprintf("/sessions?page=%d&pageSize=2", page+1), "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page %d: status %d, body %s", page+1, rec.Code, rec.Body)
+		}
+		var resp struct {
+			Data  []*models.SessionResponse `json:"data"`
+			Total int                       `json:"total"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+		if len(resp.Data) != size || resp.Total != len(want) {
+			t.Fatalf("page %d: %d sessions of %d, want %d of %d", page+1, len(resp.Data), resp.Total, size, len(want))
+		}
+		for _, session := range resp.Data {
+			if !want[session.ID] || seen[session.ID] {
+				t.Fatalf("page %d: unexpected or repeated session %d", page+1, session.ID)
+			}
+			seen[session.ID] = true
+		}
+	}
+	if len(seen) != len(want) {
+		t.Fatalf("pages covered %d sessions, want %d", len(seen), len(want))
+	}
+
+	// Without paging parameters the plain array is kept
+	var all []*models.SessionResponse
+	rec := doJSON(e, http.MethodGet, "/sessions", "", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &all); err != nil || len(all) != len(want) {
+		t.Fatalf("unpaginated: %d sessions (%v), body %s; want %d", len(all), err, rec.Body, len(want))
+	}
+}
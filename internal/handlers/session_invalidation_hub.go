@@ -3,7 +3,8 @@
 package handlers
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -13,12 +14,59 @@ type SessionInvalidationHub struct {
 	invalidatedChan map[int]chan struct{}
 	registeredAt    map[int]time.Time
 	closed          map[int]bool // ✅ Track closed channels
+
+	// ✅ Bounds against clients opening unlimited long-polls
+	waiters           map[int]int // userID -> active long-polls
+	maxTracked        int
+	maxWaitersPerUser int
 }
 
 var InvalidationHub = &SessionInvalidationHub{
-	invalidatedChan: make(map[int]chan struct{}),
-	registeredAt:    make(map[int]time.Time),
-	closed:          make(map[int]bool),
+	invalidatedChan:   make(map[int]chan struct{}),
+	registeredAt:      make(map[int]time.Time),
+	closed:            make(map[int]bool),
+	waiters:           make(map[int]int),
+	maxTracked:        10000,
+	maxWaitersPerUser: 5,
+}
+
+// Configure sets how many sessions the hub tracks and how many long-polls a
+// single user may hold open. Values <= 0 keep the current limit.
+func (h *SessionInvalidationHub) Configure(maxTracked, maxWaitersPerUser int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if maxTracked > 0 {
+		h.maxTracked = maxTracked
+	}
+	if maxWaitersPerUser > 0 {
+		h.maxWaitersPerUser = maxWaitersPerUser
+	}
+}
+
+// AcquireWaiter reserves a long-poll slot for the user. It returns false when
+// the user already holds the maximum number of concurrent long-polls.
+func (h *SessionInvalidationHub) AcquireWaiter(userID int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.waiters[userID] >= h.maxWaitersPerUser {
+		return false
+	}
+	h.waiters[userID]++
+	return true
+}
+
+// ReleaseWaiter frees a slot taken by AcquireWaiter
+func (h *SessionInvalidationHub) ReleaseWaiter(userID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.waiters[userID] <= 1 {
+		delete(h.waiters, userID)
+		return
+	}
+	h.waiters[userID]--
 }
 
 func (h *SessionInvalidationHub) RegisterSession(sessionID int) {
@@ -30,12 +78,20 @@ func (h *SessionInvalidationHub) RegisterSession(sessionID int) {
 		return
 	}
 
+	// ✅ Bounded: sessions over the limit are tracked on demand instead
+	if len(h.invalidatedChan) >= h.maxTracked {
+		return
+	}
+
 	h.invalidatedChan[sessionID] = make(chan struct{}, 1)
 	h.registeredAt[sessionID] = time.Now()
 	h.closed[sessionID] = false
-	log.Printf("[DEBUG] Registered session %d for invalidation tracking", sessionID)
+	slog.Debug("Registered session for invalidation tracking", "session_id", sessionID)
 }
 
+// GetInvalidationChannel returns the session's channel, creating it if
+// needed. It returns nil when the hub is full; receiving from a nil channel
+// blocks, so callers fall back to their timeout or default case.
 func (h *SessionInvalidationHub) GetInvalidationChannel(sessionID int) <-chan struct{} {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -47,6 +103,11 @@ func (h *SessionInvalidationHub) GetInvalidationChannel(sessionID int) <-chan st
 		}
 	}
 
+	if _, exists := h.invalidatedChan[sessionID]; !exists && len(h.invalidatedChan) >= h.maxTracked {
+		slog.Warn("Invalidation hub full, not tracking session", "max_tracked", h.maxTracked, "session_id", sessionID)
+		return nil
+	}
+
 	// ✅ Create new channel only if needed
 	ch := make(chan struct{}, 1)
 	h.invalidatedChan[sessionID] = ch
@@ -68,7 +129,7 @@ func (h *SessionInvalidationHub) InvalidateSession(sessionID int) {
 	// ✅ Safety: Only invalidate if registered for > 100ms
 	if registeredTime, ok := h.registeredAt[sessionID]; ok {
 		if time.Since(registeredTime) < 100*time.Millisecond {
-			log.Printf("[SKIP] Session %d registered too recently, skipping invalidation", sessionID)
+			slog.Debug("Session registered too recently, skipping invalidation", "session_id", sessionID)
 			return
 		}
 	}
@@ -76,9 +137,9 @@ func (h *SessionInvalidationHub) InvalidateSession(sessionID int) {
 	// ✅ Thread-safe signal sending
 	select {
 	case ch <- struct{}{}:
-		log.Printf("[OK] Invalidation sent to session %d", sessionID)
+		slog.Debug("Invalidation sent", "session_id", sessionID)
 	default:
-		log.Printf("[OK] Signal already sent to session %d", sessionID)
+		slog.Debug("Invalidation already pending", "session_id", sessionID)
 	}
 }
 
@@ -101,7 +162,7 @@ func (h *SessionInvalidationHub) CleanupSession(sessionID int) {
 	delete(h.registeredAt, sessionID)
 	delete(h.closed, sessionID)
 	
-	log.Printf("[DEBUG] Cleaned up invalidation channel for session %d", sessionID)
+	slog.Debug("Cleaned up invalidation channel", "session_id", sessionID)
 }
 
 func (h *SessionInvalidationHub) IsSessionRegistered(sessionID int) bool {
@@ -112,12 +173,18 @@ func (h *SessionInvalidationHub) IsSessionRegistered(sessionID int) bool {
 	return exists && !h.closed[sessionID]
 }
 
-// ✅ NEW: Periodic cleanup of stale channels
-func (h *SessionInvalidationHub) StartCleanupRoutine(interval time.Duration) {
+// ✅ NEW: Periodic cleanup of stale channels until ctx is cancelled
+func (h *SessionInvalidationHub) StartCleanupRoutine(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	go func() {
-		for range ticker.C {
-			h.cleanupStaleChannels()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.cleanupStaleChannels()
+			}
 		}
 	}()
 }
@@ -140,7 +207,7 @@ func (h *SessionInvalidationHub) cleanupStaleChannels() {
 			delete(h.invalidatedChan, sessionID)
 			delete(h.registeredAt, sessionID)
 			delete(h.closed, sessionID)
-			log.Printf("[CLEANUP] Removed stale session %d", sessionID)
+			slog.Debug("Removed stale invalidation channel", "session_id", sessionID)
 		}
 	}
 }
\ No newline at end of file
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCleanupRoutinesStopOnCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	StartLoginTrackerCleanup(ctx, 5*time.Millisecond)
+	InvalidationHub.StartCleanupRoutine(ctx, 5*time.Millisecond)
+	if runtime.NumGoroutine() < before+2 {
+		t.Fatal("cleanup routines not started")
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still running after cancel, want at most %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
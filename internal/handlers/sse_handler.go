@@ -2,33 +2,137 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"sync"
 	"time"
 
 	"Monex/internal/middleware"
+	"Monex/internal/models"
+	"Monex/internal/repository"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
-// NotificationEvent represents a server-sent event
+// NotificationEvent represents a server-sent event; ID is the persisted
+// notification ID and doubles as the SSE event id
 type NotificationEvent struct {
-	Type      string                 `json:"type"` // "security_warning", "session_invalidated", "account_status"
+	ID        int64                  `json:"id,omitempty"`
+	Type      string                 `json:"type"` // "security_warning", "session_invalidated", "account_status", "server_shutdown", "token_expired"
 	Message   string                 `json:"message"`
 	Severity  string                 `json:"severity"` // "info", "warning", "critical"
 	Data      map[string]interface{} `json:"data,omitempty"`
 	Timestamp time.Time              `json:"timestamp"`
 }
 
+// maxDroppedEvents is how many consecutive events a connection may miss
+// before it is closed so the client reconnects and replays what it missed
+const maxDroppedEvents = 20
+
+// subscription tracks delivery health of a single connection
+type subscription struct {
+	dropped int // consecutive events dropped because the buffer was full
+}
+
 // NotificationHub manages SSE connections for all users
 type NotificationHub struct {
 	mu          sync.RWMutex
-	connections map[int]map[chan NotificationEvent]struct{} // userID -> set of channels
+	connections map[int]map[chan NotificationEvent]*subscription // userID -> set of channels
+	store       *repository.NotificationRepository               // optional persistence for replay
+	stopped     chan struct{}                                    // closed by Shutdown
+
+	streams map[string]*streamAuth // stream ID -> credentials of an open stream, for reauth
 }
 
 var GlobalNotificationHub = &NotificationHub{
-	connections: make(map[int]map[chan NotificationEvent]struct{}),
+	connections: make(map[int]map[chan NotificationEvent]*subscription),
+	stopped:     make(chan struct{}),
+	streams:     make(map[string]*streamAuth),
+}
+
+// Done is closed once the server shuts down; long-lived streams return then
+// so the HTTP server can drain without waiting for clients to disconnect
+func (h *NotificationHub) Done() <-chan struct{} {
+	return h.stopped
+}
+
+// Shutdown tells every open stream to send a final server_shutdown event and
+// return. It is safe to call more than once.
+func (h *NotificationHub) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	select {
+	case <-h.stopped:
+	default:
+		close(h.stopped)
+		slog.Info("Notification hub stopped, closing user streams", "users", len(h.connections))
+	}
+}
+
+// SetStore enables persisting broadcast events so reconnecting clients can replay them
+func (h *NotificationHub) SetStore(store *repository.NotificationRepository) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.store = store
+}
+
+// persist stores the event and assigns its ID; failures only cost replayability
+func (h *NotificationHub) persist(userID int, event *NotificationEvent) {
+	h.mu.RLock()
+	store := h.store
+	h.mu.RUnlock()
+
+	if store == nil {
+		return
+	}
+
+	notification := &models.Notification{
+		UserID:    userID,
+		Type:      event.Type,
+		Message:   event.Message,
+		Severity:  event.Severity,
+		Data:      event.Data,
+		CreatedAt: event.Timestamp,
+	}
+	if err := store.Create(notification); err != nil {
+		slog.Warn("Failed to persist notification", "event_type", event.Type, "user_id", userID, "error", err)
+		return
+	}
+	event.ID = notification.ID
+}
+
+// Replay returns persisted events for a user newer than lastEventID
+func (h *NotificationHub) Replay(userID int, lastEventID int64) []NotificationEvent {
+	h.mu.RLock()
+	store := h.store
+	h.mu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	notifications, err := store.ListSince(userID, lastEventID, 100)
+	if err != nil {
+		slog.Warn("Failed to load missed notifications", "user_id", userID, "error", err)
+		return nil
+	}
+
+	events := make([]NotificationEvent, 0, len(notifications))
+	for _, n := range notifications {
+		events = append(events, NotificationEvent{
+			ID:        n.ID,
+			Type:      n.Type,
+			Message:   n.Message,
+			Severity:  n.Severity,
+			Data:      n.Data,
+			Timestamp: n.CreatedAt,
+		})
+	}
+	return events
 }
 
 // Subscribe adds a new SSE connection for a user
@@ -39,11 +143,11 @@ func (h *NotificationHub) Subscribe(userID int) chan NotificationEvent {
 	ch := make(chan NotificationEvent, 10) // Buffered channel
 
 	if h.connections[userID] == nil {
-		h.connections[userID] = make(map[chan NotificationEvent]struct{})
+		h.connections[userID] = make(map[chan NotificationEvent]*subscription)
 	}
 
-	h.connections[userID][ch] = struct{}{}
-	log.Printf("[SSE] User %d subscribed (total connections: %d)", userID, len(h.connections[userID]))
+	h.connections[userID][ch] = &subscription{}
+	slog.Debug("Notification subscriber added", "user_id", userID, "connections", len(h.connections[userID]))
 
 	return ch
 }
@@ -53,36 +157,52 @@ func (h *NotificationHub) Unsubscribe(userID int, ch chan NotificationEvent) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if connections, exists := h.connections[userID]; exists {
-		delete(connections, ch)
-		close(ch)
+	// The channel may already have been closed by the hub as a slow consumer
+	if h.removeLocked(userID, ch) {
+		slog.Debug("Notification subscriber removed", "user_id", userID, "connections", len(h.connections[userID]))
+	}
+}
 
-		if len(connections) == 0 {
-			delete(h.connections, userID)
-		}
+// removeLocked closes and forgets a connection; callers must hold h.mu
+func (h *NotificationHub) removeLocked(userID int, ch chan NotificationEvent) bool {
+	connections, exists := h.connections[userID]
+	if !exists {
+		return false
+	}
+	if _, ok := connections[ch]; !ok {
+		return false
+	}
 
-		log.Printf("[SSE] User %d unsubscribed (remaining: %d)", userID, len(h.connections[userID]))
+	delete(connections, ch)
+	close(ch)
+
+	if len(connections) == 0 {
+		delete(h.connections, userID)
 	}
+	return true
 }
 
-// Broadcast sends notification to all connections for a user
+// Broadcast persists the notification and sends it to all connections for a user
 func (h *NotificationHub) Broadcast(userID int, event NotificationEvent) {
-	h.mu.RLock()
-	connections := h.connections[userID]
-	h.mu.RUnlock()
+	event.Timestamp = time.Now().UTC()
+	h.persist(userID, &event)
 
-	if connections == nil {
-		return
-	}
-
-	event.Timestamp = time.Now()
+	// Sends never block, so holding the lock here is cheap
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	for ch := range connections {
+	for ch, sub := range h.connections[userID] {
 		select {
 		case ch <- event:
-			log.Printf("[SSE] Sent %s to user %d", event.Type, userID)
-		case <-time.After(1 * time.Second):
-			log.Printf("[SSE] Timeout sending to user %d", userID)
+			sub.dropped = 0
+			slog.Debug("Notification sent", "event_type", event.Type, "user_id", userID)
+		default:
+			sub.dropped++
+			if sub.dropped >= maxDroppedEvents {
+				// Stalled client: close it so it reconnects and replays via Last-Event-ID
+				slog.Warn("Closing slow notification connection", "user_id", userID, "dropped", sub.dropped)
+				h.removeLocked(userID, ch)
+			}
 		}
 	}
 }
@@ -97,13 +217,126 @@ func (h *NotificationHub) BroadcastToAll(event NotificationEvent) {
 	}
 }
 
+// streamRevalidator re-checks the credentials of a long-lived notification
+// stream, so a token revoked or a session deleted after the stream opened
+// still cuts the feed
+type streamRevalidator struct {
+	hub         *NotificationHub
+	jwtManager  *middleware.JWTManager
+	sessionRepo *repository.SessionRepository
+	interval    time.Duration
+}
+
+// open registers the stream opened by c with the token it connected with.
+// Callers must release it with hub.closeStream when the stream ends.
+func (v *streamRevalidator) open(c echo.Context, userID int) *streamAuth {
+	token := c.QueryParam("token")
+	stream := &streamAuth{id: newStreamID(), userID: userID, token: token, sessionID: v.sessionFor(token)}
+	v.hub.openStream(stream)
+	return stream
+}
+
+// sessionFor returns the ID of the session token belongs to, or 0 for a
+// token without one
+func (v *streamRevalidator) sessionFor(token string) int {
+	if session, err := v.sessionRepo.GetByAccessTokenHash(v.sessionRepo.HashToken(token)); err == nil {
+		return session.ID
+	}
+	return 0
+}
+
+var (
+	errStreamRevoked      = errors.New("stream credentials revoked")
+	errStreamTokenExpired = errors.New("stream token expired")
+)
+
+// recheck returns errStreamRevoked once stream's token is blacklisted or
+// issued before the global revocation cutoff, or its session is deleted.
+// A token that merely expired gives errStreamTokenExpired instead: the
+// client is still logged in and only has to refresh and reconnect or reauth.
+func (v *streamRevalidator) recheck(stream *streamAuth) error {
+	token, sessionID := stream.credentials()
+	if sessionID > 0 {
+		if _, err := v.sessionRepo.GetSessionByID(sessionID, stream.userID); errors.Is(err, repository.ErrNotFound) {
+			return errStreamRevoked
+		} else if err != nil {
+			slog.Warn("Stream session check failed", "user_id", stream.userID, "error", err)
+		}
+	}
+
+	_, err := v.jwtManager.ValidateTokenType(token, middleware.TokenTypeAccess)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, jwt.ErrTokenExpired) {
+		return errStreamRevoked
+	}
+	// The signature was verified before the expiry check, so the claims can
+	// be trusted for the revocation checks ValidateToken skipped
+	claims := &middleware.Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil || v.jwtManager.IsRevoked(token, claims) {
+		return errStreamRevoked
+	}
+	return errStreamTokenExpired
+}
+
+// closeEvent is the last event sent before closing a stream that failed
+// recheck with err
+func closeEvent(err error) NotificationEvent {
+	if errors.Is(err, errStreamTokenExpired) {
+		return tokenExpiredEvent()
+	}
+	return revokedEvent()
+}
+
+// tokenExpiredEvent tells the client to refresh its token and reconnect;
+// unlike session_invalidated it doesn't end the login
+func tokenExpiredEvent() NotificationEvent {
+	return NotificationEvent{
+		Type:      "token_expired",
+		Message:   "توکن اتصال منقضی شده است",
+		Severity:  "info",
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// revokedEvent is the last event sent before closing a revoked stream
+func revokedEvent() NotificationEvent {
+	return NotificationEvent{
+		Type:      "session_invalidated",
+		Message:   "نشست شما پایان یافته است",
+		Severity:  "warning",
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// shutdownEvent is the last event sent before the server closes a stream;
+// clients reconnect once the server is back
+func shutdownEvent() NotificationEvent {
+	return NotificationEvent{
+		Type:      "server_shutdown",
+		Message:   "سرور در حال خاموش شدن است",
+		Severity:  "warning",
+		Timestamp: time.Now().UTC(),
+	}
+}
+
 // SSEHandler handles Server-Sent Events endpoint
 type SSEHandler struct {
-	hub *NotificationHub
+	hub         *NotificationHub
+	revalidator *streamRevalidator
 }
 
-func NewSSEHandler(hub *NotificationHub) *SSEHandler {
-	return &SSEHandler{hub: hub}
+func NewSSEHandler(
+	hub *NotificationHub,
+	jwtManager *middleware.JWTManager,
+	sessionRepo *repository.SessionRepository,
+	recheckInterval time.Duration,
+) *SSEHandler {
+	return &SSEHandler{
+		hub:         hub,
+		revalidator: &streamRevalidator{hub: hub, jwtManager: jwtManager, sessionRepo: sessionRepo, interval: recheckInterval},
+	}
 }
 
 // HandleSSE manages SSE connections
@@ -123,33 +356,67 @@ func (h *SSEHandler) HandleSSE(c echo.Context) error {
 	eventChan := h.hub.Subscribe(userID)
 	defer h.hub.Unsubscribe(userID, eventChan)
 
+	// ✅ The stream ID lets the client hand over a refreshed token via reauth
+	stream := h.revalidator.open(c, userID)
+	defer h.hub.closeStream(stream)
+
 	// Send initial connection success
 	initialEvent := NotificationEvent{
 		Type:      "connected",
 		Message:   "اتصال برقرار شد",
 		Severity:  "info",
-		Timestamp: time.Now(),
+		Data:      map[string]interface{}{"stream_id": stream.id},
+		Timestamp: time.Now().UTC(),
 	}
 
 	if err := h.writeEvent(c, initialEvent); err != nil {
 		return err
 	}
 
+	// ✅ Replay events missed while disconnected (EventSource sends Last-Event-ID on reconnect)
+	var lastSentID int64
+	if lastEventID := parseLastEventID(c); lastEventID > 0 {
+		lastSentID = lastEventID
+		for _, event := range h.hub.Replay(userID, lastEventID) {
+			if err := h.writeEvent(c, event); err != nil {
+				return err
+			}
+			lastSentID = event.ID
+		}
+	}
+
 	// Keep connection alive with heartbeat
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
+	// ✅ Close the stream once its token is revoked or expired or its session deleted
+	recheck := time.NewTicker(h.revalidator.interval)
+	defer recheck.Stop()
+
 	ctx := c.Request().Context()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("[SSE] Client disconnected - User %d", userID)
+			slog.Debug("SSE client disconnected", "user_id", userID)
 			return nil
 
-		case event := <-eventChan:
+		case <-h.hub.Done():
+			_ = h.writeEvent(c, shutdownEvent())
+			return nil
+
+		case event, ok := <-eventChan:
+			if !ok {
+				// Closed by the hub as a slow consumer
+				slog.Debug("SSE connection dropped by hub", "user_id", userID)
+				return nil
+			}
+			// Skip events already delivered by the replay
+			if event.ID > 0 && event.ID <= lastSentID {
+				continue
+			}
 			if err := h.writeEvent(c, event); err != nil {
-				log.Printf("[SSE] Write error for user %d: %v", userID, err)
+				slog.Debug("SSE write failed", "user_id", userID, "error", err)
 				return err
 			}
 
@@ -157,11 +424,18 @@ func (h *SSEHandler) HandleSSE(c echo.Context) error {
 			// Send heartbeat
 			heartbeat := NotificationEvent{
 				Type:      "heartbeat",
-				Timestamp: time.Now(),
+				Timestamp: time.Now().UTC(),
 			}
 			if err := h.writeEvent(c, heartbeat); err != nil {
 				return err
 			}
+
+		case <-recheck.C:
+			if err := h.revalidator.recheck(stream); err != nil {
+				slog.Info("Closing notification stream", "user_id", userID, "reason", err)
+				_ = h.writeEvent(c, closeEvent(err))
+				return nil
+			}
 		}
 	}
 }
@@ -173,7 +447,12 @@ func (h *SSEHandler) writeEvent(c echo.Context, event NotificationEvent) error {
 		return err
 	}
 
-	// SSE format: data: {json}\n\n
+	// SSE format: [id: N\n]data: {json}\n\n
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(c.Response(), "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
 	_, err = fmt.Fprintf(c.Response(), "data: %s\n\n", data)
 	if err != nil {
 		return err
@@ -183,6 +462,20 @@ func (h *SSEHandler) writeEvent(c echo.Context, event NotificationEvent) error {
 	return nil
 }
 
+// parseLastEventID reads the resume point from the Last-Event-ID header or query
+func parseLastEventID(c echo.Context) int64 {
+	value := c.Request().Header.Get("Last-Event-ID")
+	if value == "" {
+		value = c.QueryParam("last_event_id")
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
+
 // SendSecurityWarning sends a security warning to a specific user
 func SendSecurityWarning(userID int, message string, severity string, data map[string]interface{}) {
 	event := NotificationEvent{
@@ -190,22 +483,28 @@ func SendSecurityWarning(userID int, message string, severity string, data map[s
 		Message:   message,
 		Severity:  severity,
 		Data:      data,
-		Timestamp: time.Now(),
+		Timestamp: time.Now().UTC(),
 	}
 
 	GlobalNotificationHub.Broadcast(userID, event)
 }
 
-// SendAccountStatusChange notifies user of account status change
-func SendAccountStatusChange(userID int, status string, message string) {
+// SendAccountStatusChange notifies user of account status change; data is
+// merged into the event data next to the status
+func SendAccountStatusChange(userID int, status string, message string, data map[string]interface{}) {
+	eventData := map[string]interface{}{
+		"status": status,
+	}
+	for key, value := range data {
+		eventData[key] = value
+	}
+
 	event := NotificationEvent{
-		Type:     "account_status",
-		Message:  message,
-		Severity: "warning",
-		Data: map[string]interface{}{
-			"status": status,
-		},
-		Timestamp: time.Now(),
+		Type:      "account_status",
+		Message:   message,
+		Severity:  "warning",
+		Data:      eventData,
+		Timestamp: time.Now().UTC(),
 	}
 
 	GlobalNotificationHub.Broadcast(userID, event)
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+	"Monex/internal/repository"
+)
+
+// newTestHub returns a hub of its own, so tests don't share GlobalNotificationHub
+func newTestHub() *NotificationHub {
+	return &NotificationHub{
+		connections: make(map[int]map[chan NotificationEvent]*subscription),
+		stopped:     make(chan struct{}),
+		streams:     make(map[string]*streamAuth),
+	}
+}
+
+// openSSE serves handler for user and connects to its stream with token.
+// Events are delivered on the returned channel, which is closed when the
+// server ends the stream.
+func openSSE(t *testing.T, handler *SSEHandler, user *models.User, token string) <-chan NotificationEvent {
+	t.Helper()
+	return resumeSSE(t, handler, user, token, "")
+}
+
+// resumeSSE is openSSE sending lastEventID as Last-Event-ID, as a
+// reconnecting EventSource does
+func resumeSSE(t *testing.T, handler *SSEHandler, user *models.User, token, lastEventID string) <-chan NotificationEvent {
+	t.Helper()
+	e := newEcho()
+	e.GET("/stream", handler.HandleSSE, withUser(user))
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/stream?token="+url.QueryEscape(token), nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	events := make(chan NotificationEvent, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var event NotificationEvent
+			if json.Unmarshal([]byte(data), &event) == nil {
+				events <- event
+			}
+		}
+	}()
+	return events
+}
+
+// lastEvent returns the final event of a stream, failing if it stays open
+func lastEvent(t *testing.T, events <-chan NotificationEvent, within time.Duration) NotificationEvent {
+	t.Helper()
+	var last NotificationEvent
+	timeout := time.After(within)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return last
+			}
+			last = event
+		case <-timeout:
+			t.Fatalf("stream still open after %v, last event %q", within, last.Type)
+		}
+	}
+}
+
+func TestStreamClosedWhenTokenBlacklisted(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "streamer", "Str0ng!Passw0rd", models.RoleUser)
+	token, err := env.jwt.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+
+	handler := NewSSEHandler(newTestHub(), env.jwt, env.sessions, 20*time.Millisecond)
+	events := openSSE(t, handler, user, token)
+	if first := <-events; first.Type != "connected" {
+		t.Fatalf("first event = %q, want connected", first.Type)
+	}
+
+	if err := env.blacklist.BlacklistToken(user.ID, token, "access", time.Now().Add(time.Hour), "test"); err != nil {
+		t.Fatalf("BlacklistToken: %v", err)
+	}
+	if last := lastEvent(t, events, 2*time.Second); last.Type != "session_invalidated" {
+		t.Fatalf("last event = %q, want session_invalidated", last.Type)
+	}
+}
+
+func TestStreamReportsExpiredToken(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "streamer", "Str0ng!Passw0rd", models.RoleUser)
+	env.cfg.JWT.AccessDuration = time.Second
+	token, err := env.jwt.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+
+	handler := NewSSEHandler(newTestHub(), env.jwt, env.sessions, 50*time.Millisecond)
+	events := openSSE(t, handler, user, token)
+
+	// Plain expiry must not look like a revocation, which logs the client out
+	if last := lastEvent(t, events, 5*time.Second); last.Type != "token_expired" {
+		t.Fatalf("last event = %q, want token_expired", last.Type)
+	}
+}
+
+func TestStreamSurvivesTokenRefresh(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "streamer", "Str0ng!Passw0rd", models.RoleUser)
+	env.cfg.JWT.AccessDuration = 2 * time.Second
+	token, err := env.jwt.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+
+	hub := newTestHub()
+	handler := NewSSEHandler(hub, env.jwt, env.sessions, 50*time.Millisecond)
+	events := openSSE(t, handler, user, token)
+	connected := <-events
+	streamID, _ := connected.Data["stream_id"].(string)
+	if connected.Type != "connected" || streamID == "" {
+		t.Fatalf("first event = %+v, want connected with a stream_id", connected)
+	}
+
+	// Refresh: hand the stream a new token before the first one expires
+	env.cfg.JWT.AccessDuration = time.Hour
+	refreshed, err := env.jwt.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	e := newEcho()
+	e.POST("/reauth", handler.ReauthStream, withUser(user))
+	if rec := doJSON(e, http.MethodPost, "/reauth", `{"stream_id":"`+streamID+`"}`, bearer(refreshed)); rec.Code != http.StatusOK {
+		t.Fatalf("reauth: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	// Past the first token's expiry the stream still delivers
+	time.Sleep(2500 * time.Millisecond)
+	hub.Broadcast(user.ID, NotificationEvent{Type: "security_warning", Message: "test"})
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("stream closed after reauth")
+			}
+			if event.Type == "security_warning" {
+				return
+			}
+			if event.Type != "heartbeat" {
+				t.Fatalf("unexpected event %q", event.Type)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("event not delivered after reauth")
+		}
+	}
+}
+
+func TestStreamReplaysMissedEvents(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "streamer", "Str0ng!Passw0rd", models.RoleUser)
+	other := env.createUser(t, "other", "Str0ng!Passw0rd", models.RoleUser)
+	token, err := env.jwt.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+
+	hub := newTestHub()
+	store := repository.NewNotificationRepository(env.db)
+	hub.SetStore(store)
+
+	// Broadcast while the user has no open stream
+	hub.Broadcast(user.ID, NotificationEvent{Type: "security_warning", Message: "seen"})
+	hub.Broadcast(user.ID, NotificationEvent{Type: "security_warning", Message: "missed"})
+	hub.Broadcast(other.ID, NotificationEvent{Type: "security_warning", Message: "someone else's"})
+	stored, err := store.ListSince(user.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("ListSince: %v", err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("%d notifications stored for the user, want 2", len(stored))
+	}
+
+	// Reconnect having seen the first event
+	handler := NewSSEHandler(hub, env.jwt, env.sessions, time.Minute)
+	events := resumeSSE(t, handler, user, token, strconv.FormatInt(stored[0].ID, 10))
+	if first := <-events; first.Type != "connected" {
+		t.Fatalf("first event = %q, want connected", first.Type)
+	}
+	select {
+	case replayed := <-events:
+		if replayed.ID != stored[1].ID || replayed.Message != "missed" {
+			t.Fatalf("replayed %+v, want event %d \"missed\"", replayed, stored[1].ID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("missed event not replayed")
+	}
+
+	// Nothing else was owed; the next event is live
+	hub.Broadcast(user.ID, NotificationEvent{Type: "security_warning", Message: "live"})
+	select {
+	case next := <-events:
+		if next.Message != "live" {
+			t.Fatalf("event after the replay = %q, want live", next.Message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("live event not delivered after the replay")
+	}
+}
+
+func TestBroadcastDropsStalledSubscriber(t *testing.T) {
+	hub := newTestHub()
+	stalled := hub.Subscribe(1)
+
+	// Thousands of events to a subscriber that never reads must not block
+	start := time.Now()
+	for i := 0; i < 5000; i++ {
+		hub.Broadcast(1, NotificationEvent{Type: "security_warning", Message: strconv.Itoa(i)})
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("5000 broadcasts took %v", elapsed)
+	}
+
+	// The buffered events are still there, then the channel is closed
+	received := 0
+	for open := true; open; {
+		select {
+		case _, open = <-stalled:
+			if open {
+				received++
+			}
+		case <-time.After(time.Second):
+			t.Fatal("stalled subscriber's channel not closed")
+		}
+	}
+	if received != cap(stalled) {
+		t.Fatalf("stalled subscriber received %d events, want its buffer of %d", received, cap(stalled))
+	}
+	hub.mu.RLock()
+	_, tracked := hub.connections[1]
+	hub.mu.RUnlock()
+	if tracked {
+		t.Fatal("hub still tracks the stalled subscriber")
+	}
+}
+
+func TestStreamEndsOnHubShutdown(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "streamer", "Str0ng!Passw0rd", models.RoleUser)
+	token, err := env.jwt.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+
+	hub := newTestHub()
+	events := openSSE(t, NewSSEHandler(hub, env.jwt, env.sessions, time.Hour), user, token)
+	if first := <-events; first.Type != "connected" {
+		t.Fatalf("first event = %q, want connected", first.Type)
+	}
+
+	hub.Shutdown()
+	hub.Shutdown() // a second call must not panic
+	if last := lastEvent(t, events, 2*time.Second); last.Type != "server_shutdown" {
+		t.Fatalf("last event = %q, want server_shutdown", last.Type)
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"Monex/config"
+	"Monex/internal/database"
+	"Monex/internal/middleware"
+	"Monex/internal/models"
+	"Monex/internal/notifier"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+const testJWTSecret = "test-secret-0123456789abcdef0123456789abcdef"
+
+// testEnv is a fresh database under t.TempDir() with the repositories and
+// JWT manager main wires up
+type testEnv struct {
+	cfg             *config.Config
+	db              *database.DB
+	users           *repository.UserRepository
+	audit           *repository.AuditRepository
+	sessions        *repository.SessionRepository
+	blacklist       *repository.TokenBlacklistRepository
+	settings        *repository.SettingsRepository
+	loginAttempts   *repository.LoginAttemptRepository
+	passwordResets  *repository.PasswordResetRepository
+	passwordHistory *repository.PasswordHistoryRepository
+	jwt             *middleware.JWTManager
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("JWT_SECRET", testJWTSecret)
+
+	cfg := config.Load()
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	blacklist := repository.NewTokenBlacklistRepository(db)
+	jm, err := middleware.NewJWTManager(&cfg.JWT, blacklist)
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+	return &testEnv{
+		cfg:             cfg,
+		db:              db,
+		users:           repository.NewUserRepository(db),
+		audit:           repository.NewAuditRepository(db),
+		sessions:        repository.NewSessionRepository(db),
+		blacklist:       blacklist,
+		settings:        repository.NewSettingsRepository(db),
+		loginAttempts:   repository.NewLoginAttemptRepository(db),
+		passwordResets:  repository.NewPasswordResetRepository(db),
+		passwordHistory: repository.NewPasswordHistoryRepository(db),
+		jwt:             jm,
+	}
+}
+
+// authHandler builds an AuthHandler over the environment's repositories
+func (env *testEnv) authHandler(t *testing.T, n notifier.Notifier, cfg *config.Config) *AuthHandler {
+	t.Helper()
+	h, err := NewAuthHandler(env.users, env.audit, env.sessions, env.blacklist, env.loginAttempts, env.jwt, n, cfg)
+	if err != nil {
+		t.Fatalf("NewAuthHandler: %v", err)
+	}
+	return h
+}
+
+// createUser stores an active user with password and returns it
+func (env *testEnv) createUser(t *testing.T, username, password, role string) *models.User {
+	t.Helper()
+	user := &models.User{
+		Username:      username,
+		Email:         username + "@example.com",
+		Role:          role,
+		Active:        true,
+		EmailVerified: true,
+	}
+	if err := user.SetPassword(password, 4); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	if err := env.users.Create(user); err != nil {
+		t.Fatalf("Create %s: %v", username, err)
+	}
+	return user
+}
+
+// admin returns the admin seeded by database.New
+func (env *testEnv) admin(t *testing.T) *models.User {
+	t.Helper()
+	admin, err := env.users.GetByUsername("admin")
+	if err != nil {
+		t.Fatalf("seeded admin: %v", err)
+	}
+	return admin
+}
+
+// withUser authenticates every request as user, like AuthMiddleware would
+func withUser(user *models.User) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user_id", user.ID)
+			c.Set("username", user.Username)
+			c.Set("role", user.Role)
+			return next(c)
+		}
+	}
+}
+
+// newEcho returns an Echo instance that renders errors like the server does
+func newEcho() *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = middleware.HTTPErrorHandler
+	return e
+}
+
+// doJSON sends a JSON request through e and returns the recorded response
+func doJSON(e *echo.Echo, method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for key, values := range header {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeCode returns the "code" field of a JSON error body
+func decodeCode(t *testing.T, body []byte) string {
+	t.Helper()
+	var out struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return out.Code
+}
+
+// bearer is an Authorization header carrying token
+func bearer(token string) http.Header {
+	return http.Header{echo.HeaderAuthorization: []string{"Bearer " + token}}
+}
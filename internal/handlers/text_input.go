@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+// cleanText trims s and drops control characters other than newline and
+// tab. Format characters such as the zero-width non-joiner used in Persian
+// are kept.
+func cleanText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// validateNote cleans a free-text note and rejects it with 400 when it is
+// longer than maxLen characters
+func validateNote(note string, maxLen int) (string, error) {
+	note = cleanText(note)
+	if len([]rune(note)) > maxLen {
+		return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("یادداشت حداکثر %d کاراکتر است", maxLen))
+	}
+	return note, nil
+}
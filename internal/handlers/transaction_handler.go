@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -17,12 +18,14 @@ import (
 type TransactionHandler struct {
 	transactionRepo *repository.TransactionRepository
 	auditRepo       *repository.AuditRepository
+	config          *config.SecurityConfig
 }
 
-func NewTransactionHandler(transactionRepo *repository.TransactionRepository, auditRepo *repository.AuditRepository) *TransactionHandler {
+func NewTransactionHandler(transactionRepo *repository.TransactionRepository, auditRepo *repository.AuditRepository, cfg *config.SecurityConfig) *TransactionHandler {
 	return &TransactionHandler{
 		transactionRepo: transactionRepo,
 		auditRepo:       auditRepo,
+		config:          cfg,
 	}
 }
 
@@ -34,12 +37,23 @@ type CreateTransactionRequest struct {
 	CreatedAt time.Time `json:"created_at"` // Optional custom timestamp
 }
 
-// UpdateTransactionRequest represents transaction update data
+// UpdateTransactionRequest represents transaction update data.
+// UpdatedAt is the version the client last saw; when set, the update is
+// rejected with 409 if the transaction changed in the meantime.
 type UpdateTransactionRequest struct {
 	Type      string    `json:"type" validate:"oneof=deposit withdraw expense"`
 	Amount    int       `json:"amount" validate:"gt=0"`
 	Note      string    `json:"note"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// maxBatchGetIDs caps the IDs accepted by one batch-get request
+const maxBatchGetIDs = 100
+
+// BatchGetTransactionsRequest lists the transactions to fetch, in the order wanted
+type BatchGetTransactionsRequest struct {
+	IDs []int `json:"ids"`
 }
 
 type DeleteAllTransactionsRequest struct {
@@ -51,6 +65,30 @@ func isValidType(typeStr string) bool {
 	return typeStr == "deposit" || typeStr == "withdraw" || typeStr == "expense"
 }
 
+// validateCreatedAt rejects custom timestamps too far in the future (they
+// would sort first forever) or, when TRANSACTION_MAX_PAST is set, too old.
+// A zero time means "now" and is always accepted.
+func (h *TransactionHandler) validateCreatedAt(createdAt time.Time) error {
+	if createdAt.IsZero() {
+		return nil
+	}
+
+	now := time.Now()
+	if createdAt.After(now.Add(h.config.TransactionMaxFuture)) {
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
+			"message": "تاریخ تراکنش نمی‌تواند در آینده باشد",
+			"code":    "created_at_in_future",
+		})
+	}
+	if h.config.TransactionMaxPast > 0 && createdAt.Before(now.Add(-h.config.TransactionMaxPast)) {
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
+			"message": "تاریخ تراکنش بیش از حد قدیمی است",
+			"code":    "created_at_too_old",
+		})
+	}
+	return nil
+}
+
 func (h *TransactionHandler) ListTransactions(c echo.Context) error {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
@@ -76,6 +114,7 @@ func (h *TransactionHandler) ListTransactions(c echo.Context) error {
 	}
 	if search := c.QueryParam("search"); search != "" {
 		filters["search"] = search
+		filters["fts"] = c.QueryParam("fts") == "true"
 	}
 	if sortField := c.QueryParam("sortField"); sortField != "" {
 		filters["sortField"] = sortField
@@ -84,13 +123,36 @@ func (h *TransactionHandler) ListTransactions(c echo.Context) error {
 		filters["sortOrder"] = sortOrder
 	}
 
+	// ✅ Running balance is only meaningful over the full, chronologically ordered history
+	if c.QueryParam("includeBalance") == "true" {
+		if _, ok := filters["type"]; ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "محاسبه مانده با فیلتر امکان‌پذیر نیست")
+		}
+		if _, ok := filters["search"]; ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "محاسبه مانده با فیلتر امکان‌پذیر نیست")
+		}
+
+		transactions, total, err := h.transactionRepo.ListWithBalance(userID, pageSize, offset)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to list transactions")
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"data":     amountsView(c, transactions),
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		})
+	}
+
 	transactions, total, err := h.transactionRepo.List(userID, pageSize, offset, filters)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list transactions")
+		// An unknown type filter is ErrInvalidInput
+		return repositoryError(err, "تراکنش یافت نشد", "failed to list transactions")
 	}
 
 	return c.JSON(http.StatusOK, map[string]any{
-		"data":     transactions,
+		"data":     amountsView(c, transactions),
 		"total":    total,
 		"page":     page,
 		"pageSize": pageSize,
@@ -114,7 +176,7 @@ func (h *TransactionHandler) DeleteAllTransactions(c echo.Context, userRepo *rep
 
 	user, err := userRepo.GetByID(userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
 	}
 
 	if !user.CheckPassword(req.Password) {
@@ -136,6 +198,58 @@ func (h *TransactionHandler) DeleteAllTransactions(c echo.Context, userRepo *rep
 	})
 }
 
+// PreviewDeleteAllTransactions reports what DeleteAllTransactions would
+// remove for the current user: the number of transactions and their totals
+func (h *TransactionHandler) PreviewDeleteAllTransactions(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	stats, err := h.transactionRepo.GetStats(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت آمار")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"count": stats.Transactions,
+		"stats": amountsView(c, stats),
+	})
+}
+
+// BatchGetTransactions returns the requested transactions in request order.
+// IDs that don't exist or belong to someone else are left out, so the
+// response can't reveal other users' transactions.
+func (h *TransactionHandler) BatchGetTransactions(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	req := new(BatchGetTransactionsRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "درخواست نامعتبر")
+	}
+	if len(req.IDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه تراکنش‌ها را وارد کنید")
+	}
+	if len(req.IDs) > maxBatchGetIDs {
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
+			"message": fmt.Sprintf("حداکثر %d تراکنش در هر درخواست قابل دریافت است", maxBatchGetIDs),
+			"code":    "too_many_ids",
+		})
+	}
+
+	transactions, err := h.transactionRepo.GetByIDs(userID, req.IDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get transactions")
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"data": amountsView(c, transactions),
+	})
+}
+
 // CreateTransaction creates a new transaction
 func (h *TransactionHandler) CreateTransaction(c echo.Context) error {
 	userID, err := middleware.GetUserID(c)
@@ -158,14 +272,25 @@ func (h *TransactionHandler) CreateTransaction(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "نوع تراکنش نامعتبر است")
 	}
 
+	note, err := validateNote(req.Note, h.config.MaxNoteLength)
+	if err != nil {
+		return err
+	}
+	if err := h.validateCreatedAt(req.CreatedAt); err != nil {
+		return err
+	}
+
 	// Create transaction
 	transaction := &models.Transaction{
 		UserID:    userID,
 		Type:      req.Type,
 		Amount:    req.Amount,
-		Note:      req.Note,
+		Note:      note,
 		CreatedAt: req.CreatedAt,
 	}
+	if err := ValidateTransaction(transaction, &h.config.TransactionRules); err != nil {
+		return err
+	}
 
 	if err := h.transactionRepo.Create(transaction); err != nil {
 		_ = h.auditRepo.LogAction(
@@ -180,18 +305,17 @@ func (h *TransactionHandler) CreateTransaction(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطایی در ایجاد تراکنش رخ داده است")
 	}
 
-	// ✅ LOG SUCCESSFUL TRANSACTION CREATION
-	_ = h.auditRepo.LogAction(
+	// ✅ LOG SUCCESSFUL TRANSACTION CREATION (with the new row, so it can be undone)
+	_ = h.auditRepo.LogTransactionChange(
 		userID,
 		"create_transaction",
-		"transaction",
 		c.RealIP(),
 		c.Request().Header.Get("User-Agent"),
-		true,
 		fmt.Sprintf("Created %s transaction: %d", req.Type, req.Amount),
+		&models.TransactionChange{TransactionID: transaction.ID, After: transaction},
 	)
 
-	return c.JSON(http.StatusCreated, transaction)
+	return c.JSON(http.StatusCreated, amountsView(c, transaction))
 }
 
 // UpdateTransaction updates a transaction
@@ -211,11 +335,20 @@ func (h *TransactionHandler) UpdateTransaction(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "درخواست نامعتبر")
 	}
 
+	note, err := validateNote(req.Note, h.config.MaxNoteLength)
+	if err != nil {
+		return err
+	}
+	if err := h.validateCreatedAt(req.CreatedAt); err != nil {
+		return err
+	}
+
 	// Get existing transaction
 	transaction, err := h.transactionRepo.GetByID(id, userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "تراکنش یافت نشد")
+		return repositoryError(err, "تراکنش یافت نشد", "خطا در دریافت تراکنش")
 	}
+	before := *transaction
 
 	// ✅ Update fields - only if provided and valid
 	if req.Type != "" && isValidType(req.Type) {
@@ -228,7 +361,7 @@ func (h *TransactionHandler) UpdateTransaction(c echo.Context) error {
 		transaction.Amount = req.Amount
 	}
 
-	transaction.Note = req.Note
+	transaction.Note = note
 
 	// ✅ Only update created_at if explicitly provided and not zero
 	if !req.CreatedAt.IsZero() {
@@ -236,11 +369,36 @@ func (h *TransactionHandler) UpdateTransaction(c echo.Context) error {
 	}
 	// Otherwise keep original created_at
 
-	if err := h.transactionRepo.Update(transaction); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "خطایی در بروز رسانی تراکنش رخ داده است")
+	if err := ValidateTransaction(transaction, &h.config.TransactionRules); err != nil {
+		return err
+	}
+
+	if err := h.transactionRepo.Update(transaction, req.UpdatedAt); err != nil {
+		if errors.Is(err, repository.ErrTransactionConflict) {
+			// ✅ Return the current server state so the client can merge
+			current, getErr := h.transactionRepo.GetByID(id, userID)
+			if getErr != nil {
+				return repositoryError(getErr, "تراکنش یافت نشد", "خطا در دریافت تراکنش")
+			}
+			return echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
+				"message": "این تراکنش در این فاصله توسط دستگاه دیگری ویرایش شده است",
+				"code":    "conflict",
+				"current": amountsView(c, current),
+			})
+		}
+		return repositoryError(err, "تراکنش یافت نشد", "خطایی در بروز رسانی تراکنش رخ داده است")
 	}
 
-	return c.JSON(http.StatusOK, transaction)
+	_ = h.auditRepo.LogTransactionChange(
+		userID,
+		"update_transaction",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		changeDetails(transaction.ID, &before, transaction, "updated_at", "is_edited"),
+		&models.TransactionChange{TransactionID: transaction.ID, Before: &before, After: transaction},
+	)
+
+	return c.JSON(http.StatusOK, amountsView(c, transaction))
 }
 
 // DeleteTransaction deletes a transaction
@@ -255,10 +413,24 @@ func (h *TransactionHandler) DeleteTransaction(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "شناسه تراکنش نامعتبر")
 	}
 
+	transaction, err := h.transactionRepo.GetByID(id, userID)
+	if err != nil {
+		return repositoryError(err, "تراکنش یافت نشد", "خطا در دریافت تراکنش")
+	}
+
 	if err := h.transactionRepo.Delete(id, userID); err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "تراکنش یافت نشد")
+		return repositoryError(err, "تراکنش یافت نشد", "خطا در حذف تراکنش")
 	}
 
+	_ = h.auditRepo.LogTransactionChange(
+		userID,
+		"delete_transaction",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		fmt.Sprintf("Deleted %s transaction %d: %d", transaction.Type, transaction.ID, transaction.Amount),
+		&models.TransactionChange{TransactionID: transaction.ID, Before: transaction},
+	)
+
 	return c.JSON(http.StatusOK, map[string]string{"message": "تراکنش با موفقیت حذف شد"})
 }
 
@@ -274,5 +446,5 @@ func (h *TransactionHandler) GetStats(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت آمار")
 	}
 
-	return c.JSON(http.StatusOK, stats)
+	return c.JSON(http.StatusOK, amountsView(c, stats))
 }
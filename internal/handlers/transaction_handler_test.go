@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+	"Monex/internal/repository"
+)
+
+func TestStaleTransactionUpdateConflicts(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+
+	tx := &models.Transaction{UserID: user.ID, Type: "expense", Amount: 1000, Note: "coffee", CreatedAt: time.Now().Add(-time.Hour)}
+	if err := transactions.Create(tx); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	seen, err := transactions.GetByID(tx.ID, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	version, _ := json.Marshal(seen.UpdatedAt)
+
+	h := NewTransactionHandler(transactions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.PUT("/transactions/:id", h.UpdateTransaction, withUser(user))
+	path := fmt.Sprintf("/transactions/%d", tx.ID)
+
+	// Both devices saw the same version; the first edit wins
+	rec := doJSON(e, http.MethodPut, path, `{"amount":1500,"note":"coffee","updated_at":`+string(version)+`}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first update: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec = doJSON(e, http.MethodPut, path, `{"amount":2000,"note":"tea","updated_at":`+string(version)+`}`, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("stale update: status %d, body %s; want 409", rec.Code, rec.Body)
+	}
+	var body struct {
+		Code    string              `json:"code"`
+		Current *models.Transaction `json:"current"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if body.Code != "conflict" || body.Current == nil || body.Current.Amount != 1500 {
+		t.Fatalf("conflict body %s, want code conflict with the current amount 1500", rec.Body)
+	}
+
+	// The stale edit changed nothing
+	stored, err := transactions.GetByID(tx.ID, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Amount != 1500 || stored.Note != "coffee" {
+		t.Fatalf("stored %d %q after the stale update, want 1500 \"coffee\"", stored.Amount, stored.Note)
+	}
+}
+
+func TestAmountsAsStrings(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+
+	h := NewTransactionHandler(transactions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.POST("/transactions", h.CreateTransaction, withUser(user))
+	e.PUT("/transactions/:id", h.UpdateTransaction, withUser(user))
+
+	// 2^60 doesn't survive a round trip through a JavaScript number
+	const amount = `"amount":"1152921504606846976"`
+	rec := doJSON(e, http.MethodPost, "/transactions?numbersAsStrings=true", fmt.Sprintf(`{"type":"deposit","amount":%d}`, 1<<60), nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), amount) {
+		t.Fatalf("create body %s, want %s", rec.Body, amount)
+	}
+	var created struct {
+		ID        int       `json:"id"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+
+	// The conflict payload carries the current state in the same format
+	stale, _ := json.Marshal(created.UpdatedAt.Add(-time.Hour))
+	path := fmt.Sprintf("/transactions/%d?numbersAsStrings=true", created.ID)
+	rec = doJSON(e, http.MethodPut, path, `{"amount":5,"updated_at":`+string(stale)+`}`, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("stale update: status %d, body %s; want 409", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), amount) {
+		t.Fatalf("conflict body %s, want %s", rec.Body, amount)
+	}
+}
+
+func TestRunningBalanceAcrossPages(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	other := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+
+	// Inserted out of order; the balance follows created_at
+	day := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	rows := []struct {
+		hour   int
+		kind   string
+		amount int
+	}{
+		{3, "expense", 300}, {0, "deposit", 5000}, {4, "deposit", 1000}, {1, "withdraw", 1200}, {2, "expense", 500},
+	}
+	for _, row := range rows {
+		err := transactions.Create(&models.Transaction{
+			UserID: user.ID, Type: row.kind, Amount: row.amount, CreatedAt: day.Add(time.Duration(row.hour) * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if err := transactions.Create(&models.Transaction{UserID: other.ID, Type: "deposit", Amount: 99999, CreatedAt: day}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	h := NewTransactionHandler(transactions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.GET("/transactions", h.ListTransactions, withUser(user))
+
+	var balances []int
+	for page := 1; page <= 2; page++ {
+		rec := doJSON(e, http.MethodGet, fmt.Sprintf("/transactions?includeBalance=true&pageSize=3&page=%d", page), "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page %d: status %d, body %s", page, rec.Code, rec.Body)
+		}
+		var body struct {
+			Data []*models.Transaction `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode page %d: %v", page, err)
+		}
+		for _, tx := range body.Data {
+			if tx.BalanceAfter == nil {
+				t.Fatalf("transaction %d on page %d has no balance_after", tx.ID, page)
+			}
+			balances = append(balances, *tx.BalanceAfter)
+		}
+	}
+
+	want := []int{5000, 3800, 3300, 3000, 4000}
+	if fmt.Sprint(balances) != fmt.Sprint(want) {
+		t.Fatalf("running balances %v, want %v", balances, want)
+	}
+}
+
+func TestTimestampsRoundTripInUTC(t *testing.T) {
+	// A host zone east of UTC would show up as an offset if anything
+	// converted to local time on the way out
+	previous := time.Local
+	time.Local = time.FixedZone("IRST", 3*3600+1800)
+	t.Cleanup(func() { time.Local = previous })
+
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+
+	tx := &models.Transaction{UserID: user.ID, Type: "deposit", Amount: 500, CreatedAt: time.Now().Add(-time.Hour)}
+	if err := transactions.Create(tx); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	storedTx, err := transactions.GetByID(tx.ID, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	_, _, sessionID := loginSession(t, env, user, "203.0.113.7")
+	session, err := env.sessions.GetSessionByID(sessionID, user.ID)
+	if err != nil {
+		t.Fatalf("GetSessionByID: %v", err)
+	}
+
+	for name, value := range map[string]time.Time{
+		"transaction created_at": storedTx.CreatedAt,
+		"transaction updated_at": storedTx.UpdatedAt,
+		"session created_at":     session.CreatedAt,
+		"session last_activity":  session.LastActivity,
+		"session expires_at":     session.ExpiresAt,
+	} {
+		if value.Location() != time.UTC {
+			t.Errorf("%s in %v, want UTC", name, value.Location())
+		}
+		if encoded, _ := json.Marshal(value); !strings.HasSuffix(string(encoded), `Z"`) {
+			t.Errorf("%s encodes as %s, want a Z suffix", name, encoded)
+		}
+	}
+
+	// A next_run sent with an offset comes back normalized to UTC
+	h := NewRecurringHandler(repository.NewRecurringRepository(env.db), env.audit, env.cfg.Security.MaxNoteLength)
+	e := newEcho()
+	e.POST("/recurring", h.CreateRecurring, withUser(user))
+	e.GET("/recurring", h.ListRecurring, withUser(user))
+	rec := doJSON(e, http.MethodPost, "/recurring",
+		`{"type":"expense","amount":100,"interval":"monthly","next_run":"2030-01-31T23:30:00+03:30"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create recurring: status %d, body %s", rec.Code, rec.Body)
+	}
+	rec = doJSON(e, http.MethodGet, "/recurring", "", nil)
+	if !strings.Contains(rec.Body.String(), `"next_run":"2030-01-31T20:00:00Z"`) {
+		t.Fatalf("recurring list %s, want next_run 2030-01-31T20:00:00Z", rec.Body)
+	}
+}
+
+func TestNoteLengthAndControlCharacters(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.Security.MaxNoteLength = 10
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	h := NewTransactionHandler(repository.NewTransactionRepository(env.db), env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.POST("/transactions", h.CreateTransaction, withUser(user))
+	create := func(note string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"type": "deposit", "amount": 100, "note": note})
+		return doJSON(e, http.MethodPost, "/transactions", string(body), nil)
+	}
+
+	// The limit counts characters, not bytes
+	if rec := create("یادداشت‌کو"); rec.Code != http.StatusCreated {
+		t.Fatalf("note at the limit: status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := create("یادداشت‌کوت"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("note over the limit: status %d, want 400", rec.Code)
+	}
+
+	// Control characters are dropped; newlines, tabs and the zero-width non-joiner stay
+	rec := create(" \x00نو‌ت\x07\n\tok\x1b ")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("note with control characters: status %d, body %s", rec.Code, rec.Body)
+	}
+	var created models.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if want := "نو‌ت\n\tok"; created.Note != want {
+		t.Fatalf("stored note %q, want %q", created.Note, want)
+	}
+}
+
+func TestCreatedAtWindow(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.Security.TransactionMaxFuture = time.Hour
+	env.cfg.Security.TransactionMaxPast = 30 * 24 * time.Hour
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	h := NewTransactionHandler(repository.NewTransactionRepository(env.db), env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.POST("/transactions", h.CreateTransaction, withUser(user))
+	create := func(createdAt time.Time) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"type": "expense", "amount": 100, "created_at": createdAt})
+		return doJSON(e, http.MethodPost, "/transactions", string(body), nil)
+	}
+
+	now := time.Now()
+	for _, tt := range []struct {
+		name      string
+		createdAt time.Time
+		code      string
+	}{
+		{"slightly past", now.Add(-10 * time.Minute), ""},
+		{"within the future allowance", now.Add(30 * time.Minute), ""},
+		{"future", now.Add(2 * time.Hour), "created_at_in_future"},
+		{"far past", now.AddDate(0, -2, 0), "created_at_too_old"},
+	} {
+		rec := create(tt.createdAt)
+		switch {
+		case tt.code == "" && rec.Code != http.StatusCreated:
+			t.Errorf("%s: status %d, body %s; want 201", tt.name, rec.Code, rec.Body)
+		case tt.code != "" && (rec.Code != http.StatusBadRequest || decodeCode(t, rec.Body.Bytes()) != tt.code):
+			t.Errorf("%s: status %d, body %s; want 400 %s", tt.name, rec.Code, rec.Body, tt.code)
+		}
+	}
+}
+
+func TestTransactionRules(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.Security.TransactionRules.RequireNoteFor = map[string]bool{"expense": true}
+	env.cfg.Security.TransactionRules.MaxAmount = map[string]int{"withdraw": 5000}
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+	h := NewTransactionHandler(transactions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.POST("/transactions", h.CreateTransaction, withUser(user))
+	e.PUT("/transactions/:id", h.UpdateTransaction, withUser(user))
+	send := func(method, path string, req map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		return doJSON(e, method, path, string(body), nil)
+	}
+
+	for _, tt := range []struct {
+		name string
+		req  map[string]any
+		code string
+	}{
+		{"expense without a note", map[string]any{"type": "expense", "amount": 100}, "note_required"},
+		{"expense with a whitespace note", map[string]any{"type": "expense", "amount": 100, "note": "  "}, "note_required"},
+		{"expense with a note", map[string]any{"type": "expense", "amount": 100, "note": "coffee"}, ""},
+		{"deposit without a note", map[string]any{"type": "deposit", "amount": 100}, ""},
+		{"withdraw at the limit", map[string]any{"type": "withdraw", "amount": 5000}, ""},
+		{"withdraw over the limit", map[string]any{"type": "withdraw", "amount": 5001}, "amount_exceeds_limit"},
+		{"deposit over the withdraw limit", map[string]any{"type": "deposit", "amount": 9000}, ""},
+	} {
+		rec := send(http.MethodPost, "/transactions", tt.req)
+		switch {
+		case tt.code == "" && rec.Code != http.StatusCreated:
+			t.Errorf("%s: status %d, body %s; want 201", tt.name, rec.Code, rec.Body)
+		case tt.code != "" && (rec.Code != http.StatusBadRequest || decodeCode(t, rec.Body.Bytes()) != tt.code):
+			t.Errorf("%s: status %d, body %s; want 400 %s", tt.name, rec.Code, rec.Body, tt.code)
+		}
+	}
+
+	// Updates are checked against the transaction as it will be stored
+	tx := &models.Transaction{UserID: user.ID, Type: "deposit", Amount: 100, CreatedAt: time.Now().Add(-time.Hour)}
+	if err := transactions.Create(tx); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	path := fmt.Sprintf("/transactions/%d", tx.ID)
+	if rec := send(http.MethodPut, path, map[string]any{"type": "expense"}); rec.Code != http.StatusBadRequest || decodeCode(t, rec.Body.Bytes()) != "note_required" {
+		t.Errorf("retype to expense without a note: status %d, body %s; want 400 note_required", rec.Code, rec.Body)
+	}
+	if rec := send(http.MethodPut, path, map[string]any{"type": "withdraw", "amount": 6000}); rec.Code != http.StatusBadRequest || decodeCode(t, rec.Body.Bytes()) != "amount_exceeds_limit" {
+		t.Errorf("withdraw over the limit: status %d, body %s; want 400 amount_exceeds_limit", rec.Code, rec.Body)
+	}
+	stored, err := transactions.GetByID(tx.ID, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Type != "deposit" || stored.Amount != 100 {
+		t.Fatalf("stored %s %d after rejected updates, want deposit 100", stored.Type, stored.Amount)
+	}
+}
+
+func TestBatchGetTransactions(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	bob := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+	var ids []int
+	for _, owner := range []*models.User{alice, bob, alice} {
+		tx := &models.Transaction{UserID: owner.ID, Type: "expense", Amount: 100, CreatedAt: time.Now().Add(-time.Hour)}
+		if err := transactions.Create(tx); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids = append(ids, tx.ID)
+	}
+
+	h := NewTransactionHandler(transactions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.POST("/transactions/batch-get", h.BatchGetTransactions, withUser(alice))
+	batchGet := func(ids []int) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"ids": ids})
+		return doJSON(e, http.MethodPost, "/transactions/batch-get", string(body), nil)
+	}
+
+	rec := batchGet([]int{ids[2], ids[1], ids[0]})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch-get: status %d, body %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Data []models.Transaction `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if len(body.Data) != 2 || body.Data[0].ID != ids[2] || body.Data[1].ID != ids[0] {
+		t.Fatalf("batch-get body %s, want alice's %d then %d without bob's %d", rec.Body, ids[2], ids[0], ids[1])
+	}
+
+	if rec := batchGet(nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("no ids: status %d, want 400", rec.Code)
+	}
+	tooMany := make([]int, maxBatchGetIDs+1)
+	if rec := batchGet(tooMany); rec.Code != http.StatusBadRequest || decodeCode(t, rec.Body.Bytes()) != "too_many_ids" {
+		t.Errorf("%d ids: status %d, body %s; want 400 too_many_ids", len(tooMany), rec.Code, rec.Body)
+	}
+}
+
+func TestDeleteAllPreviewCountsOnlyOwnRows(t *testing.T) {
+	env := newTestEnv(t)
+	alice := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	bob := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+	for _, tx := range []*models.Transaction{
+		{UserID: alice.ID, Type: "deposit", Amount: 10000},
+		{UserID: alice.ID, Type: "deposit", Amount: 2500},
+		{UserID: alice.ID, Type: "withdraw", Amount: 3000},
+		{UserID: alice.ID, Type: "expense", Amount: 1200},
+		{UserID: bob.ID, Type: "deposit", Amount: 99000},
+		{UserID: bob.ID, Type: "expense", Amount: 500},
+	} {
+		tx.CreatedAt = time.Now().Add(-time.Hour)
+		if err := transactions.Create(tx); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	h := NewTransactionHandler(transactions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.GET("/transactions/delete-all/preview", h.PreviewDeleteAllTransactions, withUser(alice))
+	rec := doJSON(e, http.MethodGet, "/transactions/delete-all/preview", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("preview: status %d, body %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Count int                     `json:"count"`
+		Stats models.TransactionStats `json:"stats"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	want := models.TransactionStats{TotalDeposit: 12500, TotalWithdraw: 3000, TotalExpense: 1200, Balance: 8300, Transactions: 4}
+	if body.Count != 4 || body.Stats != want {
+		t.Fatalf("preview %s, want count 4 and %+v", rec.Body, want)
+	}
+
+	// Nothing was deleted
+	if _, total, err := transactions.List(alice.ID, 10, 0, nil); err != nil || total != 4 {
+		t.Fatalf("alice has %d transactions after the preview (err %v), want 4", total, err)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"Monex/config"
+	"Monex/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// transactionTypeLabels names transaction types in error messages
+var transactionTypeLabels = map[string]string{
+	"deposit":  "واریز",
+	"withdraw": "برداشت",
+	"expense":  "هزینه",
+}
+
+// ValidateTransaction enforces the configured per-type rules on a
+// transaction as it will be stored. Create passes the new transaction and
+// update the existing one with the request applied, so a partial update
+// can't slip past a rule.
+func ValidateTransaction(t *models.Transaction, rules *config.TransactionRulesConfig) error {
+	if rules.RequireNoteFor[t.Type] && t.Note == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
+			"message": fmt.Sprintf("برای تراکنش %s وارد کردن یادداشت الزامی است", transactionTypeLabels[t.Type]),
+			"code":    "note_required",
+		})
+	}
+	if limit, ok := rules.MaxAmount[t.Type]; ok && t.Amount > limit {
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+			"message": fmt.Sprintf("مبلغ تراکنش %s حداکثر %d است", transactionTypeLabels[t.Type], limit),
+			"code":    "amount_exceeds_limit",
+			"limit":   limit,
+		})
+	}
+	return nil
+}
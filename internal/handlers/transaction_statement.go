@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"Monex/internal/middleware"
+	"Monex/internal/models"
+	"Monex/internal/pdf"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxStatementTransactions bounds the rows rendered into one statement
+const maxStatementTransactions = 10000
+
+// Statement layout in points
+const (
+	statementMargin     = 40.0
+	statementRowHeight  = 16.0
+	statementBottom     = pdf.PageHeight - 60
+	statementNoteLength = 45
+)
+
+// statementColumns are the table column offsets from the left margin
+var statementColumns = []struct {
+	title  string
+	offset float64
+}{
+	{"Date", 0},
+	{"Type", 110},
+	{"Amount", 190},
+	{"Note", 290},
+}
+
+// GetStatement downloads a printable statement of the current user's
+// transactions in an optional from/to range. PDF is the only format, chosen
+// with format=pdf or an Accept: application/pdf header.
+func (h *TransactionHandler) GetStatement(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	format := c.QueryParam("format")
+	if format == "" && strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "application/pdf") {
+		format = "pdf"
+	}
+	if format != "pdf" {
+		return echo.NewHTTPError(http.StatusNotAcceptable, "فرمت صورتحساب پشتیبانی نمی‌شود (format=pdf)")
+	}
+
+	var from, to time.Time
+	if value := c.QueryParam("from"); value != "" {
+		parsed, _, err := parseAuditTime(value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "تاریخ شروع نامعتبر است (YYYY-MM-DD یا RFC3339)")
+		}
+		from = parsed
+	}
+	if value := c.QueryParam("to"); value != "" {
+		parsed, dateOnly, err := parseAuditTime(value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "تاریخ پایان نامعتبر است (YYYY-MM-DD یا RFC3339)")
+		}
+		if dateOnly {
+			parsed = parsed.AddDate(0, 0, 1) // include the whole day
+		}
+		to = parsed
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return echo.NewHTTPError(http.StatusBadRequest, "تاریخ شروع باید قبل از تاریخ پایان باشد")
+	}
+
+	stats, err := h.transactionRepo.GetStatsInRange(userID, from, to)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت آمار")
+	}
+	if stats.Transactions > maxStatementTransactions {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("تعداد تراکنش‌ها بیش از %d است، بازه زمانی را کوچک‌تر کنید", maxStatementTransactions))
+	}
+
+	username, _ := c.Get("username").(string)
+	doc := pdf.New()
+	y := writeStatementHeader(doc, username, from, to)
+
+	err = h.transactionRepo.ForEachByUserInRange(userID, from, to, func(transaction *models.Transaction) error {
+		if y > statementBottom {
+			doc.AddPage()
+			y = writeStatementColumns(doc, statementMargin+20)
+		}
+		note := []rune(transaction.Note)
+		if len(note) > statementNoteLength {
+			note = append(note[:statementNoteLength-3], []rune("...")...)
+		}
+		cells := []string{
+			transaction.CreatedAt.UTC().Format("2006-01-02 15:04"),
+			transaction.Type,
+			fmt.Sprintf("%d", transaction.Amount),
+			string(note),
+		}
+		for i, column := range statementColumns {
+			doc.Text(statementMargin+column.offset, y, 9, false, cells[i])
+		}
+		y += statementRowHeight
+		return nil
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت تراکنش‌ها")
+	}
+
+	writeStatementTotals(doc, y, stats)
+
+	_ = h.auditRepo.LogAction(
+		userID,
+		"export_statement",
+		"transaction",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Exported PDF statement (%d transactions)", stats.Transactions),
+	)
+
+	filename := fmt.Sprintf("monex_statement_%s.pdf", time.Now().UTC().Format("2006-01-02"))
+	c.Response().Header().Set(echo.HeaderContentType, "application/pdf")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+	_, err = doc.WriteTo(c.Response())
+	return err
+}
+
+// writeStatementHeader draws the title block and column titles on the first
+// page and returns the baseline of the first table row
+func writeStatementHeader(doc *pdf.Document, username string, from, to time.Time) float64 {
+	doc.AddPage()
+	doc.Text(statementMargin, 60, 16, true, "Monex - Transaction Statement")
+	doc.Text(statementMargin, 84, 10, false, "User: "+username)
+	doc.Text(statementMargin, 100, 10, false, "Period: "+statementPeriod(from, to))
+	doc.Text(statementMargin, 116, 10, false, "Generated: "+time.Now().UTC().Format("2006-01-02 15:04 UTC"))
+	return writeStatementColumns(doc, 144)
+}
+
+// writeStatementColumns draws the column titles at y and returns the
+// baseline of the next row
+func writeStatementColumns(doc *pdf.Document, y float64) float64 {
+	for _, column := range statementColumns {
+		doc.Text(statementMargin+column.offset, y, 10, true, column.title)
+	}
+	doc.Line(statementMargin, y+5, pdf.PageWidth-statementMargin, y+5)
+	return y + statementRowHeight + 4
+}
+
+// writeStatementTotals draws the totals footer, on a new page when the
+// current one is full
+func writeStatementTotals(doc *pdf.Document, y float64, stats *models.TransactionStats) {
+	if y+5*statementRowHeight > statementBottom {
+		doc.AddPage()
+		y = statementMargin + 20
+	}
+	doc.Line(statementMargin, y-8, pdf.PageWidth-statementMargin, y-8)
+	y += 8
+
+	totals := []struct {
+		label string
+		value int
+	}{
+		{"Deposits", stats.TotalDeposit},
+		{"Withdrawals", stats.TotalWithdraw},
+		{"Expenses", stats.TotalExpense},
+		{"Net", stats.Balance},
+	}
+	for _, total := range totals {
+		doc.Text(statementMargin, y, 10, true, total.label)
+		doc.Text(statementMargin+110, y, 10, false, fmt.Sprintf("%d", total.value))
+		y += statementRowHeight
+	}
+	doc.Text(statementMargin, y, 9, false, fmt.Sprintf("%d transactions", stats.Transactions))
+}
+
+// statementPeriod describes the requested range; to is exclusive
+func statementPeriod(from, to time.Time) string {
+	start, end := "beginning", "now"
+	if !from.IsZero() {
+		start = from.UTC().Format("2006-01-02 15:04")
+	}
+	if !to.IsZero() {
+		end = "before " + to.UTC().Format("2006-01-02 15:04")
+	}
+	return start + " - " + end
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+	"Monex/internal/repository"
+)
+
+func TestStatementPDF(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "erfan", "Str0ng!Passw0rd", "user")
+	transactions := repository.NewTransactionRepository(env.db)
+
+	day := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	for i, note := range []string{"حقوق اسفند", "خرید کتاب (۲ جلد)", "Rent"} {
+		err := transactions.Create(&models.Transaction{
+			UserID:    user.ID,
+			Type:      []string{"deposit", "expense", "withdraw"}[i],
+			Amount:    1000 * (i + 1),
+			Note:      note,
+			CreatedAt: day.Add(time.Duration(i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	h := NewTransactionHandler(transactions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.GET("/statement", h.GetStatement, withUser(user))
+
+	rec := doJSON(e, http.MethodGet, "/statement?format=pdf&from=2025-03-01&to=2025-03-31", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("statement: status %d, body %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	body := rec.Body.Bytes()
+	if !bytes.HasPrefix(body, []byte("%PDF-")) || !bytes.Contains(body, []byte("%%EOF")) {
+		t.Fatalf("not a PDF: %.40q", body)
+	}
+	if !bytes.Contains(body, []byte("/FontFile2")) {
+		t.Fatal("statement doesn't embed a Unicode font")
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"Monex/internal/middleware"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// lastUndoableChange picks the newest change in logs (newest first) that no
+// later undo has reverted yet
+func lastUndoableChange(logs []*models.TransactionChangeLog) *models.TransactionChangeLog {
+	reverted := make(map[int]bool)
+	for _, entry := range logs {
+		if entry.Action == "undo_transaction" {
+			reverted[entry.Change.Reverts] = true
+			continue
+		}
+		if !reverted[entry.ID] {
+			return entry
+		}
+	}
+	return nil
+}
+
+// UndoLastTransaction reverses the user's most recent create, update or
+// delete within TRANSACTION_UNDO_WINDOW using the state recorded in the
+// audit log. Each call steps one change further back. The row must still be
+// exactly as that change left it, otherwise 409 undo_conflict.
+func (h *TransactionHandler) UndoLastTransaction(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	logs, err := h.auditRepo.RecentTransactionChanges(userID, time.Now().Add(-h.config.TransactionUndoWindow))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بازگردانی تراکنش")
+	}
+
+	target := lastUndoableChange(logs)
+	if target == nil {
+		return echo.NewHTTPError(http.StatusNotFound, map[string]string{
+			"message": "عملیاتی برای بازگردانی وجود ندارد",
+			"code":    "nothing_to_undo",
+		})
+	}
+
+	change := target.Change
+	undo := &models.TransactionChange{TransactionID: change.TransactionID, Reverts: target.ID}
+	switch {
+	case target.Action == "create_transaction" && change.After != nil:
+		err = h.transactionRepo.DeleteVersion(change.TransactionID, userID, change.After.UpdatedAt)
+		undo.Before = change.After
+	case target.Action == "update_transaction" && change.Before != nil && change.After != nil:
+		err = h.transactionRepo.Revert(change.Before, change.After.UpdatedAt)
+		undo.Before, undo.After = change.After, change.Before
+	case target.Action == "delete_transaction" && change.Before != nil:
+		err = h.transactionRepo.Restore(change.Before)
+		undo.After = change.Before
+	default:
+		slog.Warn("Unsupported transaction change in audit log", "audit_id", target.ID, "action", target.Action)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بازگردانی تراکنش")
+	}
+
+	if errors.Is(err, repository.ErrTransactionConflict) {
+		return echo.NewHTTPError(http.StatusConflict, map[string]string{
+			"message": "این تراکنش پس از آخرین عملیات تغییر کرده و قابل بازگردانی نیست",
+			"code":    "undo_conflict",
+		})
+	}
+	if err != nil {
+		slog.Error("Failed to undo transaction change", "audit_id", target.ID, "error", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بازگردانی تراکنش")
+	}
+
+	_ = h.auditRepo.LogTransactionChange(
+		userID,
+		"undo_transaction",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		fmt.Sprintf("Undid %s of transaction %d", target.Action, change.TransactionID),
+		undo,
+	)
+
+	response := map[string]interface{}{
+		"message":     "عملیات با موفقیت بازگردانی شد",
+		"undone":      target.Action,
+		"transaction": nil, // a create was undone
+	}
+	if undo.After != nil {
+		response["transaction"] = amountsView(c, undo.After)
+	}
+	return c.JSON(http.StatusOK, response)
+}
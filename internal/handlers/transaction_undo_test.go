@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+	"Monex/internal/repository"
+)
+
+func TestUndoRevertsUpdateAndRestoresDelete(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+	h := NewTransactionHandler(transactions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.POST("/transactions/undo", h.UndoLastTransaction, withUser(user))
+	e.POST("/transactions", h.CreateTransaction, withUser(user))
+	e.PUT("/transactions/:id", h.UpdateTransaction, withUser(user))
+	e.DELETE("/transactions/:id", h.DeleteTransaction, withUser(user))
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return doJSON(e, method, path, body, nil)
+	}
+	undo := func() *httptest.ResponseRecorder {
+		t.Helper()
+		return send(http.MethodPost, "/transactions/undo", "")
+	}
+
+	if rec := undo(); rec.Code != http.StatusNotFound || decodeCode(t, rec.Body.Bytes()) != "nothing_to_undo" {
+		t.Fatalf("undo with no history: status %d, body %s; want 404 nothing_to_undo", rec.Code, rec.Body)
+	}
+
+	createdAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	rec := send(http.MethodPost, "/transactions", fmt.Sprintf(`{"type":"expense","amount":1000,"note":"coffee","created_at":%q}`, createdAt.Format(time.RFC3339)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", rec.Code, rec.Body)
+	}
+	var created models.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	path := fmt.Sprintf("/transactions/%d", created.ID)
+
+	// Undoing an update puts every field back
+	if rec := send(http.MethodPut, path, `{"type":"deposit","amount":2500,"note":"refund"}`); rec.Code != http.StatusOK {
+		t.Fatalf("update: status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := undo(); rec.Code != http.StatusOK {
+		t.Fatalf("undo update: status %d, body %s", rec.Code, rec.Body)
+	}
+	stored, err := transactions.GetByID(created.ID, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID after undoing the update: %v", err)
+	}
+	if stored.Type != "expense" || stored.Amount != 1000 || stored.Note != "coffee" || !stored.CreatedAt.Equal(createdAt) {
+		t.Fatalf("after undoing the update: %s %d %q %v, want expense 1000 \"coffee\" %v",
+			stored.Type, stored.Amount, stored.Note, stored.CreatedAt, createdAt)
+	}
+
+	// Undoing a delete brings the row back under its original ID
+	if rec := send(http.MethodDelete, path, ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d, body %s", rec.Code, rec.Body)
+	}
+	if _, err := transactions.GetByID(created.ID, user.ID); err == nil {
+		t.Fatal("transaction still there after delete")
+	}
+	rec = undo()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("undo delete: status %d, body %s", rec.Code, rec.Body)
+	}
+	var undone struct {
+		Undone      string              `json:"undone"`
+		Transaction *models.Transaction `json:"transaction"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &undone); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if undone.Undone != "delete_transaction" || undone.Transaction == nil || undone.Transaction.ID != created.ID {
+		t.Fatalf("undo delete body %s, want delete_transaction with id %d", rec.Body, created.ID)
+	}
+	restored, err := transactions.GetByID(created.ID, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID after undoing the delete: %v", err)
+	}
+	if restored.Type != "expense" || restored.Amount != 1000 || restored.Note != "coffee" {
+		t.Fatalf("restored %s %d %q, want expense 1000 \"coffee\"", restored.Type, restored.Amount, restored.Note)
+	}
+
+	// The next undo steps back past the update (already undone) to the create
+	if rec := undo(); rec.Code != http.StatusOK {
+		t.Fatalf("undo create: status %d, body %s", rec.Code, rec.Body)
+	}
+	if _, err := transactions.GetByID(created.ID, user.ID); err == nil {
+		t.Fatal("transaction still there after undoing its create")
+	}
+	if rec := undo(); rec.Code != http.StatusNotFound {
+		t.Fatalf("undo with everything reverted: status %d, body %s; want 404", rec.Code, rec.Body)
+	}
+}
+
+func TestUndoConflictsWithLaterEdits(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+	h := NewTransactionHandler(transactions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.POST("/transactions/undo", h.UndoLastTransaction, withUser(user))
+	e.POST("/transactions", h.CreateTransaction, withUser(user))
+
+	rec := doJSON(e, http.MethodPost, "/transactions", `{"type":"deposit","amount":500}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", rec.Code, rec.Body)
+	}
+	var created models.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+
+	// Changed behind the audit log's back, e.g. by an import
+	time.Sleep(10 * time.Millisecond)
+	if _, err := env.db.Exec("UPDATE transactions SET amount = 700, updated_at = ? WHERE id = ?", time.Now().UTC(), created.ID); err != nil {
+		t.Fatalf("edit row: %v", err)
+	}
+
+	rec = doJSON(e, http.MethodPost, "/transactions/undo", "", nil)
+	if rec.Code != http.StatusConflict || decodeCode(t, rec.Body.Bytes()) != "undo_conflict" {
+		t.Fatalf("undo after a later edit: status %d, body %s; want 409 undo_conflict", rec.Code, rec.Body)
+	}
+	if _, err := transactions.GetByID(created.ID, user.ID); err != nil {
+		t.Fatalf("transaction gone after a conflicting undo: %v", err)
+	}
+}
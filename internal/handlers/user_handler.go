@@ -1,15 +1,19 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"Monex/config"
+	"Monex/internal/logger"
 	"Monex/internal/middleware"
 	"Monex/internal/models"
+	"Monex/internal/notifier"
 	"Monex/internal/repository"
 
 	"github.com/labstack/echo/v4"
@@ -20,6 +24,8 @@ type UserHandler struct {
 	auditRepo          *repository.AuditRepository
 	sessionRepo        *repository.SessionRepository
 	tokenBlacklistRepo *repository.TokenBlacklistRepository
+	historyRepo        *repository.PasswordHistoryRepository
+	notifier           notifier.Notifier
 	config             *config.Config
 }
 
@@ -30,6 +36,8 @@ func NewUserHandler(
 	auditRepo *repository.AuditRepository,
 	sessionRepo *repository.SessionRepository,
 	tokenBlacklistRepo *repository.TokenBlacklistRepository,
+	historyRepo *repository.PasswordHistoryRepository,
+	securityNotifier notifier.Notifier,
 	cfg *config.Config,
 ) *UserHandler {
 	return &UserHandler{
@@ -37,6 +45,8 @@ func NewUserHandler(
 		auditRepo:          auditRepo,
 		sessionRepo:        sessionRepo,
 		tokenBlacklistRepo: tokenBlacklistRepo,
+		historyRepo:        historyRepo,
+		notifier:           securityNotifier,
 		config:             cfg,
 	}
 }
@@ -45,7 +55,7 @@ func NewUserHandler(
 type CreateUserRequest struct {
 	Username string `json:"username" validate:"required,min=3,max=50"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Password string `json:"password" validate:"required"`
 	Role     string `json:"role" validate:"required,oneof=admin user"`
 	Active   *bool  `json:"active"`
 }
@@ -76,6 +86,11 @@ func (h *UserHandler) ListUsers(c echo.Context) error {
 	if search := c.QueryParam("q"); search != "" {
 		filters["search"] = search
 	}
+	for _, param := range []string{"role", "active", "locked"} {
+		if value := c.QueryParam(param); value != "" {
+			filters[param] = value
+		}
+	}
 	if sortField := c.QueryParam("sortField"); sortField != "" {
 		filters["sortField"] = sortField
 	}
@@ -84,8 +99,15 @@ func (h *UserHandler) ListUsers(c echo.Context) error {
 	}
 
 	users, total, err := h.userRepo.List(pageSize, offset, filters)
+	if errors.Is(err, repository.ErrInvalidInput) {
+		// An unknown role or a non-boolean active/locked
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+			"message": "فیلتر نامعتبر است",
+			"code":    "invalid_input",
+		})
+	}
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list users")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to list users").SetInternal(err)
 	}
 
 	// Convert to response format
@@ -111,12 +133,34 @@ func (h *UserHandler) GetUser(c echo.Context) error {
 
 	user, err := h.userRepo.GetByID(id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
 	}
 
 	return c.JSON(http.StatusOK, user.ToResponse())
 }
 
+// GetUserPasswordHistory lists when a user changed their password (admin only)
+func (h *UserHandler) GetUserPasswordHistory(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه کاربر نامعتبر است")
+	}
+
+	if _, err := h.userRepo.GetByID(id); err != nil {
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+
+	changes, err := listPasswordChanges(h.historyRepo, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت تاریخچه کلمه عبور")
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"data":  changes,
+		"total": len(changes),
+	})
+}
+
 // CreateUser creates a new user (admin only)
 func (h *UserHandler) CreateUser(c echo.Context) error {
 	adminID, _ := middleware.GetUserID(c)
@@ -134,8 +178,12 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "کلمه عبور باید بین 3 تا 50 کاراکتر باشد")
 	}
 
-	if len(req.Password) < 8 {
-		return echo.NewHTTPError(http.StatusBadRequest, "کلمه عبور بایستی حداقل 8 کاراکتر باشد")
+	if isReservedUsername(strings.TrimSpace(req.Username), h.config.Security.ReservedUsernames) {
+		return reservedUsernameError()
+	}
+
+	if err := ValidatePasswordStrength(req.Password, &h.config.Security.PasswordPolicy); err != nil {
+		return passwordPolicyHTTPError(err)
 	}
 
 	// Validate role
@@ -162,7 +210,8 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 	}
 
 	// Check if email exists
-	exists, err = h.userRepo.ExistsByEmail(strings.TrimSpace(req.Email))
+	email := models.NormalizeEmail(req.Email)
+	exists, err = h.userRepo.ExistsByEmail(email)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بررسی ایمیل")
 	}
@@ -174,7 +223,7 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 			c.RealIP(),
 			c.Request().Header.Get("User-Agent"),
 			false,
-			fmt.Sprintf("Email already exists: %s", req.Email),
+			fmt.Sprintf("Email already exists: %s", email),
 		)
 		return echo.NewHTTPError(http.StatusConflict, "این ایمیل از قبل در سیستم موجود است")
 	}
@@ -188,7 +237,7 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 	// Create user
 	user := &models.User{
 		Username: strings.TrimSpace(req.Username),
-		Email:    strings.TrimSpace(req.Email),
+		Email:    email,
 		Role:     req.Role,
 		Active:   active,
 	}
@@ -223,10 +272,49 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 		fmt.Sprintf("Created user: %s (ID: %d, Role: %s)", user.Username, user.ID, user.Role),
 	)
 
+	sendVerificationEmail(h.notifier, &h.config.Security, user, c.RealIP())
+
 	return c.JSON(http.StatusCreated, user.ToResponse())
 }
 
-// DeleteUser deletes a user (admin only)
+// ensureNotLastAdmin refuses to demote, disable or delete user when they are
+// the only admin left who can sign in, which would lock everyone out of the
+// admin functions. It fails early, before any side effect; the write itself
+// is guarded by the repository too, which catches concurrent demotions.
+func (h *UserHandler) ensureNotLastAdmin(user *models.User) error {
+	if !user.IsActiveAdmin() {
+		return nil
+	}
+
+	count, err := h.userRepo.CountActiveAdmins()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بررسی مدیران سیستم")
+	}
+	if count <= 1 {
+		return lastActiveAdminError()
+	}
+	return nil
+}
+
+// lastActiveAdminError is the response to a change that would leave no admin
+// who can sign in
+func lastActiveAdminError() error {
+	return echo.NewHTTPError(http.StatusConflict, map[string]string{
+		"message": "این کاربر آخرین مدیر فعال سیستم است و نمی‌توان آن را حذف، غیرفعال یا به کاربر عادی تبدیل کرد",
+		"code":    "last_active_admin",
+	})
+}
+
+// DeleteUserRequest confirms a hard delete with the acting admin's password
+type DeleteUserRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// DeleteUser permanently deletes a user (admin only). The delete cascades to
+// the user's transactions, sessions, recurring rules, notifications and
+// password history, and their audit entries lose the user reference. Because
+// financial history is lost, the admin must confirm with their own password;
+// DeactivateUser is the reversible alternative.
 func (h *UserHandler) DeleteUser(c echo.Context) error {
 	adminID, _ := middleware.GetUserID(c)
 	id, err := strconv.Atoi(c.Param("id"))
@@ -240,13 +328,51 @@ func (h *UserHandler) DeleteUser(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "شما مجوز حذف حساب کاربری خود را ندارید")
 	}
 
+	req := new(DeleteUserRequest)
+	if err := c.Bind(req); err != nil || req.Password == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, map[string]interface{}{
+			"message": "برای حذف دائمی کاربر، کلمه عبور خود را وارد کنید",
+			"code":    "password_confirmation_required",
+		})
+	}
+
+	admin, err := h.userRepo.GetByID(adminID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+	if !admin.CheckPassword(req.Password) {
+		_ = h.auditRepo.LogActionWithSeverity(
+			adminID,
+			"delete_user",
+			"user",
+			c.RealIP(),
+			c.Request().Header.Get("User-Agent"),
+			false,
+			fmt.Sprintf("Password confirmation failed for deleting user ID %d", id),
+			"warning",
+		)
+		return echo.NewHTTPError(http.StatusForbidden, map[string]interface{}{
+			"message": "کلمه عبور وارد شده صحیح نیست",
+			"code":    "password_confirmation_failed",
+		})
+	}
+
 	// Get user info before deletion
 	user, err := h.userRepo.GetByID(id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+	if err := h.ensureNotLastAdmin(user); err != nil {
+		return err
 	}
 
+	// Revoke live tokens first; the cascade removes the session rows they refer to
+	h.disableUserSessions(id, fmt.Sprintf("Account deleted by admin %d", adminID))
+
 	if err := h.userRepo.Delete(id); err != nil {
+		if errors.Is(err, repository.ErrLastActiveAdmin) {
+			return lastActiveAdminError()
+		}
 		_ = h.auditRepo.LogAction(
 			adminID,
 			"delete_user",
@@ -260,7 +386,7 @@ func (h *UserHandler) DeleteUser(c echo.Context) error {
 	}
 
 	// ✅ Log successful user deletion
-	_ = h.auditRepo.LogAction(
+	_ = h.auditRepo.LogActionWithSeverity(
 		adminID,
 		"delete_user",
 		"user",
@@ -268,14 +394,101 @@ func (h *UserHandler) DeleteUser(c echo.Context) error {
 		c.Request().Header.Get("User-Agent"),
 		true,
 		fmt.Sprintf("Deleted user: %s (ID: %d, Email: %s)", user.Username, user.ID, user.Email),
+		"critical",
 	)
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "کاربر با موفقیت حذف شد"})
 }
 
+// DeactivateUser disables an account and ends its sessions while keeping all
+// of its data (admin only). ReactivateUser reverses it.
+func (h *UserHandler) DeactivateUser(c echo.Context) error {
+	adminID, _ := middleware.GetUserID(c)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه کاربر نامعتبر است")
+	}
+	if id == adminID {
+		return echo.NewHTTPError(http.StatusBadRequest, "شما مجوز غیرفعال کردن حساب کاربری خود را ندارید")
+	}
+
+	user, err := h.userRepo.GetByID(id)
+	if err != nil {
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+
+	if user.Active {
+		if err := h.ensureNotLastAdmin(user); err != nil {
+			return err
+		}
+		if err := h.userRepo.SetActive(id, false); err != nil {
+			if errors.Is(err, repository.ErrLastActiveAdmin) {
+				return lastActiveAdminError()
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "خطا در غیرفعال کردن کاربر")
+		}
+		user.Active = false
+
+		h.disableUserSessions(id, fmt.Sprintf("Account deactivated by admin %d", adminID))
+
+		notifier.Dispatch(h.notifier, notifier.Event{
+			Type:      notifier.EventAccountDisabled,
+			UserID:    user.ID,
+			Username:  user.Username,
+			IPAddress: c.RealIP(),
+		})
+	}
+
+	_ = h.auditRepo.LogActionWithSeverity(
+		adminID,
+		"deactivate_user",
+		"user",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Deactivated user: %s (ID: %d)", user.Username, user.ID),
+		"warning",
+	)
+
+	return c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// ReactivateUser re-enables a deactivated account (admin only)
+func (h *UserHandler) ReactivateUser(c echo.Context) error {
+	adminID, _ := middleware.GetUserID(c)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه کاربر نامعتبر است")
+	}
+
+	user, err := h.userRepo.GetByID(id)
+	if err != nil {
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+
+	if !user.Active {
+		if err := h.userRepo.SetActive(id, true); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "خطا در فعال کردن کاربر")
+		}
+		user.Active = true
+	}
+
+	_ = h.auditRepo.LogAction(
+		adminID,
+		"reactivate_user",
+		"user",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Reactivated user: %s (ID: %d)", user.Username, user.ID),
+	)
+
+	return c.JSON(http.StatusOK, user.ToResponse())
+}
+
 // ResetUserPasswordRequest represents password reset data (admin only)
 type ResetUserPasswordRequest struct {
-	NewPassword string `json:"new_password" validate:"required,min=8"`
+	NewPassword string `json:"new_password" validate:"required"`
 }
 
 // ResetUserPassword resets a user's password (admin only)
@@ -291,13 +504,13 @@ func (h *UserHandler) ResetUserPassword(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "درخواست نامعتبر")
 	}
 
-	if len(req.NewPassword) < 8 {
-		return echo.NewHTTPError(http.StatusBadRequest, "کلمه عبور بایستی حداقل 8 کاراکتر باشد")
+	if err := ValidatePasswordStrength(req.NewPassword, &h.config.Security.PasswordPolicy); err != nil {
+		return passwordPolicyHTTPError(err)
 	}
 
 	user, err := h.userRepo.GetByID(id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
 	}
 
 	// Set new password
@@ -341,7 +554,7 @@ func (h *UserHandler) UnlockUser(c echo.Context) error {
 	// Get user by username
 	user, err := h.userRepo.GetByUsername(username)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
 	}
 
 	// Unlock the user
@@ -349,6 +562,7 @@ func (h *UserHandler) UnlockUser(c echo.Context) error {
 	user.LockedUntil = nil
 	user.PermanentlyLocked = false
 	user.FailedAttempts = 0
+	user.TempBansCount = 0
 
 	if err := h.userRepo.UpdateLockStatus(user); err != nil {
 		_ = h.auditRepo.LogAction(
@@ -378,34 +592,159 @@ func (h *UserHandler) UnlockUser(c echo.Context) error {
 	})
 }
 
+// LockUserRequest is the body of an explicit admin lock
+type LockUserRequest struct {
+	Permanent bool   `json:"permanent"`
+	Reason    string `json:"reason"`
+}
+
+// LockUser locks an account on purpose (admin only). A temporary lock lasts
+// TEMP_BAN_DURATION; a permanent one stays until unlock-permanent. Either
+// way all of the user's sessions are revoked.
+func (h *UserHandler) LockUser(c echo.Context) error {
+	adminID, _ := middleware.GetUserID(c)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه کاربر نامعتبر است")
+	}
+	if id == adminID {
+		return echo.NewHTTPError(http.StatusBadRequest, "شما مجوز قفل کردن حساب کاربری خود را ندارید")
+	}
+
+	req := new(LockUserRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "درخواست نامعتبر")
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "دلیل قفل کردن الزامی است")
+	}
+	if len([]rune(req.Reason)) > 500 {
+		return echo.NewHTTPError(http.StatusBadRequest, "دلیل قفل کردن حداکثر ۵۰۰ کاراکتر است")
+	}
+
+	user, err := h.userRepo.GetByID(id)
+	if err != nil {
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+
+	user.Locked = true
+	if req.Permanent {
+		user.PermanentlyLocked = true
+		user.LockedUntil = nil
+	} else {
+		lockedUntil := time.Now().UTC().Add(h.config.Login.TempBanDuration)
+		user.LockedUntil = &lockedUntil
+	}
+
+	if err := h.userRepo.UpdateLockStatus(user); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بروزرسانی وضعیت کاربر")
+	}
+
+	lockType := "temporarily"
+	if req.Permanent {
+		lockType = "permanently"
+	}
+	h.disableUserSessions(id, fmt.Sprintf("Account %s locked by admin %d", lockType, adminID))
+
+	notifier.Dispatch(h.notifier, notifier.Event{
+		Type:      notifier.EventAccountLocked,
+		UserID:    user.ID,
+		Username:  user.Username,
+		IPAddress: c.RealIP(),
+	})
+
+	_ = h.auditRepo.LogActionWithSeverity(
+		adminID,
+		"lock_user",
+		"user",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Locked user %s %s: %s (ID: %d)", lockType, user.Username, req.Reason, user.ID),
+		"warning",
+	)
+
+	return c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// UnlockPermanentUser lifts a permanent lock (admin only)
+func (h *UserHandler) UnlockPermanentUser(c echo.Context) error {
+	adminID, _ := middleware.GetUserID(c)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "شناسه کاربر نامعتبر است")
+	}
+
+	user, err := h.userRepo.GetByID(id)
+	if err != nil {
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+	if !user.PermanentlyLocked {
+		return echo.NewHTTPError(http.StatusBadRequest, "حساب کاربر به صورت دائمی قفل نیست")
+	}
+
+	user.Locked = false
+	user.LockedUntil = nil
+	user.PermanentlyLocked = false
+	user.FailedAttempts = 0
+
+	if err := h.userRepo.UpdateLockStatus(user); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بروزرسانی وضعیت کاربر")
+	}
+
+	_ = h.auditRepo.LogAction(
+		adminID,
+		"unlock_user_permanent",
+		"user",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Lifted permanent lock of user: %s (ID: %d)", user.Username, user.ID),
+	)
+
+	return c.JSON(http.StatusOK, user.ToResponse())
+}
+
 func (h *UserHandler) disableUserSessions(
 	userID int,
 	reason string,
+) error {
+	return revokeUserSessions(h.sessionRepo, h.tokenBlacklistRepo, userID, reason)
+}
+
+// revokeUserSessions blacklists every token of the user, invalidates their
+// sessions and notifies connected clients
+func revokeUserSessions(
+	sessionRepo *repository.SessionRepository,
+	tokenBlacklistRepo *repository.TokenBlacklistRepository,
+	userID int,
+	reason string,
 ) error {
 	// Get all active sessions
-	sessions, err := h.sessionRepo.GetUserSessions(userID)
+	sessions, err := sessionRepo.GetUserSessions(userID)
 	if err != nil {
-		log.Printf("[WARN] Failed to get sessions: %v", err)
+		slog.Warn("Failed to get sessions", "user_id", userID, "error", err)
 		return err
 	}
 
 	// Blacklist all tokens for this user
-	if h.tokenBlacklistRepo != nil {
-		if err := h.tokenBlacklistRepo.BlacklistUserTokens(userID, reason); err != nil {
-			log.Printf("[WARN] Failed to blacklist tokens: %v", err)
+	if tokenBlacklistRepo != nil {
+		if err := tokenBlacklistRepo.BlacklistUserTokens(userID, reason); err != nil {
+			slog.Warn("Failed to blacklist tokens", "user_id", userID, "error", err)
 		}
 	} else {
-		log.Printf("[WARN] tokenBlacklistRepo is nil; skipping token blacklist for user %d", userID)
+		slog.Warn("No token blacklist configured, skipping", "user_id", userID)
 	}
 
 	// Invalidate all sessions (triggers notification)
-	if err := h.sessionRepo.InvalidateAllUserSessions(userID); err != nil {
-		log.Printf("[WARN] Failed to invalidate sessions: %v", err)
+	if err := sessionRepo.InvalidateAllUserSessions(userID); err != nil {
+		slog.Warn("Failed to invalidate sessions", "user_id", userID, "error", err)
 	}
 
 	// Broadcast invalidation to all connected clients
 	for _, session := range sessions {
-		log.Printf("[SECURITY] Broadcasting invalidation - SessionID: %d, Reason: %s", session.ID, reason)
+		logger.Security("Broadcasting session invalidation", "session_id", session.ID, "reason", reason)
 		// InvalidationHub assumed to be a package-level var in this package
 		InvalidationHub.InvalidateSession(session.ID)
 		InvalidationHub.CleanupSession(session.ID)
@@ -429,22 +768,31 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
 
 	user, err := h.userRepo.GetByID(id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "کاربر یافت نشد")
+		return repositoryError(err, "کاربر یافت نشد", "خطا در دریافت کاربر")
+	}
+
+	// ✅ Demoting or disabling must leave at least one admin who can sign in
+	demote := req.Role != "" && req.Role != models.RoleAdmin
+	disable := req.Active != nil && !*req.Active
+	if demote || disable {
+		if err := h.ensureNotLastAdmin(user); err != nil {
+			return err
+		}
 	}
 
 	oldActive := user.Active
-	oldUserInfo := fmt.Sprintf("%s (Email: %s, Role: %s, Active: %v)", user.Username, user.Email, user.Role, user.Active)
+	before := *user
 
 	// Update email if provided
-	if req.Email != "" && req.Email != user.Email {
-		exists, err := h.userRepo.ExistsByEmail(strings.TrimSpace(req.Email))
+	if email := models.NormalizeEmail(req.Email); email != "" && email != models.NormalizeEmail(user.Email) {
+		exists, err := h.userRepo.ExistsByEmail(email)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بررسی ایمیل")
 		}
 		if exists {
 			return echo.NewHTTPError(http.StatusConflict, "این ایمیل از قبل در سیستم موجود است")
 		}
-		user.Email = strings.TrimSpace(req.Email)
+		user.Email = email
 	}
 
 	// Update role if provided
@@ -461,11 +809,18 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
 
 		// ✅ NEW: If disabling user, invalidate all sessions
 		if oldActive && !user.Active {
-			log.Printf("[SECURITY] Admin %d is disabling user %d - invalidating all sessions", adminID, id)
+			logger.Security("Admin disabling user, invalidating all sessions", "admin_id", adminID, "user_id", id)
 			h.disableUserSessions(
 				id,
 				fmt.Sprintf("Account disabled by admin %d", adminID),
 			)
+
+			notifier.Dispatch(h.notifier, notifier.Event{
+				Type:      notifier.EventAccountDisabled,
+				UserID:    user.ID,
+				Username:  user.Username,
+				IPAddress: c.RealIP(),
+			})
 		}
 	}
 
@@ -479,10 +834,12 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
 			false,
 			fmt.Sprintf("Failed to update user ID %d: %v", id, err),
 		)
+		if errors.Is(err, repository.ErrLastActiveAdmin) {
+			return lastActiveAdminError()
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "خطایی هنگام بروز رسانی کاربر رخ داده است")
 	}
 
-	newUserInfo := fmt.Sprintf("%s (Email: %s, Role: %s, Active: %v)", user.Username, user.Email, user.Role, user.Active)
 	_ = h.auditRepo.LogAction(
 		adminID,
 		"update_user",
@@ -490,7 +847,7 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
 		c.RealIP(),
 		c.Request().Header.Get("User-Agent"),
 		true,
-		fmt.Sprintf("Updated user ID %d: From [%s] To [%s]", id, oldUserInfo, newUserInfo),
+		changeDetails(id, &before, user, "updated_at"),
 	)
 
 	return c.JSON(http.StatusOK, user.ToResponse())
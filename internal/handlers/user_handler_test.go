@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"Monex/config"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLastActiveAdminWritesRefused(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.admin(t)
+
+	if err := env.users.SetActive(admin.ID, false); !errors.Is(err, repository.ErrLastActiveAdmin) {
+		t.Fatalf("SetActive(false) = %v, want ErrLastActiveAdmin", err)
+	}
+	if err := env.users.Delete(admin.ID); !errors.Is(err, repository.ErrLastActiveAdmin) {
+		t.Fatalf("Delete = %v, want ErrLastActiveAdmin", err)
+	}
+	demoted := *admin
+	demoted.Role = models.RoleUser
+	if err := env.users.Update(&demoted); !errors.Is(err, repository.ErrLastActiveAdmin) {
+		t.Fatalf("Update demoting = %v, want ErrLastActiveAdmin", err)
+	}
+
+	// Changes that keep them an admin who can sign in still go through
+	admin.Email = "root@example.com"
+	if err := env.users.Update(admin); err != nil {
+		t.Fatalf("Update email: %v", err)
+	}
+	if err := env.users.Delete(admin.ID + 1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("Delete missing user = %v, want ErrNotFound", err)
+	}
+}
+
+func TestConcurrentAdminDeactivationKeepsOne(t *testing.T) {
+	env := newTestEnv(t)
+	first := env.admin(t)
+	second := env.createUser(t, "second", "Str0ng!Passw0rd", models.RoleAdmin)
+
+	// Both pass a separate count check when run together; the guarded write
+	// must still let only one through
+	results := make(chan error, 2)
+	var wg sync.WaitGroup
+	for _, id := range []int{first.ID, second.ID} {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			results <- env.users.SetActive(id, false)
+		}(id)
+	}
+	wg.Wait()
+	close(results)
+
+	var refused int
+	for err := range results {
+		if errors.Is(err, repository.ErrLastActiveAdmin) {
+			refused++
+		} else if err != nil {
+			t.Fatalf("SetActive: %v", err)
+		}
+	}
+	if refused != 1 {
+		t.Fatalf("%d deactivations refused, want 1", refused)
+	}
+	if count, err := env.users.CountActiveAdmins(); err != nil || count != 1 {
+		t.Fatalf("CountActiveAdmins = %d, %v; want 1", count, err)
+	}
+}
+
+func TestParallelFailedAttemptsAllCount(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "target", "Str0ng!Passw0rd", models.RoleUser)
+
+	const attempts = 50
+	seen := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, err := env.users.IncrementFailedAttempts(user.ID)
+			if err != nil {
+				t.Errorf("IncrementFailedAttempts: %v", err)
+				return
+			}
+			seen <- count
+		}()
+	}
+	wg.Wait()
+	close(seen)
+
+	// Every increment lands and each caller sees a distinct count
+	counts := make(map[int]bool)
+	for count := range seen {
+		if counts[count] {
+			t.Fatalf("count %d returned twice", count)
+		}
+		counts[count] = true
+	}
+	stored, err := env.users.GetByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.FailedAttempts != attempts || len(counts) != attempts {
+		t.Fatalf("failed_attempts = %d with %d distinct counts, want %d", stored.FailedAttempts, len(counts), attempts)
+	}
+}
+
+func TestMixedCaseEmailConflicts(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.admin(t)
+	env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser) // alice@example.com
+	bob := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+
+	events := make(captureNotifier, 8)
+	auth := env.authHandler(t, events, env.cfg)
+	users := NewUserHandler(env.users, env.audit, env.sessions, env.blacklist, env.passwordHistory, events, env.cfg)
+	profile := NewProfileHandler(env.users, env.passwordHistory, env.sessions, env.audit, &env.cfg.Security)
+	e := newEcho()
+	e.POST("/register", auth.Register)
+	e.POST("/users", users.CreateUser, withUser(admin))
+	e.PUT("/profile", profile.UpdateProfile, withUser(bob))
+
+	conflicts := []struct {
+		name, path, method, body string
+	}{
+		{"register", "/register", http.MethodPost,
+			`{"username":"alice2","email":" Alice@Example.COM ","password":"Str0ng!Passw0rd"}`},
+		{"admin create", "/users", http.MethodPost,
+			`{"username":"alice3","email":"ALICE@example.com","password":"Str0ng!Passw0rd","role":"user"}`},
+		{"profile update", "/profile", http.MethodPut, `{"email":"\talice@EXAMPLE.com "}`},
+	}
+	for _, tt := range conflicts {
+		if rec := doJSON(e, tt.method, tt.path, tt.body, nil); rec.Code != http.StatusConflict {
+			t.Errorf("%s with a differently cased email: status %d, body %s; want 409", tt.name, rec.Code, rec.Body)
+		}
+	}
+
+	// New addresses are stored trimmed and lowercased
+	rec := doJSON(e, http.MethodPost, "/register",
+		`{"username":"carol","email":"  Carol@Example.COM","password":"Str0ng!Passw0rd"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register carol: status %d, body %s", rec.Code, rec.Body)
+	}
+	carol, err := env.users.GetByUsername("carol")
+	if err != nil {
+		t.Fatalf("GetByUsername: %v", err)
+	}
+	if carol.Email != "carol@example.com" {
+		t.Fatalf("stored email %q, want carol@example.com", carol.Email)
+	}
+}
+
+func TestReservedUsernamesRejected(t *testing.T) {
+	env := newTestEnv(t)
+	admin := env.admin(t)
+
+	events := make(captureNotifier, 8)
+	auth := env.authHandler(t, events, env.cfg)
+	users := NewUserHandler(env.users, env.audit, env.sessions, env.blacklist, env.passwordHistory, events, env.cfg)
+	e := newEcho()
+	e.POST("/register", auth.Register)
+	e.POST("/users", users.CreateUser, withUser(admin))
+	e.PUT("/users/:id", users.UpdateUser, withUser(admin))
+
+	rec := doJSON(e, http.MethodPost, "/register",
+		`{"username":"Admin","email":"fake-admin@example.com","password":"Str0ng!Passw0rd"}`, nil)
+	if rec.Code != http.StatusBadRequest || decodeCode(t, rec.Body.Bytes()) != "username_reserved" {
+		t.Fatalf("registering Admin: status %d, body %s; want 400 username_reserved", rec.Code, rec.Body)
+	}
+	rec = doJSON(e, http.MethodPost, "/users",
+		`{"username":" ROOT ","email":"root@example.com","password":"Str0ng!Passw0rd","role":"user"}`, nil)
+	if rec.Code != http.StatusBadRequest || decodeCode(t, rec.Body.Bytes()) != "username_reserved" {
+		t.Fatalf("admin creating ROOT: status %d, body %s; want 400 username_reserved", rec.Code, rec.Body)
+	}
+
+	// The seeded admin keeps its reserved name and can still be managed
+	rec = doJSON(e, http.MethodPut, fmt.Sprintf("/users/%d", admin.ID), `{"email":"ops@example.com"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("updating the real admin: status %d, body %s", rec.Code, rec.Body)
+	}
+	if stored, err := env.users.GetByID(admin.ID); err != nil || stored.Email != "ops@example.com" {
+		t.Fatalf("admin after update: %+v, %v", stored, err)
+	}
+}
+
+func TestPasswordPolicyRules(t *testing.T) {
+	tests := []struct {
+		rule   string
+		policy config.PasswordPolicyConfig
+		bad    string
+		good   string
+	}{
+		{PasswordTooShort, config.PasswordPolicyConfig{MinLength: 10}, "short", "long enough"},
+		{PasswordMissingUpper, config.PasswordPolicyConfig{RequireUpper: true}, "lowercase", "Uppercase"},
+		{PasswordMissingDigit, config.PasswordPolicyConfig{RequireDigit: true}, "nodigits", "one digit 1"},
+		{PasswordMissingSymbol, config.PasswordPolicyConfig{RequireSymbol: true}, "nosymbol1", "symbol!"},
+		{PasswordTooCommon, config.PasswordPolicyConfig{RejectCommon: true}, "Password123", "violet-harbour-lamp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			var policyErr *PasswordPolicyError
+			err := ValidatePasswordStrength(tt.bad, &tt.policy)
+			if !errors.As(err, &policyErr) || len(policyErr.Violations) != 1 || policyErr.Violations[0] != tt.rule {
+				t.Fatalf("ValidatePasswordStrength(%q) = %v, want only %s", tt.bad, err, tt.rule)
+			}
+			if err := ValidatePasswordStrength(tt.good, &tt.policy); err != nil {
+				t.Fatalf("ValidatePasswordStrength(%q) = %v, want nil", tt.good, err)
+			}
+		})
+	}
+
+	t.Run(PasswordReused, func(t *testing.T) {
+		env := newTestEnv(t)
+		user := env.createUser(t, "alice", "Current!Passw0rd", "user")
+		old, err := bcrypt.GenerateFromPassword([]byte("Previous!Passw0rd"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hash: %v", err)
+		}
+		if err := env.passwordHistory.Add(user.ID, string(old)); err != nil {
+			t.Fatalf("history Add: %v", err)
+		}
+		policy := &config.PasswordPolicyConfig{HistorySize: 2}
+
+		for _, pw := range []string{"Current!Passw0rd", "Previous!Passw0rd"} {
+			var policyErr *PasswordPolicyError
+			err := checkPasswordReuse(pw, user, env.passwordHistory, policy)
+			if !errors.As(err, &policyErr) || policyErr.Violations[0] != PasswordReused {
+				t.Fatalf("checkPasswordReuse(%q) = %v, want %s", pw, err, PasswordReused)
+			}
+		}
+		if err := checkPasswordReuse("Brand!NewPassw0rd", user, env.passwordHistory, policy); err != nil {
+			t.Fatalf("checkPasswordReuse of a new password = %v, want nil", err)
+		}
+	})
+}
+
+func TestRepositoryErrorsWrapSentinels(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", "Str0ng!Passw0rd", "user")
+	_, _, sessionID := loginSession(t, env, user, "203.0.113.7")
+
+	_, missingUser := env.users.GetByID(user.ID + 1000)
+	_, missingSession := env.sessions.GetSessionByID(sessionID+1000, user.ID)
+	staleRotation := env.sessions.RotateTokens(sessionID, "not-the-refresh-token", "a", "r", "aj", "rj")
+	_, _, badRole := env.users.List(10, 0, map[string]interface{}{"role": "root"})
+
+	tests := []struct {
+		name     string
+		err      error
+		sentinel error
+		status   int
+	}{
+		{"missing user", missingUser, repository.ErrNotFound, http.StatusNotFound},
+		{"missing session", missingSession, repository.ErrNotFound, http.StatusNotFound},
+		{"stale rotation", staleRotation, repository.ErrConflict, http.StatusConflict},
+		{"transaction conflict", repository.ErrTransactionConflict, repository.ErrConflict, http.StatusConflict},
+		{"bad role filter", badRole, repository.ErrInvalidInput, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.sentinel) {
+			t.Errorf("%s: %v does not match %v", tt.name, tt.err, tt.sentinel)
+			continue
+		}
+		var httpErr *echo.HTTPError
+		if !errors.As(repositoryError(tt.err, "not found", "failed"), &httpErr) || httpErr.Code != tt.status {
+			t.Errorf("%s: repositoryError = %v, want status %d", tt.name, httpErr, tt.status)
+		}
+	}
+
+	var httpErr *echo.HTTPError
+	if !errors.As(repositoryError(errors.New("disk I/O error"), "not found", "failed"), &httpErr) ||
+		httpErr.Code != http.StatusInternalServerError {
+		t.Fatalf("unknown error: repositoryError = %v, want status 500", httpErr)
+	}
+}
+
+func TestListUsersRejectsInvalidFilters(t *testing.T) {
+	env := newTestEnv(t)
+	h := NewUserHandler(env.users, env.audit, env.sessions, env.blacklist, env.passwordHistory, nil, env.cfg)
+	e := newEcho()
+	e.GET("/users", h.ListUsers, withUser(env.admin(t)))
+
+	for _, query := range []string{"role=owner", "active=maybe", "locked=1x"} {
+		rec := doJSON(e, http.MethodGet, "/users?"+query, "", nil)
+		if rec.Code != http.StatusBadRequest || decodeCode(t, rec.Body.Bytes()) != "invalid_input" {
+			t.Errorf("%s: status %d, body %s; want 400 invalid_input", query, rec.Code, rec.Body)
+		}
+	}
+	if rec := doJSON(e, http.MethodGet, "/users?role=admin&active=true", "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("valid filters: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDeactivateKeepsDataAndDeleteRemovesIt(t *testing.T) {
+	env := newTestEnv(t)
+	boss := env.createUser(t, "boss", "Adm1n!Passw0rd", models.RoleAdmin)
+	alice := env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+	bob := env.createUser(t, "bob", "Str0ng!Passw0rd", models.RoleUser)
+	transactions := repository.NewTransactionRepository(env.db)
+	for _, owner := range []int{alice.ID, alice.ID, bob.ID} {
+		if err := transactions.Create(&models.Transaction{UserID: owner, Type: "deposit", Amount: 100, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	loginSession(t, env, alice, "203.0.113.7")
+	loginSession(t, env, bob, "203.0.113.8")
+
+	count := func(table string, userID int) int {
+		t.Helper()
+		var n int
+		if err := env.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE user_id = ?", userID).Scan(&n); err != nil {
+			t.Fatalf("count %s: %v", table, err)
+		}
+		return n
+	}
+
+	h := NewUserHandler(env.users, env.audit, env.sessions, env.blacklist, env.passwordHistory, nil, env.cfg)
+	e := newEcho()
+	e.POST("/users/:id/deactivate", h.DeactivateUser, withUser(boss))
+	e.POST("/users/:id/reactivate", h.ReactivateUser, withUser(boss))
+	e.DELETE("/users/:id", h.DeleteUser, withUser(boss))
+
+	// Deactivating ends the sessions but keeps the account and its data
+	if rec := doJSON(e, http.MethodPost, fmt.Sprintf("/users/%d/deactivate", alice.ID), "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("deactivate: status %d, body %s", rec.Code, rec.Body)
+	}
+	stored, err := env.users.GetByID(alice.ID)
+	if err != nil || stored.Active {
+		t.Fatalf("deactivated user = %+v (%v), want inactive", stored, err)
+	}
+	if n := count("transactions", alice.ID); n != 2 {
+		t.Fatalf("%d transactions after deactivation, want 2", n)
+	}
+	if n := count("sessions", alice.ID); n != 0 {
+		t.Fatalf("%d sessions after deactivation, want 0", n)
+	}
+	if rec := doJSON(e, http.MethodPost, fmt.Sprintf("/users/%d/reactivate", alice.ID), "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("reactivate: status %d, body %s", rec.Code, rec.Body)
+	}
+	if stored, err := env.users.GetByID(alice.ID); err != nil || !stored.Active || count("transactions", alice.ID) != 2 {
+		t.Fatalf("reactivated user = %+v (%v), want active with 2 transactions", stored, err)
+	}
+
+	// Deleting removes the account and everything it owns
+	if rec := doJSON(e, http.MethodDelete, fmt.Sprintf("/users/%d", bob.ID), `{"password":"Adm1n!Passw0rd"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d, body %s", rec.Code, rec.Body)
+	}
+	if _, err := env.users.GetByID(bob.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("GetByID after delete = %v, want ErrNotFound", err)
+	}
+	if n := count("transactions", bob.ID) + count("sessions", bob.ID); n != 0 {
+		t.Fatalf("%d transactions and sessions left after delete, want 0", n)
+	}
+	if n := count("transactions", alice.ID); n != 2 {
+		t.Fatalf("deleting bob left alice with %d transactions, want 2", n)
+	}
+}
+
+func TestLockAnotherAdminButNotSelf(t *testing.T) {
+	env := newTestEnv(t)
+	boss := env.createUser(t, "boss", "Adm1n!Passw0rd", models.RoleAdmin)
+	other := env.createUser(t, "other", "Adm1n!Passw0rd", models.RoleAdmin)
+	loginSession(t, env, other, "203.0.113.7")
+
+	h := NewUserHandler(env.users, env.audit, env.sessions, env.blacklist, env.passwordHistory, nil, env.cfg)
+	e := newEcho()
+	e.POST("/users/:id/lock", h.LockUser, withUser(boss))
+	lock := func(id int, body string) int {
+		return doJSON(e, http.MethodPost, fmt.Sprintf("/users/%d/lock", id), body, nil).Code
+	}
+
+	if code := lock(boss.ID, `{"permanent":true,"reason":"testing"}`); code != http.StatusBadRequest {
+		t.Fatalf("self-lock: status %d, want 400", code)
+	}
+	if self, _ := env.users.GetByID(boss.ID); self.Locked {
+		t.Fatal("admin locked their own account")
+	}
+
+	if code := lock(other.ID, `{"permanent":true}`); code != http.StatusBadRequest {
+		t.Errorf("lock without a reason: status %d, want 400", code)
+	}
+	if code := lock(other.ID, `{"permanent":true,"reason":"compromised"}`); code != http.StatusOK {
+		t.Fatalf("locking another admin: status %d, want 200", code)
+	}
+	locked, err := env.users.GetByID(other.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if !locked.Locked || !locked.PermanentlyLocked {
+		t.Fatalf("other admin locked %t, permanently %t; want both", locked.Locked, locked.PermanentlyLocked)
+	}
+	if sessions, err := env.sessions.GetUserSessions(other.ID); err != nil || len(sessions) != 0 {
+		t.Errorf("locked admin kept %d sessions (%v), want none", len(sessions), err)
+	}
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"Monex/internal/middleware"
+	"Monex/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxImportRows bounds one import; every created user costs a bcrypt hash
+const maxImportRows = 200
+
+// Import row outcomes
+const (
+	importStatusCreated = "created"
+	importStatusValid   = "valid" // dry run: the row would be created
+	importStatusError   = "error"
+)
+
+// UserImportResult is the outcome of one CSV row. TemporaryPassword is only
+// returned once, in the import response.
+type UserImportResult struct {
+	Row               int    `json:"row"`
+	Username          string `json:"username"`
+	Email             string `json:"email"`
+	Role              string `json:"role,omitempty"`
+	Active            bool   `json:"active"`
+	Status            string `json:"status"`
+	Code              string `json:"code,omitempty"`
+	Error             string `json:"error,omitempty"`
+	UserID            int    `json:"user_id,omitempty"`
+	TemporaryPassword string `json:"temporary_password,omitempty"`
+}
+
+// UserImportResponse summarizes an import
+type UserImportResponse struct {
+	DryRun  bool                `json:"dry_run"`
+	Created int                 `json:"created"`
+	Valid   int                 `json:"valid"`
+	Failed  int                 `json:"failed"`
+	Results []*UserImportResult `json:"results"`
+}
+
+// ImportUsers creates users from a CSV with the columns username, email,
+// role and active (admin only). The CSV is the "file" form field or the raw
+// request body; a header row is optional and may reorder the columns. Each
+// user gets a generated temporary password and must change it at first
+// login. With dryRun=true rows are only validated.
+func (h *UserHandler) ImportUsers(c echo.Context) error {
+	adminID, _ := middleware.GetUserID(c)
+	dryRun, _ := strconv.ParseBool(c.QueryParam("dryRun"))
+
+	done, ok := LongOperations.Begin("user_import")
+	if !ok {
+		return errShuttingDown()
+	}
+	defer done()
+
+	records, err := readImportCSV(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("فایل CSV نامعتبر است: %v", err))
+	}
+
+	columns := map[string]int{"username": 0, "email": 1, "role": 2, "active": 3}
+	firstRow := 1
+	if len(records) > 0 && strings.EqualFold(strings.TrimSpace(records[0][0]), "username") {
+		columns = make(map[string]int)
+		for i, name := range records[0] {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		if _, ok := columns["email"]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "ستون email در سطر عنوان یافت نشد")
+		}
+		records = records[1:]
+		firstRow = 2
+	}
+	if len(records) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "فایل CSV هیچ کاربری ندارد")
+	}
+	if len(records) > maxImportRows {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("حداکثر %d کاربر در هر بار قابل وارد کردن است", maxImportRows))
+	}
+
+	response := &UserImportResponse{DryRun: dryRun, Results: make([]*UserImportResult, 0, len(records))}
+	seenUsernames := make(map[string]bool)
+	seenEmails := make(map[string]bool)
+
+	for i, record := range records {
+		field := func(name string) string {
+			if index, ok := columns[name]; ok && index < len(record) {
+				return strings.TrimSpace(record[index])
+			}
+			return ""
+		}
+
+		result := &UserImportResult{
+			Row:      firstRow + i,
+			Username: field("username"),
+			Email:    models.NormalizeEmail(field("email")),
+		}
+		response.Results = append(response.Results, result)
+
+		if err := h.validateImportRow(result, field("role"), field("active"), seenUsernames, seenEmails); err != nil {
+			return err
+		}
+		if result.Status == importStatusError {
+			response.Failed++
+			continue
+		}
+		seenUsernames[strings.ToLower(result.Username)] = true
+		seenEmails[result.Email] = true
+
+		if dryRun {
+			result.Status = importStatusValid
+			response.Valid++
+			continue
+		}
+
+		if err := h.createImportedUser(c, adminID, result); err != nil {
+			result.Status = importStatusError
+			result.Code = "create_failed"
+			result.Error = "خطا در ایجاد کاربر"
+			response.Failed++
+			continue
+		}
+		response.Created++
+	}
+
+	if !dryRun {
+		_ = h.auditRepo.LogAction(
+			adminID,
+			"import_users",
+			"user",
+			c.RealIP(),
+			c.Request().Header.Get("User-Agent"),
+			response.Failed == 0,
+			fmt.Sprintf("Imported %d users from CSV (%d rows failed)", response.Created, response.Failed),
+		)
+	}
+
+	// The response carries one-time passwords
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, response)
+}
+
+// readImportCSV reads the CSV from the "file" form field, or from the body
+// when the request isn't a multipart upload
+func readImportCSV(c echo.Context) ([][]string, error) {
+	var source io.Reader = c.Request().Body
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return nil, errors.New("file field is missing")
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		source = file
+	}
+
+	reader := csv.NewReader(source)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return reader.ReadAll()
+}
+
+// validateImportRow fills in the role and active flag and marks the result
+// as an error when the row can't be created. Only database failures are
+// returned as errors.
+func (h *UserHandler) validateImportRow(
+	result *UserImportResult,
+	role, active string,
+	seenUsernames, seenEmails map[string]bool,
+) error {
+	reject := func(code, message string) {
+		result.Status = importStatusError
+		result.Code = code
+		result.Error = message
+	}
+
+	result.Role = strings.ToLower(role)
+	if result.Role == "" {
+		result.Role = models.RoleUser
+	}
+	result.Active = true
+	if active != "" {
+		parsed, err := strconv.ParseBool(active)
+		if err != nil {
+			reject("invalid_active", "مقدار active باید true یا false باشد")
+			return nil
+		}
+		result.Active = parsed
+	}
+
+	if len(result.Username) < 3 || len(result.Username) > 50 {
+		reject("invalid_username", "نام کاربری باید بین 3 تا 50 کاراکتر باشد")
+		return nil
+	}
+	if isReservedUsername(result.Username, h.config.Security.ReservedUsernames) {
+		reject("username_reserved", reservedUsernameMessage)
+		return nil
+	}
+	if _, err := mail.ParseAddress(result.Email); err != nil {
+		reject("invalid_email", "ایمیل نامعتبر است")
+		return nil
+	}
+	if result.Role != models.RoleAdmin && result.Role != models.RoleUser {
+		reject("invalid_role", "نقش نامعتبر")
+		return nil
+	}
+
+	// Usernames are case-insensitive in the database
+	if seenUsernames[strings.ToLower(result.Username)] {
+		reject("duplicate_username", "این نام کاربری در فایل تکرار شده است")
+		return nil
+	}
+	if seenEmails[result.Email] {
+		reject("duplicate_email", "این ایمیل در فایل تکرار شده است")
+		return nil
+	}
+
+	exists, err := h.userRepo.ExistsByUsername(result.Username)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بررسی نام کاربری")
+	}
+	if exists {
+		reject("duplicate_username", "این نام کاربری از قبل در سیستم موجود است")
+		return nil
+	}
+
+	exists, err = h.userRepo.ExistsByEmail(result.Email)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "خطا در بررسی ایمیل")
+	}
+	if exists {
+		reject("duplicate_email", "این ایمیل از قبل در سیستم موجود است")
+		return nil
+	}
+	return nil
+}
+
+// createImportedUser creates a validated row with a temporary password
+func (h *UserHandler) createImportedUser(c echo.Context, adminID int, result *UserImportResult) error {
+	password, err := generateTemporaryPassword(&h.config.Security.PasswordPolicy)
+	if err != nil {
+		return err
+	}
+
+	user := &models.User{
+		Username:               result.Username,
+		Email:                  result.Email,
+		Role:                   result.Role,
+		Active:                 result.Active,
+		PasswordChangeRequired: true,
+	}
+	if err := user.SetPassword(password, h.config.Security.BcryptCost); err != nil {
+		return err
+	}
+	if err := h.userRepo.Create(user); err != nil {
+		_ = h.auditRepo.LogAction(
+			adminID,
+			"create_user",
+			"user",
+			c.RealIP(),
+			c.Request().Header.Get("User-Agent"),
+			false,
+			fmt.Sprintf("Failed to import user %s: %v", user.Username, err),
+		)
+		return err
+	}
+
+	_ = h.auditRepo.LogAction(
+		adminID,
+		"create_user",
+		"user",
+		c.RealIP(),
+		c.Request().Header.Get("User-Agent"),
+		true,
+		fmt.Sprintf("Imported user: %s (ID: %d, Role: %s)", user.Username, user.ID, user.Role),
+	)
+
+	sendVerificationEmail(h.notifier, &h.config.Security, user, c.RealIP())
+
+	result.Status = importStatusCreated
+	result.UserID = user.ID
+	result.TemporaryPassword = password
+	return nil
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"Monex/internal/models"
+)
+
+func TestImportUsersCreatesAndReportsDuplicates(t *testing.T) {
+	env := newTestEnv(t)
+	env.cfg.Security.BcryptCost = 4
+	env.createUser(t, "alice", "Str0ng!Passw0rd", models.RoleUser)
+
+	h := NewUserHandler(env.users, env.audit, env.sessions, env.blacklist, env.passwordHistory, nil, env.cfg)
+	e := newEcho()
+	e.POST("/users/import", h.ImportUsers, withUser(env.admin(t)))
+
+	csv := "username,email,role,active\n" +
+		"bob,bob@example.com,user,true\n" +
+		"carol,Carol@Example.com,admin,false\n" +
+		"ALICE,alice2@example.com,user,true\n" +
+		"Bob,bob2@example.com,user,true\n" +
+		"dave,carol@example.com,user,true\n" +
+		"erin,alice@example.com,user,true\n"
+	rec := doJSON(e, http.MethodPost, "/users/import", csv, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store for one-time passwords", cc)
+	}
+	var resp UserImportResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if resp.Created != 2 || resp.Failed != 4 || len(resp.Results) != 6 {
+		t.Fatalf("created %d, failed %d of %d rows; want 2 and 4 of 6", resp.Created, resp.Failed, len(resp.Results))
+	}
+
+	wantCodes := []string{"", "", "duplicate_username", "duplicate_username", "duplicate_email", "duplicate_email"}
+	for i, result := range resp.Results {
+		if result.Row != i+2 || result.Code != wantCodes[i] {
+			t.Errorf("row %d (%s): code %q, want row %d with %q", result.Row, result.Username, result.Code, i+2, wantCodes[i])
+		}
+	}
+
+	// Created users sign in with their temporary password and must change it
+	for _, result := range resp.Results[:2] {
+		user, err := env.users.GetByUsername(result.Username)
+		if err != nil {
+			t.Fatalf("imported %s not stored: %v", result.Username, err)
+		}
+		if user.ID != result.UserID || user.Role != result.Role || user.Active != result.Active {
+			t.Errorf("%s stored as id %d %s active=%t, reported %d %s active=%t",
+				result.Username, user.ID, user.Role, user.Active, result.UserID, result.Role, result.Active)
+		}
+		if !user.PasswordChangeRequired || !user.CheckPassword(result.TemporaryPassword) {
+			t.Errorf("%s: password change required %t, temporary password valid %t; want both",
+				result.Username, user.PasswordChangeRequired, user.CheckPassword(result.TemporaryPassword))
+		}
+	}
+	if carol, _ := env.users.GetByUsername("carol"); carol == nil || carol.Email != "carol@example.com" {
+		t.Errorf("carol's email not normalized: %+v", carol)
+	}
+}
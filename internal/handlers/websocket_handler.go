@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"Monex/internal/middleware"
+	"Monex/internal/repository"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = (wsPongWait * 9) / 10
+)
+
+// wsControlFrame is a message from the client. The only one understood is
+// {"type": "reauth", "token": "<access token>"}, which moves the connection
+// onto a refreshed token.
+type wsControlFrame struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+// WebSocketHandler delivers the same notification stream as SSE over a
+// WebSocket, for clients behind proxies that buffer text/event-stream
+type WebSocketHandler struct {
+	hub         *NotificationHub
+	upgrader    websocket.Upgrader
+	revalidator *streamRevalidator
+}
+
+// NewWebSocketHandler accepts upgrades from the server's own origin and from
+// allowedOrigins, the same list the CORS middleware uses
+func NewWebSocketHandler(
+	hub *NotificationHub,
+	allowedOrigins []string,
+	jwtManager *middleware.JWTManager,
+	sessionRepo *repository.SessionRepository,
+	recheckInterval time.Duration,
+) *WebSocketHandler {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[strings.ToLower(origin)] = true
+	}
+
+	return &WebSocketHandler{
+		hub:         hub,
+		revalidator: &streamRevalidator{hub: hub, jwtManager: jwtManager, sessionRepo: sessionRepo, interval: recheckInterval},
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				if origin == "" || allowed["*"] || allowed[strings.ToLower(origin)] {
+					return true
+				}
+				u, err := url.Parse(origin)
+				return err == nil && strings.EqualFold(u.Host, r.Host)
+			},
+		},
+	}
+}
+
+// HandleWebSocket manages WebSocket notification connections
+func (h *WebSocketHandler) HandleWebSocket(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		slog.Warn("WebSocket upgrade failed", "user_id", userID, "error", err)
+		return nil
+	}
+	defer conn.Close()
+
+	eventChan := h.hub.Subscribe(userID)
+	defer h.hub.Unsubscribe(userID, eventChan)
+
+	stream := h.revalidator.open(c, userID)
+	defer h.hub.closeStream(stream)
+
+	// Reader: handles pongs, reauth frames and detects client close. Only the
+	// loop below writes, so reauth results are handed over to it.
+	closed := make(chan struct{})
+	reauthed := make(chan error, 1)
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(4096)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		for {
+			var frame wsControlFrame
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if json.Unmarshal(data, &frame) != nil || frame.Type != "reauth" {
+				continue
+			}
+			err = h.revalidator.reauthorize(stream.id, userID, frame.Token)
+			select {
+			case reauthed <- err:
+			default:
+			}
+		}
+	}()
+
+	if err := h.writeEvent(conn, NotificationEvent{
+		Type:      "connected",
+		Message:   "اتصال برقرار شد",
+		Severity:  "info",
+		Data:      map[string]interface{}{"stream_id": stream.id},
+		Timestamp: time.Now().UTC(),
+	}); err != nil {
+		return nil
+	}
+
+	// ✅ Replay missed events, same as SSE's Last-Event-ID
+	var lastSentID int64
+	if lastEventID := parseLastEventID(c); lastEventID > 0 {
+		lastSentID = lastEventID
+		for _, event := range h.hub.Replay(userID, lastEventID) {
+			if err := h.writeEvent(conn, event); err != nil {
+				return nil
+			}
+			lastSentID = event.ID
+		}
+	}
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	// ✅ Close the connection once its token is revoked or its session deleted
+	recheck := time.NewTicker(h.revalidator.interval)
+	defer recheck.Stop()
+
+	for {
+		select {
+		case <-closed:
+			slog.Debug("WebSocket client disconnected", "user_id", userID)
+			return nil
+
+		case <-h.hub.Done():
+			_ = h.writeEvent(conn, shutdownEvent())
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown"),
+				time.Now().Add(wsWriteWait))
+			return nil
+
+		case event, ok := <-eventChan:
+			if !ok {
+				slog.Debug("WebSocket connection dropped by hub", "user_id", userID)
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer"),
+					time.Now().Add(wsWriteWait))
+				return nil
+			}
+			if event.ID > 0 && event.ID <= lastSentID {
+				continue
+			}
+			if err := h.writeEvent(conn, event); err != nil {
+				slog.Debug("WebSocket write failed", "user_id", userID, "error", err)
+				return nil
+			}
+
+		case err := <-reauthed:
+			if err != nil {
+				slog.Info("WebSocket reauth rejected", "user_id", userID, "error", err)
+			}
+			if err := h.writeEvent(conn, reauthEvent(err)); err != nil {
+				return nil
+			}
+
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return nil
+			}
+
+		case <-recheck.C:
+			if err := h.revalidator.recheck(stream); err != nil {
+				slog.Info("Closing WebSocket", "user_id", userID, "reason", err)
+				_ = h.writeEvent(conn, closeEvent(err))
+				reason := "session revoked"
+				if errors.Is(err, errStreamTokenExpired) {
+					reason = "token expired"
+				}
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason),
+					time.Now().Add(wsWriteWait))
+				return nil
+			}
+		}
+	}
+}
+
+// writeEvent writes a notification as a JSON text frame
+func (h *WebSocketHandler) writeEvent(conn *websocket.Conn, event NotificationEvent) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(event)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketDeliversSecurityWarning(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "streamer", "Str0ng!Passw0rd", models.RoleUser)
+	token, err := env.jwt.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+
+	// SendSecurityWarning goes through the global hub
+	handler := NewWebSocketHandler(GlobalNotificationHub, nil, env.jwt, env.sessions, time.Minute)
+	e := newEcho()
+	e.GET("/ws", handler.HandleWebSocket, withUser(user))
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + url.QueryEscape(token)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var connected NotificationEvent
+	if err := conn.ReadJSON(&connected); err != nil || connected.Type != "connected" {
+		t.Fatalf("first frame = %+v (%v), want connected", connected, err)
+	}
+
+	SendSecurityWarning(user.ID, "new login", "warning", map[string]interface{}{"ip": "203.0.113.7"})
+
+	var warning NotificationEvent
+	if err := conn.ReadJSON(&warning); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	if warning.Type != "security_warning" || warning.Message != "new login" || warning.Severity != "warning" || warning.Data["ip"] != "203.0.113.7" {
+		t.Fatalf("frame = %+v, want the security warning", warning)
+	}
+}
@@ -0,0 +1,49 @@
+// Package instancelock guarantees that only one Monex process uses a data
+// directory at a time. The lock is held by the operating system, so it is
+// released even if the process crashes.
+package instancelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ErrLocked is returned when another process holds the lock
+var ErrLocked = errors.New("another instance holds the lock")
+
+// Lock is an acquired instance lock
+type Lock struct {
+	file *os.File
+	path string
+}
+
+// Acquire takes the lock at path without blocking. It returns ErrLocked if
+// another process already holds it.
+func Acquire(path string) (*Lock, error) {
+	file, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The PID is informational only; the OS lock is what counts
+	_ = file.Truncate(0)
+	_, _ = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+
+	return &Lock{file: file, path: path}, nil
+}
+
+// Release unlocks the lock file. The file itself is left in place: removing
+// it could let two processes lock different files under the same name.
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	if err := unlockFile(l.file); err != nil {
+		return fmt.Errorf("failed to unlock %s: %w", l.path, err)
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
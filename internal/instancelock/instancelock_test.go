@@ -0,0 +1,36 @@
+//go:build linux || darwin || windows
+
+// Other Unix systems may emulate flock with fcntl locks, which don't
+// conflict within one process
+
+package instancelock
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecondAcquireIsLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monex.lock")
+
+	first, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("first Acquire: %v", err)
+	}
+	if _, err := Acquire(path); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Acquire = %v, want ErrLocked", err)
+	}
+
+	// Releasing lets the next instance in
+	if err := first.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	second, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+	if err := second.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build windows
+
+package instancelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is returned when another handle has the file open
+const errorSharingViolation syscall.Errno = 32
+
+// lockFile opens path with no sharing allowed, so a second process can't
+// open it until the first handle is closed
+func lockFile(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := syscall.CreateFile(name,
+		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+		0, // no sharing
+		nil,
+		syscall.OPEN_ALWAYS,
+		syscall.FILE_ATTRIBUTE_NORMAL,
+		0,
+	)
+	if err != nil {
+		if errors.Is(err, errorSharingViolation) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return os.NewFile(uintptr(handle), path), nil
+}
+
+// unlockFile is a no-op; closing the handle releases the lock
+func unlockFile(file *os.File) error {
+	return nil
+}
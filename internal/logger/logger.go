@@ -0,0 +1,128 @@
+// Package logger configures structured logging (log/slog) for the application.
+// Code that still uses the stdlib log package is bridged into the same handler,
+// with "[ERROR]"/"[WARN]"/"[DEBUG]"/"[SECURITY]" prefixes mapped to levels.
+package logger
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// Setup installs a JSON or text slog handler writing to w as the default logger
+// and routes the stdlib log package through it. format is "json" or "text";
+// level is "debug", "info", "warn" or "error".
+func Setup(w io.Writer, format, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(level)}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+
+	logger := slog.New(&contextHandler{Handler: handler})
+	slog.SetDefault(logger)
+
+	// slog.SetDefault already redirects log.Print*, but only at INFO; the
+	// bridge keeps the level carried by legacy message prefixes
+	log.SetFlags(0)
+	log.SetOutput(&bridge{logger: logger})
+
+	return logger
+}
+
+// ParseLevel converts a LOG_LEVEL value to a slog level (default info)
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Security logs a security-relevant event at WARN with category=security
+func Security(msg string, args ...any) {
+	slog.Warn(msg, append([]any{"category", "security"}, args...)...)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose log records carry the request id
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request id stored in ctx, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds request_id to records logged with a request context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// legacyPrefixes maps stdlib log prefixes to slog levels and categories
+var legacyPrefixes = []struct {
+	prefix   string
+	level    slog.Level
+	category string
+}{
+	{"[CRITICAL]", slog.LevelError, ""},
+	{"[ERROR]", slog.LevelError, ""},
+	{"[WARN]", slog.LevelWarn, ""},
+	{"[SECURITY]", slog.LevelWarn, "security"},
+	{"[DEBUG]", slog.LevelDebug, ""},
+	{"[INFO]", slog.LevelInfo, ""},
+	{"[OK]", slog.LevelInfo, ""},
+}
+
+// bridge adapts stdlib log output to slog records
+type bridge struct {
+	logger *slog.Logger
+}
+
+func (b *bridge) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	level := slog.LevelInfo
+	var attrs []any
+
+	for _, lp := range legacyPrefixes {
+		if strings.HasPrefix(msg, lp.prefix) {
+			level = lp.level
+			msg = strings.TrimSpace(strings.TrimPrefix(msg, lp.prefix))
+			if lp.category != "" {
+				attrs = append(attrs, "category", lp.category)
+			}
+			break
+		}
+	}
+
+	b.logger.Log(context.Background(), level, msg, attrs...)
+	return len(p), nil
+}
@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestSetupJSONEmitsParseableRecords(t *testing.T) {
+	previous, flags := slog.Default(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		log.SetFlags(flags)
+		log.SetOutput(os.Stderr)
+	})
+
+	var out bytes.Buffer
+	Setup(&out, "json", "info")
+	slog.Info("Login", "user_id", 7)
+	Security("Login blocked", "ip", "203.0.113.7")
+	log.Printf("[WARN] legacy message")
+	slog.Debug("below the level")
+
+	var records []map[string]any
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+
+	want := []struct{ level, msg string }{
+		{"INFO", "Login"},
+		{"WARN", "Login blocked"},
+		{"WARN", "legacy message"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("%d records, want %d: %s", len(records), len(want), out.String())
+	}
+	for i, w := range want {
+		if records[i]["level"] != w.level || records[i]["msg"] != w.msg {
+			t.Errorf("record %d = %v, want level %s msg %q", i, records[i], w.level, w.msg)
+		}
+	}
+	if records[0]["user_id"] != float64(7) {
+		t.Errorf("user_id = %v, want 7", records[0]["user_id"])
+	}
+	if records[1]["category"] != "security" {
+		t.Errorf("security record category = %v, want security", records[1]["category"])
+	}
+}
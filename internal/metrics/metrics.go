@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds all Monex metrics (kept separate from the global default registry)
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "monex_http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "monex_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	loginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "monex_login_attempts_total",
+		Help: "Login attempts by result (success, failure).",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		loginAttempts,
+	)
+}
+
+// RegisterDB exposes connection pool stats from db.Stats()
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, "monex"))
+}
+
+// RegisterActiveSessions exposes the number of active sessions, read on every scrape
+func RegisterActiveSessions(count func() (int, error)) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "monex_active_sessions",
+		Help: "Number of unexpired user sessions.",
+	}, func() float64 {
+		n, err := count()
+		if err != nil {
+			slog.Warn("Failed to count active sessions for metrics", "error", err)
+			return 0
+		}
+		return float64(n)
+	}))
+}
+
+// RegisterSlowQueries exposes the number of statements that exceeded the
+// slow-query threshold, read on every scrape
+func RegisterSlowQueries(count func() uint64) {
+	Registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "monex_db_slow_queries_total",
+		Help: "Database statements slower than SLOW_QUERY_MS.",
+	}, func() float64 {
+		return float64(count())
+	}))
+}
+
+// RecordLogin counts a login attempt
+func RecordLogin(success bool) {
+	if success {
+		loginAttempts.WithLabelValues("success").Inc()
+	} else {
+		loginAttempts.WithLabelValues("failure").Inc()
+	}
+}
+
+// Middleware records request count and duration per route template
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				} else if !c.Response().Committed {
+					status = http.StatusInternalServerError
+				}
+			}
+
+			// Use the route template (e.g. /api/transactions/:id) to keep label cardinality bounded
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			httpRequests.WithLabelValues(c.Request().Method, route, strconv.Itoa(status)).Inc()
+			httpDuration.WithLabelValues(c.Request().Method, route).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// Handler serves the metrics page
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestMetricsExposeRequestCount(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/api/transactions/:id", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/transactions/42", nil))
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	page := string(body)
+
+	// Labelled by route template, not the concrete path
+	want := `monex_http_requests_total{method="GET",route="/api/transactions/:id",status="204"} 1`
+	if !strings.Contains(page, want) {
+		t.Fatalf("metrics page lacks %s:\n%s", want, page)
+	}
+	if !strings.Contains(page, "monex_http_request_duration_seconds_count") {
+		t.Fatal("metrics page lacks the request duration histogram")
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -14,14 +14,32 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// DefaultRedactFields are always redacted from logged request bodies. A key
+// is redacted when it contains one of these, case-insensitively, so
+// "refresh_token" and "new_password" are covered too.
+var DefaultRedactFields = []string{"password", "token", "secret", "authorization", "api_key"}
+
+// maxLoggedBodySize caps the sanitized body stored in the audit log
+const maxLoggedBodySize = 1000
+
 // ✅ COMPREHENSIVE AUDIT LOGGING MIDDLEWARE
 type AuditLoggerMiddleware struct {
-	auditRepo *repository.AuditRepository
+	auditRepo    *repository.AuditRepository
+	redactFields []string
 }
 
-func NewAuditLoggerMiddleware(auditRepo *repository.AuditRepository) *AuditLoggerMiddleware {
+// NewAuditLoggerMiddleware redacts DefaultRedactFields plus extraRedactFields
+func NewAuditLoggerMiddleware(auditRepo *repository.AuditRepository, extraRedactFields []string) *AuditLoggerMiddleware {
+	fields := append([]string{}, DefaultRedactFields...)
+	for _, field := range extraRedactFields {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			fields = append(fields, field)
+		}
+	}
+
 	return &AuditLoggerMiddleware{
-		auditRepo: auditRepo,
+		auditRepo:    auditRepo,
+		redactFields: fields,
 	}
 }
 
@@ -35,6 +53,7 @@ type RequestInfo struct {
 	Duration    time.Duration
 	StatusCode  int
 	Error       string
+	RequestID   string
 }
 
 // Middleware function
@@ -75,6 +94,7 @@ func (m *AuditLoggerMiddleware) Middleware() echo.MiddlewareFunc {
 				UserID:      userID,
 				Duration:    time.Since(start),
 				StatusCode:  c.Response().Status,
+				RequestID:   GetRequestID(c),
 			}
 
 			if err != nil {
@@ -113,27 +133,62 @@ func (m *AuditLoggerMiddleware) sanitizeRequestBody(body string) string {
 		return ""
 	}
 
-	// Limit body size
-	if len(body) > 1000 {
-		body = body[:1000] + "... (truncated)"
+	// Only JSON can be redacted reliably; anything else may hold secrets in
+	// an unknown layout, so it isn't logged at all
+	var data interface{}
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		return fmt.Sprintf("(non-JSON body, %d bytes)", len(body))
 	}
 
-	// Parse JSON and remove sensitive fields
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(body), &data); err == nil {
-		sensitiveFields := []string{"password", "old_password", "new_password", "token", "secret"}
+	sanitized, _ := json.Marshal(m.redact(data))
 
-		for _, field := range sensitiveFields {
-			if _, exists := data[field]; exists {
-				data[field] = "***REDACTED***"
+	// Truncate only after redacting so a cut can't expose a secret
+	if len(sanitized) > maxLoggedBodySize {
+		return string(sanitized[:maxLoggedBodySize]) + "... (truncated)"
+	}
+	return string(sanitized)
+}
+
+// redact replaces sensitive values at any depth of a decoded JSON value
+func (m *AuditLoggerMiddleware) redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if m.isSensitive(key) {
+				v[key] = "***REDACTED***"
+			} else {
+				v[key] = m.redact(item)
 			}
 		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = m.redact(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
 
-		sanitized, _ := json.Marshal(data)
-		return string(sanitized)
+func (m *AuditLoggerMiddleware) isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range m.redactFields {
+		if strings.Contains(key, field) {
+			return true
+		}
 	}
+	return false
+}
 
-	return body
+// RedactHeader returns value, or a placeholder when the header carries
+// credentials (Authorization, X-Refresh-Token, ...). Use it if headers are
+// ever added to audit details.
+func (m *AuditLoggerMiddleware) RedactHeader(name, value string) string {
+	if m.isSensitive(name) {
+		return "***REDACTED***"
+	}
+	return value
 }
 
 // ✅ Log request to database
@@ -143,8 +198,8 @@ func (m *AuditLoggerMiddleware) logRequest(info *RequestInfo) {
 	success := info.StatusCode < 400
 
 	details := fmt.Sprintf(
-		"Method: %s, Path: %s, Status: %d, Duration: %v",
-		info.Method, info.Path, info.StatusCode, info.Duration,
+		"RequestID: %s, Method: %s, Path: %s, Status: %d, Duration: %v",
+		info.RequestID, info.Method, info.Path, info.StatusCode, info.Duration,
 	)
 
 	if info.RequestBody != "" {
@@ -183,7 +238,7 @@ func (m *AuditLoggerMiddleware) logRequest(info *RequestInfo) {
 		}
 
 		if err != nil {
-			log.Printf("[Audit] Failed to log: %v", err)
+			slog.Error("Failed to write audit log", "request_id", info.RequestID, "action", action, "error", err)
 		}
 	}()
 }
@@ -209,9 +264,18 @@ func (m *AuditLoggerMiddleware) determineAction(info *RequestInfo) string {
 
 	// Transactions
 	if strings.Contains(path, "/transactions") {
+		if strings.HasSuffix(path, "/delete-all/preview") {
+			return "view_transactions"
+		}
 		if strings.Contains(path, "/delete-all") {
 			return "delete_all_transactions"
 		}
+		if strings.HasSuffix(path, "/undo") {
+			return "undo_transaction"
+		}
+		if strings.HasSuffix(path, "/batch-get") {
+			return "view_transactions"
+		}
 		switch method {
 		case "POST":
 			return "create_transaction"
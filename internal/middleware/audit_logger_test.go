@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeRequestBodyRedactsNestedFields(t *testing.T) {
+	m := NewAuditLoggerMiddleware(nil, []string{" SSN "})
+
+	body := `{
+		"username": "alice",
+		"new_password": "hunter2",
+		"profile": {"Refresh_Token": "abc", "ssn": "123-45-6789", "city": "Tabriz"},
+		"devices": [{"name": "phone", "api_key": "k1"}, {"name": "laptop", "secrets": ["s1"]}],
+		"tags": ["plain", "values"]
+	}`
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(m.sanitizeRequestBody(body)), &got); err != nil {
+		t.Fatalf("sanitized body is not JSON: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"username":     "alice",
+		"new_password": "***REDACTED***",
+		"profile":      map[string]interface{}{"Refresh_Token": "***REDACTED***", "ssn": "***REDACTED***", "city": "Tabriz"},
+		"devices": []interface{}{
+			map[string]interface{}{"name": "phone", "api_key": "***REDACTED***"},
+			map[string]interface{}{"name": "laptop", "secrets": "***REDACTED***"},
+		},
+		"tags": []interface{}{"plain", "values"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sanitized body = %v\nwant %v", got, want)
+	}
+
+	if got := m.sanitizeRequestBody("password=hunter2"); got != "(non-JSON body, 16 bytes)" {
+		t.Fatalf("non-JSON body logged as %q", got)
+	}
+}
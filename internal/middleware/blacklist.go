@@ -1,11 +1,13 @@
 package middleware
 
 import (
+	"context"
 	"sync"
 	"time"
 )
 
-// TokenBlacklist manages blacklisted JWT tokens
+// TokenBlacklist manages blacklisted JWT tokens, keyed by jti or, for tokens
+// without one, by the raw token
 type TokenBlacklist struct {
 	mu     sync.RWMutex
 	tokens map[string]time.Time
@@ -23,6 +25,20 @@ func (tb *TokenBlacklist) Add(token string, expiry time.Time) {
 	tb.tokens[token] = expiry
 }
 
+// AddClaims blacklists a parsed token under its jti, so that removing its
+// database entry can find it again. Tokens without a jti are keyed by the
+// raw token.
+func (tb *TokenBlacklist) AddClaims(token string, claims *Claims) {
+	if claims == nil || claims.ExpiresAt == nil {
+		return
+	}
+	key := claims.ID
+	if key == "" {
+		key = token
+	}
+	tb.Add(key, claims.ExpiresAt.Time)
+}
+
 // Contains checks if a token is blacklisted
 func (tb *TokenBlacklist) Contains(token string) bool {
 	tb.mu.RLock()
@@ -49,6 +65,21 @@ func (tb *TokenBlacklist) Remove(token string) {
 	delete(tb.tokens, token)
 }
 
+// Len returns how many unexpired tokens are held in memory
+func (tb *TokenBlacklist) Len() int {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+
+	now := time.Now()
+	count := 0
+	for _, expiry := range tb.tokens {
+		if !now.After(expiry) {
+			count++
+		}
+	}
+	return count
+}
+
 // Cleanup removes expired tokens (should be called periodically)
 func (tb *TokenBlacklist) Cleanup() {
 	tb.mu.Lock()
@@ -63,11 +94,18 @@ func (tb *TokenBlacklist) Cleanup() {
 }
 
 // StartCleanupRoutine starts a goroutine to periodically clean expired tokens
-func (tb *TokenBlacklist) StartCleanupRoutine(interval time.Duration) {
+// until ctx is cancelled
+func (tb *TokenBlacklist) StartCleanupRoutine(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	go func() {
-		for range ticker.C {
-			tb.Cleanup()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				tb.Cleanup()
+			}
 		}
 	}()
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitForGoroutines fails the test unless the goroutine count drops to at
+// most n within a second
+func waitForGoroutines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines still running, want at most %d", runtime.NumGoroutine(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCleanupRoutinesStopOnCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	blacklist := &TokenBlacklist{tokens: make(map[string]time.Time)}
+	blacklist.Add("expired", time.Now().Add(-time.Minute))
+	blacklist.StartCleanupRoutine(ctx, 5*time.Millisecond)
+	NewEndpointRateLimiter(1, time.Hour).StartCleanupRoutine(ctx, 5*time.Millisecond)
+
+	if runtime.NumGoroutine() < before+2 {
+		t.Fatal("cleanup routines not started")
+	}
+	// The routines do their work while running
+	deadline := time.Now().Add(time.Second)
+	for {
+		blacklist.mu.RLock()
+		remaining := len(blacklist.tokens)
+		blacklist.mu.RUnlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("blacklist cleanup never ran")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	waitForGoroutines(t, before)
+}
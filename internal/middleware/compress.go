@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+)
+
+// uncompressedPaths are never gzipped: notification streams must flush each
+// event as it is written, and backups are already-compressed archives
+var uncompressedPaths = []string{
+	"/api/notifications/stream",
+	"/api/notifications/ws",
+	"/api/backup",
+}
+
+// CompressionMiddleware gzips responses of at least minLength bytes at the
+// given level (-1 is the gzip default). Level 0 disables compression.
+func CompressionMiddleware(level, minLength int) echo.MiddlewareFunc {
+	if level == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+
+	return echomiddleware.GzipWithConfig(echomiddleware.GzipConfig{
+		Level:     level,
+		MinLength: minLength,
+		Skipper:   skipCompression,
+	})
+}
+
+func skipCompression(c echo.Context) bool {
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream") {
+		return true
+	}
+	path := c.Request().URL.Path
+	for _, prefix := range uncompressedPaths {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
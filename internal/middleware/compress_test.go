@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestCompressionSkipsStreams(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("x", 4096) + `"}`
+	newServer := func(level int) *echo.Echo {
+		e := echo.New()
+		e.Use(CompressionMiddleware(level, 1024))
+		e.GET("/api/transactions", func(c echo.Context) error { return c.JSONBlob(http.StatusOK, []byte(large)) })
+		e.GET("/api/small", func(c echo.Context) error { return c.JSONBlob(http.StatusOK, []byte(`{"ok":true}`)) })
+		e.GET("/api/notifications/stream", func(c echo.Context) error {
+			c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+			return c.String(http.StatusOK, "data: "+large+"\n\n")
+		})
+		return e
+	}
+	encoding := func(e *echo.Echo, path, accept string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Header().Get(echo.HeaderContentEncoding)
+	}
+
+	e := newServer(-1)
+	if got := encoding(e, "/api/transactions", ""); got != "gzip" {
+		t.Errorf("large JSON response: Content-Encoding %q, want gzip", got)
+	}
+	if got := encoding(e, "/api/small", ""); got != "" {
+		t.Errorf("response under the minimum length: Content-Encoding %q, want none", got)
+	}
+	if got := encoding(e, "/api/notifications/stream", "text/event-stream"); got != "" {
+		t.Errorf("SSE stream: Content-Encoding %q, want none", got)
+	}
+	if got := encoding(e, "/api/notifications/stream", ""); got != "" {
+		t.Errorf("SSE route without an Accept header: Content-Encoding %q, want none", got)
+	}
+
+	if got := encoding(newServer(0), "/api/transactions", ""); got != "" {
+		t.Errorf("GZIP_LEVEL=0: Content-Encoding %q, want none", got)
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DeviceIDCookie is the httpOnly cookie that carries the device_id set at login
+const DeviceIDCookie = "monex_device_id"
+
+// deviceIDCookieMaxAge keeps the device recognizable across logins
+const deviceIDCookieMaxAge = 365 * 24 * time.Hour
+
+// DeviceID returns the caller's device_id from the cookie, falling back to
+// the X-Device-ID header. Query parameters are deliberately ignored: URLs end
+// up in access logs, proxies and browser history.
+func DeviceID(c echo.Context) string {
+	if cookie, err := c.Cookie(DeviceIDCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	return c.Request().Header.Get("X-Device-ID")
+}
+
+// SetDeviceIDCookie stores deviceID in a Secure (when served over TLS),
+// httpOnly, SameSite=Strict cookie scoped to the API
+func SetDeviceIDCookie(c echo.Context, deviceID string, secure bool) {
+	c.SetCookie(&http.Cookie{
+		Name:     DeviceIDCookie,
+		Value:    deviceID,
+		Path:     "/api",
+		MaxAge:   int(deviceIDCookieMaxAge.Seconds()),
+		Secure:   secure || c.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ClearDeviceIDCookie expires the device_id cookie
+func ClearDeviceIDCookie(c echo.Context, secure bool) {
+	c.SetCookie(&http.Cookie{
+		Name:     DeviceIDCookie,
+		Value:    "",
+		Path:     "/api",
+		MaxAge:   -1,
+		Secure:   secure || c.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequireVerifiedEmail blocks users whose email is unverified from the routes
+// it guards. Such users can still log in and read their data. When enabled is
+// false every request passes.
+func RequireVerifiedEmail(userRepo *repository.UserRepository, enabled bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if !enabled {
+			return next
+		}
+
+		return func(c echo.Context) error {
+			userID, err := GetUserID(c)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+			}
+
+			user, err := userRepo.GetByID(userID)
+			if errors.Is(err, repository.ErrNotFound) {
+				return echo.NewHTTPError(http.StatusUnauthorized, "کاربر یافت نشد")
+			}
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت کاربر").SetInternal(err)
+			}
+
+			if !user.EmailVerified {
+				return echo.NewHTTPError(http.StatusForbidden, map[string]interface{}{
+					"message": "برای انجام این عملیات ابتدا ایمیل خود را تایید کنید",
+					"code":    "email_not_verified",
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"Monex/internal/logger"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ParseCIDRList parses allowlist entries; a bare IP is treated as a single-host range
+func ParseCIDRList(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address: %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ipAllowed reports whether ip falls inside any of the networks
+func ipAllowed(ip string, networks []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminIPAllowlistMiddleware rejects requests from outside the allowed
+// networks with 403. It must run before RequireRole so that out-of-range
+// clients learn nothing about the route. With no networks configured every
+// request passes, preserving the default open behavior.
+func AdminIPAllowlistMiddleware(networks []*net.IPNet, auditRepo *repository.AuditRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if len(networks) == 0 {
+			return next
+		}
+
+		return func(c echo.Context) error {
+			clientIP := c.RealIP()
+			if ipAllowed(clientIP, networks) {
+				return next(c)
+			}
+
+			userID, _ := c.Get("user_id").(int)
+			path := c.Request().URL.Path
+			logger.Security("Admin request denied by IP allowlist", "ip", clientIP, "user_id", userID, "path", path)
+
+			if auditRepo != nil {
+				auditRepo.LogActionWithSeverity(userID, "admin_ip_denied", "admin", clientIP,
+					c.Request().Header.Get("User-Agent"), false,
+					fmt.Sprintf("Admin request to %s %s from non-allowlisted IP", c.Request().Method, path),
+					"critical")
+			}
+
+			return echo.NewHTTPError(http.StatusForbidden, "دسترسی از این آدرس IP مجاز نیست")
+		}
+	}
+}
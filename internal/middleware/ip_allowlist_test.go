@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAdminIPAllowlist(t *testing.T) {
+	networks, err := ParseCIDRList([]string{"203.0.113.0/24", "198.51.100.9", "2001:db8:10::/48", " ::1 "})
+	if err != nil {
+		t.Fatalf("ParseCIDRList: %v", err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.GET("/admin", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) },
+		AdminIPAllowlistMiddleware(networks, nil))
+
+	tests := []struct {
+		name string
+		ip   string
+		want int
+	}{
+		{"inside an IPv4 range", "203.0.113.200", http.StatusNoContent},
+		{"single IPv4 host", "198.51.100.9", http.StatusNoContent},
+		{"next to the single IPv4 host", "198.51.100.10", http.StatusForbidden},
+		{"outside every range", "192.0.2.1", http.StatusForbidden},
+		{"inside the IPv6 range", "2001:db8:10:ffff::1", http.StatusNoContent},
+		{"outside the IPv6 range", "2001:db8:11::1", http.StatusForbidden},
+		{"single IPv6 host", "::1", http.StatusNoContent},
+		{"IPv4-mapped IPv6 address", "::ffff:203.0.113.5", http.StatusNoContent},
+		{"unparseable address", "not-an-ip", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set(echo.HeaderXRealIP, tt.ip)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s (%s): status %d, want %d", tt.name, tt.ip, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestAdminIPAllowlistUnset(t *testing.T) {
+	e := echo.New()
+	e.GET("/admin", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) },
+		AdminIPAllowlistMiddleware(nil, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set(echo.HeaderXRealIP, "192.0.2.1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("no allowlist configured: status %d, want 204", rec.Code)
+	}
+}
+
+func TestParseCIDRListRejectsInvalidEntries(t *testing.T) {
+	for _, entry := range []string{"203.0.113.0/33", "2001:db8::/129", "example.com"} {
+		if _, err := ParseCIDRList([]string{entry}); err == nil {
+			t.Errorf("ParseCIDRList(%q) succeeded", entry)
+		}
+	}
+}
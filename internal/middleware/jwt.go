@@ -1,10 +1,16 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"Monex/config"
@@ -15,16 +21,31 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// Token types, so an access token can't be used as a refresh token or the
+// other way round
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// ErrWrongTokenType is returned for a valid token of the other type
+var ErrWrongTokenType = errors.New("wrong token type")
+
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	TokenType string `json:"token_type"`
 	jwt.RegisteredClaims
 }
 
 type JWTManager struct {
 	config        *config.JWTConfig
 	blacklistRepo *repository.TokenBlacklistRepository
+	signingMethod jwt.SigningMethod
+	privateKey    *rsa.PrivateKey
+	publicKey     *rsa.PublicKey
+	notBefore     atomic.Int64 // unix seconds; tokens issued before are revoked (0 = unset)
 }
 
 func (jm *JWTManager) ParseToken(token string) (any, any) {
@@ -34,11 +55,97 @@ func (jm *JWTManager) ParseToken(token string) (any, any) {
 func NewJWTManager(
 	cfg *config.JWTConfig,
 	blacklistRepo *repository.TokenBlacklistRepository,
-) *JWTManager {
-	return &JWTManager{
+) (*JWTManager, error) {
+	jm := &JWTManager{
 		config:        cfg,
 		blacklistRepo: blacklistRepo,
+		signingMethod: jwt.SigningMethodHS256,
 	}
+
+	// ✅ Switch to RS256 when key files are configured
+	if cfg.PrivateKeyFile != "" || cfg.PublicKeyFile != "" {
+		if err := jm.loadRSAKeys(); err != nil {
+			return nil, fmt.Errorf("failed to load JWT RSA keys: %w", err)
+		}
+		jm.signingMethod = jwt.SigningMethodRS256
+		slog.Info("JWT signing configured with RS256 key files")
+	}
+
+	return jm, nil
+}
+
+// loadRSAKeys reads the PEM key files; the public key is derived from the
+// private key when only the latter is configured. A public key alone can't
+// sign the tokens this server issues, so it is refused.
+func (jm *JWTManager) loadRSAKeys() error {
+	if jm.config.PrivateKeyFile == "" {
+		return fmt.Errorf("JWT_PUBLIC_KEY_FILE is set without JWT_PRIVATE_KEY_FILE; tokens can't be signed")
+	}
+
+	data, err := os.ReadFile(jm.config.PrivateKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read private key: %w", err)
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse private key: %w", err)
+	}
+	jm.privateKey = privateKey
+	jm.publicKey = &privateKey.PublicKey
+
+	if jm.config.PublicKeyFile != "" {
+		data, err := os.ReadFile(jm.config.PublicKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read public key: %w", err)
+		}
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse public key: %w", err)
+		}
+		jm.publicKey = publicKey
+	}
+
+	return nil
+}
+
+// signClaims signs the claims with the configured algorithm
+func (jm *JWTManager) signClaims(claims *Claims) (string, error) {
+	token := jwt.NewWithClaims(jm.signingMethod, claims)
+
+	if jm.signingMethod == jwt.SigningMethodRS256 {
+		if jm.privateKey == nil {
+			return "", fmt.Errorf("no private key configured for signing")
+		}
+		return token.SignedString(jm.privateKey)
+	}
+
+	return token.SignedString([]byte(jm.config.Secret))
+}
+
+// verificationKey returns the key for the token's algorithm, rejecting any
+// algorithm other than the one this manager is configured for
+func (jm *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != jm.signingMethod.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		return jm.publicKey, nil
+	case *jwt.SigningMethodHMAC:
+		return []byte(jm.config.Secret), nil
+	default:
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+}
+
+// previousSecretKey verifies HS256 tokens with the secret before the last
+// rotation
+func (jm *JWTManager) previousSecretKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return []byte(jm.config.PreviousSecret), nil
 }
 
 // Config returns the JWT configuration
@@ -46,78 +153,209 @@ func (jm *JWTManager) Config() *config.JWTConfig {
 	return jm.config
 }
 
+// AccessDurationFor returns the access token lifetime for role. Admins get
+// AdminAccessDuration when it is set.
+func (jm *JWTManager) AccessDurationFor(role string) time.Duration {
+	if role == models.RoleAdmin && jm.config.AdminAccessDuration > 0 {
+		return jm.config.AdminAccessDuration
+	}
+	return jm.config.AccessDuration
+}
+
+// RefreshDurationFor returns the refresh token lifetime for role. Admins get
+// AdminRefreshDuration when it is set.
+func (jm *JWTManager) RefreshDurationFor(role string) time.Duration {
+	if role == models.RoleAdmin && jm.config.AdminRefreshDuration > 0 {
+		return jm.config.AdminRefreshDuration
+	}
+	return jm.config.RefreshDuration
+}
+
+// LoginRefreshDuration returns the refresh token lifetime of a new login:
+// JWT_REMEMBER_ME_DURATION or JWT_NO_REMEMBER_ME_DURATION by the client's
+// remember_me choice, or RefreshDurationFor(role) when it made none. A
+// shorter admin refresh lifetime still applies to admins.
+func (jm *JWTManager) LoginRefreshDuration(role string, rememberMe *bool) time.Duration {
+	if rememberMe == nil {
+		return jm.RefreshDurationFor(role)
+	}
+
+	duration := jm.config.NoRememberMeDuration
+	if *rememberMe {
+		duration = jm.config.RememberMeDuration
+	}
+	if admin := jm.config.AdminRefreshDuration; role == models.RoleAdmin && admin > 0 && admin < duration {
+		return admin
+	}
+	return duration
+}
+
 // GenerateAccessToken generates a new access token
 func (jm *JWTManager) GenerateAccessToken(user *models.User) (string, error) {
+	jti, err := generateJTI()
+	if err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Role:     user.Role,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		TokenType: TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(jm.config.AccessDuration)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(jm.AccessDurationFor(user.Role))),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Subject:   fmt.Sprintf("%d", user.ID),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jm.config.Secret))
+	return jm.signClaims(claims)
 }
 
 // GenerateRefreshToken generates a new refresh token (simpler, longer-lived)
-func (jm *JWTManager) GenerateRefreshToken(user *models.User) (string, error) {
+// that expires after lifetime
+func (jm *JWTManager) GenerateRefreshToken(user *models.User, lifetime time.Duration) (string, error) {
+	jti, err := generateJTI()
+	if err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Role:     user.Role,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		TokenType: TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(jm.config.RefreshDuration)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(lifetime)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   fmt.Sprintf("%d", user.ID),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jm.config.Secret))
+	return jm.signClaims(claims)
+}
+
+// generateJTI creates a unique JWT ID
+func generateJTI() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// TokenID returns the jti of a token this manager issued, without verifying it
+func (jm *JWTManager) TokenID(tokenString string) string {
+	claims := &Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return ""
+	}
+	return claims.ID
 }
 
 // ValidateToken validates a JWT token and returns claims
 func (jm *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 	// ✅ Check in-memory blacklist FIRST (faster, no DB)
 	if Blacklist.Contains(tokenString) {
-		log.Printf("[DEBUG] Token in memory blacklist")
+		slog.Debug("Token found in memory blacklist")
 		return nil, fmt.Errorf("token is invalid")
 	}
 
-	// ✅ Optional: Check DB blacklist (but don't fail on DB error)
-	if jm.blacklistRepo != nil {
-		isBlacklisted, err := jm.blacklistRepo.IsBlacklisted(tokenString)
-		if err != nil {
-			// ❌ DB error - log but continue
-			log.Printf("[WARN] Blacklist DB error (continuing): %v", err)
-		} else if isBlacklisted {
-			log.Printf("[DEBUG] Token in DB blacklist")
-			return nil, fmt.Errorf("token is invalid")
-		}
-	}
-
 	// ✅ Standard JWT validation
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return []byte(jm.config.Secret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, jm.verificationKey,
+		jwt.WithValidMethods([]string{jm.signingMethod.Alg()}))
+
+	// ✅ Tokens signed before a JWT_SECRET rotation stay valid until they expire
+	if errors.Is(err, jwt.ErrTokenSignatureInvalid) && jm.config.PreviousSecret != "" &&
+		jm.signingMethod == jwt.SigningMethodHS256 {
+		token, err = jwt.ParseWithClaims(tokenString, &Claims{}, jm.previousSecretKey,
+			jwt.WithValidMethods([]string{jm.signingMethod.Alg()}))
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if jm.IsRevoked(tokenString, claims) {
+		return nil, fmt.Errorf("token is invalid")
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	return claims, nil
+}
+
+// ValidateTokenType validates a token like ValidateToken and also requires
+// it to be of tokenType. Tokens without a type, issued before types existed,
+// are rejected too.
+func (jm *JWTManager) ValidateTokenType(tokenString, tokenType string) (*Claims, error) {
+	claims, err := jm.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != tokenType {
+		return nil, fmt.Errorf("%w: got %q, want %q", ErrWrongTokenType, claims.TokenType, tokenType)
+	}
+	return claims, nil
+}
+
+// SetTokensNotBefore revokes every token issued before t (global logout)
+func (jm *JWTManager) SetTokensNotBefore(t time.Time) {
+	jm.notBefore.Store(t.Unix())
+}
+
+// TokensNotBefore returns the global revocation cutoff (zero when unset)
+func (jm *JWTManager) TokensNotBefore() time.Time {
+	if unix := jm.notBefore.Load(); unix > 0 {
+		return time.Unix(unix, 0)
+	}
+	return time.Time{}
+}
+
+// IsRevoked reports whether a parsed token is blacklisted in memory or in the DB
+func (jm *JWTManager) IsRevoked(tokenString string, claims *Claims) bool {
+	// ✅ Global revocation: reject anything issued before the cutoff
+	if cutoff := jm.notBefore.Load(); cutoff > 0 {
+		if claims.IssuedAt == nil || claims.IssuedAt.Unix() < cutoff {
+			slog.Debug("Token issued before global revocation cutoff", "jti", claims.ID)
+			return true
+		}
+	}
+
+	if Blacklist.Contains(tokenString) {
+		slog.Debug("Token found in memory blacklist")
+		return true
+	}
+
+	if claims.ID != "" && Blacklist.Contains(claims.ID) {
+		slog.Debug("Token ID found in memory blacklist", "jti", claims.ID)
+		return true
+	}
+
+	// ✅ Check DB blacklist by jti (hash fallback for legacy tokens), but don't fail on DB error
+	if jm.blacklistRepo != nil {
+		isBlacklisted, err := jm.blacklistRepo.IsRevoked(claims.ID, tokenString)
+		if err != nil {
+			// ❌ DB error - log but continue
+			slog.Warn("Blacklist lookup failed, continuing", "jti", claims.ID, "error", err)
+		} else if isBlacklisted {
+			slog.Debug("Token found in database blacklist", "jti", claims.ID)
+			return true
+		}
+	}
+
+	return false
+}
+
+// SigningAlgorithm returns the JWT algorithm used to sign tokens
+func (jm *JWTManager) SigningAlgorithm() string {
+	return jm.signingMethod.Alg()
 }
 
 // AuthMiddleware is the Echo middleware for JWT authentication
@@ -142,8 +380,8 @@ func (jm *JWTManager) AuthMiddleware() echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusUnauthorized, "توکن نامعتبر است")
 			}
 
-			// Validate token
-			claims, err := jm.ValidateToken(tokenString)
+			// Validate token; refresh tokens only work at /auth/refresh
+			claims, err := jm.ValidateTokenType(tokenString, TokenTypeAccess)
 			if err != nil {
 				return echo.NewHTTPError(http.StatusUnauthorized, "توکن دسترسی منقضی شده است")
 			}
@@ -159,6 +397,38 @@ func (jm *JWTManager) AuthMiddleware() echo.MiddlewareFunc {
 	}
 }
 
+// QueryTokenAuthMiddleware authenticates with the token query parameter, for
+// EventSource and WebSocket clients that cannot send an Authorization header.
+// Revoked tokens are rejected exactly as in AuthMiddleware.
+func (jm *JWTManager) QueryTokenAuthMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tokenString := c.QueryParam("token")
+			if tokenString == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "توکن یافت نشد")
+			}
+
+			// ✅ Check if token is blacklisted
+			if Blacklist.Contains(tokenString) {
+				return echo.NewHTTPError(http.StatusUnauthorized, "توکن نامعتبر است")
+			}
+
+			// Validate token (also checks the DB blacklist and global revocation)
+			claims, err := jm.ValidateTokenType(tokenString, TokenTypeAccess)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "توکن دسترسی منقضی شده است")
+			}
+
+			c.Set("user_id", claims.UserID)
+			c.Set("username", claims.Username)
+			c.Set("role", claims.Role)
+			c.Set("claims", claims)
+
+			return next(c)
+		}
+	}
+}
+
 // RequireRole middleware checks if user has the required role
 func RequireRole(roles ...string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
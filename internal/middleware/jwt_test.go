@@ -0,0 +1,360 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"Monex/config"
+	"Monex/internal/database"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// newJWTManager builds a manager and fails the test on a key loading error
+func newJWTManager(t *testing.T, cfg *config.JWTConfig, blacklist *repository.TokenBlacklistRepository) *JWTManager {
+	t.Helper()
+	jm, err := NewJWTManager(cfg, blacklist)
+	if err != nil {
+		t.Fatalf("NewJWTManager: %v", err)
+	}
+	return jm
+}
+
+func TestPreviousSecretOverlap(t *testing.T) {
+	const (
+		oldSecret   = "old-secret-0123456789abcdef0123456789abcdef"
+		newSecret   = "new-secret-0123456789abcdef0123456789abcdef"
+		otherSecret = "other-secret-0123456789abcdef0123456789abcd"
+	)
+	manager := func(secret, previous string) *JWTManager {
+		return newJWTManager(t, &config.JWTConfig{
+			Secret:         secret,
+			PreviousSecret: previous,
+			AccessDuration: time.Hour,
+		}, nil)
+	}
+	user := &models.User{ID: 7, Username: "alice", Role: models.RoleUser}
+	issue := func(jm *JWTManager) string {
+		t.Helper()
+		token, err := jm.GenerateAccessToken(user)
+		if err != nil {
+			t.Fatalf("GenerateAccessToken: %v", err)
+		}
+		return token
+	}
+
+	beforeRotation := issue(manager(oldSecret, ""))
+	rotated := manager(newSecret, oldSecret)
+
+	// Tokens issued before the rotation stay valid during the overlap
+	claims, err := rotated.ValidateTokenType(beforeRotation, TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("token signed with the previous secret rejected: %v", err)
+	}
+	if claims.UserID != user.ID {
+		t.Fatalf("claims.UserID = %d, want %d", claims.UserID, user.ID)
+	}
+
+	// New tokens are signed with the current secret only
+	afterRotation := issue(rotated)
+	if _, err := manager(newSecret, "").ValidateToken(afterRotation); err != nil {
+		t.Fatalf("new token doesn't verify with the current secret: %v", err)
+	}
+	if _, err := manager(oldSecret, "").ValidateToken(afterRotation); err == nil {
+		t.Fatal("new token verifies with the previous secret")
+	}
+
+	// Once the previous secret is dropped, and for any other secret, old tokens fail
+	if _, err := manager(newSecret, "").ValidateToken(beforeRotation); err == nil {
+		t.Fatal("old token accepted without JWT_SECRET_PREVIOUS")
+	}
+	if _, err := rotated.ValidateToken(issue(manager(otherSecret, ""))); err == nil {
+		t.Fatal("token signed with an unrelated secret accepted")
+	}
+}
+
+func TestRevokedJTI(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("JWT_SECRET", "test-secret-0123456789abcdef0123456789abcdef")
+	cfg := config.Load()
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	blacklist := repository.NewTokenBlacklistRepository(db)
+	jm := newJWTManager(t, &cfg.JWT, blacklist)
+	user := &models.User{ID: 1, Username: "admin", Role: models.RoleAdmin}
+
+	token, err := jm.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	claims, err := jm.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("fresh token rejected: %v", err)
+	}
+
+	// Revoking by jti alone, twice, rejects the correctly signed token
+	for i := 0; i < 2; i++ {
+		if err := blacklist.BlacklistJTI(user.ID, claims.ID, TokenTypeAccess, claims.ExpiresAt.Time, "test"); err != nil {
+			t.Fatalf("BlacklistJTI #%d: %v", i+1, err)
+		}
+	}
+	if _, err := jm.ValidateToken(token); err == nil {
+		t.Fatal("token with a revoked jti accepted")
+	}
+
+	// Other tokens of the same user are unaffected
+	other, err := jm.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	if _, err := jm.ValidateToken(other); err != nil {
+		t.Fatalf("unrevoked token rejected: %v", err)
+	}
+}
+
+func TestSigningAlgorithms(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyFile, pemKey, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	hs256 := newJWTManager(t, &config.JWTConfig{
+		Secret:         "test-secret-0123456789abcdef0123456789abcdef",
+		AccessDuration: time.Hour,
+	}, nil)
+	rs256 := newJWTManager(t, &config.JWTConfig{
+		Secret:         "test-secret-0123456789abcdef0123456789abcdef",
+		PrivateKeyFile: keyFile,
+		AccessDuration: time.Hour,
+	}, nil)
+	if got := rs256.SigningAlgorithm(); got != "RS256" {
+		t.Fatalf("SigningAlgorithm() with a key file = %s, want RS256", got)
+	}
+	if got := hs256.SigningAlgorithm(); got != "HS256" {
+		t.Fatalf("SigningAlgorithm() without key files = %s, want HS256", got)
+	}
+
+	user := &models.User{ID: 7, Username: "alice", Role: models.RoleUser}
+	for _, jm := range []*JWTManager{hs256, rs256} {
+		token, err := jm.GenerateAccessToken(user)
+		if err != nil {
+			t.Fatalf("%s GenerateAccessToken: %v", jm.SigningAlgorithm(), err)
+		}
+		claims, err := jm.ValidateTokenType(token, TokenTypeAccess)
+		if err != nil {
+			t.Fatalf("%s token rejected by its own manager: %v", jm.SigningAlgorithm(), err)
+		}
+		if claims.UserID != user.ID {
+			t.Fatalf("%s claims.UserID = %d, want %d", jm.SigningAlgorithm(), claims.UserID, user.ID)
+		}
+	}
+
+	// A token of the other algorithm is refused either way round
+	rsToken, err := rs256.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	if _, err := hs256.ValidateToken(rsToken); err == nil {
+		t.Fatal("HS256 manager accepted an RS256 token")
+	}
+	hsToken, err := hs256.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	if _, err := rs256.ValidateToken(hsToken); err == nil {
+		t.Fatal("RS256 manager accepted an HS256 token")
+	}
+}
+
+func TestNewJWTManagerRejectsUnusableKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	cases := map[string]config.JWTConfig{
+		"missing private key": {PrivateKeyFile: filepath.Join(dir, "missing.pem")},
+		"unparseable key":     {PrivateKeyFile: garbage},
+		"public key only":     {PublicKeyFile: garbage},
+	}
+	for name, cfg := range cases {
+		cfg.Secret = "test-secret-0123456789abcdef0123456789abcdef"
+		cfg.AccessDuration = time.Hour
+		if jm, err := NewJWTManager(&cfg, nil); err == nil || jm != nil {
+			t.Errorf("%s: NewJWTManager() = %v, %v, want an error", name, jm, err)
+		}
+	}
+}
+
+func TestAdminTokenDurations(t *testing.T) {
+	cfg := &config.JWTConfig{
+		Secret:               "test-secret-0123456789abcdef0123456789abcdef",
+		AccessDuration:       time.Hour,
+		RefreshDuration:      48 * time.Hour,
+		AdminAccessDuration:  10 * time.Minute,
+		AdminRefreshDuration: 8 * time.Hour,
+	}
+	jm := newJWTManager(t, cfg, nil)
+	admin := &models.User{ID: 1, Username: "admin", Role: models.RoleAdmin}
+	user := &models.User{ID: 2, Username: "alice", Role: models.RoleUser}
+
+	expiry := func(u *models.User) time.Time {
+		t.Helper()
+		token, err := jm.GenerateAccessToken(u)
+		if err != nil {
+			t.Fatalf("GenerateAccessToken: %v", err)
+		}
+		claims, err := jm.ValidateToken(token)
+		if err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+		return claims.ExpiresAt.Time
+	}
+	now := time.Now()
+	adminExpiry, userExpiry := expiry(admin), expiry(user)
+	if !adminExpiry.Before(userExpiry) {
+		t.Fatalf("admin token expires at %v, not before the user token at %v", adminExpiry, userExpiry)
+	}
+	if d := adminExpiry.Sub(now); d < 9*time.Minute || d > 11*time.Minute {
+		t.Errorf("admin access token lives %v, want about %v", d, cfg.AdminAccessDuration)
+	}
+
+	if got := jm.RefreshDurationFor(models.RoleAdmin); got != cfg.AdminRefreshDuration {
+		t.Errorf("admin refresh duration = %v, want %v", got, cfg.AdminRefreshDuration)
+	}
+	if got := jm.RefreshDurationFor(models.RoleUser); got != cfg.RefreshDuration {
+		t.Errorf("user refresh duration = %v, want %v", got, cfg.RefreshDuration)
+	}
+
+	// Unset admin durations fall back to the general ones
+	cfg.AdminAccessDuration, cfg.AdminRefreshDuration = 0, 0
+	if got := jm.AccessDurationFor(models.RoleAdmin); got != cfg.AccessDuration {
+		t.Errorf("admin access duration without override = %v, want %v", got, cfg.AccessDuration)
+	}
+	if got := jm.RefreshDurationFor(models.RoleAdmin); got != cfg.RefreshDuration {
+		t.Errorf("admin refresh duration without override = %v, want %v", got, cfg.RefreshDuration)
+	}
+}
+
+func TestQueryTokenAuthRefusesBlacklistedTokens(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("JWT_SECRET", "test-secret-0123456789abcdef0123456789abcdef")
+	cfg := config.Load()
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	blacklist := repository.NewTokenBlacklistRepository(db)
+	jm := newJWTManager(t, &cfg.JWT, blacklist)
+	user := &models.User{ID: 1, Username: "admin", Role: models.RoleAdmin}
+	issue := func() string {
+		t.Helper()
+		token, err := jm.GenerateAccessToken(user)
+		if err != nil {
+			t.Fatalf("GenerateAccessToken: %v", err)
+		}
+		return token
+	}
+
+	e := echo.New()
+	e.GET("/api/notifications/stream", func(c echo.Context) error {
+		return c.String(http.StatusOK, strconv.Itoa(c.Get("user_id").(int)))
+	}, jm.QueryTokenAuthMiddleware())
+	stream := func(token string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/notifications/stream?token="+token, nil))
+		return rec.Code
+	}
+
+	if code := stream(issue()); code != http.StatusOK {
+		t.Fatalf("valid token: status %d, want 200", code)
+	}
+	if code := stream(""); code != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", code)
+	}
+
+	// Revoked in the database, e.g. by logout on another instance
+	revoked := issue()
+	claims, err := jm.ValidateToken(revoked)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if err := blacklist.BlacklistJTI(user.ID, claims.ID, TokenTypeAccess, claims.ExpiresAt.Time, "test"); err != nil {
+		t.Fatalf("BlacklistJTI: %v", err)
+	}
+	if code := stream(revoked); code != http.StatusUnauthorized {
+		t.Errorf("token blacklisted in the database: status %d, want 401", code)
+	}
+
+	// Held in the in-memory blacklist only
+	blacklisted := issue()
+	Blacklist.Add(blacklisted, time.Now().Add(time.Hour))
+	t.Cleanup(func() { Blacklist.Remove(blacklisted) })
+	if code := stream(blacklisted); code != http.StatusUnauthorized {
+		t.Errorf("token in the in-memory blacklist: status %d, want 401", code)
+	}
+
+	refresh, err := jm.GenerateRefreshToken(user, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	if code := stream(refresh); code != http.StatusUnauthorized {
+		t.Errorf("refresh token: status %d, want 401", code)
+	}
+}
+
+func TestLoginRefreshDuration(t *testing.T) {
+	jm := newJWTManager(t, &config.JWTConfig{
+		Secret:               "test-secret-0123456789abcdef0123456789abcdef",
+		RefreshDuration:      168 * time.Hour,
+		AdminRefreshDuration: 8 * time.Hour,
+		RememberMeDuration:   720 * time.Hour,
+		NoRememberMeDuration: 4 * time.Hour,
+	}, nil)
+	yes, no := true, false
+
+	for _, tt := range []struct {
+		role       string
+		rememberMe *bool
+		want       time.Duration
+	}{
+		{models.RoleUser, &yes, 720 * time.Hour},
+		{models.RoleUser, &no, 4 * time.Hour},
+		{models.RoleUser, nil, 168 * time.Hour},
+		{models.RoleAdmin, &yes, 8 * time.Hour}, // the shorter admin lifetime wins
+		{models.RoleAdmin, &no, 4 * time.Hour},
+		{models.RoleAdmin, nil, 8 * time.Hour},
+	} {
+		choice := "unset"
+		if tt.rememberMe != nil {
+			choice = fmt.Sprint(*tt.rememberMe)
+		}
+		if got := jm.LoginRefreshDuration(tt.role, tt.rememberMe); got != tt.want {
+			t.Errorf("LoginRefreshDuration(%s, remember_me %s) = %v, want %v", tt.role, choice, got, tt.want)
+		}
+	}
+}
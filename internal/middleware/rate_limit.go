@@ -1,8 +1,16 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
+
+	"Monex/internal/logger"
+	"Monex/internal/repository"
 
 	"github.com/labstack/echo/v4"
 	"golang.org/x/time/rate"
@@ -40,3 +48,180 @@ func UserRateLimitMiddleware(reqPerSec float64) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// EndpointRateLimiter throttles a single public endpoint per client IP
+type EndpointRateLimiter struct {
+	mu         sync.Mutex
+	limiters   map[string]*endpointLimiterEntry
+	limit      rate.Limit
+	burst      int
+	ttl        time.Duration // idle time after which an IP's limiter is dropped
+	maxEntries int
+}
+
+type endpointLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewEndpointRateLimiter allows requests per window for each IP, with the
+// full allowance available as a burst
+func NewEndpointRateLimiter(requests int, window time.Duration) *EndpointRateLimiter {
+	if requests < 1 {
+		requests = 1
+	}
+	return &EndpointRateLimiter{
+		limiters:   make(map[string]*endpointLimiterEntry),
+		limit:      rate.Every(window / time.Duration(requests)),
+		burst:      requests,
+		ttl:        time.Hour,
+		maxEntries: 10000,
+	}
+}
+
+// Configure sets how long idle IPs are remembered and how many IPs are
+// tracked at once. Values <= 0 keep the current setting.
+func (l *EndpointRateLimiter) Configure(ttl time.Duration, maxEntries int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if ttl > 0 {
+		l.ttl = ttl
+	}
+	if maxEntries > 0 {
+		l.maxEntries = maxEntries
+	}
+}
+
+// Allow reports whether ip may make another request now
+func (l *EndpointRateLimiter) Allow(ip string) bool {
+	allowed, _ := l.Take(ip)
+	return allowed
+}
+
+// Take spends one request from ip's budget and reports whether it was
+// allowed, along with the budget left afterwards. IPv6 addresses share the
+// budget of their /64 (see RateLimitKey).
+func (l *EndpointRateLimiter) Take(ip string) (bool, RateLimitStatus) {
+	ip = RateLimitKey(ip)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, exists := l.limiters[ip]
+	if !exists {
+		if len(l.limiters) >= l.maxEntries {
+			l.evict()
+		}
+		entry = &endpointLimiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[ip] = entry
+	}
+	entry.lastSeen = time.Now()
+
+	allowed := entry.limiter.Allow()
+	return allowed, LimiterStatus(entry.limiter)
+}
+
+// Middleware rejects over-limit requests with 429 and records them in the audit log
+func (l *EndpointRateLimiter) Middleware(action string, auditRepo *repository.AuditRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			clientIP := c.RealIP()
+			allowed, status := l.Take(clientIP)
+			SetRateLimitHeaders(c, status)
+			if allowed {
+				return next(c)
+			}
+
+			logger.Security("Endpoint rate limit exceeded", "action", action, "ip", clientIP)
+			if auditRepo != nil {
+				auditRepo.LogActionWithNullUser(action+"_rate_limited", "auth", clientIP,
+					c.Request().Header.Get("User-Agent"), false,
+					fmt.Sprintf("Rate limit exceeded for %s", c.Request().URL.Path))
+			}
+
+			return echo.NewHTTPError(http.StatusTooManyRequests, map[string]interface{}{
+				"message": "درخواست‌های متوالی زیاد. لطفا کمی صبر کنید",
+				"code":    "rate_limited",
+			})
+		}
+	}
+}
+
+// RateLimitStatus is what's left of a client's request budget
+type RateLimitStatus struct {
+	Limit     int           // requests available in a full budget
+	Remaining int           // requests that may be made right now
+	Reset     time.Duration // until the budget is full again
+}
+
+// LimiterStatus reads the budget of a token-bucket limiter: the bucket size
+// is the limit and its current tokens are what remains
+func LimiterStatus(limiter *rate.Limiter) RateLimitStatus {
+	tokens := limiter.Tokens()
+	status := RateLimitStatus{
+		Limit:     limiter.Burst(),
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+	}
+	if missing := float64(status.Limit) - tokens; missing > 0 && limiter.Limit() > 0 {
+		status.Reset = time.Duration(missing / float64(limiter.Limit()) * float64(time.Second))
+	}
+	return status
+}
+
+// SetRateLimitHeaders tells the client its remaining budget.
+// X-RateLimit-Reset is in seconds, rounded up.
+func SetRateLimitHeaders(c echo.Context, status RateLimitStatus) {
+	header := c.Response().Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(status.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	header.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(status.Reset.Seconds()))))
+}
+
+// StartCleanupRoutine drops limiters of idle IPs until ctx is cancelled
+func (l *EndpointRateLimiter) StartCleanupRoutine(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.cleanup()
+			}
+		}
+	}()
+}
+
+func (l *EndpointRateLimiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ip, entry := range l.limiters {
+		if time.Since(entry.lastSeen) > l.ttl {
+			delete(l.limiters, ip)
+		}
+	}
+}
+
+// evict makes room for a new IP when the limiter is full. Idle entries go
+// first; otherwise only the least recently seen IP is dropped, so flooding
+// the limiter with new IPs can't reset everyone else's limits. Callers must
+// hold l.mu.
+func (l *EndpointRateLimiter) evict() {
+	var oldestIP string
+	var oldest time.Time
+	for ip, entry := range l.limiters {
+		if time.Since(entry.lastSeen) > l.ttl {
+			delete(l.limiters, ip)
+			continue
+		}
+		if oldestIP == "" || entry.lastSeen.Before(oldest) {
+			oldestIP, oldest = ip, entry.lastSeen
+		}
+	}
+	if len(l.limiters) >= l.maxEntries && oldestIP != "" {
+		delete(l.limiters, oldestIP)
+	}
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.7":              "203.0.113.7",
+		"::ffff:203.0.113.7":       "203.0.113.7",
+		"2001:db8:1:2::1":          "2001:db8:1:2::/64",
+		"2001:db8:1:2:ffff:ffff::": "2001:db8:1:2::/64",
+		"not-an-ip":                "not-an-ip",
+	}
+	for ip, want := range tests {
+		if got := RateLimitKey(ip); got != want {
+			t.Errorf("RateLimitKey(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestEndpointRateLimiterSharesIPv6Network(t *testing.T) {
+	limiter := NewEndpointRateLimiter(2, time.Hour)
+
+	// Two addresses of one /64 spend a single budget
+	if !limiter.Allow("2001:db8:1:2::1") || !limiter.Allow("2001:db8:1:2::beef") {
+		t.Fatal("first two requests of the /64 refused")
+	}
+	if limiter.Allow("2001:db8:1:2:aaaa::3") {
+		t.Fatal("third address in the same /64 got a fresh budget")
+	}
+
+	// The neighbouring /64 and IPv4 clients are limited separately
+	if !limiter.Allow("2001:db8:1:3::1") {
+		t.Fatal("another /64 shares the exhausted budget")
+	}
+	if !limiter.Allow("203.0.113.7") || !limiter.Allow("203.0.113.7") || limiter.Allow("203.0.113.7") {
+		t.Fatal("IPv4 address not limited on its own")
+	}
+}
+
+func TestEndpointRateLimiterReturns429(t *testing.T) {
+	limiter := NewEndpointRateLimiter(2, time.Hour)
+	e := echo.New()
+	e.IPExtractor = NewIPExtractor(nil)
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.POST("/register", func(c echo.Context) error { return c.NoContent(http.StatusCreated) },
+		limiter.Middleware("register", nil))
+
+	register := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/register", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 1; i <= 2; i++ {
+		if rec := register("203.0.113.7:5000"); rec.Code != http.StatusCreated {
+			t.Fatalf("request %d: status %d, want 201", i, rec.Code)
+		}
+	}
+	rec := register("203.0.113.7:5001")
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "rate_limited") {
+		t.Fatalf("over the limit: status %d, body %s; want 429 rate_limited", rec.Code, rec.Body)
+	}
+	if remaining := rec.Header().Get("X-RateLimit-Remaining"); remaining != "0" {
+		t.Fatalf("X-RateLimit-Remaining = %q, want 0", remaining)
+	}
+
+	// Other clients keep their own budget
+	if rec := register("198.51.100.9:5000"); rec.Code != http.StatusCreated {
+		t.Fatalf("another IP: status %d, want 201", rec.Code)
+	}
+}
+
+func TestRateLimitRemainingCountsDown(t *testing.T) {
+	const limit = 5
+	limiter := NewEndpointRateLimiter(limit, time.Hour)
+	e := echo.New()
+	e.IPExtractor = NewIPExtractor(nil)
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.GET("/refresh", func(c echo.Context) error { return c.NoContent(http.StatusOK) },
+		limiter.Middleware("refresh", nil))
+
+	for i := 1; i <= limit+1; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/refresh", nil)
+		req.RemoteAddr = "203.0.113.7:5000"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		wantCode, wantRemaining := http.StatusOK, limit-i
+		if i > limit {
+			wantCode, wantRemaining = http.StatusTooManyRequests, 0
+		}
+		if rec.Code != wantCode {
+			t.Fatalf("request %d: status %d, want %d", i, rec.Code, wantCode)
+		}
+		if got := rec.Header().Get("X-RateLimit-Limit"); got != strconv.Itoa(limit) {
+			t.Fatalf("request %d: X-RateLimit-Limit = %q, want %d", i, got, limit)
+		}
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != strconv.Itoa(wantRemaining) {
+			t.Fatalf("request %d: X-RateLimit-Remaining = %q, want %d", i, got, wantRemaining)
+		}
+	}
+}
+
+func TestEndpointRateLimiterEvictsEntriesIndividually(t *testing.T) {
+	limiter := NewEndpointRateLimiter(1, time.Hour)
+	limiter.Configure(time.Minute, 2)
+	idle := func(ip string) {
+		limiter.mu.Lock()
+		limiter.limiters[ip].lastSeen = time.Now().Add(-2 * time.Minute)
+		limiter.mu.Unlock()
+	}
+	tracked := func(ip string) bool {
+		limiter.mu.Lock()
+		defer limiter.mu.Unlock()
+		_, ok := limiter.limiters[ip]
+		return ok
+	}
+
+	// Cleanup drops only the entry idle past the TTL
+	limiter.Allow("203.0.113.1")
+	limiter.Allow("203.0.113.2")
+	idle("203.0.113.1")
+	limiter.cleanup()
+	if tracked("203.0.113.1") || !tracked("203.0.113.2") {
+		t.Fatal("cleanup should drop the idle IP and keep the active one")
+	}
+
+	// At capacity the least recently seen IP makes room; the exhausted
+	// budget of the other one survives
+	limiter.Allow("203.0.113.3")
+	limiter.mu.Lock()
+	limiter.limiters["203.0.113.2"].lastSeen = time.Now().Add(-time.Second)
+	limiter.mu.Unlock()
+	limiter.Allow("203.0.113.4")
+	if tracked("203.0.113.2") || !tracked("203.0.113.3") || !tracked("203.0.113.4") {
+		t.Fatal("a full limiter should evict only the least recently seen IP")
+	}
+	if limiter.Allow("203.0.113.3") {
+		t.Fatal("evicting another IP reset a spent budget")
+	}
+
+	// An idle entry goes before the least recently seen active one
+	idle("203.0.113.4")
+	limiter.Allow("203.0.113.5")
+	if tracked("203.0.113.4") || !tracked("203.0.113.3") {
+		t.Fatal("a full limiter should evict the idle IP first")
+	}
+}
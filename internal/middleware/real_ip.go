@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NewIPExtractor resolves the client IP from X-Forwarded-For, but only across
+// hops that belong to the trusted proxy networks. Echo's default RealIP trusts
+// the header from anyone, which lets clients spoof their address and evade the
+// per-IP login rate limiter; with this extractor a spoofed header sent from an
+// untrusted peer is ignored and the peer address is used instead.
+func NewIPExtractor(trustedProxies []*net.IPNet) echo.IPExtractor {
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, network := range trustedProxies {
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// rateLimitIPv6Prefix is the IPv6 network treated as one client by the rate
+// limiters; a single subscriber is usually handed at least a /64
+const rateLimitIPv6Prefix = 64
+
+// RateLimitKey maps a client IP to the key its per-IP limits are tracked
+// under. IPv4 addresses, including IPv4-mapped IPv6 ones, are used as is;
+// IPv6 addresses collapse to their /64, so rotating the low bits doesn't get
+// a fresh limiter. Values that aren't IPs are returned unchanged.
+func RateLimitKey(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.String()
+	}
+	mask := net.CIDRMask(rateLimitIPv6Prefix, 128)
+	network := net.IPNet{IP: parsed.Mask(mask), Mask: mask}
+	return network.String()
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPExtractorIgnoresSpoofedXFF(t *testing.T) {
+	trusted, err := ParseCIDRList([]string{"127.0.0.0/8", "10.0.0.0/8", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("ParseCIDRList: %v", err)
+	}
+	extract := NewIPExtractor(trusted)
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"no header", "198.51.100.1:4000", "", "198.51.100.1"},
+		{"spoofed header from an untrusted peer", "198.51.100.1:4000", "203.0.113.7", "198.51.100.1"},
+		{"forwarded by a trusted proxy", "10.0.0.5:4000", "203.0.113.7", "203.0.113.7"},
+		{"spoofed hop before a trusted proxy", "10.0.0.5:4000", "192.0.2.1, 203.0.113.7", "203.0.113.7"},
+		{"chain of trusted proxies", "127.0.0.1:4000", "203.0.113.7, 10.0.0.9", "203.0.113.7"},
+		{"trusted IPv6 proxy", "[fd00::1]:4000", "2001:db8::7", "2001:db8::7"},
+		{"spoofed header from an untrusted IPv6 peer", "[2001:db8::1]:4000", "203.0.113.7", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if got := extract(req); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"Monex/internal/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxRequestIDLength bounds client-supplied ids so they can't bloat logs
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware assigns every request an id: an incoming X-Request-ID is
+// honored when well-formed, otherwise a UUIDv4 is generated. The id is stored
+// in the echo context, the request context (for slog) and the response header.
+func RequestIDMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			requestID := c.Request().Header.Get(echo.HeaderXRequestID)
+			if !isValidRequestID(requestID) {
+				requestID = newUUID()
+			}
+
+			c.Set("request_id", requestID)
+			c.SetRequest(c.Request().WithContext(logger.WithRequestID(c.Request().Context(), requestID)))
+			c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+
+			return next(c)
+		}
+	}
+}
+
+// GetRequestID extracts the request id from context
+func GetRequestID(c echo.Context) string {
+	requestID, _ := c.Get("request_id").(string)
+	return requestID
+}
+
+// HTTPErrorHandler renders errors as JSON that always carries the request id,
+// so a user-reported error can be matched to the server logs
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	code := http.StatusInternalServerError
+	var message interface{} = http.StatusText(code)
+
+	if he, ok := err.(*echo.HTTPError); ok {
+		code = he.Code
+		message = he.Message
+		if he.Internal != nil {
+			slog.ErrorContext(c.Request().Context(), "Request failed", "status", code, "error", he.Internal)
+		}
+	} else {
+		slog.ErrorContext(c.Request().Context(), "Unhandled request error", "path", c.Path(), "error", err)
+	}
+
+	body := map[string]interface{}{}
+	switch m := message.(type) {
+	case map[string]interface{}:
+		for k, v := range m {
+			body[k] = v
+		}
+	case map[string]string:
+		for k, v := range m {
+			body[k] = v
+		}
+	case string:
+		body["message"] = m
+	case error:
+		body["message"] = m.Error()
+	default:
+		body["message"] = m
+	}
+	body["request_id"] = GetRequestID(c)
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(code)
+	} else {
+		err = c.JSON(code, body)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request().Context(), "Failed to write error response", "error", err)
+	}
+}
+
+// isValidRequestID accepts short ids made of printable, header-safe characters
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
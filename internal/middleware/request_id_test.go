@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.Use(RequestIDMiddleware())
+	e.GET("/ok", func(c echo.Context) error { return c.String(http.StatusOK, GetRequestID(c)) })
+	e.GET("/fail", func(c echo.Context) error { return echo.NewHTTPError(http.StatusBadRequest, "bad") })
+
+	get := func(path, requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if requestID != "" {
+			req.Header.Set(echo.HeaderXRequestID, requestID)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A provided id is echoed and used for the request
+	rec := get("/ok", "client-trace-123")
+	if got := rec.Header().Get(echo.HeaderXRequestID); got != "client-trace-123" || rec.Body.String() != got {
+		t.Fatalf("provided id: header %q, context %q; want client-trace-123", got, rec.Body)
+	}
+	rec = get("/fail", "client-trace-456")
+	if !strings.Contains(rec.Body.String(), `"request_id":"client-trace-456"`) {
+		t.Fatalf("error body %s lacks the provided request id", rec.Body)
+	}
+
+	// Missing or malformed ids are replaced by a fresh UUIDv4
+	seen := map[string]bool{}
+	for _, provided := range []string{"", "has space", strings.Repeat("x", maxRequestIDLength+1)} {
+		rec := get("/ok", provided)
+		got := rec.Header().Get(echo.HeaderXRequestID)
+		if !uuidV4.MatchString(got) || rec.Body.String() != got {
+			t.Fatalf("id for %q: header %q, context %q; want a UUIDv4", provided, got, rec.Body)
+		}
+		if seen[got] {
+			t.Fatalf("generated id %s repeated", got)
+		}
+		seen[got] = true
+	}
+}
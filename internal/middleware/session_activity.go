@@ -1,51 +1,97 @@
 package middleware
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
+	"Monex/internal/logger"
+	"Monex/internal/models"
 	"Monex/internal/repository"
 
 	"github.com/labstack/echo/v4"
 )
 
-// SessionActivityMiddleware tracks last activity and validates sessions
-func SessionActivityMiddleware(sessionRepo *repository.SessionRepository) echo.MiddlewareFunc {
+// SessionActivityMiddleware tracks last activity and validates sessions.
+// The session is the one that issued the presented access token, whatever
+// device id the client sends, and a token without a session is rejected.
+// When idleTimeout is greater than zero, sessions idle for longer are invalidated.
+func SessionActivityMiddleware(
+	sessionRepo *repository.SessionRepository,
+	tokenBlacklistRepo *repository.TokenBlacklistRepository,
+	idleTimeout time.Duration,
+) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// Extract device_id from header or cookie
-			deviceID := c.Request().Header.Get("X-Device-ID")
-			if deviceID == "" {
-				deviceID = c.QueryParam("device_id")
+			token := ExtractBearerToken(c)
+			if token == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "هدر مجوز نامعتبر است")
+			}
+			userID, err := GetUserID(c)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "عدم احراز هویت")
+			}
+
+			session, err := sessionRepo.GetByAccessTokenHash(sessionRepo.HashToken(token))
+			if errors.Is(err, repository.ErrNotFound) || (err == nil && session.UserID != userID) {
+				// ✅ Session deleted - return 401 to force logout
+				return echo.NewHTTPError(http.StatusUnauthorized, "سشن شما منقضی شده است. لطفا دوباره وارد شوید")
+			}
+			if err != nil {
+				slog.Warn("Session validation error", "user_id", userID, "error", err)
+				return next(c)
 			}
 
-			// If we have device_id, update last activity
-			if deviceID != "" {
-				if err := sessionRepo.UpdateActivity(deviceID); err != nil {
-					log.Printf("[WARN] Failed to update activity for device %s: %v", deviceID, err)
-				}
+			// ✅ Check idle timeout BEFORE bumping last activity
+			if idleTimeout > 0 && time.Since(session.LastActivity) > idleTimeout {
+				expireIdleSession(c, sessionRepo, tokenBlacklistRepo, session)
+				return echo.NewHTTPError(http.StatusUnauthorized, map[string]interface{}{
+					"message": "سشن شما به دلیل عدم فعالیت منقضی شده است. لطفا دوباره وارد شوید",
+					"code":    "idle_timeout",
+				})
 			}
 
-			// Extract token to check if session still exists
-			authHeader := c.Request().Header.Get("Authorization")
-			if authHeader != "" {
-				parts := strings.SplitN(authHeader, " ", 2)
-				if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
-					token := parts[1]
-
-					// Check if session still exists in database
-					sessionExists, err := sessionRepo.ValidateTokenSession(token)
-					if err != nil {
-						log.Printf("[WARN] Session validation error: %v", err)
-					} else if !sessionExists {
-						// ✅ Session deleted - return 401 to force logout
-						return echo.NewHTTPError(http.StatusUnauthorized, "سشن شما منقضی شده است. لطفا دوباره وارد شوید")
-					}
-				}
+			if err := sessionRepo.UpdateActivity(session.ID); err != nil {
+				slog.Warn("Failed to update activity", "session_id", session.ID, "error", err)
 			}
 
 			return next(c)
 		}
 	}
 }
+
+// expireIdleSession blacklists the idle session's tokens and deletes it
+func expireIdleSession(
+	c echo.Context,
+	sessionRepo *repository.SessionRepository,
+	tokenBlacklistRepo *repository.TokenBlacklistRepository,
+	session *models.Session,
+) {
+	if tokenBlacklistRepo != nil {
+		if err := tokenBlacklistRepo.BlacklistBySessionID(session.ID, session.UserID); err != nil {
+			slog.Warn("Failed to blacklist idle session", "session_id", session.ID, "user_id", session.UserID, "error", err)
+		}
+	}
+
+	if claims, ok := c.Get("claims").(*Claims); ok {
+		Blacklist.AddClaims(ExtractBearerToken(c), claims)
+	}
+
+	if err := sessionRepo.InvalidateSession(session.ID, session.UserID); err != nil {
+		slog.Warn("Failed to delete idle session", "session_id", session.ID, "user_id", session.UserID, "error", err)
+		return
+	}
+
+	logger.Security("Session expired after idle timeout", "session_id", session.ID, "user_id", session.UserID)
+}
+
+// ExtractBearerToken returns the bearer token from the Authorization header
+func ExtractBearerToken(c echo.Context) string {
+	parts := strings.SplitN(c.Request().Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	return parts[1]
+}
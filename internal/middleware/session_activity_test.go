@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"Monex/config"
+	"Monex/internal/database"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestSessionActivityIdleTimeout(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("JWT_SECRET", "test-secret-0123456789abcdef0123456789abcdef")
+	cfg := config.Load()
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	users := repository.NewUserRepository(db)
+	sessions := repository.NewSessionRepository(db)
+	admin, err := users.GetByUsername("admin")
+	if err != nil {
+		t.Fatalf("seeded admin: %v", err)
+	}
+	newSession := func(token string, lastActivity time.Time) int {
+		t.Helper()
+		session, err := sessions.CreateSession(admin.ID, "Firefox on Linux", "Firefox", "Linux", "203.0.113.10",
+			token, token+"-refresh", token+"-jti", token+"-refresh-jti", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		if _, err := db.Exec("UPDATE sessions SET last_activity = ? WHERE id = ?",
+			lastActivity.UTC().Format("2006-01-02 15:04:05"), session.ID); err != nil {
+			t.Fatalf("backdate last_activity: %v", err)
+		}
+		return session.ID
+	}
+	active := newSession("active-token", time.Now().Add(-time.Minute))
+	idle := newSession("idle-token", time.Now().Add(-2*time.Hour))
+	activeSession, err := sessions.GetSessionByID(active, admin.ID)
+	if err != nil {
+		t.Fatalf("active session: %v", err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) },
+		func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Set("user_id", admin.ID)
+				return next(c)
+			}
+		},
+		SessionActivityMiddleware(sessions, repository.NewTokenBlacklistRepository(db), time.Hour))
+
+	request := func(token, deviceID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		if deviceID != "" {
+			req.Header.Set("X-Device-ID", deviceID)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// An active session passes without a device id and its activity is bumped
+	if rec := request("active-token", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("active session: status %d, body %s", rec.Code, rec.Body)
+	}
+	bumped, err := sessions.GetSessionByID(active, admin.ID)
+	if err != nil {
+		t.Fatalf("active session after request: %v", err)
+	}
+	if time.Since(bumped.LastActivity) > 30*time.Second {
+		t.Fatalf("last_activity = %v, want bumped to now", bumped.LastActivity)
+	}
+
+	// An idle session expires even when the request names another, active device
+	rec := request("idle-token", activeSession.DeviceID)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "idle_timeout") {
+		t.Fatalf("idle session: status %d, body %s; want 401 idle_timeout", rec.Code, rec.Body)
+	}
+	if _, err := sessions.GetSessionByID(idle, admin.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("idle session after request: %v, want ErrNotFound", err)
+	}
+
+	// A token whose session is gone is rejected, with or without a device id
+	for _, deviceID := range []string{"", activeSession.DeviceID} {
+		if rec := request("unknown-token", deviceID); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("token without session (device id %q): status %d, want 401", deviceID, rec.Code)
+		}
+	}
+}
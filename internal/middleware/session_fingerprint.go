@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"Monex/config"
+	"Monex/internal/logger"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+	"Monex/internal/useragent"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FingerprintMismatch lists how a request differs from the device and
+// network its session was created on: "os", "browser" and/or "ip". OS and
+// browser the session recorded as unknown aren't compared. IPs only differ
+// when they fall outside the same /ipv4Prefix or /ipv6Prefix network; a
+// prefix of 0 ignores IP changes.
+func FingerprintMismatch(session *models.Session, userAgent, ip string, ipv4Prefix, ipv6Prefix int) []string {
+	var mismatches []string
+
+	device := useragent.Parse(userAgent)
+	if session.OS != "" && session.OS != useragent.UnknownOS && device.OS != session.OS {
+		mismatches = append(mismatches, "os")
+	}
+	if session.Browser != "" && session.Browser != useragent.UnknownBrowser && device.Browser != session.Browser {
+		mismatches = append(mismatches, "browser")
+	}
+	if !sameNetwork(session.IPAddress, ip, ipv4Prefix, ipv6Prefix) {
+		mismatches = append(mismatches, "ip")
+	}
+
+	return mismatches
+}
+
+// sameNetwork reports whether a and b share the configured prefix.
+// Unparseable addresses and a v4/v6 family change aren't held against the
+// request, nor is anything when the family's prefix is 0.
+func sameNetwork(a, b string, ipv4Prefix, ipv6Prefix int) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return true
+	}
+
+	if v4A, v4B := ipA.To4(), ipB.To4(); v4A != nil || v4B != nil {
+		if v4A == nil || v4B == nil || ipv4Prefix == 0 {
+			return true
+		}
+		mask := net.CIDRMask(ipv4Prefix, 32)
+		return v4A.Mask(mask).Equal(v4B.Mask(mask))
+	}
+
+	if ipv6Prefix == 0 {
+		return true
+	}
+	mask := net.CIDRMask(ipv6Prefix, 128)
+	return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
+
+// SessionFingerprintMiddleware compares each authenticated request with the
+// OS, browser and network of the session its access token belongs to. A
+// mismatch flags the session as suspicious and is logged and audited once;
+// with STRICT_FINGERPRINT the session is ended and the client must sign in
+// again. Disabled unless FINGERPRINT_CHECK or STRICT_FINGERPRINT is set.
+func SessionFingerprintMiddleware(
+	sessionRepo *repository.SessionRepository,
+	tokenBlacklistRepo *repository.TokenBlacklistRepository,
+	auditRepo *repository.AuditRepository,
+	cfg *config.SecurityConfig,
+) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if !cfg.FingerprintCheck {
+			return next
+		}
+
+		return func(c echo.Context) error {
+			userID, ok := c.Get("user_id").(int)
+			if !ok {
+				return next(c)
+			}
+			token := ExtractBearerToken(c)
+			if token == "" {
+				return next(c)
+			}
+
+			// A missing session is rejected by UserStatusMiddleware
+			session, err := sessionRepo.GetByAccessTokenHash(sessionRepo.HashToken(token))
+			if err != nil {
+				return next(c)
+			}
+
+			userAgent := c.Request().UserAgent()
+			mismatches := FingerprintMismatch(session, userAgent, c.RealIP(),
+				cfg.FingerprintIPv4Prefix, cfg.FingerprintIPv6Prefix)
+			if len(mismatches) == 0 {
+				return next(c)
+			}
+
+			details := fmt.Sprintf("Session %d used from a different %s: session %s/%s from %s, request %s from %s",
+				session.ID, strings.Join(mismatches, ", "), session.OS, session.Browser, session.IPAddress,
+				useragent.Parse(userAgent).DeviceName, c.RealIP())
+
+			if cfg.StrictFingerprint {
+				logger.Security("Session fingerprint mismatch, ending session",
+					"session_id", session.ID, "user_id", userID, "mismatch", mismatches, "ip", c.RealIP())
+
+				if err := tokenBlacklistRepo.BlacklistBySessionID(session.ID, userID); err != nil {
+					slog.Warn("Failed to blacklist mismatching session", "session_id", session.ID, "error", err)
+				}
+				if claims, ok := c.Get("claims").(*Claims); ok {
+					Blacklist.AddClaims(token, claims)
+				}
+				if err := sessionRepo.InvalidateSession(session.ID, userID); err != nil {
+					slog.Warn("Failed to delete mismatching session", "session_id", session.ID, "error", err)
+				}
+				_ = auditRepo.LogActionWithSeverity(userID, "session_fingerprint_mismatch", "session",
+					c.RealIP(), userAgent, false, details+"; session ended", "critical")
+
+				return echo.NewHTTPError(http.StatusUnauthorized, map[string]interface{}{
+					"message": "این سشن از دستگاه یا شبکه دیگری استفاده شده و برای امنیت حساب پایان یافت. لطفا دوباره وارد شوید",
+					"code":    "fingerprint_mismatch",
+				})
+			}
+
+			flagged, err := sessionRepo.MarkSuspicious(session.ID)
+			if err != nil {
+				slog.Warn("Failed to flag suspicious session", "session_id", session.ID, "error", err)
+			}
+			if flagged {
+				logger.Security("Session fingerprint mismatch",
+					"session_id", session.ID, "user_id", userID, "mismatch", mismatches, "ip", c.RealIP())
+				_ = auditRepo.LogActionWithSeverity(userID, "session_fingerprint_mismatch", "session",
+					c.RealIP(), userAgent, true, details, "warning")
+			}
+
+			return next(c)
+		}
+	}
+}
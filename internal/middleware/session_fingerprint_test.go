@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"Monex/config"
+	"Monex/internal/database"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	firefoxOnLinux = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	chromeOnLinux  = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"
+	firefoxOnWin   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0"
+)
+
+func TestFingerprintMismatch(t *testing.T) {
+	session := &models.Session{OS: "Linux", Browser: "Firefox", IPAddress: "203.0.113.10"}
+
+	tests := []struct {
+		name      string
+		session   *models.Session
+		userAgent string
+		ip        string
+		want      []string
+	}{
+		{"same device, same /16", session, firefoxOnLinux, "203.0.200.7", nil},
+		{"other browser", session, chromeOnLinux, "203.0.113.10", []string{"browser"}},
+		{"other OS", session, firefoxOnWin, "203.0.113.10", []string{"os"}},
+		{"other network", session, firefoxOnLinux, "198.51.100.1", []string{"ip"}},
+		{"everything differs", session, "curl/8.0", "198.51.100.1", []string{"os", "browser", "ip"}},
+		{"unknown OS isn't compared", &models.Session{OS: "Unknown OS", Browser: "Firefox"}, firefoxOnWin, "", nil},
+		{"same IPv6 /48", &models.Session{IPAddress: "2001:db8:1:1::1"}, "", "2001:db8:1:ffff::2", nil},
+		{"other IPv6 /48", &models.Session{IPAddress: "2001:db8:1::1"}, "", "2001:db8:2::1", []string{"ip"}},
+		{"family change isn't held against it", &models.Session{IPAddress: "203.0.113.10"}, "", "2001:db8::1", nil},
+	}
+	for _, tt := range tests {
+		got := FingerprintMismatch(tt.session, tt.userAgent, tt.ip, 16, 48)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestStrictFingerprint(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("JWT_SECRET", "test-secret-0123456789abcdef0123456789abcdef")
+	t.Setenv("STRICT_FINGERPRINT", "true")
+	cfg := config.Load()
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	users := repository.NewUserRepository(db)
+	sessions := repository.NewSessionRepository(db)
+	admin, err := users.GetByUsername("admin")
+	if err != nil {
+		t.Fatalf("seeded admin: %v", err)
+	}
+	session, err := sessions.CreateSession(admin.ID, "Firefox on Linux", "Firefox", "Linux", "203.0.113.10",
+		"access-token", "refresh-token", "access-jti", "refresh-jti", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) },
+		func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Set("user_id", admin.ID)
+				return next(c)
+			}
+		},
+		SessionFingerprintMiddleware(sessions, repository.NewTokenBlacklistRepository(db),
+			repository.NewAuditRepository(db), &cfg.Security))
+
+	request := func(userAgent, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer access-token")
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set(echo.HeaderXRealIP, ip)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request(firefoxOnLinux, "203.0.113.10"); rec.Code != http.StatusNoContent {
+		t.Fatalf("matching request: status %d, body %s", rec.Code, rec.Body)
+	}
+	if _, err := sessions.GetSessionByID(session.ID, admin.ID); err != nil {
+		t.Fatalf("session after matching request: %v", err)
+	}
+
+	rec := request(chromeOnLinux, "198.51.100.1")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "fingerprint_mismatch") {
+		t.Fatalf("mismatching request: status %d, body %s; want 401 fingerprint_mismatch", rec.Code, rec.Body)
+	}
+	if _, err := sessions.GetSessionByID(session.ID, admin.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("session after mismatch: %v, want ErrNotFound", err)
+	}
+}
@@ -2,11 +2,13 @@
 package middleware
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"Monex/internal/logger"
 	"Monex/internal/repository"
 
 	"github.com/labstack/echo/v4"
@@ -14,11 +16,13 @@ import (
 
 // UserStatusMiddleware validates user status on every request
 // ✅ NEW POLICY: Does NOT terminate existing sessions when account is locked
-// Only validates Active status and permanent locks
+// Only validates Active status and permanent locks. Expired temporary locks
+// are cleared on the next request only when autoUnlock is true.
 func UserStatusMiddleware(
 	userRepo *repository.UserRepository,
 	tokenBlacklistRepo *repository.TokenBlacklistRepository,
 	sessionRepo *repository.SessionRepository,
+	autoUnlock bool,
 ) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -29,15 +33,19 @@ func UserStatusMiddleware(
 
 			// Get user
 			user, err := userRepo.GetByID(userID)
-			if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
 				return echo.NewHTTPError(http.StatusUnauthorized, "User not found")
 			}
+			if err != nil {
+				// A database hiccup must not sign the user out
+				return echo.NewHTTPError(http.StatusInternalServerError, "خطا در دریافت کاربر").SetInternal(err)
+			}
 
 			// ✅ CRITICAL: Check if INACTIVE (admin disabled account)
 			if !user.Active {
 				// Account was MANUALLY disabled by admin
 				// This is a serious action - terminate all sessions
-				log.Printf("[SECURITY] Inactive account detected - UserID: %d", userID)
+				logger.Security("Inactive account detected", "user_id", userID)
 				tokenBlacklistRepo.BlacklistUserTokens(userID, "Account disabled by administrator")
 				return echo.NewHTTPError(
 					http.StatusForbidden,
@@ -48,7 +56,7 @@ func UserStatusMiddleware(
 			// ✅ CRITICAL: Check if PERMANENTLY locked
 			if user.PermanentlyLocked {
 				// Permanent lock - serious security issue
-				log.Printf("[SECURITY] Permanently locked account - UserID: %d", userID)
+				logger.Security("Permanently locked account", "user_id", userID)
 				tokenBlacklistRepo.BlacklistUserTokens(userID, "Account permanently locked")
 				return echo.NewHTTPError(
 					http.StatusForbidden,
@@ -59,17 +67,17 @@ func UserStatusMiddleware(
 			// ✅ NEW POLICY: If temporarily locked, DO NOT terminate session
 			// Only NEW logins are blocked - existing sessions continue
 			if user.Locked {
-				if user.LockedUntil != nil && time.Now().After(*user.LockedUntil) {
+				if autoUnlock && user.LockedUntil != nil && time.Now().After(*user.LockedUntil) {
 					// Auto-unlock if expired
 					user.Locked = false
 					user.LockedUntil = nil
 					user.FailedAttempts = 0
 					userRepo.UpdateLockStatus(user)
-					log.Printf("[INFO] Auto-unlocked account - UserID: %d", userID)
+					slog.Info("Auto-unlocked account", "user_id", userID)
 				} else {
 					// ✅ IMPORTANT: Session continues even if locked
 					// User will see warning in UI but won't be logged out
-					log.Printf("[INFO] Locked account with active session - UserID: %d (session preserved)", userID)
+					slog.Info("Locked account with active session, session preserved", "user_id", userID)
 					// DO NOT return error - let request continue
 				}
 			}
@@ -83,9 +91,9 @@ func UserStatusMiddleware(
 
 					sessionExists, err := sessionRepo.ValidateTokenSession(token)
 					if err != nil {
-						log.Printf("[WARN] Session validation error: %v", err)
+						slog.Warn("Session validation error", "user_id", userID, "error", err)
 					} else if !sessionExists {
-						log.Printf("[SECURITY] Session not found for token - UserID: %d", userID)
+						logger.Security("Session not found for token", "user_id", userID)
 						return echo.NewHTTPError(
 							http.StatusUnauthorized,
 							"سشن شما منقضی شده است. لطفا دوباره وارد شوید",
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -25,31 +26,39 @@ type Session struct {
 	ExpiresAt    time.Time `json:"expires_at"`
 	CreatedAt    time.Time `json:"created_at"`
 	IsCurrent    bool      `json:"is_current"` // Set by handler
+
+	// Suspicious is set once a request didn't match the session's fingerprint
+	Suspicious bool `json:"suspicious"`
 }
 
 type SessionResponse struct {
-	ID           int       `json:"id"`
-	DeviceID     string    `json:"device_id"`
-	DeviceName   string    `json:"device_name"`
-	Browser      string    `json:"browser"`
-	OS           string    `json:"os"`
-	IPAddress    string    `json:"ip_address"`
-	LastActivity time.Time `json:"last_activity"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	CreatedAt    time.Time `json:"created_at"`
-	IsCurrent    bool      `json:"is_current"`
+	ID            int       `json:"id"`
+	DeviceID      string    `json:"device_id"`
+	DeviceName    string    `json:"device_name"`
+	Browser       string    `json:"browser"`
+	OS            string    `json:"os"`
+	IPAddress     string    `json:"ip_address"`
+	LastActivity  time.Time `json:"last_activity"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	IsCurrent     bool      `json:"is_current"`
+	IsActiveNow   bool      `json:"is_active_now"`   // last activity within the active window
+	LastSeenHuman string    `json:"last_seen_human"` // relative last activity, e.g. "۵ دقیقه پیش"
+
+	Suspicious bool `json:"suspicious"` // used from a device or network it wasn't created on
 }
 
 // AuditLog represents an audit log entry
 type AuditLog struct {
 	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
+	UserID    *int      `json:"user_id"`  // nil for system and unauthenticated events
 	Action    string    `json:"action"`   // "login", "create_transaction", etc.
 	Resource  string    `json:"resource"` // "auth", "transaction", etc.
 	IPAddress string    `json:"ip_address"`
 	UserAgent string    `json:"user_agent"`
 	Success   bool      `json:"success"`
-	Details   string    `json:"details"` // Error message or additional info
+	Details   string    `json:"details"`  // Error message or additional info
+	Severity  string    `json:"severity"` // info, warning, error or critical
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -57,6 +66,47 @@ func (a *AuditLog) Printf(s string, err error) {
 	panic("unimplemented")
 }
 
+// TransactionChange is the before/after state of a transaction recorded in
+// the audit log. Before is nil for a create and After for a delete; an undo
+// also names the audit entry it reverts.
+type TransactionChange struct {
+	TransactionID int          `json:"transaction_id"`
+	Before        *Transaction `json:"before,omitempty"`
+	After         *Transaction `json:"after,omitempty"`
+	Reverts       int          `json:"reverts,omitempty"`
+}
+
+// TransactionChangeLog is an audit entry carrying a TransactionChange
+type TransactionChangeLog struct {
+	ID        int
+	Action    string // create_transaction, update_transaction, delete_transaction or undo_transaction
+	Change    TransactionChange
+	CreatedAt time.Time
+}
+
+// BlacklistEntry is a revoked token as shown to admins. The token hash and
+// JWT ID are never exposed.
+type BlacklistEntry struct {
+	ID            int       `json:"id"`
+	UserID        *int      `json:"user_id"`    // nil for entries without a user
+	TokenType     string    `json:"token_type"` // access, refresh or all
+	Reason        string    `json:"reason"`
+	BlacklistedAt time.Time `json:"blacklisted_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	JTI           string    `json:"-"` // matches the in-memory blacklist; empty for hash-only entries
+}
+
+// Notification is a persisted real-time event, replayable over SSE
+type Notification struct {
+	ID        int64                  `json:"id"`
+	UserID    int                    `json:"user_id"`
+	Type      string                 `json:"type"`
+	Message   string                 `json:"message"`
+	Severity  string                 `json:"severity"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
 // User represents a system user
 type User struct {
 	ID                     int        `json:"id"`
@@ -70,6 +120,7 @@ type User struct {
 	TempBansCount          int        `json:"temp_bans_count"`
 	LockedUntil            *time.Time `json:"locked_until"`
 	PermanentlyLocked      bool       `json:"permanently_locked"`
+	EmailVerified          bool       `json:"email_verified"`
 	PasswordChangeRequired bool       `json:"password_change_required"`
 	LastPasswordChange     *time.Time `json:"last_password_change"`
 	CreatedAt              time.Time  `json:"created_at"`
@@ -88,6 +139,7 @@ type UserResponse struct {
 	TempBansCount     int        `json:"temp_bans_count"`
 	LockedUntil       *time.Time `json:"locked_until"`
 	PermanentlyLocked bool       `json:"permanently_locked"`
+	EmailVerified     bool       `json:"email_verified"`
 	CreatedAt         time.Time  `json:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
 }
@@ -105,11 +157,24 @@ func (u *User) ToResponse() *UserResponse {
 		TempBansCount:     u.TempBansCount,
 		LockedUntil:       u.LockedUntil,
 		PermanentlyLocked: u.PermanentlyLocked,
+		EmailVerified:     u.EmailVerified,
 		CreatedAt:         u.CreatedAt,
 		UpdatedAt:         u.UpdatedAt,
 	}
 }
 
+// IsActiveAdmin reports whether u is an admin who can sign in: active and
+// not permanently locked
+func (u *User) IsActiveAdmin() bool {
+	return u.Role == RoleAdmin && u.Active && !u.PermanentlyLocked
+}
+
+// NormalizeEmail returns the canonical stored form of an email address:
+// surrounding whitespace removed and lowercased
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 // SetPassword hashes and sets the user password
 func (u *User) SetPassword(password string, cost int) error {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
@@ -126,6 +191,15 @@ func (u *User) CheckPassword(password string) bool {
 	return err == nil
 }
 
+// NeedsRehash reports whether the stored hash uses a lower cost than configured
+func (u *User) NeedsRehash(cost int) bool {
+	hashCost, err := bcrypt.Cost([]byte(u.Password))
+	if err != nil {
+		return false
+	}
+	return hashCost < cost
+}
+
 func DummyCheckPassword(dummyHash, password string) bool {
 	// Always hash to prevent timing attacks
 	_ = bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
@@ -142,6 +216,85 @@ type Transaction struct {
 	IsEdited  bool      `json:"is_edited"` // ✅ ADD THIS
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	BalanceAfter *int `json:"balance_after,omitempty"` // Set only when a running balance is requested
+}
+
+// SignedAmount returns the amount's effect on the balance (deposits add, withdraws/expenses subtract)
+func (t *Transaction) SignedAmount() int {
+	if t.Type == "deposit" {
+		return t.Amount
+	}
+	return -t.Amount
+}
+
+// Recurring transaction intervals
+const (
+	IntervalDaily   = "daily"
+	IntervalWeekly  = "weekly"
+	IntervalMonthly = "monthly"
+)
+
+// RecurringTransaction is a rule that creates a transaction on a schedule
+type RecurringTransaction struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Type      string    `json:"type"` // deposit, withdraw, expense
+	Amount    int       `json:"amount"`
+	Note      string    `json:"note"`
+	Interval  string    `json:"interval"` // daily, weekly, monthly
+	NextRun   time.Time `json:"next_run"`
+	AnchorDay int       `json:"-"` // day of month monthly rules aim for (keeps the 31st after a short month)
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsValidInterval reports whether interval is a supported recurrence
+func IsValidInterval(interval string) bool {
+	return interval == IntervalDaily || interval == IntervalWeekly || interval == IntervalMonthly
+}
+
+// NextAfter returns the first run strictly after now, skipping any missed
+// occurrences so a rule that was due while the server was down fires once
+func (r *RecurringTransaction) NextAfter(now time.Time) time.Time {
+	next := r.advance(r.NextRun)
+	for !next.After(now) {
+		next = r.advance(next)
+	}
+	return next
+}
+
+// advance moves t forward by one interval
+func (r *RecurringTransaction) advance(t time.Time) time.Time {
+	switch r.Interval {
+	case IntervalDaily:
+		return t.AddDate(0, 0, 1)
+	case IntervalWeekly:
+		return t.AddDate(0, 0, 7)
+	default:
+		// time.AddDate normalizes Jan 31 + 1 month to Mar 3, so clamp to the
+		// last day of the target month instead
+		day := r.AnchorDay
+		if day <= 0 {
+			day = t.Day()
+		}
+		firstOfNext := time.Date(t.Year(), t.Month()+1, 1, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+		lastDay := firstOfNext.AddDate(0, 1, -1).Day()
+		if day > lastDay {
+			day = lastDay
+		}
+		return time.Date(firstOfNext.Year(), firstOfNext.Month(), day, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	}
+}
+
+// UserCounts splits all users by account state; a disabled account counts
+// only as disabled even when it is also locked
+type UserCounts struct {
+	Total    int `json:"total"`
+	Active   int `json:"active"`
+	Locked   int `json:"locked"`
+	Disabled int `json:"disabled"`
 }
 
 // TransactionStats represents transaction statistics
@@ -153,6 +306,36 @@ type TransactionStats struct {
 	Transactions  int `json:"transactions"`
 }
 
+// PasswordChange is one entry of a user's password history; the old hash
+// is deliberately not part of it
+type PasswordChange struct {
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// LoginStatsDay holds successful and failed login counts for one day
+type LoginStatsDay struct {
+	Date    string `json:"date"` // YYYY-MM-DD (UTC)
+	Success int    `json:"success"`
+	Failed  int    `json:"failed"`
+}
+
+// LoginStatsCount is a value (IP or username) with its failed login count
+type LoginStatsCount struct {
+	Value    string `json:"value"`
+	Failures int    `json:"failures"`
+}
+
+// LoginStats aggregates login attempts over a date range
+type LoginStats struct {
+	From         string             `json:"from"`
+	To           string             `json:"to"`
+	TotalSuccess int                `json:"total_success"`
+	TotalFailed  int                `json:"total_failed"`
+	Daily        []*LoginStatsDay   `json:"daily"`
+	TopIPs       []*LoginStatsCount `json:"top_ips"`
+	TopUsernames []*LoginStatsCount `json:"top_usernames"`
+}
+
 // RefreshToken represents a JWT refresh token
 type RefreshToken struct {
 	ID        int       `json:"id"`
@@ -0,0 +1,72 @@
+package notifier
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"Monex/config"
+)
+
+// Security event types delivered out-of-band
+const (
+	EventAccountLocked   = "account_locked"
+	EventAccountDisabled = "account_disabled"
+	EventNewDeviceLogin  = "new_device_login"
+)
+
+// Account event types that carry a token for the receiver to email to the user
+const (
+	EventEmailVerification = "email_verification"
+	EventPasswordReset     = "password_reset"
+)
+
+// Event is the payload describing a critical security event
+type Event struct {
+	Type      string    `json:"event_type"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	IPAddress string    `json:"ip"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Set only for account events such as EventEmailVerification and EventPasswordReset
+	Email     string     `json:"email,omitempty"`
+	Token     string     `json:"token,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Notifier delivers security events to an external channel (webhook, SMTP, ...)
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// NoopNotifier discards all events
+type NoopNotifier struct{}
+
+func (NoopNotifier) Notify(ctx context.Context, event Event) error {
+	return nil
+}
+
+// New returns the notifier configured for this deployment, or a no-op one
+func New(cfg *config.NotificationConfig) Notifier {
+	if cfg == nil || cfg.WebhookURL == "" {
+		return NoopNotifier{}
+	}
+	return NewWebhookNotifier(cfg.WebhookURL, cfg.WebhookTimeout, cfg.WebhookRetries)
+}
+
+// Dispatch sends the event in the background so callers never block on delivery
+func Dispatch(n Notifier, event Event) {
+	if n == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	go func() {
+		if err := n.Notify(context.Background(), event); err != nil {
+			slog.Warn("Failed to deliver notification", "event_type", event.Type, "user_id", event.UserID, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,80 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier POSTs security events as JSON to a configured URL
+type WebhookNotifier struct {
+	url        string
+	client     *http.Client
+	maxRetries int
+	retryDelay time.Duration
+}
+
+func NewWebhookNotifier(url string, timeout time.Duration, maxRetries int) *WebhookNotifier {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	return &WebhookNotifier{
+		url:        url,
+		client:     &http.Client{Timeout: timeout},
+		maxRetries: maxRetries,
+		retryDelay: 500 * time.Millisecond,
+	}
+}
+
+// Notify delivers the event, retrying failed attempts with a linear backoff
+func (w *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= w.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * w.retryDelay):
+			}
+		}
+
+		if lastErr = w.send(ctx, payload); lastErr == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("webhook delivery failed after %d attempts: %w", w.maxRetries+1, lastErr)
+}
+
+func (w *WebhookNotifier) send(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookPayload(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with Content-Type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := NewWebhookNotifier(server.URL, time.Second, 0).Notify(context.Background(), Event{
+		Type:      EventAccountLocked,
+		UserID:    7,
+		Username:  "alice",
+		IPAddress: "203.0.113.7",
+		Timestamp: at,
+	})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	want := map[string]any{
+		"event_type": EventAccountLocked,
+		"user_id":    float64(7),
+		"username":   "alice",
+		"ip":         "203.0.113.7",
+		"timestamp":  "2026-01-02T03:04:05Z",
+	}
+	if len(body) != len(want) {
+		t.Fatalf("payload %v, want exactly the fields %v", body, want)
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("payload[%q] = %v, want %v", key, body[key], value)
+		}
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first two attempts
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhook := NewWebhookNotifier(server.URL, time.Second, 2)
+	webhook.retryDelay = time.Millisecond
+	if err := webhook.Notify(context.Background(), Event{Type: EventAccountDisabled}); err != nil {
+		t.Fatalf("Notify with two retries: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("attempts = %d, want 3", got)
+	}
+
+	// Without enough retries the last error is returned
+	calls.Store(0)
+	webhook.maxRetries = 1
+	if err := webhook.Notify(context.Background(), Event{Type: EventAccountDisabled}); err == nil {
+		t.Fatal("Notify succeeded although every attempt failed")
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("attempts = %d, want 2", got)
+	}
+}
@@ -0,0 +1,356 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// font is a parsed TrueType font. Only what embedding needs is read: the
+// Unicode cmap, advance widths, the metrics of the font descriptor and the
+// glyph outlines for subsetting.
+type font struct {
+	name   string
+	data   []byte
+	tables map[string][]byte
+
+	unitsPerEm int
+	bbox       [4]int // xMin, yMin, xMax, yMax in font units
+	ascent     int
+	descent    int
+	capHeight  int
+
+	cmap     map[rune]uint16
+	advances []uint16 // per glyph
+	loca     []uint32 // glyph offsets into glyf, numGlyphs+1 entries
+	longLoca bool
+}
+
+var errBadFont = errors.New("malformed TrueType font")
+
+func parseFont(name string, data []byte) (*font, error) {
+	if len(data) < 12 {
+		return nil, errBadFont
+	}
+	f := &font{name: name, data: data, tables: make(map[string][]byte)}
+
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		record := 12 + 16*i
+		if record+16 > len(data) {
+			return nil, errBadFont
+		}
+		tag := string(data[record : record+4])
+		offset := binary.BigEndian.Uint32(data[record+8:])
+		length := binary.BigEndian.Uint32(data[record+12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: table %s out of range", errBadFont, tag)
+		}
+		f.tables[tag] = data[offset : offset+length]
+	}
+	for _, tag := range []string{"head", "hhea", "hmtx", "maxp", "loca", "glyf", "cmap"} {
+		if f.tables[tag] == nil {
+			return nil, fmt.Errorf("%w: no %s table", errBadFont, tag)
+		}
+	}
+
+	head := f.tables["head"]
+	if len(head) < 54 {
+		return nil, errBadFont
+	}
+	f.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	for i := range f.bbox {
+		f.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	f.longLoca = binary.BigEndian.Uint16(head[50:]) == 1
+
+	hhea := f.tables["hhea"]
+	if len(hhea) < 36 || f.unitsPerEm == 0 {
+		return nil, errBadFont
+	}
+	f.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	f.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+	f.capHeight = f.ascent
+	if os2 := f.tables["OS/2"]; len(os2) >= 90 && binary.BigEndian.Uint16(os2) >= 2 {
+		f.capHeight = int(int16(binary.BigEndian.Uint16(os2[88:])))
+	}
+
+	numGlyphs := int(binary.BigEndian.Uint16(f.tables["maxp"][4:]))
+	if err := f.parseAdvances(numGlyphs, int(binary.BigEndian.Uint16(hhea[34:]))); err != nil {
+		return nil, err
+	}
+	if err := f.parseLoca(numGlyphs); err != nil {
+		return nil, err
+	}
+	if err := f.parseCmap(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *font) parseAdvances(numGlyphs, numMetrics int) error {
+	hmtx := f.tables["hmtx"]
+	if numMetrics == 0 || len(hmtx) < 4*numMetrics {
+		return errBadFont
+	}
+	f.advances = make([]uint16, numGlyphs)
+	for i := range f.advances {
+		if i < numMetrics {
+			f.advances[i] = binary.BigEndian.Uint16(hmtx[4*i:])
+		} else {
+			f.advances[i] = f.advances[numMetrics-1]
+		}
+	}
+	return nil
+}
+
+func (f *font) parseLoca(numGlyphs int) error {
+	loca := f.tables["loca"]
+	f.loca = make([]uint32, numGlyphs+1)
+	for i := range f.loca {
+		if f.longLoca {
+			if 4*i+4 > len(loca) {
+				return errBadFont
+			}
+			f.loca[i] = binary.BigEndian.Uint32(loca[4*i:])
+		} else {
+			if 2*i+2 > len(loca) {
+				return errBadFont
+			}
+			f.loca[i] = 2 * uint32(binary.BigEndian.Uint16(loca[2*i:]))
+		}
+	}
+	return nil
+}
+
+// parseCmap reads the Windows Unicode BMP subtable (format 4)
+func (f *font) parseCmap() error {
+	cmap := f.tables["cmap"]
+	if len(cmap) < 4 {
+		return errBadFont
+	}
+	var sub []byte
+	for i := 0; i < int(binary.BigEndian.Uint16(cmap[2:])); i++ {
+		record := 4 + 8*i
+		if record+8 > len(cmap) {
+			return errBadFont
+		}
+		platform := binary.BigEndian.Uint16(cmap[record:])
+		encoding := binary.BigEndian.Uint16(cmap[record+2:])
+		offset := binary.BigEndian.Uint32(cmap[record+4:])
+		if platform == 3 && encoding == 1 && int(offset)+4 <= len(cmap) &&
+			binary.BigEndian.Uint16(cmap[offset:]) == 4 {
+			sub = cmap[offset:]
+			break
+		}
+	}
+	if sub == nil || len(sub) < 14 {
+		return fmt.Errorf("%w: no Unicode cmap", errBadFont)
+	}
+
+	segments := int(binary.BigEndian.Uint16(sub[6:])) / 2
+	ends := 14
+	starts := ends + 2*segments + 2
+	deltas := starts + 2*segments
+	rangeOffsets := deltas + 2*segments
+	if rangeOffsets+2*segments > len(sub) {
+		return errBadFont
+	}
+
+	f.cmap = make(map[rune]uint16)
+	for s := 0; s < segments; s++ {
+		end := int(binary.BigEndian.Uint16(sub[ends+2*s:]))
+		start := int(binary.BigEndian.Uint16(sub[starts+2*s:]))
+		delta := binary.BigEndian.Uint16(sub[deltas+2*s:])
+		rangeOffset := int(binary.BigEndian.Uint16(sub[rangeOffsets+2*s:]))
+		for c := start; c <= end && c != 0xFFFF; c++ {
+			var glyph uint16
+			if rangeOffset == 0 {
+				glyph = uint16(c) + delta
+			} else {
+				at := rangeOffsets + 2*s + rangeOffset + 2*(c-start)
+				if at+2 > len(sub) {
+					continue
+				}
+				if glyph = binary.BigEndian.Uint16(sub[at:]); glyph != 0 {
+					glyph += delta
+				}
+			}
+			if glyph != 0 && int(glyph) < len(f.advances) {
+				f.cmap[rune(c)] = glyph
+			}
+		}
+	}
+	return nil
+}
+
+// glyph returns the glyph for r, or 0 (.notdef) when the font lacks it
+func (f *font) glyph(r rune) uint16 {
+	return f.cmap[r]
+}
+
+// width returns the advance of glyph in PDF text space units (1/1000 em)
+func (f *font) width(glyph uint16) int {
+	if int(glyph) >= len(f.advances) {
+		return 0
+	}
+	return f.scale(int(f.advances[glyph]))
+}
+
+func (f *font) scale(units int) int {
+	return units * 1000 / f.unitsPerEm
+}
+
+// glyphData returns the outline of glyph in the glyf table
+func (f *font) glyphData(glyph uint16) []byte {
+	glyf := f.tables["glyf"]
+	start, end := f.loca[glyph], f.loca[glyph+1]
+	if start >= end || int(end) > len(glyf) {
+		return nil
+	}
+	return glyf[start:end]
+}
+
+// Composite glyph flags
+const (
+	argsAreWords    = 0x0001
+	haveScale       = 0x0008
+	moreComponents  = 0x0020
+	haveXYScale     = 0x0040
+	haveTwoByTwo    = 0x0080
+	compositeHeader = 10
+)
+
+// addComponents adds the glyphs a composite glyph is built from to used
+func (f *font) addComponents(glyph uint16, used map[uint16]bool) {
+	data := f.glyphData(glyph)
+	if len(data) < compositeHeader || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return
+	}
+	for at := compositeHeader; at+4 <= len(data); {
+		flags := binary.BigEndian.Uint16(data[at:])
+		component := binary.BigEndian.Uint16(data[at+2:])
+		if int(component) < len(f.advances) && !used[component] {
+			used[component] = true
+			f.addComponents(component, used)
+		}
+
+		at += 4
+		if flags&argsAreWords != 0 {
+			at += 4
+		} else {
+			at += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			at += 2
+		case flags&haveXYScale != 0:
+			at += 4
+		case flags&haveTwoByTwo != 0:
+			at += 8
+		}
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+}
+
+// subset returns a font file holding only the outlines of the used glyphs.
+// Glyph ids are kept, so the other glyphs are left empty rather than removed
+// and the PDF can address glyphs by their original id.
+func (f *font) subset(used map[uint16]bool) []byte {
+	keep := map[uint16]bool{0: true} // .notdef
+	for glyph := range used {
+		keep[glyph] = true
+		f.addComponents(glyph, keep)
+	}
+
+	var glyf []byte
+	loca := make([]uint32, len(f.loca))
+	for glyph := 0; glyph+1 < len(f.loca); glyph++ {
+		loca[glyph] = uint32(len(glyf))
+		if keep[uint16(glyph)] {
+			glyf = append(glyf, f.glyphData(uint16(glyph))...)
+			if len(glyf)%2 == 1 {
+				glyf = append(glyf, 0) // short loca offsets count words
+			}
+		}
+	}
+	loca[len(loca)-1] = uint32(len(glyf))
+
+	var locaData []byte
+	for _, offset := range loca {
+		if f.longLoca {
+			locaData = binary.BigEndian.AppendUint32(locaData, offset)
+		} else {
+			locaData = binary.BigEndian.AppendUint16(locaData, uint16(offset/2))
+		}
+	}
+
+	tables := map[string][]byte{"glyf": glyf, "loca": locaData}
+	for _, tag := range []string{"head", "hhea", "hmtx", "maxp", "cmap", "OS/2", "cvt ", "fpgm", "prep"} {
+		if data, ok := f.tables[tag]; ok {
+			tables[tag] = data
+		}
+	}
+	return buildFontFile(tables)
+}
+
+// buildFontFile assembles tables into a TrueType file with valid checksums
+func buildFontFile(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= len(tags) {
+		searchRange *= 2
+		entrySelector++
+	}
+
+	out := binary.BigEndian.AppendUint32(nil, 0x00010000)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(tags)))
+	out = binary.BigEndian.AppendUint16(out, uint16(searchRange*16))
+	out = binary.BigEndian.AppendUint16(out, uint16(entrySelector))
+	out = binary.BigEndian.AppendUint16(out, uint16(len(tags)*16-searchRange*16))
+
+	offset := len(out) + 16*len(tags)
+	var body []byte
+	headAt := -1
+	for _, tag := range tags {
+		data := tables[tag]
+		if tag == "head" {
+			// checkSumAdjustment is computed over the file with this field zeroed
+			data = append([]byte(nil), data...)
+			binary.BigEndian.PutUint32(data[8:], 0)
+			headAt = offset + len(body)
+		}
+		out = append(out, tag...)
+		out = binary.BigEndian.AppendUint32(out, checksum(data))
+		out = binary.BigEndian.AppendUint32(out, uint32(offset+len(body)))
+		out = binary.BigEndian.AppendUint32(out, uint32(len(data)))
+		body = append(body, data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	out = append(out, body...)
+
+	if headAt >= 0 {
+		binary.BigEndian.PutUint32(out[headAt+8:], 0xB1B0AFBA-checksum(out))
+	}
+	return out
+}
+
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
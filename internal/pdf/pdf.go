@@ -0,0 +1,252 @@
+// Package pdf writes simple text-and-line PDF documents without external
+// dependencies. Text is set in embedded DejaVu Sans Condensed fonts, which
+// cover Latin, Persian and Arabic; only the glyphs a document uses are
+// embedded.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	_ "embed"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+//go:embed fonts/DejaVuSansCondensed.ttf
+var regularFontData []byte
+
+//go:embed fonts/DejaVuSansCondensed-Bold.ttf
+var boldFontData []byte
+
+// regularFont and boldFont are parsed once; the files are part of the binary
+var (
+	regularFont = mustParseFont("DejaVuSansCondensed", regularFontData)
+	boldFont    = mustParseFont("DejaVuSansCondensed-Bold", boldFontData)
+)
+
+func mustParseFont(name string, data []byte) *font {
+	f, err := parseFont(name, data)
+	if err != nil {
+		panic(fmt.Sprintf("pdf: embedded font %s: %v", name, err))
+	}
+	return f
+}
+
+// A4 page size in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document collects pages and renders them with WriteTo
+type Document struct {
+	pages []*bytes.Buffer
+	fonts [2]*fontUse // regular, bold
+}
+
+// fontUse records which glyphs of a font a document draws, and the text
+// each stands for so it can be copied out of the PDF
+type fontUse struct {
+	font  *font
+	runes map[uint16][]rune
+}
+
+// New returns an empty document; call AddPage before drawing
+func New() *Document {
+	return &Document{fonts: [2]*fontUse{
+		{font: regularFont, runes: make(map[uint16][]rune)},
+		{font: boldFont, runes: make(map[uint16][]rune)},
+	}}
+}
+
+// AddPage starts a new page; subsequent drawing goes to it
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// PageCount returns the number of pages added so far
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+// Text draws s with its baseline at (x, y), measured in points from the
+// top-left corner of the current page. Right-to-left text is shaped and
+// reordered, but still starts at x.
+func (d *Document) Text(x, y, size float64, bold bool, s string) {
+	index := 0
+	if bold {
+		index = 1
+	}
+	fmt.Fprintf(d.current(), "BT /F%d %.2f Tf %.2f %.2f Td <%s> Tj ET\n",
+		index+1, size, x, PageHeight-y, d.fonts[index].encode(s))
+}
+
+// encode returns s as hex glyph ids and records the glyphs used
+func (u *fontUse) encode(s string) string {
+	var b strings.Builder
+	for _, r := range visualOrder(shapeArabic([]rune(s))) {
+		if r < 0x20 {
+			r = ' '
+		}
+		glyph := u.font.glyph(r)
+		if _, seen := u.runes[glyph]; !seen && glyph != 0 {
+			if text, ok := logicalText[r]; ok {
+				u.runes[glyph] = text
+			} else {
+				u.runes[glyph] = []rune{r}
+			}
+		}
+		fmt.Fprintf(&b, "%04X", glyph)
+	}
+	return b.String()
+}
+
+// Line draws a thin line from (x1, y1) to (x2, y2), measured from the top-left corner
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.current(), "0.5 w %.2f %.2f m %.2f %.2f l S\n",
+		x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+func (d *Document) current() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// WriteTo renders the document as PDF 1.4
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	stream := func(dict string, data []byte) {
+		object(fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data))
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are fixed, each page then takes a page and a content
+	// object, and each font four more objects after the pages
+	fontObjects := 5 + 2*len(d.pages)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	for i, use := range d.fonts {
+		first := fontObjects + 4*i
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H "+
+			"/DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", use.font.name, first, first+3))
+	}
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, 6+2*i))
+		stream("", page.Bytes())
+	}
+
+	for i, use := range d.fonts {
+		first := fontObjects + 4*i
+		f := use.font
+		object(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s "+
+			"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+			"/FontDescriptor %d 0 R /CIDToGIDMap /Identity /DW %d /W [%s] >>",
+			f.name, first+1, f.width(0), use.widths()))
+		object(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] "+
+			"/ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+			f.name, f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+			f.scale(f.ascent), f.scale(f.descent), f.scale(f.capHeight), first+2))
+
+		used := make(map[uint16]bool, len(use.runes))
+		for glyph := range use.runes {
+			used[glyph] = true
+		}
+		file := f.subset(used)
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(file)
+		zw.Close()
+		stream(fmt.Sprintf("/Filter /FlateDecode /Length1 %d", len(file)), compressed.Bytes())
+		stream("", []byte(use.toUnicode()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// glyphs returns the used glyphs in ascending order
+func (u *fontUse) glyphs() []uint16 {
+	glyphs := make([]uint16, 0, len(u.runes))
+	for glyph := range u.runes {
+		glyphs = append(glyphs, glyph)
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+	return glyphs
+}
+
+// widths lists the advance of every used glyph for the /W array
+func (u *fontUse) widths() string {
+	var b strings.Builder
+	for _, glyph := range u.glyphs() {
+		fmt.Fprintf(&b, "%d [%d] ", glyph, u.font.width(glyph))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// toUnicode is the CMap that maps glyphs back to text for search and copy
+func (u *fontUse) toUnicode() string {
+	var b strings.Builder
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+
+	glyphs := u.glyphs()
+	for len(glyphs) > 0 {
+		chunk := glyphs[:min(len(glyphs), 100)] // at most 100 entries per section
+		glyphs = glyphs[len(chunk):]
+		fmt.Fprintf(&b, "%d beginbfchar\n", len(chunk))
+		for _, glyph := range chunk {
+			fmt.Fprintf(&b, "<%04X> <", glyph)
+			for _, unit := range utf16Units(u.runes[glyph]) {
+				fmt.Fprintf(&b, "%04X", unit)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+	}
+
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend")
+	return b.String()
+}
+
+func utf16Units(runes []rune) []uint16 {
+	var units []uint16
+	for _, r := range runes {
+		if r >= 0x10000 {
+			r -= 0x10000
+			units = append(units, uint16(0xD800+(r>>10)), uint16(0xDC00+(r&0x3FF)))
+		} else {
+			units = append(units, uint16(r))
+		}
+	}
+	return units
+}
@@ -0,0 +1,127 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestShapeArabic(t *testing.T) {
+	tests := []struct {
+		text string
+		want []rune
+	}{
+		// seen initial, lam-alef final, meem isolated
+		{"سلام", []rune{0xFEB3, 0xFEFC, 0xFEE1}},
+		// the zero width non-joiner breaks the word without a glyph
+		{"می‌شود", []rune{0xFEE3, 0xFBFD, 0xFEB7, 0xFEEE, 0xFEA9}},
+		// Persian letters outside Presentation Forms-B
+		{"پژ", []rune{0xFB58, 0xFB8B}},
+		{"abc", []rune("abc")},
+	}
+	for _, tt := range tests {
+		if got := shapeArabic([]rune(tt.text)); string(got) != string(tt.want) {
+			t.Errorf("shapeArabic(%q) = %U, want %U", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestVisualOrder(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"Monex 2024", "Monex 2024"},
+		{"ابج", "جبا"},
+		// numbers keep their order inside right-to-left text
+		{"ابج 1500 د", "د 1500 جبا"},
+		// a Latin word inside Persian text
+		{"اب Monex ج", "ج Monex با"},
+		{"Note: اب", "Note: با"},
+		{"اب (ج)", "(ج) با"},
+		{"ابج ۱۲ د", "د ۱۲ جبا"},
+		// a leading number doesn't make the line left-to-right
+		{"۱۵ اب", "با ۱۵"},
+	}
+	for _, tt := range tests {
+		if got := string(visualOrder([]rune(tt.text))); got != tt.want {
+			t.Errorf("visualOrder(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDocumentEmbedsUsedGlyphs(t *testing.T) {
+	doc := New()
+	doc.Text(40, 60, 16, true, "Monex - صورتحساب")
+	doc.Text(40, 80, 10, false, "خرید کتاب (۲ جلد)")
+	doc.AddPage()
+	doc.Line(40, 40, 500, 40)
+
+	var out bytes.Buffer
+	if _, err := doc.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	data := out.Bytes()
+
+	// Every xref entry points at its object
+	xrefAt := bytes.LastIndex(data, []byte("startxref\n"))
+	start, err := strconv.Atoi(strings.Fields(string(data[xrefAt+len("startxref\n"):]))[0])
+	if err != nil {
+		t.Fatalf("startxref: %v", err)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(data[start:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %q", i+1, data[offset:offset+20])
+		}
+	}
+	if len(entries) != 4+2*doc.PageCount()+8 {
+		t.Fatalf("%d objects, want %d", len(entries), 4+2*doc.PageCount()+8)
+	}
+
+	// Every character has a glyph, and Persian text maps back to its letters
+	for _, text := range []string{"Monex - صورتحساب", "خرید کتاب (۲ جلد)"} {
+		for _, r := range visualOrder(shapeArabic([]rune(text))) {
+			if regularFont.glyph(r) == 0 || boldFont.glyph(r) == 0 {
+				t.Errorf("no glyph for %U in %q", r, text)
+			}
+		}
+	}
+	if !bytes.Contains(data, []byte(fmt.Sprintf("<%04X> <0635>", regularFont.glyph(0xFEBB)))) &&
+		!bytes.Contains(data, []byte(fmt.Sprintf("<%04X> <0635>", boldFont.glyph(0xFEBB)))) {
+		t.Fatal("ToUnicode doesn't map the initial sad back to U+0635")
+	}
+
+	// The embedded subsets parse and hold the outlines of the used glyphs
+	streams := regexp.MustCompile(`(?s)/Length1 (\d+) /Length (\d+) >>\nstream\n`).FindAllSubmatchIndex(data, -1)
+	if len(streams) != 2 {
+		t.Fatalf("%d embedded fonts, want 2", len(streams))
+	}
+	for i, loc := range streams {
+		length, _ := strconv.Atoi(string(data[loc[4]:loc[5]]))
+		zr, err := zlib.NewReader(bytes.NewReader(data[loc[1] : loc[1]+length]))
+		if err != nil {
+			t.Fatalf("font %d: %v", i, err)
+		}
+		file, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("font %d: %v", i, err)
+		}
+		subset, err := parseFont("subset", file)
+		if err != nil {
+			t.Fatalf("font %d subset: %v", i, err)
+		}
+		use := doc.fonts[i]
+		for glyph := range use.runes {
+			if len(subset.glyphData(glyph)) == 0 && len(use.font.glyphData(glyph)) > 0 {
+				t.Errorf("font %d: glyph %d missing from subset", i, glyph)
+			}
+		}
+		if len(file) >= len(use.font.data)/4 {
+			t.Errorf("font %d: subset is %d bytes of %d", i, len(file), len(use.font.data))
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package pdf
+
+import "unicode"
+
+// PDF text has no shaping engine: glyphs are drawn left to right exactly as
+// given. Persian and Arabic text is therefore converted to the contextual
+// presentation forms (so letters join) and reordered for display.
+
+// arabicForms lists the presentation forms of a letter: isolated, final,
+// initial, medial. Letters that only join to the preceding letter have no
+// initial or medial form.
+var arabicForms = map[rune][]rune{
+	0x0621: {0xFE80},
+	0x0622: {0xFE81, 0xFE82},
+	0x0623: {0xFE83, 0xFE84},
+	0x0624: {0xFE85, 0xFE86},
+	0x0625: {0xFE87, 0xFE88},
+	0x0626: {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C},
+	0x0627: {0xFE8D, 0xFE8E},
+	0x0628: {0xFE8F, 0xFE90, 0xFE91, 0xFE92},
+	0x0629: {0xFE93, 0xFE94},
+	0x062A: {0xFE95, 0xFE96, 0xFE97, 0xFE98},
+	0x062B: {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	0x062C: {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0},
+	0x062D: {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	0x062E: {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8},
+	0x062F: {0xFEA9, 0xFEAA},
+	0x0630: {0xFEAB, 0xFEAC},
+	0x0631: {0xFEAD, 0xFEAE},
+	0x0632: {0xFEAF, 0xFEB0},
+	0x0633: {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4},
+	0x0634: {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	0x0635: {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC},
+	0x0636: {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	0x0637: {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4},
+	0x0638: {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	0x0639: {0xFEC9, 0xFECA, 0xFECB, 0xFECC},
+	0x063A: {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	0x0641: {0xFED1, 0xFED2, 0xFED3, 0xFED4},
+	0x0642: {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	0x0643: {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC},
+	0x0644: {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	0x0645: {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4},
+	0x0646: {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	0x0647: {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC},
+	0x0648: {0xFEED, 0xFEEE},
+	0x0649: {0xFEEF, 0xFEF0},
+	0x064A: {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+	0x067E: {0xFB56, 0xFB57, 0xFB58, 0xFB59}, // peh
+	0x0686: {0xFB7A, 0xFB7B, 0xFB7C, 0xFB7D}, // tcheh
+	0x0698: {0xFB8A, 0xFB8B},                 // jeh
+	0x06A9: {0xFB8E, 0xFB8F, 0xFB90, 0xFB91}, // keheh
+	0x06AF: {0xFB92, 0xFB93, 0xFB94, 0xFB95}, // gaf
+	0x06C0: {0xFBA4, 0xFBA5},                 // heh with yeh above
+	0x06CC: {0xFBFC, 0xFBFD, 0xFBFE, 0xFBFF}, // farsi yeh
+}
+
+// lamAlef maps the alef following a lam to the isolated form of their
+// ligature; the final form is the next code point
+var lamAlef = map[rune]rune{
+	0x0622: 0xFEF5,
+	0x0623: 0xFEF7,
+	0x0625: 0xFEF9,
+	0x0627: 0xFEFB,
+}
+
+// logicalText maps each presentation form back to the letters it shows, so
+// text copied out of the PDF is searchable
+var logicalText = func() map[rune][]rune {
+	text := make(map[rune][]rune)
+	for letter, forms := range arabicForms {
+		for _, form := range forms {
+			text[form] = []rune{letter}
+		}
+	}
+	for alef, ligature := range lamAlef {
+		text[ligature] = []rune{lam, alef}
+		text[ligature+1] = []rune{lam, alef}
+	}
+	return text
+}()
+
+const (
+	lam        = 0x0644
+	tatweel    = 0x0640
+	zeroWidthN = 0x200C // zero width non-joiner, common in Persian
+	zeroWidthJ = 0x200D
+)
+
+// joinsForward reports whether r connects to the letter after it
+func joinsForward(r rune) bool {
+	return r == tatweel || r == zeroWidthJ || len(arabicForms[r]) == 4
+}
+
+// joinsBackward reports whether r connects to the letter before it
+func joinsBackward(r rune) bool {
+	return r == tatweel || r == zeroWidthJ || len(arabicForms[r]) >= 2
+}
+
+// transparent marks combining marks, which don't break joining
+func transparent(r rune) bool {
+	return unicode.Is(unicode.Mn, r)
+}
+
+// shapeArabic replaces Arabic letters with the presentation form their
+// neighbours call for, in logical order
+func shapeArabic(text []rune) []rune {
+	neighbour := func(i, step int) rune {
+		for i += step; i >= 0 && i < len(text); i += step {
+			if !transparent(text[i]) {
+				return text[i]
+			}
+		}
+		return 0
+	}
+
+	out := make([]rune, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		r := text[i]
+		forms, ok := arabicForms[r]
+		if !ok {
+			if r != zeroWidthN && r != zeroWidthJ {
+				out = append(out, r)
+			}
+			continue
+		}
+
+		joinedBefore := joinsForward(neighbour(i, -1))
+
+		if r == lam {
+			if next := neighbour(i, 1); lamAlef[next] != 0 {
+				ligature := lamAlef[next]
+				if joinedBefore {
+					ligature++
+				}
+				out = append(out, ligature)
+				for i++; text[i] != next; i++ {
+					out = append(out, text[i]) // marks between lam and alef
+				}
+				continue
+			}
+		}
+
+		joinedAfter := len(forms) == 4 && joinsBackward(neighbour(i, 1))
+		switch {
+		case joinedBefore && joinedAfter:
+			out = append(out, forms[3])
+		case joinedBefore && len(forms) >= 2:
+			out = append(out, forms[1])
+		case joinedAfter:
+			out = append(out, forms[2])
+		default:
+			out = append(out, forms[0])
+		}
+	}
+	return out
+}
+
+// rightToLeft reports whether r belongs to a right-to-left script. Persian
+// and Arabic digits are written left to right like any other digits.
+func rightToLeft(r rune) bool {
+	return !unicode.IsDigit(r) &&
+		((r >= 0x0590 && r <= 0x08FF) || (r >= 0xFB1D && r <= 0xFDFF) || (r >= 0xFE70 && r <= 0xFEFF))
+}
+
+// strongLeftToRight reports whether r fixes a left-to-right direction; digits
+// count as such, so numbers inside right-to-left text keep their order
+func strongLeftToRight(r rune) bool {
+	return !rightToLeft(r) && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// mirrored swaps paired punctuation inside right-to-left runs
+var mirrored = map[rune]rune{'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{', '<': '>', '>': '<', '«': '»', '»': '«'}
+
+// visualOrder reorders logical text into the left-to-right order it is drawn
+// in. It is a simplification of the Unicode bidi algorithm for single lines:
+// the first letter sets the base direction, and neutral characters take the
+// direction of their neighbours when both agree, else the base one.
+func visualOrder(text []rune) []rune {
+	rtl := make([]bool, len(text))
+	base, hasRTL := false, false
+	for _, r := range text {
+		if rightToLeft(r) {
+			hasRTL = true
+			break
+		}
+	}
+	if !hasRTL {
+		return text
+	}
+	for _, r := range text {
+		if rightToLeft(r) {
+			base = true
+			break
+		}
+		if unicode.IsLetter(r) {
+			break
+		}
+	}
+
+	for i := 0; i < len(text); {
+		r := text[i]
+		if rightToLeft(r) || strongLeftToRight(r) {
+			rtl[i] = rightToLeft(r)
+			i++
+			continue
+		}
+
+		// A run of neutral characters
+		j := i
+		for j < len(text) && !rightToLeft(text[j]) && !strongLeftToRight(text[j]) {
+			j++
+		}
+		direction := base
+		if i > 0 && j < len(text) && rightToLeft(text[i-1]) == rightToLeft(text[j]) {
+			direction = rightToLeft(text[j])
+		}
+		for k := i; k < j; k++ {
+			rtl[k] = direction
+		}
+		i = j
+	}
+
+	// Split into directional runs, then lay them out
+	type run struct {
+		text []rune
+		rtl  bool
+	}
+	var runs []run
+	for i := 0; i < len(text); {
+		j := i
+		for j < len(text) && rtl[j] == rtl[i] {
+			j++
+		}
+		segment := append([]rune(nil), text[i:j]...)
+		if rtl[i] {
+			for a, b := 0, len(segment)-1; a < b; a, b = a+1, b-1 {
+				segment[a], segment[b] = segment[b], segment[a]
+			}
+			for k, r := range segment {
+				if m, ok := mirrored[r]; ok {
+					segment[k] = m
+				}
+			}
+		}
+		runs = append(runs, run{segment, rtl[i]})
+		i = j
+	}
+	if base {
+		for a, b := 0, len(runs)-1; a < b; a, b = a+1, b-1 {
+			runs[a], runs[b] = runs[b], runs[a]
+		}
+	}
+
+	out := make([]rune, 0, len(text))
+	for _, r := range runs {
+		out = append(out, r.text...)
+	}
+	return out
+}
@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"database/sql"
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
+	"time"
 
 	"Monex/internal/database"
 	"Monex/internal/models"
@@ -32,7 +35,7 @@ func (r *AuditRepository) LogAction(
 		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 	`
 
-	_, err := r.db.Exec(query, userID, action, resource, ipAddress, userAgent, success, details)
+	_, err := r.db.ExecWithRetry(query, userID, action, resource, ipAddress, userAgent, success, details)
 	if err != nil {
 		return fmt.Errorf("failed to log audit: %w", err)
 	}
@@ -52,6 +55,42 @@ func (r *AuditRepository) GetAuditLogs(limit, offset int, filters map[string]int
 		args = append(args, searchPattern, searchPattern, searchPattern)
 	}
 
+	if userID, ok := filters["user_id"].(int); ok && userID > 0 {
+		whereClauses = append(whereClauses, "user_id = ?")
+		args = append(args, userID)
+	}
+
+	if action, ok := filters["action"].(string); ok && action != "" {
+		whereClauses = append(whereClauses, "action = ?")
+		args = append(args, action)
+	}
+
+	if resource, ok := filters["resource"].(string); ok && resource != "" {
+		whereClauses = append(whereClauses, "resource = ?")
+		args = append(args, resource)
+	}
+
+	if success, ok := filters["success"].(bool); ok {
+		whereClauses = append(whereClauses, "success = ?")
+		args = append(args, success)
+	}
+
+	if severity, ok := filters["severity"].(string); ok && severity != "" {
+		whereClauses = append(whereClauses, "severity = ?")
+		args = append(args, severity)
+	}
+
+	// from is inclusive, to is exclusive; created_at is stored as UTC text
+	if from, ok := filters["from"].(time.Time); ok && !from.IsZero() {
+		whereClauses = append(whereClauses, "created_at >= ?")
+		args = append(args, formatTimestamp(from))
+	}
+
+	if to, ok := filters["to"].(time.Time); ok && !to.IsZero() {
+		whereClauses = append(whereClauses, "created_at < ?")
+		args = append(args, formatTimestamp(to))
+	}
+
 	whereClause := ""
 	if len(whereClauses) > 0 {
 		whereClause = "WHERE " + strings.Join(whereClauses, " AND ")
@@ -62,11 +101,11 @@ func (r *AuditRepository) GetAuditLogs(limit, offset int, filters map[string]int
 	var total int
 	err := r.db.QueryRow(countQuery, args...).Scan(&total)
 	if err != nil {
-		log.Printf("[ERROR] Failed to count audit logs: %v", err)
+		slog.Error("Failed to count audit logs", "error", err)
 		return nil, 0, fmt.Errorf("failed to count audit logs: %w", err)
 	}
 
-	log.Printf("[DEBUG] Total audit logs: %d", total)
+	slog.Debug("Counted audit logs", "total", total)
 
 	// Build ORDER BY clause
 	sortField := "created_at"
@@ -75,7 +114,7 @@ func (r *AuditRepository) GetAuditLogs(limit, offset int, filters map[string]int
 		// Validate sort field to prevent SQL injection
 		validFields := map[string]bool{
 			"id": true, "user_id": true, "action": true, "resource": true,
-			"ip_address": true, "success": true, "created_at": true,
+			"ip_address": true, "success": true, "severity": true, "created_at": true,
 		}
 		if validFields[field] {
 			sortField = field
@@ -90,10 +129,11 @@ func (r *AuditRepository) GetAuditLogs(limit, offset int, filters map[string]int
 
 	// Get logs
 	query := fmt.Sprintf(`
-		SELECT id, COALESCE(user_id, 0) as user_id, action, resource, 
+		SELECT id, user_id, action, resource, 
 		       COALESCE(ip_address, '') as ip_address, 
 		       COALESCE(user_agent, '') as user_agent, 
-		       success, COALESCE(details, '') as details, created_at
+		       success, COALESCE(details, '') as details,
+		       COALESCE(severity, 'info') as severity, created_at
 		FROM audit_logs
 		%s
 		ORDER BY %s %s
@@ -102,11 +142,11 @@ func (r *AuditRepository) GetAuditLogs(limit, offset int, filters map[string]int
 
 	queryArgs := append(args, limit, offset)
 
-	log.Printf("[DEBUG] Audit query: %s with args: %v", query, queryArgs)
+	slog.Debug("Audit query", "query", query, "args", queryArgs)
 
 	rows, err := r.db.Query(query, queryArgs...)
 	if err != nil {
-		log.Printf("[ERROR] Failed to query audit logs: %v", err)
+		slog.Error("Failed to query audit logs", "error", err)
 		return nil, 0, fmt.Errorf("failed to get audit logs: %w", err)
 	}
 	defer rows.Close()
@@ -114,29 +154,117 @@ func (r *AuditRepository) GetAuditLogs(limit, offset int, filters map[string]int
 	logs := make([]*models.AuditLog, 0, limit)
 	for rows.Next() {
 		log := &models.AuditLog{}
+		var userID sql.NullInt64
 		err := rows.Scan(
 			&log.ID,
-			&log.UserID,
+			&userID,
 			&log.Action,
 			&log.Resource,
 			&log.IPAddress,
 			&log.UserAgent,
 			&log.Success,
 			&log.Details,
+			&log.Severity,
 			&log.CreatedAt,
 		)
 		if err != nil {
-			log.Printf("[ERROR] Failed to scan audit log: %v", err)
+			slog.Error("Failed to scan audit log", "error", err)
 			return nil, 0, fmt.Errorf("failed to scan audit log: %w", err)
 		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			log.UserID = &id
+		}
 		logs = append(logs, log)
 	}
 
-	log.Printf("[DEBUG] Retrieved %d audit logs", len(logs))
+	slog.Debug("Retrieved audit logs", "count", len(logs))
 
 	return logs, total, nil
 }
 
+// LogActionWithSeverity logs an audit entry with an explicit severity
+// (info, warning, error or critical)
+func (r *AuditRepository) LogActionWithSeverity(
+	userID int,
+	action string,
+	resource string,
+	ipAddress string,
+	userAgent string,
+	success bool,
+	details string,
+	severity string,
+) error {
+	query := `
+		INSERT INTO audit_logs (user_id, action, resource, ip_address, user_agent, success, details, severity, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+
+	_, err := r.db.ExecWithRetry(query, userID, action, resource, ipAddress, userAgent, success, details, severity)
+	if err != nil {
+		return fmt.Errorf("failed to log audit: %w", err)
+	}
+
+	return nil
+}
+
+// LogTransactionChange logs a successful transaction mutation together
+// with the row's state before and after it
+func (r *AuditRepository) LogTransactionChange(
+	userID int,
+	action string,
+	ipAddress string,
+	userAgent string,
+	details string,
+	change *models.TransactionChange,
+) error {
+	changes, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed to encode transaction change: %w", err)
+	}
+
+	query := `
+		INSERT INTO audit_logs (user_id, action, resource, ip_address, user_agent, success, details, changes, created_at)
+		VALUES (?, ?, 'transaction', ?, ?, 1, ?, ?, CURRENT_TIMESTAMP)
+	`
+
+	if _, err := r.db.ExecWithRetry(query, userID, action, ipAddress, userAgent, details, string(changes)); err != nil {
+		return fmt.Errorf("failed to log audit: %w", err)
+	}
+
+	return nil
+}
+
+// RecentTransactionChanges returns the user's transaction changes logged
+// since the given time, newest first
+func (r *AuditRepository) RecentTransactionChanges(userID int, since time.Time) ([]*models.TransactionChangeLog, error) {
+	rows, err := r.db.Query(`
+		SELECT id, action, changes, created_at
+		FROM audit_logs
+		WHERE user_id = ? AND changes IS NOT NULL AND created_at >= ?
+		ORDER BY id DESC
+	`, userID, formatTimestamp(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transaction changes: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []*models.TransactionChangeLog
+	for rows.Next() {
+		entry := &models.TransactionChangeLog{}
+		var changes string
+		if err := rows.Scan(&entry.ID, &entry.Action, &changes, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction change: %w", err)
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Change); err != nil {
+			slog.Warn("Skipping unreadable transaction change", "audit_id", entry.ID, "error", err)
+			continue
+		}
+		logs = append(logs, entry)
+	}
+	return logs, rows.Err()
+}
+
 // LogActionWithNullUser logs an audit entry with NULL user_id (for unauthenticated requests)
 func (r *AuditRepository) LogActionWithNullUser(
 	action string,
@@ -151,7 +279,7 @@ func (r *AuditRepository) LogActionWithNullUser(
 		VALUES (NULL, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 	`
 
-	_, err := r.db.Exec(query, action, resource, ipAddress, userAgent, success, details)
+	_, err := r.db.ExecWithRetry(query, action, resource, ipAddress, userAgent, success, details)
 	if err != nil {
 		return fmt.Errorf("failed to log audit: %w", err)
 	}
@@ -159,9 +287,43 @@ func (r *AuditRepository) LogActionWithNullUser(
 	return nil
 }
 
+// Count returns the number of stored audit logs
+func (r *AuditRepository) Count() (int, error) {
+	var count int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM audit_logs").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count audit logs: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteOlderThan purges non-critical audit logs created before t
+func (r *AuditRepository) DeleteOlderThan(t time.Time) (int64, error) {
+	result, err := r.db.ExecWithRetry(
+		"DELETE FROM audit_logs WHERE created_at < ? AND severity != 'critical'",
+		formatTimestamp(t),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge audit logs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// DeleteCriticalOlderThan purges critical audit logs created before t. They
+// have their own retention because they are the ones worth investigating later.
+func (r *AuditRepository) DeleteCriticalOlderThan(t time.Time) (int64, error) {
+	result, err := r.db.ExecWithRetry(
+		"DELETE FROM audit_logs WHERE created_at < ? AND severity = 'critical'",
+		formatTimestamp(t),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge critical audit logs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 // DeleteAll deletes all audit logs (admin only)
 func (r *AuditRepository) DeleteAll() error {
-	_, err := r.db.Exec("DELETE FROM audit_logs")
+	_, err := r.db.ExecWithRetry("DELETE FROM audit_logs")
 	if err != nil {
 		return fmt.Errorf("failed to delete all audit logs: %w", err)
 	}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+)
+
+// seedAuditLogs inserts rows with fixed timestamps so range filters are deterministic
+func seedAuditLogs(t *testing.T, r *AuditRepository, rows []auditSeed) {
+	t.Helper()
+	for _, row := range rows {
+		var userID interface{}
+		if row.userID > 0 {
+			userID = row.userID
+		}
+		if _, err := r.db.Exec(`INSERT INTO audit_logs (user_id, action, resource, ip_address, user_agent, success, details, severity, created_at)
+			VALUES (?, ?, ?, '203.0.113.7', 'test', ?, ?, ?, ?)`,
+			userID, row.action, row.resource, row.success, row.details, row.severity, formatTimestamp(row.at)); err != nil {
+			t.Fatalf("seed %s: %v", row.details, err)
+		}
+	}
+}
+
+type auditSeed struct {
+	userID   int
+	action   string
+	resource string
+	success  bool
+	severity string
+	at       time.Time
+	details  string
+}
+
+// auditDetails returns the details of logs, sorted
+func auditDetails(logs []*models.AuditLog) string {
+	details := make([]string, len(logs))
+	for i, log := range logs {
+		details[i] = log.Details
+	}
+	sort.Strings(details)
+	return fmt.Sprint(details)
+}
+
+// newAuditUsers creates two users for audit rows to refer to
+func newAuditUsers(t *testing.T, r *AuditRepository) (int, int) {
+	t.Helper()
+	users := NewUserRepository(r.db)
+	var ids [2]int
+	for i, name := range []string{"alice", "bob"} {
+		user := &models.User{Username: name, Email: name + "@example.com", Role: models.RoleUser, Active: true, Password: "x"}
+		if err := users.Create(user); err != nil {
+			t.Fatalf("Create %s: %v", name, err)
+		}
+		ids[i] = user.ID
+	}
+	if _, err := r.db.Exec("DELETE FROM audit_logs"); err != nil {
+		t.Fatalf("clear audit logs: %v", err)
+	}
+	return ids[0], ids[1]
+}
+
+func TestAuditLogFilters(t *testing.T) {
+	audit := NewAuditRepository(newTestDB(t))
+	alice, bob := newAuditUsers(t, audit)
+
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 12, 0, 0, 0, time.UTC) }
+	seedAuditLogs(t, audit, []auditSeed{
+		{alice, "login", "auth", true, "info", day(1), "a1"},
+		{alice, "login", "auth", false, "warning", day(2), "a2"},
+		{alice, "create_transaction", "transaction", true, "info", day(3), "a3"},
+		{bob, "login", "auth", false, "warning", day(3), "b1"},
+		{bob, "delete_user", "user", true, "critical", day(4), "b2 removed carol"},
+		{0, "login_rate_limited", "auth", false, "warning", day(5), "anon"},
+	})
+
+	tests := []struct {
+		name    string
+		filters map[string]interface{}
+		want    string
+	}{
+		{"none", nil, "[a1 a2 a3 anon b1 b2 removed carol]"},
+		{"user", map[string]interface{}{"user_id": alice}, "[a1 a2 a3]"},
+		{"action", map[string]interface{}{"action": "login"}, "[a1 a2 b1]"},
+		{"resource", map[string]interface{}{"resource": "auth"}, "[a1 a2 anon b1]"},
+		{"success", map[string]interface{}{"success": true}, "[a1 a3 b2 removed carol]"},
+		{"failure", map[string]interface{}{"success": false}, "[a2 anon b1]"},
+		{"severity", map[string]interface{}{"severity": "warning"}, "[a2 anon b1]"},
+		{"search", map[string]interface{}{"search": "carol"}, "[b2 removed carol]"},
+		{"from", map[string]interface{}{"from": day(4)}, "[anon b2 removed carol]"},
+		{"to is exclusive", map[string]interface{}{"to": day(2)}, "[a1]"},
+		{"user and failure", map[string]interface{}{"user_id": alice, "success": false}, "[a2]"},
+		{"action and range", map[string]interface{}{"action": "login", "from": day(2), "to": day(4)}, "[a2 b1]"},
+		{"resource, severity and user", map[string]interface{}{"resource": "auth", "severity": "warning", "user_id": bob}, "[b1]"},
+		{"no match", map[string]interface{}{"user_id": bob, "severity": "info"}, "[]"},
+	}
+	for _, tt := range tests {
+		logs, total, err := audit.GetAuditLogs(100, 0, tt.filters)
+		if err != nil {
+			t.Fatalf("%s: GetAuditLogs: %v", tt.name, err)
+		}
+		if got := auditDetails(logs); got != tt.want || total != len(logs) {
+			t.Errorf("%s: got %s (total %d), want %s", tt.name, got, total, tt.want)
+		}
+	}
+}
+
+func TestAuditLogNullUser(t *testing.T) {
+	audit := NewAuditRepository(newTestDB(t))
+	alice, _ := newAuditUsers(t, audit)
+
+	if err := audit.LogActionWithNullUser("login_rate_limited", "auth", "203.0.113.7", "test", false, "anonymous"); err != nil {
+		t.Fatalf("LogActionWithNullUser: %v", err)
+	}
+	if err := audit.LogActionWithSeverity(alice, "account_locked", "auth", "203.0.113.7", "test", false, "locked", "critical"); err != nil {
+		t.Fatalf("LogActionWithSeverity: %v", err)
+	}
+
+	logs, _, err := audit.GetAuditLogs(10, 0, map[string]interface{}{"sortField": "id", "sortOrder": "asc"})
+	if err != nil {
+		t.Fatalf("GetAuditLogs: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("got %d logs, want 2", len(logs))
+	}
+	if logs[0].UserID != nil {
+		t.Errorf("anonymous row user_id = %d, want nil", *logs[0].UserID)
+	}
+	if logs[1].UserID == nil || *logs[1].UserID != alice {
+		t.Errorf("user row user_id = %v, want %d", logs[1].UserID, alice)
+	}
+	if logs[0].Severity != "info" || logs[1].Severity != "critical" {
+		t.Errorf("severities = %q, %q; want info, critical", logs[0].Severity, logs[1].Severity)
+	}
+}
@@ -0,0 +1,17 @@
+package repository
+
+import "errors"
+
+// Errors shared by the repositories. They are returned wrapped with the
+// resource involved, e.g. "user not found", so callers match them with
+// errors.Is instead of comparing messages; any other error is a failure of
+// the database itself.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrInvalidInput = errors.New("invalid input")
+
+	// ErrLastActiveAdmin is returned by user writes that would leave no
+	// admin who can sign in
+	ErrLastActiveAdmin = errors.New("last active admin")
+)
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"Monex/internal/database"
+	"Monex/internal/models"
+)
+
+type LoginAttemptRepository struct {
+	db *database.DB
+}
+
+func NewLoginAttemptRepository(db *database.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// Record stores a single login attempt
+func (r *LoginAttemptRepository) Record(username, ipAddress, userAgent string, success bool, failureReason string) error {
+	_, err := r.db.ExecWithRetry(`
+		INSERT INTO login_attempts (username, ip_address, user_agent, success, failure_reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, username, ipAddress, userAgent, success, failureReason, formatTimestamp(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to record login attempt: %w", err)
+	}
+	return nil
+}
+
+// GetStats aggregates attempts in [from, to): per-day success/failure counts
+// and the top offending IPs and most-targeted usernames by failure count
+func (r *LoginAttemptRepository) GetStats(from, to time.Time, top int) (*models.LoginStats, error) {
+	fromStr := formatTimestamp(from)
+	toStr := formatTimestamp(to)
+
+	stats := &models.LoginStats{
+		From:         from.UTC().Format("2006-01-02"),
+		To:           to.UTC().Add(-time.Second).Format("2006-01-02"),
+		Daily:        make([]*models.LoginStatsDay, 0),
+		TopIPs:       make([]*models.LoginStatsCount, 0),
+		TopUsernames: make([]*models.LoginStatsCount, 0),
+	}
+
+	rows, err := r.db.Query(`
+		SELECT strftime('%Y-%m-%d', created_at) AS day,
+			COALESCE(SUM(CASE WHEN success = 1 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN success = 0 THEN 1 ELSE 0 END), 0)
+		FROM login_attempts
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY day
+		ORDER BY day ASC
+	`, fromStr, toStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate login attempts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		day := &models.LoginStatsDay{}
+		if err := rows.Scan(&day.Date, &day.Success, &day.Failed); err != nil {
+			return nil, fmt.Errorf("failed to scan login stats: %w", err)
+		}
+		stats.TotalSuccess += day.Success
+		stats.TotalFailed += day.Failed
+		stats.Daily = append(stats.Daily, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating login stats: %w", err)
+	}
+
+	if stats.TopIPs, err = r.topFailures("ip_address", fromStr, toStr, top); err != nil {
+		return nil, err
+	}
+	if stats.TopUsernames, err = r.topFailures("username", fromStr, toStr, top); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// topFailures ranks values of column (a fixed column name, never user input) by failed attempts
+func (r *LoginAttemptRepository) topFailures(column, from, to string, limit int) ([]*models.LoginStatsCount, error) {
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT %s, COUNT(*) AS failures
+		FROM login_attempts
+		WHERE success = 0 AND created_at >= ? AND created_at < ?
+		GROUP BY %s
+		ORDER BY failures DESC, %s ASC
+		LIMIT ?
+	`, column, column, column), from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank login failures: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]*models.LoginStatsCount, 0)
+	for rows.Next() {
+		count := &models.LoginStatsCount{}
+		if err := rows.Scan(&count.Value, &count.Failures); err != nil {
+			return nil, fmt.Errorf("failed to scan login failures: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating login failures: %w", err)
+	}
+
+	return counts, nil
+}
+
+// DeleteOlderThan removes attempts recorded before cutoff
+func (r *LoginAttemptRepository) DeleteOlderThan(cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecWithRetry("DELETE FROM login_attempts WHERE created_at < ?", formatTimestamp(cutoff))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old login attempts: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoginStatsAggregation(t *testing.T) {
+	db := newTestDB(t)
+	attempts := NewLoginAttemptRepository(db)
+
+	day := func(d, hour int) time.Time { return time.Date(2025, 3, d, hour, 0, 0, 0, time.UTC) }
+	seed := []struct {
+		at       time.Time
+		username string
+		ip       string
+		success  bool
+	}{
+		{day(1, 23), "alice", "203.0.113.1", false}, // before the range
+		{day(2, 0), "alice", "203.0.113.1", true},
+		{day(2, 9), "alice", "203.0.113.1", false},
+		{day(2, 10), "bob", "203.0.113.2", false},
+		{day(2, 11), "bob", "203.0.113.2", false},
+		{day(4, 8), "admin", "203.0.113.2", false},
+		{day(4, 9), "admin", "203.0.113.3", false},
+		{day(4, 10), "bob", "203.0.113.4", true},
+		{day(4, 23), "carol", "203.0.113.2", true},
+		{day(5, 0), "alice", "203.0.113.1", false}, // the end is exclusive
+	}
+	for _, s := range seed {
+		if _, err := db.Exec(`INSERT INTO login_attempts (username, ip_address, user_agent, success, failure_reason, created_at)
+			VALUES (?, ?, 'test', ?, '', ?)`, s.username, s.ip, s.success, formatTimestamp(s.at)); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	stats, err := attempts.GetStats(day(2, 0), day(5, 0), 2)
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if stats.From != "2025-03-02" || stats.To != "2025-03-04" {
+		t.Fatalf("range %s..%s, want 2025-03-02..2025-03-04", stats.From, stats.To)
+	}
+	if stats.TotalSuccess != 3 || stats.TotalFailed != 5 {
+		t.Fatalf("totals %d success / %d failed, want 3 / 5", stats.TotalSuccess, stats.TotalFailed)
+	}
+
+	format := func(v interface{}) string { return fmt.Sprintf("%+v", v) }
+	var daily []string
+	for _, d := range stats.Daily {
+		daily = append(daily, format(*d))
+	}
+	// Days without attempts are left out
+	if want := "[{Date:2025-03-02 Success:1 Failed:3} {Date:2025-03-04 Success:2 Failed:2}]"; fmt.Sprint(daily) != want {
+		t.Fatalf("daily %v, want %s", daily, want)
+	}
+
+	var ips, usernames []string
+	for _, c := range stats.TopIPs {
+		ips = append(ips, format(*c))
+	}
+	for _, c := range stats.TopUsernames {
+		usernames = append(usernames, format(*c))
+	}
+	// Ties rank alphabetically; only the top 2 are kept
+	if want := "[{Value:203.0.113.2 Failures:3} {Value:203.0.113.1 Failures:1}]"; fmt.Sprint(ips) != want {
+		t.Fatalf("top IPs %v, want %s", ips, want)
+	}
+	if want := "[{Value:admin Failures:2} {Value:bob Failures:2}]"; fmt.Sprint(usernames) != want {
+		t.Fatalf("top usernames %v, want %s", usernames, want)
+	}
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"Monex/internal/database"
+	"Monex/internal/models"
+)
+
+type NotificationRepository struct {
+	db *database.DB
+}
+
+func NewNotificationRepository(db *database.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// Create persists a notification and returns it with its ID assigned
+func (r *NotificationRepository) Create(notification *models.Notification) error {
+	var data sql.NullString
+	if len(notification.Data) > 0 {
+		encoded, err := json.Marshal(notification.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encode notification data: %w", err)
+		}
+		data = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now().UTC()
+	}
+
+	query := `
+		INSERT INTO notifications (user_id, type, message, severity, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.ExecWithRetry(query,
+		notification.UserID,
+		notification.Type,
+		notification.Message,
+		notification.Severity,
+		data,
+		notification.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	notification.ID = id
+	return nil
+}
+
+// ListSince returns a user's notifications with an ID greater than afterID, oldest first
+func (r *NotificationRepository) ListSince(userID int, afterID int64, limit int) ([]*models.Notification, error) {
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	query := `
+		SELECT id, user_id, type, message, severity, COALESCE(data, ''), created_at
+		FROM notifications
+		WHERE user_id = ? AND id > ?
+		ORDER BY id ASC
+		LIMIT ?
+	`
+
+	rows, err := r.db.Query(query, userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := make([]*models.Notification, 0)
+	for rows.Next() {
+		notification := &models.Notification{}
+		var data string
+
+		if err := rows.Scan(
+			&notification.ID,
+			&notification.UserID,
+			&notification.Type,
+			&notification.Message,
+			&notification.Severity,
+			&data,
+			&notification.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+
+		if data != "" {
+			if err := json.Unmarshal([]byte(data), &notification.Data); err != nil {
+				return nil, fmt.Errorf("failed to decode notification data: %w", err)
+			}
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+// DeleteOlderThan removes notifications created before the cutoff
+func (r *NotificationRepository) DeleteOlderThan(cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecWithRetry("DELETE FROM notifications WHERE created_at < ?", cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old notifications: %w", err)
+	}
+
+	return result.RowsAffected()
+}
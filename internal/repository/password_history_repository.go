@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"Monex/internal/database"
+)
+
+type PasswordHistoryRepository struct {
+	db *database.DB
+}
+
+func NewPasswordHistoryRepository(db *database.DB) *PasswordHistoryRepository {
+	return &PasswordHistoryRepository{db: db}
+}
+
+// Add records a password hash the user has used
+func (r *PasswordHistoryRepository) Add(userID int, passwordHash string) error {
+	_, err := r.db.ExecWithRetry(
+		"INSERT INTO password_history (user_id, password_hash, created_at) VALUES (?, ?, ?)",
+		userID, passwordHash, formatTimestamp(time.Now()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add password history: %w", err)
+	}
+	return nil
+}
+
+// Recent returns the user's most recent password hashes, newest first
+func (r *PasswordHistoryRepository) Recent(userID, limit int) ([]string, error) {
+	rows, err := r.db.Query(
+		"SELECT password_hash FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?",
+		userID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password history: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make([]string, 0, limit)
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("failed to scan password history: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// ChangeTimes returns when the user changed their password, newest first.
+// Each history row is written at change time; hashes are never read here.
+func (r *PasswordHistoryRepository) ChangeTimes(userID, limit int) ([]time.Time, error) {
+	rows, err := r.db.Query(
+		"SELECT created_at FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?",
+		userID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password history: %w", err)
+	}
+	defer rows.Close()
+
+	times := make([]time.Time, 0)
+	for rows.Next() {
+		var changedAt time.Time
+		if err := rows.Scan(&changedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan password history: %w", err)
+		}
+		times = append(times, changedAt.UTC())
+	}
+	return times, rows.Err()
+}
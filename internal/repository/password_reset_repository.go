@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"Monex/internal/database"
+)
+
+var (
+	ErrResetTokenInvalid = errors.New("password reset token is invalid or already used")
+	ErrResetTokenExpired = errors.New("password reset token expired")
+)
+
+type PasswordResetRepository struct {
+	db *database.DB
+}
+
+func NewPasswordResetRepository(db *database.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// hashResetToken returns the form in which reset tokens are stored
+func hashResetToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Create stores a new reset token for the user and retires any earlier
+// unused ones, so only the most recent email works
+func (r *PasswordResetRepository) Create(userID int, token, requestedIP string, expiresAt time.Time) error {
+	now := formatTimestamp(time.Now())
+
+	if _, err := r.db.ExecWithRetry(
+		"UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL",
+		now, userID,
+	); err != nil {
+		return fmt.Errorf("failed to retire previous reset tokens: %w", err)
+	}
+
+	_, err := r.db.ExecWithRetry(`
+		INSERT INTO password_resets (user_id, token_hash, requested_ip, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, hashResetToken(token), requestedIP, formatTimestamp(expiresAt), now)
+	if err != nil {
+		return fmt.Errorf("failed to create reset token: %w", err)
+	}
+	return nil
+}
+
+// Validate returns the user of an unused, unexpired token without consuming it
+func (r *PasswordResetRepository) Validate(token string) (int, error) {
+	_, userID, err := r.lookup(token)
+	return userID, err
+}
+
+// Consume marks a token as used and returns its user. A token can be
+// consumed only once, even by concurrent requests.
+func (r *PasswordResetRepository) Consume(token string) (int, error) {
+	id, userID, err := r.lookup(token)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.db.ExecWithRetry(
+		"UPDATE password_resets SET used_at = ? WHERE id = ? AND used_at IS NULL",
+		formatTimestamp(time.Now()), id,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to consume reset token: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return 0, ErrResetTokenInvalid // consumed by a concurrent request
+	}
+
+	return userID, nil
+}
+
+// lookup returns the row id and user of a usable token
+func (r *PasswordResetRepository) lookup(token string) (int, int, error) {
+	var id, userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := r.db.QueryRow(
+		"SELECT id, user_id, expires_at, used_at FROM password_resets WHERE token_hash = ?",
+		hashResetToken(token),
+	).Scan(&id, &userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get reset token: %w", err)
+	}
+
+	if usedAt.Valid {
+		return 0, 0, ErrResetTokenInvalid
+	}
+	if time.Now().After(expiresAt) {
+		return 0, 0, ErrResetTokenExpired
+	}
+	return id, userID, nil
+}
+
+// DeleteExpired removes tokens that expired before cutoff
+func (r *PasswordResetRepository) DeleteExpired(cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecWithRetry("DELETE FROM password_resets WHERE expires_at < ?", formatTimestamp(cutoff))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired reset tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
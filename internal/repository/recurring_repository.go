@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"Monex/internal/database"
+	"Monex/internal/models"
+)
+
+type RecurringRepository struct {
+	db *database.DB
+}
+
+func NewRecurringRepository(db *database.DB) *RecurringRepository {
+	return &RecurringRepository{db: db}
+}
+
+const recurringColumns = `id, user_id, type, amount, note, interval, next_run, anchor_day, active, created_at, updated_at`
+
+// Create inserts a new recurring rule
+func (r *RecurringRepository) Create(rule *models.RecurringTransaction) error {
+	now := time.Now().UTC()
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	if rule.AnchorDay == 0 {
+		rule.AnchorDay = rule.NextRun.Day()
+	}
+
+	result, err := r.db.ExecWithRetry(`
+		INSERT INTO recurring_transactions (user_id, type, amount, note, interval, next_run, anchor_day, active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		rule.UserID,
+		rule.Type,
+		rule.Amount,
+		rule.Note,
+		rule.Interval,
+		formatTimestamp(rule.NextRun),
+		rule.AnchorDay,
+		rule.Active,
+		formatTimestamp(rule.CreatedAt),
+		formatTimestamp(rule.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create recurring transaction: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	rule.ID = int(id)
+	return nil
+}
+
+// GetByID retrieves a rule (only if it belongs to the user)
+func (r *RecurringRepository) GetByID(id, userID int) (*models.RecurringTransaction, error) {
+	row := r.db.QueryRow(
+		"SELECT "+recurringColumns+" FROM recurring_transactions WHERE id = ? AND user_id = ?",
+		id, userID,
+	)
+
+	rule, err := scanRecurring(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("recurring transaction %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring transaction: %w", err)
+	}
+	return rule, nil
+}
+
+// ListByUser returns all rules of a user ordered by next run
+func (r *RecurringRepository) ListByUser(userID int) ([]*models.RecurringTransaction, error) {
+	rows, err := r.db.Query(
+		"SELECT "+recurringColumns+" FROM recurring_transactions WHERE user_id = ? ORDER BY next_run ASC",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recurring transactions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRecurringRows(rows)
+}
+
+// ListDue returns active rules whose next run is at or before now
+func (r *RecurringRepository) ListDue(now time.Time, limit int) ([]*models.RecurringTransaction, error) {
+	if limit < 1 {
+		limit = 100
+	}
+
+	rows, err := r.db.Query(
+		"SELECT "+recurringColumns+` FROM recurring_transactions
+		WHERE active = 1 AND next_run <= ?
+		ORDER BY next_run ASC
+		LIMIT ?`,
+		formatTimestamp(now), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due recurring transactions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRecurringRows(rows)
+}
+
+// Update saves the editable fields of a rule
+func (r *RecurringRepository) Update(rule *models.RecurringTransaction) error {
+	rule.UpdatedAt = time.Now().UTC()
+
+	result, err := r.db.ExecWithRetry(`
+		UPDATE recurring_transactions
+		SET type = ?, amount = ?, note = ?, interval = ?, next_run = ?, anchor_day = ?, active = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+	`,
+		rule.Type,
+		rule.Amount,
+		rule.Note,
+		rule.Interval,
+		formatTimestamp(rule.NextRun),
+		rule.AnchorDay,
+		rule.Active,
+		formatTimestamp(rule.UpdatedAt),
+		rule.ID,
+		rule.UserID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update recurring transaction: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("recurring transaction %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// Delete removes a rule
+func (r *RecurringRepository) Delete(id, userID int) error {
+	result, err := r.db.ExecWithRetry("DELETE FROM recurring_transactions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recurring transaction: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("recurring transaction %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// ClaimRun moves next_run from expected to next. It returns false when the
+// rule was already advanced (or edited) since it was read, so a run is never
+// executed twice.
+func (r *RecurringRepository) ClaimRun(id int, expected, next time.Time) (bool, error) {
+	result, err := r.db.ExecWithRetry(`
+		UPDATE recurring_transactions
+		SET next_run = ?, updated_at = ?
+		WHERE id = ? AND next_run = ? AND active = 1
+	`,
+		formatTimestamp(next),
+		formatTimestamp(time.Now()),
+		id,
+		formatTimestamp(expected),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to advance recurring transaction: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows == 1, nil
+}
+
+type recurringScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRecurring(row recurringScanner) (*models.RecurringTransaction, error) {
+	rule := &models.RecurringTransaction{}
+	var nextRunStr, createdAtStr, updatedAtStr string
+
+	if err := row.Scan(
+		&rule.ID,
+		&rule.UserID,
+		&rule.Type,
+		&rule.Amount,
+		&rule.Note,
+		&rule.Interval,
+		&nextRunStr,
+		&rule.AnchorDay,
+		&rule.Active,
+		&createdAtStr,
+		&updatedAtStr,
+	); err != nil {
+		return nil, err
+	}
+
+	nextRun, err := parseTimestamp(nextRunStr)
+	if err != nil {
+		return nil, err
+	}
+	rule.NextRun = nextRun
+
+	if createdAt, err := parseTimestamp(createdAtStr); err == nil {
+		rule.CreatedAt = createdAt
+	}
+	if updatedAt, err := parseTimestamp(updatedAtStr); err == nil {
+		rule.UpdatedAt = updatedAt
+	}
+
+	return rule, nil
+}
+
+func scanRecurringRows(rows *database.Rows) ([]*models.RecurringTransaction, error) {
+	rules := make([]*models.RecurringTransaction, 0)
+	for rows.Next() {
+		rule, err := scanRecurring(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recurring transaction: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recurring transactions: %w", err)
+	}
+
+	return rules, nil
+}
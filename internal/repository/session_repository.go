@@ -4,12 +4,14 @@ package repository
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"Monex/internal/database"
+	"Monex/internal/logger"
 	"Monex/internal/models"
 )
 
@@ -41,7 +43,7 @@ func (r *SessionRepository) hashToken(token string) string {
 func (r *SessionRepository) FindExistingSession(userID int, deviceID string) (*models.Session, error) {
 	query := `
 		SELECT id, user_id, device_id, device_name, browser, os, ip_address,
-		       last_activity, expires_at, created_at
+		       last_activity, expires_at, created_at, suspicious_at IS NOT NULL
 		FROM sessions
 		WHERE user_id = ? AND device_id = ? AND expires_at > CURRENT_TIMESTAMP
 		LIMIT 1
@@ -61,6 +63,7 @@ func (r *SessionRepository) FindExistingSession(userID int, deviceID string) (*m
 		&lastActivityStr,
 		&expiresAtStr,
 		&createdAtStr,
+		&session.Suspicious,
 	)
 
 	if err != nil {
@@ -71,52 +74,38 @@ func (r *SessionRepository) FindExistingSession(userID int, deviceID string) (*m
 	if lastActivity, err := parseTimestamp(lastActivityStr); err == nil {
 		session.LastActivity = lastActivity
 	} else {
-		log.Printf("[WARN] Failed to parse lastActivity: %v", err)
-		session.LastActivity = time.Now()
+		slog.Warn("Failed to parse last_activity", "session_id", session.ID, "error", err)
+		session.LastActivity = time.Now().UTC()
 	}
 
 	if expiresAt, err := parseTimestamp(expiresAtStr); err == nil {
 		session.ExpiresAt = expiresAt
 	} else {
-		log.Printf("[WARN] Failed to parse expiresAt: %v", err)
-		session.ExpiresAt = time.Now().Add(7 * 24 * time.Hour)
+		slog.Warn("Failed to parse expires_at", "session_id", session.ID, "error", err)
+		session.ExpiresAt = time.Now().UTC().Add(7 * 24 * time.Hour)
 	}
 
 	if createdAt, err := parseTimestamp(createdAtStr); err == nil {
 		session.CreatedAt = createdAt
 	} else {
-		log.Printf("[WARN] Failed to parse createdAt: %v", err)
-		session.CreatedAt = time.Now()
+		slog.Warn("Failed to parse created_at", "session_id", session.ID, "error", err)
+		session.CreatedAt = time.Now().UTC()
 	}
 
 	return session, nil
 }
 
-func parseTimestamp(timeStr string) (time.Time, error) {
-	// Try multiple formats
-	formats := []string{
-		"2006-01-02T15:04:05Z",        // ISO 8601 UTC
-		"2006-01-02T15:04:05.999999Z", // ISO 8601 with microseconds
-		"2006-01-02 15:04:05",         // SQLite format
-		"2006-01-02 15:04:05.999999",  // SQLite with microseconds
-		time.RFC3339,                  // RFC3339
-		time.RFC3339Nano,              // RFC3339 with nanoseconds
-	}
-
-	for _, format := range formats {
-		if t, err := time.Parse(format, timeStr); err == nil {
-			return t, nil
-		}
-	}
-
-	return time.Time{}, fmt.Errorf("unable to parse timestamp: %s", timeStr)
-}
-
-// ✅ UpdateSession updates existing session with new tokens
+// ✅ UpdateSession updates existing session with new tokens. Signing in again
+// also refreshes the device details and clears any suspicion.
 func (r *SessionRepository) UpdateSession(
 	sessionID int,
+	deviceName string,
+	browser string,
+	os string,
 	accessToken string,
 	refreshToken string,
+	accessJTI string,
+	refreshJTI string,
 	ipAddress string,
 	expiresAt time.Time,
 ) error {
@@ -127,21 +116,32 @@ func (r *SessionRepository) UpdateSession(
 		UPDATE sessions 
 		SET access_token_hash = ?, 
 		    refresh_token_hash = ?, 
+		    access_jti = ?,
+		    refresh_jti = ?,
 		    ip_address = ?,
+		    device_name = ?,
+		    browser = ?,
+		    os = ?,
+		    suspicious_at = NULL,
 		    last_activity = ?, 
 		    expires_at = ?, 
 		    updated_at = ?
 		WHERE id = ?
 	`
 
-	_, err := r.db.Exec(
+	_, err := r.db.ExecWithRetry(
 		query,
 		r.hashToken(accessToken),
 		r.hashToken(refreshToken),
+		accessJTI,
+		refreshJTI,
 		ipAddress,
-		now.Format("2006-01-02 15:04:05"),
-		expiresAtFormatted.Format("2006-01-02 15:04:05"),
-		now.Format("2006-01-02 15:04:05"),
+		deviceName,
+		browser,
+		os,
+		formatTimestamp(now),
+		formatTimestamp(expiresAtFormatted),
+		formatTimestamp(now),
 		sessionID,
 	)
 
@@ -149,7 +149,7 @@ func (r *SessionRepository) UpdateSession(
 		return fmt.Errorf("failed to update session: %w", err)
 	}
 
-	log.Printf("[DEBUG] UpdateSession SUCCESS - SessionID: %d", sessionID)
+	slog.Debug("Session updated", "session_id", sessionID)
 	return nil
 }
 
@@ -163,6 +163,8 @@ func (r *SessionRepository) CreateOrUpdateSession(
 	ipAddress string,
 	accessToken string,
 	refreshToken string,
+	accessJTI string,
+	refreshJTI string,
 	expiresAt time.Time,
 ) (*models.Session, error) {
 	// Try to find existing session
@@ -170,12 +172,16 @@ func (r *SessionRepository) CreateOrUpdateSession(
 
 	if err == nil && existingSession != nil {
 		// ✅ Session exists - UPDATE it
-		log.Printf("[DEBUG] Reusing existing session - SessionID: %d, DeviceID: %s", existingSession.ID, deviceID)
+		slog.Debug("Reusing existing session", "session_id", existingSession.ID, "device_id", deviceID)
 
-		if err := r.UpdateSession(existingSession.ID, accessToken, refreshToken, ipAddress, expiresAt); err != nil {
+		if err := r.UpdateSession(existingSession.ID, deviceName, browser, os, accessToken, refreshToken, accessJTI, refreshJTI, ipAddress, expiresAt); err != nil {
 			return nil, err
 		}
 
+		existingSession.DeviceName = deviceName
+		existingSession.Browser = browser
+		existingSession.OS = os
+		existingSession.Suspicious = false
 		existingSession.IPAddress = ipAddress
 		existingSession.LastActivity = time.Now().UTC()
 		existingSession.ExpiresAt = expiresAt.UTC()
@@ -184,9 +190,9 @@ func (r *SessionRepository) CreateOrUpdateSession(
 	}
 
 	// ✅ No existing session - CREATE new one
-	log.Printf("[DEBUG] Creating NEW session - UserID: %d, DeviceID: %s", userID, deviceID)
+	slog.Debug("Creating new session", "user_id", userID, "device_id", deviceID)
 
-	return r.CreateSession(userID, deviceName, browser, os, ipAddress, accessToken, refreshToken, expiresAt)
+	return r.CreateSession(userID, deviceName, browser, os, ipAddress, accessToken, refreshToken, accessJTI, refreshJTI, expiresAt)
 }
 
 // CreateSession creates new session (original method)
@@ -198,28 +204,31 @@ func (r *SessionRepository) CreateSession(
 	ipAddress string,
 	accessToken string,
 	refreshToken string,
+	accessJTI string,
+	refreshJTI string,
 	expiresAt time.Time,
 ) (*models.Session, error) {
 	deviceID, err := r.GenerateDeviceID()
 	if err != nil {
-		log.Printf("[ERROR] Failed to generate device ID: %v", err)
+		slog.Error("Failed to generate device ID", "user_id", userID, "error", err)
 		return nil, err
 	}
 
 	now := time.Now().UTC()
 	expiresAtFormatted := expiresAt.UTC()
 
-	log.Printf("[DEBUG] CreateSession - UserID: %d, DeviceID: %s, DeviceName: %s", userID, deviceID, deviceName)
-	log.Printf("[DEBUG] CreateSession - CreatedAt: %v, ExpiresAt: %v", now, expiresAtFormatted)
+	slog.Debug("Creating session", "user_id", userID, "device_id", deviceID, "device_name", deviceName,
+		"created_at", now, "expires_at", expiresAtFormatted)
 
 	query := `
 		INSERT INTO sessions 
 		(user_id, device_id, device_name, browser, os, ip_address, 
-		 access_token_hash, refresh_token_hash, last_activity, expires_at, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 access_token_hash, refresh_token_hash, access_jti, refresh_jti,
+		 last_activity, expires_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := r.db.Exec(
+	result, err := r.db.ExecWithRetry(
 		query,
 		userID,
 		deviceID,
@@ -229,23 +238,25 @@ func (r *SessionRepository) CreateSession(
 		ipAddress,
 		r.hashToken(accessToken),
 		r.hashToken(refreshToken),
-		now.Format("2006-01-02 15:04:05"),
-		expiresAtFormatted.Format("2006-01-02 15:04:05"),
-		now.Format("2006-01-02 15:04:05"),
-		now.Format("2006-01-02 15:04:05"),
+		accessJTI,
+		refreshJTI,
+		formatTimestamp(now),
+		formatTimestamp(expiresAtFormatted),
+		formatTimestamp(now),
+		formatTimestamp(now),
 	)
 	if err != nil {
-		log.Printf("[ERROR] CreateSession Exec failed: %v", err)
+		slog.Error("Failed to insert session", "user_id", userID, "device_id", deviceID, "error", err)
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		log.Printf("[ERROR] Failed to get LastInsertId: %v", err)
+		slog.Error("Failed to get session id", "user_id", userID, "error", err)
 		return nil, fmt.Errorf("failed to get session ID: %w", err)
 	}
 
-	log.Printf("[DEBUG] CreateSession SUCCESS - SessionID: %d", id)
+	slog.Debug("Session created", "session_id", id, "user_id", userID)
 
 	return &models.Session{
 		ID:           int(id),
@@ -265,16 +276,82 @@ func (r *SessionRepository) CreateSession(
 func (r *SessionRepository) GetSessionByID(sessionID int, userID int) (*models.Session, error) {
 	query := `
 		SELECT id, user_id, device_id, device_name, browser, os, ip_address,
-		       last_activity, expires_at, created_at
+		       last_activity, expires_at, created_at, suspicious_at IS NOT NULL
 		FROM sessions
 		WHERE id = ? AND user_id = ?
 		LIMIT 1
 	`
 
+	return r.scanSession(r.db.QueryRow(query, sessionID, userID))
+}
+
+// GetByAccessTokenHash retrieves the unexpired session that issued the
+// access token with the given hash (see HashToken)
+func (r *SessionRepository) GetByAccessTokenHash(hash string) (*models.Session, error) {
+	query := `
+		SELECT id, user_id, device_id, device_name, browser, os, ip_address,
+		       last_activity, expires_at, created_at, suspicious_at IS NOT NULL
+		FROM sessions
+		WHERE access_token_hash = ? AND expires_at > CURRENT_TIMESTAMP
+		LIMIT 1
+	`
+
+	return r.scanSession(r.db.QueryRow(query, hash))
+}
+
+// GetByRefreshTokenHash retrieves the unexpired session whose current
+// refresh token has the given hash (see HashToken)
+func (r *SessionRepository) GetByRefreshTokenHash(hash string) (*models.Session, error) {
+	query := `
+		SELECT id, user_id, device_id, device_name, browser, os, ip_address,
+		       last_activity, expires_at, created_at, suspicious_at IS NOT NULL
+		FROM sessions
+		WHERE refresh_token_hash = ? AND expires_at > CURRENT_TIMESTAMP
+		LIMIT 1
+	`
+
+	return r.scanSession(r.db.QueryRow(query, hash))
+}
+
+// RotateTokens replaces a session's tokens after a refresh, only if its
+// refresh token is still oldRefreshToken, so a refresh token is spent once
+// even by concurrent requests. The session keeps its expiry and the IP
+// address it was created from: that is what fingerprint checks compare
+// against, so a refresh from another network must not overwrite it.
+func (r *SessionRepository) RotateTokens(sessionID int, oldRefreshToken, accessToken, refreshToken, accessJTI, refreshJTI string) error {
+	now := formatTimestamp(time.Now().UTC())
+
+	result, err := r.db.ExecWithRetry(`
+		UPDATE sessions
+		SET access_token_hash = ?,
+		    refresh_token_hash = ?,
+		    access_jti = ?,
+		    refresh_jti = ?,
+		    last_activity = ?,
+		    updated_at = ?
+		WHERE id = ? AND refresh_token_hash = ?
+	`, r.hashToken(accessToken), r.hashToken(refreshToken), accessJTI, refreshJTI,
+		now, now, sessionID, r.hashToken(oldRefreshToken))
+	if err != nil {
+		return fmt.Errorf("failed to rotate session tokens: %w", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("session %w", ErrConflict)
+	}
+	return nil
+}
+
+// HashToken returns the form in which session tokens are stored
+func (r *SessionRepository) HashToken(token string) string {
+	return r.hashToken(token)
+}
+
+func (r *SessionRepository) scanSession(row *database.Row) (*models.Session, error) {
 	session := &models.Session{}
 	var lastActivityStr, expiresAtStr, createdAtStr string
 
-	err := r.db.QueryRow(query, sessionID, userID).Scan(
+	err := row.Scan(
 		&session.ID,
 		&session.UserID,
 		&session.DeviceID,
@@ -285,52 +362,127 @@ func (r *SessionRepository) GetSessionByID(sessionID int, userID int) (*models.S
 		&lastActivityStr,
 		&expiresAtStr,
 		&createdAtStr,
+		&session.Suspicious,
 	)
 
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("session %w", ErrNotFound)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("session not found: %w", err)
+		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 
 	// ✅ Use helper function
 	if lastActivity, err := parseTimestamp(lastActivityStr); err == nil {
 		session.LastActivity = lastActivity
 	} else {
-		log.Printf("[WARN] Failed to parse lastActivity: %v", err)
-		session.LastActivity = time.Now()
+		slog.Warn("Failed to parse last_activity", "session_id", session.ID, "error", err)
+		session.LastActivity = time.Now().UTC()
 	}
 
 	if expiresAt, err := parseTimestamp(expiresAtStr); err == nil {
 		session.ExpiresAt = expiresAt
 	} else {
-		log.Printf("[WARN] Failed to parse expiresAt: %v", err)
-		session.ExpiresAt = time.Now().Add(7 * 24 * time.Hour)
+		slog.Warn("Failed to parse expires_at", "session_id", session.ID, "error", err)
+		session.ExpiresAt = time.Now().UTC().Add(7 * 24 * time.Hour)
 	}
 
 	if createdAt, err := parseTimestamp(createdAtStr); err == nil {
 		session.CreatedAt = createdAt
 	} else {
-		log.Printf("[WARN] Failed to parse createdAt: %v", err)
-		session.CreatedAt = time.Now()
+		slog.Warn("Failed to parse created_at", "session_id", session.ID, "error", err)
+		session.CreatedAt = time.Now().UTC()
 	}
 
 	return session, nil
 }
 
+// MarkSuspicious flags a session whose token was used from a mismatching
+// device or network. It reports whether the session was newly flagged, so
+// callers can warn once rather than on every request.
+func (r *SessionRepository) MarkSuspicious(sessionID int) (bool, error) {
+	result, err := r.db.ExecWithRetry(
+		"UPDATE sessions SET suspicious_at = ? WHERE id = ? AND suspicious_at IS NULL",
+		formatTimestamp(time.Now()), sessionID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark session suspicious: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// CountCreatedSince returns how many of the user's sessions were created at
+// or after since. Reused sessions keep their creation time and aren't counted.
+func (r *SessionRepository) CountCreatedSince(userID int, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM sessions WHERE user_id = ? AND created_at >= ?",
+		userID, formatTimestamp(since),
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// MarkCreatedSinceSuspicious flags the user's sessions created at or after
+// since and returns how many weren't flagged already
+func (r *SessionRepository) MarkCreatedSinceSuspicious(userID int, since time.Time) (int, error) {
+	result, err := r.db.ExecWithRetry(
+		"UPDATE sessions SET suspicious_at = ? WHERE user_id = ? AND created_at >= ? AND suspicious_at IS NULL",
+		formatTimestamp(time.Now()), userID, formatTimestamp(since),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark sessions suspicious: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(rows), nil
+}
+
 // GetUserSessions retrieves all active sessions for user
 func (r *SessionRepository) GetUserSessions(userID int) ([]*models.Session, error) {
+	return r.listUserSessions(userID, -1, 0) // LIMIT -1 means no limit in SQLite
+}
+
+// ListUserSessions retrieves one page of a user's active sessions, most
+// recently active first, and the total number of active sessions
+func (r *SessionRepository) ListUserSessions(userID, limit, offset int) ([]*models.Session, int, error) {
+	total, err := r.CountActiveSessions(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sessions, err := r.listUserSessions(userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return sessions, total, nil
+}
+
+func (r *SessionRepository) listUserSessions(userID, limit, offset int) ([]*models.Session, error) {
 	query := `
 		SELECT id, user_id, device_id, device_name, browser, os, ip_address,
-		       last_activity, expires_at, created_at
+		       last_activity, expires_at, created_at, suspicious_at IS NOT NULL
 		FROM sessions
 		WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP
-		ORDER BY last_activity DESC
+		ORDER BY last_activity DESC, id DESC
+		LIMIT ? OFFSET ?
 	`
 
-	log.Printf("[DEBUG] GetUserSessions query for UserID: %d", userID)
+	slog.Debug("Listing sessions", "user_id", userID)
 
-	rows, err := r.db.Query(query, userID)
+	rows, err := r.db.Query(query, userID, limit, offset)
 	if err != nil {
-		log.Printf("[ERROR] GetUserSessions Query failed: %v", err)
+		slog.Error("Failed to query sessions", "user_id", userID, "error", err)
 		return nil, fmt.Errorf("failed to query sessions: %w", err)
 	}
 	defer rows.Close()
@@ -354,9 +506,10 @@ func (r *SessionRepository) GetUserSessions(userID int) ([]*models.Session, erro
 			&lastActivityStr,
 			&expiresAtStr,
 			&createdAtStr,
+			&session.Suspicious,
 		)
 		if err != nil {
-			log.Printf("[ERROR] GetUserSessions Scan failed: %v", err)
+			slog.Error("Failed to scan session", "user_id", userID, "error", err)
 			return nil, fmt.Errorf("failed to scan session: %w", err)
 		}
 
@@ -364,35 +517,35 @@ func (r *SessionRepository) GetUserSessions(userID int) ([]*models.Session, erro
 		if lastActivity, err := parseTimestamp(lastActivityStr); err == nil {
 			session.LastActivity = lastActivity
 		} else {
-			log.Printf("[WARN] Failed to parse lastActivity for session %d: %v", session.ID, err)
-			session.LastActivity = time.Now()
+			slog.Warn("Failed to parse last_activity", "session_id", session.ID, "error", err)
+			session.LastActivity = time.Now().UTC()
 		}
 
 		if expiresAt, err := parseTimestamp(expiresAtStr); err == nil {
 			session.ExpiresAt = expiresAt
 		} else {
-			log.Printf("[WARN] Failed to parse expiresAt for session %d: %v", session.ID, err)
-			session.ExpiresAt = time.Now().Add(7 * 24 * time.Hour)
+			slog.Warn("Failed to parse expires_at", "session_id", session.ID, "error", err)
+			session.ExpiresAt = time.Now().UTC().Add(7 * 24 * time.Hour)
 		}
 
 		if createdAt, err := parseTimestamp(createdAtStr); err == nil {
 			session.CreatedAt = createdAt
 		} else {
-			log.Printf("[WARN] Failed to parse createdAt for session %d: %v", session.ID, err)
-			session.CreatedAt = time.Now()
+			slog.Warn("Failed to parse created_at", "session_id", session.ID, "error", err)
+			session.CreatedAt = time.Now().UTC()
 		}
 
 		sessions = append(sessions, session)
-		log.Printf("[DEBUG] Session %d - Device: %s, LastActivity: %v, Expires: %v",
-			session.ID, session.DeviceName, session.LastActivity, session.ExpiresAt)
+		slog.Debug("Session loaded", "session_id", session.ID, "device", session.DeviceName,
+			"last_activity", session.LastActivity, "expires_at", session.ExpiresAt)
 	}
 
 	if err = rows.Err(); err != nil {
-		log.Printf("[ERROR] GetUserSessions rows iteration error: %v", err)
+		slog.Error("Failed to iterate sessions", "user_id", userID, "error", err)
 		return nil, fmt.Errorf("error iterating sessions: %w", err)
 	}
 
-	log.Printf("[DEBUG] GetUserSessions - Found %d sessions for UserID %d", rowCount, userID)
+	slog.Debug("Listed sessions", "user_id", userID, "count", rowCount)
 
 	if sessions == nil {
 		sessions = make([]*models.Session, 0)
@@ -401,19 +554,42 @@ func (r *SessionRepository) GetUserSessions(userID int) ([]*models.Session, erro
 	return sessions, nil
 }
 
+// CountActiveSessions returns the number of unexpired sessions of a user
+func (r *SessionRepository) CountActiveSessions(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM sessions WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP",
+		userID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// CountAllActiveSessions returns the number of unexpired sessions across all users
+func (r *SessionRepository) CountAllActiveSessions() (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM sessions WHERE expires_at > CURRENT_TIMESTAMP").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
 // InvalidateSession revokes specific session
 func (r *SessionRepository) InvalidateSession(sessionID int, userID int) error {
 	query := "DELETE FROM sessions WHERE id = ? AND user_id = ?"
-	log.Printf("[DEBUG] InvalidateSession - SessionID: %d, UserID: %d", sessionID, userID)
+	slog.Debug("Invalidating session", "session_id", sessionID, "user_id", userID)
 
-	result, err := r.db.Exec(query, sessionID, userID)
+	result, err := r.db.ExecWithRetry(query, sessionID, userID)
 	if err != nil {
-		log.Printf("[ERROR] InvalidateSession failed: %v", err)
+		slog.Error("Failed to invalidate session", "session_id", sessionID, "user_id", userID, "error", err)
 		return err
 	}
 
 	rowsAffected, _ := result.RowsAffected()
-	log.Printf("[DEBUG] InvalidateSession - Rows deleted: %d", rowsAffected)
+	slog.Debug("Session invalidated", "session_id", sessionID, "rows", rowsAffected)
 
 	return nil
 }
@@ -421,25 +597,52 @@ func (r *SessionRepository) InvalidateSession(sessionID int, userID int) error {
 // InvalidateAllUserSessions revokes all user sessions
 func (r *SessionRepository) InvalidateAllUserSessions(userID int) error {
 	query := "DELETE FROM sessions WHERE user_id = ?"
-	log.Printf("[DEBUG] InvalidateAllUserSessions - UserID: %d", userID)
+	slog.Debug("Invalidating all sessions", "user_id", userID)
 
-	result, err := r.db.Exec(query, userID)
+	result, err := r.db.ExecWithRetry(query, userID)
 	if err != nil {
-		log.Printf("[ERROR] InvalidateAllUserSessions failed: %v", err)
+		slog.Error("Failed to invalidate all sessions", "user_id", userID, "error", err)
 		return err
 	}
 
 	rowsAffected, _ := result.RowsAffected()
-	log.Printf("[DEBUG] InvalidateAllUserSessions - Rows deleted: %d", rowsAffected)
+	slog.Debug("All sessions invalidated", "user_id", userID, "rows", rowsAffected)
 
 	return nil
 }
 
-// UpdateActivity updates last activity timestamp
-func (r *SessionRepository) UpdateActivity(deviceID string) error {
-	query := "UPDATE sessions SET last_activity = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE device_id = ?"
+// DeleteAllSessions removes every session of every user and returns the
+// deleted session ids so their live connections can be notified. The ids
+// come back from the DELETE itself, so a session created concurrently is
+// either deleted and reported or left alone, never deleted unreported
+func (r *SessionRepository) DeleteAllSessions() ([]int, error) {
+	rows, err := r.db.Query("DELETE FROM sessions RETURNING id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan session id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	slog.Info("All sessions deleted", "count", len(ids))
+	return ids, nil
+}
+
+// UpdateActivity updates the last activity timestamp of a session
+func (r *SessionRepository) UpdateActivity(sessionID int) error {
+	query := "UPDATE sessions SET last_activity = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
 
-	_, err := r.db.Exec(query, deviceID)
+	_, err := r.db.ExecWithRetry(query, sessionID)
 	if err != nil {
 		return fmt.Errorf("failed to update activity: %w", err)
 	}
@@ -451,15 +654,15 @@ func (r *SessionRepository) UpdateActivity(deviceID string) error {
 func (r *SessionRepository) DeleteExpiredSessions() error {
 	query := "DELETE FROM sessions WHERE expires_at <= CURRENT_TIMESTAMP"
 
-	result, err := r.db.Exec(query)
+	result, err := r.db.ExecWithRetry(query)
 	if err != nil {
-		log.Printf("[ERROR] DeleteExpiredSessions failed: %v", err)
+		slog.Error("Failed to delete expired sessions", "error", err)
 		return err
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected > 0 {
-		log.Printf("[DEBUG] DeleteExpiredSessions - Rows deleted: %d", rowsAffected)
+		slog.Debug("Expired sessions deleted", "rows", rowsAffected)
 	}
 
 	return nil
@@ -490,13 +693,13 @@ func (r *SessionRepository) InvalidateUserActiveSessions(userID int) error {
 	// Delete all active sessions
 	query := "DELETE FROM sessions WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP"
 
-	result, err := r.db.Exec(query, userID)
+	result, err := r.db.ExecWithRetry(query, userID)
 	if err != nil {
 		return fmt.Errorf("failed to invalidate sessions: %w", err)
 	}
 
 	rowsAffected, _ := result.RowsAffected()
-	log.Printf("[SECURITY] Invalidated %d active sessions for user %d", rowsAffected, userID)
+	logger.Security("Invalidated active sessions", "user_id", userID, "count", rowsAffected)
 
 	return nil
 }
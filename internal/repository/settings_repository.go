@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"Monex/internal/database"
+)
+
+// Keys of server-wide settings stored in app_settings
+const (
+	SettingTokensNotBefore = "tokens_not_before" // unix seconds; tokens issued earlier are rejected
+)
+
+type SettingsRepository struct {
+	db *database.DB
+}
+
+func NewSettingsRepository(db *database.DB) *SettingsRepository {
+	return &SettingsRepository{db: db}
+}
+
+// Get returns the value of a setting, or "" when it has never been set
+func (r *SettingsRepository) Get(key string) (string, error) {
+	var value string
+	err := r.db.QueryRow("SELECT value FROM app_settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get setting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// Set creates or replaces a setting
+func (r *SettingsRepository) Set(key, value string) error {
+	_, err := r.db.ExecWithRetry(`
+		INSERT INTO app_settings (key, value, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, key, value)
+	if err != nil {
+		return fmt.Errorf("failed to set setting %s: %w", key, err)
+	}
+	return nil
+}
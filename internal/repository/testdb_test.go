@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+
+	"Monex/config"
+	"Monex/internal/database"
+)
+
+// newTestDB opens a fresh database under t.TempDir(); it holds only the
+// seeded admin account
+func newTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.New(&config.DatabaseConfig{
+		Path:              filepath.Join(dir, "data.db"),
+		MaxOpenConns:      1,
+		MaxIdleConns:      1,
+		BusyTimeout:       5000,
+		AdminPasswordFile: filepath.Join(dir, ".admin-password.txt"),
+		AdminUsername:     "admin",
+		AdminEmail:        "admin@monex.local",
+	})
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// timestampFormat is how datetimes written as text are stored. Values are
+// always UTC, so string comparison and ORDER BY in SQL stay chronological
+// and match SQLite's CURRENT_TIMESTAMP.
+const timestampFormat = "2006-01-02 15:04:05"
+
+// formatTimestamp converts t to UTC in the stored text format
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampFormat)
+}
+
+// timestampFormats are the layouts parseTimestamp accepts: our own text
+// format, RFC 3339 and everything the sqlite driver writes for time.Time
+var timestampFormats = append([]string{
+	timestampFormat,
+	time.RFC3339Nano,
+}, sqlite3.SQLiteTimestampFormats...)
+
+// parseTimestamp parses a stored datetime and returns it in UTC. Values
+// without a zone are UTC, as SQLite's CURRENT_TIMESTAMP is.
+func parseTimestamp(value string) (time.Time, error) {
+	for _, format := range timestampFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse timestamp: %s", value)
+}
+
+// utcOrNil converts an optional time to UTC for the driver, keeping nil as NULL
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
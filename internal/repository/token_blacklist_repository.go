@@ -2,12 +2,15 @@ package repository
 
 import (
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"Monex/internal/database"
+	"Monex/internal/logger"
+	"Monex/internal/models"
 )
 
 type TokenBlacklistRepository struct {
@@ -24,7 +27,7 @@ func (r *TokenBlacklistRepository) hashToken(token string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// BlacklistToken adds a token to blacklist
+// BlacklistToken adds a token to blacklist (legacy path for tokens without a jti)
 func (r *TokenBlacklistRepository) BlacklistToken(
 	userID int,
 	token string,
@@ -39,12 +42,40 @@ func (r *TokenBlacklistRepository) BlacklistToken(
 		VALUES (?, ?, ?, ?, ?)
 	`
 
-	_, err := r.db.Exec(query, userID, tokenHash, tokenType, expiresAt, reason)
+	_, err := r.db.ExecWithRetry(query, userID, tokenHash, tokenType, formatTimestamp(expiresAt), reason)
 	if err != nil {
 		return fmt.Errorf("failed to blacklist token: %w", err)
 	}
 
-	log.Printf("[SECURITY] Token blacklisted - UserID: %d, Type: %s, Reason: %s", userID, tokenType, reason)
+	logger.Security("Token blacklisted", "user_id", userID, "token_type", tokenType, "reason", reason)
+	return nil
+}
+
+// BlacklistJTI revokes a token by its JWT ID without needing the token
+// itself. Revoking the same jti twice is a no-op.
+func (r *TokenBlacklistRepository) BlacklistJTI(
+	userID int,
+	jti string,
+	tokenType string,
+	expiresAt time.Time,
+	reason string,
+) error {
+	if jti == "" {
+		return fmt.Errorf("jti is required")
+	}
+
+	query := `
+		INSERT INTO token_blacklist (user_id, token_hash, jti, token_type, expires_at, reason)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(token_hash) DO NOTHING
+	`
+
+	_, err := r.db.ExecWithRetry(query, userID, "JTI_"+jti, jti, tokenType, formatTimestamp(expiresAt), reason)
+	if err != nil {
+		return fmt.Errorf("failed to blacklist jti: %w", err)
+	}
+
+	logger.Security("Token ID blacklisted", "user_id", userID, "token_type", tokenType, "reason", reason)
 	return nil
 }
 
@@ -67,44 +98,61 @@ func (r *TokenBlacklistRepository) IsBlacklisted(token string) (bool, error) {
 	return count > 0, nil
 }
 
+// IsRevoked checks the blacklist by jti and, for tokens issued before jti
+// support or revoked via their session hash, by the token hash
+func (r *TokenBlacklistRepository) IsRevoked(jti string, token string) (bool, error) {
+	if jti == "" {
+		return r.IsBlacklisted(token)
+	}
+
+	query := `
+		SELECT COUNT(*) 
+		FROM token_blacklist 
+		WHERE (jti = ? OR token_hash = ?) AND expires_at > CURRENT_TIMESTAMP
+	`
+
+	var count int
+	err := r.db.QueryRow(query, jti, r.hashToken(token)).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check blacklist: %w", err)
+	}
+
+	return count > 0, nil
+}
+
 // BlacklistBySessionID blacklists all tokens for a specific session
 func (r *TokenBlacklistRepository) BlacklistBySessionID(sessionID int, userID int) error {
 	// Get session tokens
 	query := `
-		SELECT access_token_hash, refresh_token_hash, expires_at
+		SELECT access_token_hash, refresh_token_hash,
+		       COALESCE(access_jti, ''), COALESCE(refresh_jti, ''), expires_at
 		FROM sessions
 		WHERE id = ? AND user_id = ?
 	`
 
-	var accessHash, refreshHash string
+	var accessHash, refreshHash, accessJTI, refreshJTI string
 	var expiresAt time.Time
 
-	err := r.db.QueryRow(query, sessionID, userID).Scan(&accessHash, &refreshHash, &expiresAt)
+	err := r.db.QueryRow(query, sessionID, userID).Scan(&accessHash, &refreshHash, &accessJTI, &refreshJTI, &expiresAt)
 	if err != nil {
 		return fmt.Errorf("failed to get session tokens: %w", err)
 	}
 
-	// Blacklist both tokens
-	insertQuery := `
-		INSERT INTO token_blacklist (user_id, token_hash, token_type, expires_at, reason)
-		VALUES (?, ?, ?, ?, ?)
-	`
-
 	reason := fmt.Sprintf("Session %d invalidated", sessionID)
 
 	// Blacklist access token
-	_, err = r.db.Exec(insertQuery, userID, accessHash, "access", expiresAt, reason)
+	err = r.insertSessionToken(userID, accessHash, accessJTI, "access", expiresAt, reason)
 	if err != nil {
-		log.Printf("[WARN] Failed to blacklist access token: %v", err)
+		slog.Warn("Failed to blacklist access token", "session_id", sessionID, "user_id", userID, "error", err)
 	}
 
 	// Blacklist refresh token
-	_, err = r.db.Exec(insertQuery, userID, refreshHash, "refresh", expiresAt, reason)
+	err = r.insertSessionToken(userID, refreshHash, refreshJTI, "refresh", expiresAt, reason)
 	if err != nil {
-		log.Printf("[WARN] Failed to blacklist refresh token: %v", err)
+		slog.Warn("Failed to blacklist refresh token", "session_id", sessionID, "user_id", userID, "error", err)
 	}
 
-	log.Printf("[SECURITY] Session tokens blacklisted - SessionID: %d, UserID: %d", sessionID, userID)
+	logger.Security("Session tokens blacklisted", "session_id", sessionID, "user_id", userID)
 	return nil
 }
 
@@ -112,7 +160,8 @@ func (r *TokenBlacklistRepository) BlacklistBySessionID(sessionID int, userID in
 func (r *TokenBlacklistRepository) BlacklistUserTokens(userID int, reason string) error {
 	// Get all active sessions
 	query := `
-		SELECT id, access_token_hash, refresh_token_hash, expires_at
+		SELECT id, access_token_hash, refresh_token_hash,
+		       COALESCE(access_jti, ''), COALESCE(refresh_jti, ''), expires_at
 		FROM sessions
 		WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP
 	`
@@ -123,38 +172,76 @@ func (r *TokenBlacklistRepository) BlacklistUserTokens(userID int, reason string
 	}
 	defer rows.Close()
 
-	insertQuery := `
-		INSERT INTO token_blacklist (user_id, token_hash, token_type, expires_at, reason)
-		VALUES (?, ?, ?, ?, ?)
-	`
-
 	for rows.Next() {
 		var sessionID int
-		var accessHash, refreshHash string
+		var accessHash, refreshHash, accessJTI, refreshJTI string
 		var expiresAt time.Time
 
-		if err := rows.Scan(&sessionID, &accessHash, &refreshHash, &expiresAt); err != nil {
-			log.Printf("[WARN] Failed to scan session: %v", err)
+		if err := rows.Scan(&sessionID, &accessHash, &refreshHash, &accessJTI, &refreshJTI, &expiresAt); err != nil {
+			slog.Warn("Failed to scan session", "user_id", userID, "error", err)
 			continue
 		}
 
 		// Blacklist access token
-		_, err = r.db.Exec(insertQuery, userID, accessHash, "access", expiresAt, reason)
+		err = r.insertSessionToken(userID, accessHash, accessJTI, "access", expiresAt, reason)
 		if err != nil {
-			log.Printf("[WARN] Failed to blacklist access token: %v", err)
+			slog.Warn("Failed to blacklist access token", "user_id", userID, "error", err)
 		}
 
 		// Blacklist refresh token
-		_, err = r.db.Exec(insertQuery, userID, refreshHash, "refresh", expiresAt, reason)
+		err = r.insertSessionToken(userID, refreshHash, refreshJTI, "refresh", expiresAt, reason)
 		if err != nil {
-			log.Printf("[WARN] Failed to blacklist refresh token: %v", err)
+			slog.Warn("Failed to blacklist refresh token", "user_id", userID, "error", err)
 		}
 	}
 
-	log.Printf("[SECURITY] All user tokens blacklisted - UserID: %d, Reason: %s", userID, reason)
+	logger.Security("All user tokens blacklisted", "user_id", userID, "reason", reason)
 	return nil
 }
 
+// BlacklistAllSessionTokens blacklists the access and refresh tokens of every
+// active session of every user in one statement
+func (r *TokenBlacklistRepository) BlacklistAllSessionTokens(reason string, blacklistedBy int) (int64, error) {
+	query := `
+		INSERT INTO token_blacklist (user_id, token_hash, jti, token_type, expires_at, reason, blacklisted_by)
+		SELECT user_id, access_token_hash, access_jti, 'access', expires_at, ?, ?
+		FROM sessions WHERE expires_at > CURRENT_TIMESTAMP
+		UNION ALL
+		SELECT user_id, refresh_token_hash, refresh_jti, 'refresh', expires_at, ?, ?
+		FROM sessions WHERE expires_at > CURRENT_TIMESTAMP
+		ON CONFLICT(token_hash) DO NOTHING
+	`
+
+	result, err := r.db.ExecWithRetry(query, reason, blacklistedBy, reason, blacklistedBy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to blacklist all session tokens: %w", err)
+	}
+
+	count, _ := result.RowsAffected()
+	logger.Security("Blacklisted all session tokens", "count", count, "reason", reason)
+	return count, nil
+}
+
+// insertSessionToken blacklists a session token by its stored hash and jti.
+// A token that is already blacklisted is left as it is.
+func (r *TokenBlacklistRepository) insertSessionToken(
+	userID int,
+	tokenHash string,
+	jti string,
+	tokenType string,
+	expiresAt time.Time,
+	reason string,
+) error {
+	query := `
+		INSERT INTO token_blacklist (user_id, token_hash, jti, token_type, expires_at, reason)
+		VALUES (?, ?, NULLIF(?, ''), ?, ?, ?)
+		ON CONFLICT(token_hash) DO NOTHING
+	`
+
+	_, err := r.db.ExecWithRetry(query, userID, tokenHash, jti, tokenType, formatTimestamp(expiresAt), reason)
+	return err
+}
+
 // IsSessionActive checks if session still exists and is valid
 func (r *TokenBlacklistRepository) IsSessionActive(sessionID int) (bool, error) {
 	query := `
@@ -176,19 +263,81 @@ func (r *TokenBlacklistRepository) IsSessionActive(sessionID int) (bool, error)
 func (r *TokenBlacklistRepository) CleanupExpired() error {
 	query := `DELETE FROM token_blacklist WHERE expires_at <= CURRENT_TIMESTAMP`
 
-	result, err := r.db.Exec(query)
+	result, err := r.db.ExecWithRetry(query)
 	if err != nil {
 		return fmt.Errorf("failed to cleanup expired tokens: %w", err)
 	}
 
 	rows, _ := result.RowsAffected()
 	if rows > 0 {
-		log.Printf("[CLEANUP] Removed %d expired blacklist entries", rows)
+		slog.Info("Removed expired blacklist entries", "category", "cleanup", "count", rows)
 	}
 
 	return nil
 }
 
+// List returns blacklist entries, most recently blacklisted first, and the
+// total number of entries
+func (r *TokenBlacklistRepository) List(limit, offset int) ([]*models.BlacklistEntry, int, error) {
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM token_blacklist").Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count blacklist entries: %w", err)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, user_id, token_type, reason, blacklisted_at, expires_at
+		FROM token_blacklist
+		ORDER BY blacklisted_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list blacklist entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]*models.BlacklistEntry, 0)
+	for rows.Next() {
+		entry := &models.BlacklistEntry{}
+		var userID sql.NullInt64
+		if err := rows.Scan(&entry.ID, &userID, &entry.TokenType, &entry.Reason,
+			&entry.BlacklistedAt, &entry.ExpiresAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan blacklist entry: %w", err)
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			entry.UserID = &id
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
+
+// Delete removes one blacklist entry, making its token valid again if it
+// hasn't expired. Returns ErrNotFound when the entry doesn't exist.
+func (r *TokenBlacklistRepository) Delete(id int) (*models.BlacklistEntry, error) {
+	entry := &models.BlacklistEntry{}
+	var userID sql.NullInt64
+	err := r.db.QueryRow(`
+		SELECT id, user_id, token_type, reason, blacklisted_at, expires_at, COALESCE(jti, '')
+		FROM token_blacklist WHERE id = ?
+	`, id).Scan(&entry.ID, &userID, &entry.TokenType, &entry.Reason, &entry.BlacklistedAt, &entry.ExpiresAt, &entry.JTI)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("blacklist entry %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blacklist entry: %w", err)
+	}
+	if userID.Valid {
+		uid := int(userID.Int64)
+		entry.UserID = &uid
+	}
+
+	if _, err := r.db.ExecWithRetry("DELETE FROM token_blacklist WHERE id = ?", id); err != nil {
+		return nil, fmt.Errorf("failed to delete blacklist entry: %w", err)
+	}
+	return entry, nil
+}
+
 // This is called when user is disabled or locked
 func (r *TokenBlacklistRepository) BlacklistUserAllTokens(
 	userID int,
@@ -210,16 +359,12 @@ func (r *TokenBlacklistRepository) BlacklistUserAllTokens(
 		ON CONFLICT DO NOTHING
 	`
 
-	_, err := r.db.Exec(query, futureTime, reason, userID)
+	_, err := r.db.ExecWithRetry(query, formatTimestamp(futureTime), reason, userID)
 	if err != nil {
 		return fmt.Errorf("failed to blacklist all user tokens: %w", err)
 	}
 
-	log.Printf(
-		"[SECURITY] Blacklisted all tokens for user %d - Reason: %s",
-		userID,
-		reason,
-	)
+	logger.Security("Blacklisted all tokens", "user_id", userID, "reason", reason)
 	return nil
 }
 
@@ -63,10 +63,10 @@ type TransactionRepository struct {
 
 func (r *TransactionRepository) DeleteAllByUserID(userID int) error {
 	if userID <= 0 {
-		return fmt.Errorf("invalid user ID")
+		return fmt.Errorf("%w: user ID %d", ErrInvalidInput, userID)
 	}
 
-	result, err := r.db.Exec("DELETE FROM transactions WHERE user_id = ?", userID)
+	result, err := r.db.ExecWithRetry("DELETE FROM transactions WHERE user_id = ?", userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete all transactions: %w", err)
 	}
@@ -90,14 +90,15 @@ func (r *TransactionRepository) Create(transaction *models.Transaction) error {
         INSERT INTO transactions (user_id, type, amount, note, is_edited, created_at, updated_at)
         VALUES (?, ?, ?, ?, ?, ?, ?)
     `
-	now := time.Now()
+	now := time.Now().UTC()
 	if transaction.CreatedAt.IsZero() {
 		transaction.CreatedAt = now
 	}
+	transaction.CreatedAt = transaction.CreatedAt.UTC()
 	transaction.UpdatedAt = now
 	transaction.IsEdited = false // ✅ NEW TRANSACTIONS ARE NOT EDITED
 
-	result, err := r.db.Exec(query,
+	result, err := r.db.ExecWithRetry(query,
 		transaction.UserID,
 		transaction.Type,
 		transaction.Amount,
@@ -138,7 +139,7 @@ func (r *TransactionRepository) GetByID(id, userID int) (*models.Transaction, er
 		&transaction.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("transaction not found")
+		return nil, fmt.Errorf("transaction %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get transaction: %w", err)
@@ -146,6 +147,65 @@ func (r *TransactionRepository) GetByID(id, userID int) (*models.Transaction, er
 	return transaction, nil
 }
 
+// GetByIDs retrieves the user's transactions with the given IDs in the
+// order requested. IDs that don't exist or belong to another user are
+// omitted; duplicates are returned once.
+func (r *TransactionRepository) GetByIDs(userID int, ids []int) ([]*models.Transaction, error) {
+	if len(ids) == 0 {
+		return []*models.Transaction{}, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, userID)
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+
+	query := fmt.Sprintf(`
+        SELECT id, user_id, type, amount, note, is_edited, created_at, updated_at
+        FROM transactions
+        WHERE user_id = ? AND id IN (%s)
+    `, strings.Join(placeholders, ", "))
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactions: %w", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[int]*models.Transaction, len(ids))
+	for rows.Next() {
+		transaction := &models.Transaction{}
+		err := rows.Scan(
+			&transaction.ID,
+			&transaction.UserID,
+			&transaction.Type,
+			&transaction.Amount,
+			&transaction.Note,
+			&transaction.IsEdited,
+			&transaction.CreatedAt,
+			&transaction.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		byID[transaction.ID] = transaction
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating transactions: %w", err)
+	}
+
+	transactions := make([]*models.Transaction, 0, len(byID))
+	for _, id := range ids {
+		if transaction, ok := byID[id]; ok {
+			transactions = append(transactions, transaction)
+			delete(byID, id) // a repeated ID is returned once
+		}
+	}
+	return transactions, nil
+}
+
 // List retrieves transactions with filters and pagination
 func (r *TransactionRepository) List(userID, limit, offset int, filters map[string]interface{}) ([]*models.Transaction, int, error) {
 	// ✅ Input validation
@@ -162,24 +222,36 @@ func (r *TransactionRepository) List(userID, limit, offset int, filters map[stri
 	if typeFilter, ok := filters["type"].(string); ok && typeFilter != "" {
 		// ✅ Validate type enum
 		if typeFilter != "deposit" && typeFilter != "withdraw" && typeFilter != "expense" {
-			return nil, 0, fmt.Errorf("invalid transaction type")
+			return nil, 0, fmt.Errorf("%w: transaction type %q", ErrInvalidInput, typeFilter)
 		}
 		whereClauses = append(whereClauses, "type = ?")
 		args = append(args, typeFilter)
 	}
 
+	// ✅ Full-text search joins the FTS5 index and ranks matches; without FTS5 it falls back to LIKE
+	fromClause := "transactions"
+	useFTS := false
 	if search, ok := filters["search"].(string); ok && search != "" {
-		// ✅ Sanitize search input (prevent SQL wildcards exploitation)
-		search = strings.ReplaceAll(search, "%", "\\%")
-		search = strings.ReplaceAll(search, "_", "\\_")
-		whereClauses = append(whereClauses, "note LIKE ? ESCAPE '\\'")
-		args = append(args, "%"+search+"%")
+		useFTS, _ = filters["fts"].(bool)
+		if useFTS && r.db.FTSEnabled && len(strings.Fields(search)) > 0 {
+			fromClause = `transactions JOIN (
+				SELECT rowid AS fts_id, rank AS fts_rank FROM transactions_fts WHERE transactions_fts MATCH ?
+			) fts ON fts.fts_id = transactions.id`
+			args = append([]interface{}{ftsQuery(search)}, args...)
+		} else {
+			useFTS = false
+			// ✅ Sanitize search input (prevent SQL wildcards exploitation)
+			search = strings.ReplaceAll(search, "%", "\\%")
+			search = strings.ReplaceAll(search, "_", "\\_")
+			whereClauses = append(whereClauses, "note LIKE ? ESCAPE '\\'")
+			args = append(args, "%"+search+"%")
+		}
 	}
 
 	whereClause := strings.Join(whereClauses, " AND ")
 
 	// Get total count
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM transactions WHERE %s", whereClause)
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", fromClause, whereClause)
 	var total int
 	err := r.db.QueryRow(countQuery, args...).Scan(&total)
 	if err != nil {
@@ -187,22 +259,24 @@ func (r *TransactionRepository) List(userID, limit, offset int, filters map[stri
 	}
 
 	// ✅ SAFE: Validated sort parameters
-	sortField := validateSortField(
-		filters["sortField"].(string),
-		validTransactionSortFields,
-	)
-	sortOrder := validateSortOrder(
-		filters["sortOrder"].(string),
+	requestedSort, _ := filters["sortField"].(string)
+	requestedOrder, _ := filters["sortOrder"].(string)
+	orderClause := fmt.Sprintf("%s %s",
+		validateSortField(requestedSort, validTransactionSortFields),
+		validateSortOrder(requestedOrder),
 	)
+	if useFTS && requestedSort == "" {
+		orderClause = "fts.fts_rank ASC, " + orderClause // best matches first
+	}
 
 	// ✅ Build query with safe parameters
 	query := fmt.Sprintf(`
 		SELECT id, user_id, type, amount, note, is_edited, created_at, updated_at
-		FROM transactions 
+		FROM %s 
 		WHERE %s 
-		ORDER BY %s %s 
+		ORDER BY %s 
 		LIMIT ? OFFSET ?
-	`, whereClause, sortField, sortOrder)
+	`, fromClause, whereClause, orderClause)
 
 	args = append(args, limit, offset)
 	rows, err := r.db.Query(query, args...)
@@ -237,27 +311,202 @@ func (r *TransactionRepository) List(userID, limit, offset int, filters map[stri
 	return transactions, total, nil
 }
 
-// Update updates a transaction
-func (r *TransactionRepository) Update(transaction *models.Transaction) error {
-	query := `
+// ForEachByUser streams all of a user's transactions in chronological order
+// without loading them into memory; iteration stops at the first error from fn
+func (r *TransactionRepository) ForEachByUser(userID int, fn func(*models.Transaction) error) error {
+	return r.ForEachByUserInRange(userID, time.Time{}, time.Time{}, fn)
+}
+
+// ForEachByUserInRange is ForEachByUser limited to transactions created in
+// [from, to); a zero bound leaves that side open
+func (r *TransactionRepository) ForEachByUserInRange(userID int, from, to time.Time, fn func(*models.Transaction) error) error {
+	rangeClause, args := createdAtRange(from, to)
+	rows, err := r.db.Query(`
+		SELECT id, user_id, type, amount, note, is_edited, created_at, updated_at
+		FROM transactions
+		WHERE user_id = ?`+rangeClause+`
+		ORDER BY created_at ASC, id ASC
+	`, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		transaction := &models.Transaction{}
+		if err := rows.Scan(
+			&transaction.ID,
+			&transaction.UserID,
+			&transaction.Type,
+			&transaction.Amount,
+			&transaction.Note,
+			&transaction.IsEdited,
+			&transaction.CreatedAt,
+			&transaction.UpdatedAt,
+		); err != nil {
+			return fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		if err := fn(transaction); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating transactions: %w", err)
+	}
+	return nil
+}
+
+// ListWithBalance retrieves a page of transactions in chronological order with
+// balance_after set on each. The opening balance of the page is aggregated over
+// all earlier rows, so balances stay continuous across pages.
+func (r *TransactionRepository) ListWithBalance(userID, limit, offset int) ([]*models.Transaction, int, error) {
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM transactions WHERE user_id = ?", userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count transactions: %w", err)
+	}
+
+	// Opening balance: everything before this page in the same ordering
+	var balance int
+	err := r.db.QueryRow(`
+		SELECT COALESCE(SUM(signed), 0) FROM (
+			SELECT CASE WHEN type = 'deposit' THEN amount ELSE -amount END AS signed
+			FROM transactions
+			WHERE user_id = ?
+			ORDER BY created_at ASC, id ASC
+			LIMIT ?
+		)
+	`, userID, offset).Scan(&balance)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to compute opening balance: %w", err)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, user_id, type, amount, note, is_edited, created_at, updated_at
+		FROM transactions
+		WHERE user_id = ?
+		ORDER BY created_at ASC, id ASC
+		LIMIT ? OFFSET ?
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := make([]*models.Transaction, 0, limit)
+	for rows.Next() {
+		transaction := &models.Transaction{}
+		err := rows.Scan(
+			&transaction.ID,
+			&transaction.UserID,
+			&transaction.Type,
+			&transaction.Amount,
+			&transaction.Note,
+			&transaction.IsEdited,
+			&transaction.CreatedAt,
+			&transaction.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+
+		balance += transaction.SignedAmount()
+		balanceAfter := balance
+		transaction.BalanceAfter = &balanceAfter
+
+		transactions = append(transactions, transaction)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating transactions: %w", err)
+	}
+
+	return transactions, total, nil
+}
+
+// ftsQuery turns free text into an FTS5 query: every word must match as a
+// prefix, and quoting keeps user input from being parsed as FTS syntax
+func ftsQuery(search string) string {
+	terms := strings.Fields(search)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// ErrTransactionConflict is returned when a transaction changed since the client last read it
+var ErrTransactionConflict = fmt.Errorf("transaction was modified by another request: %w", ErrConflict)
+
+// storedVersion returns the row's updated_at exactly as stored, or
+// ErrTransactionConflict when it isn't expectedUpdatedAt. updated_at is
+// stored as text; callers match on the exact stored value so a concurrent
+// write between this read and their own statement still conflicts.
+func (r *TransactionRepository) storedVersion(id, userID int, expectedUpdatedAt time.Time) (string, error) {
+	var storedUpdatedAt string
+	err := r.db.QueryRow(
+		"SELECT CAST(updated_at AS TEXT) FROM transactions WHERE id = ? AND user_id = ?",
+		id, userID,
+	).Scan(&storedUpdatedAt)
+	if err == sql.ErrNoRows {
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get transaction version: %w", err)
+	}
+
+	stored, err := parseTimestamp(storedUpdatedAt)
+	if err != nil || !stored.Equal(expectedUpdatedAt) {
+		return "", ErrTransactionConflict
+	}
+	return storedUpdatedAt, nil
+}
+
+// Update updates a transaction. When expectedUpdatedAt is non-zero the update
+// only applies if the row still carries that updated_at (optimistic locking);
+// otherwise ErrTransactionConflict is returned.
+func (r *TransactionRepository) Update(transaction *models.Transaction, expectedUpdatedAt time.Time) error {
+	whereClause := "id = ? AND user_id = ?"
+	whereArgs := []interface{}{transaction.ID, transaction.UserID}
+
+	if !expectedUpdatedAt.IsZero() {
+		storedUpdatedAt, err := r.storedVersion(transaction.ID, transaction.UserID, expectedUpdatedAt)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("transaction %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		whereClause += " AND CAST(updated_at AS TEXT) = ?"
+		whereArgs = append(whereArgs, storedUpdatedAt)
+	}
+
+	query := fmt.Sprintf(`
         UPDATE transactions 
         SET type = ?, amount = ?, note = ?, created_at = ?, 
             is_edited = ?, updated_at = ?
-        WHERE id = ? AND user_id = ?
-    `
-	transaction.UpdatedAt = time.Now()
+        WHERE %s
+    `, whereClause)
+	transaction.CreatedAt = transaction.CreatedAt.UTC()
+	transaction.UpdatedAt = time.Now().UTC()
 	transaction.IsEdited = true // ✅ MARK AS EDITED WHEN UPDATING
 
-	result, err := r.db.Exec(query,
+	args := []interface{}{
 		transaction.Type,
 		transaction.Amount,
 		transaction.Note,
 		transaction.CreatedAt,
 		transaction.IsEdited, // ✅ ADD THIS
 		transaction.UpdatedAt,
-		transaction.ID,
-		transaction.UserID,
-	)
+	}
+	result, err := r.db.ExecWithRetry(query, append(args, whereArgs...)...)
 	if err != nil {
 		return fmt.Errorf("failed to update transaction: %w", err)
 	}
@@ -268,7 +517,10 @@ func (r *TransactionRepository) Update(transaction *models.Transaction) error {
 	}
 
 	if rows == 0 {
-		return fmt.Errorf("transaction not found")
+		if !expectedUpdatedAt.IsZero() {
+			return ErrTransactionConflict
+		}
+		return fmt.Errorf("transaction %w", ErrNotFound)
 	}
 
 	return nil
@@ -276,7 +528,7 @@ func (r *TransactionRepository) Update(transaction *models.Transaction) error {
 
 // Delete deletes a transaction
 func (r *TransactionRepository) Delete(id, userID int) error {
-	result, err := r.db.Exec("DELETE FROM transactions WHERE id = ? AND user_id = ?", id, userID)
+	result, err := r.db.ExecWithRetry("DELETE FROM transactions WHERE id = ? AND user_id = ?", id, userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete transaction: %w", err)
 	}
@@ -287,14 +539,131 @@ func (r *TransactionRepository) Delete(id, userID int) error {
 	}
 
 	if rows == 0 {
-		return fmt.Errorf("transaction not found")
+		return fmt.Errorf("transaction %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// Restore re-inserts a deleted transaction exactly as it was, ID included.
+// ErrTransactionConflict is returned when the ID is taken again.
+func (r *TransactionRepository) Restore(transaction *models.Transaction) error {
+	result, err := r.db.ExecWithRetry(`
+        INSERT OR IGNORE INTO transactions (id, user_id, type, amount, note, is_edited, created_at, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `,
+		transaction.ID,
+		transaction.UserID,
+		transaction.Type,
+		transaction.Amount,
+		transaction.Note,
+		transaction.IsEdited,
+		transaction.CreatedAt.UTC(),
+		transaction.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to restore transaction: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrTransactionConflict
+	}
+	return nil
+}
+
+// Revert writes back every field of an earlier state, updated_at included,
+// if the row is still at expectedUpdatedAt; otherwise, or when the row is
+// gone, ErrTransactionConflict is returned.
+func (r *TransactionRepository) Revert(transaction *models.Transaction, expectedUpdatedAt time.Time) error {
+	storedUpdatedAt, err := r.storedVersion(transaction.ID, transaction.UserID, expectedUpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrTransactionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.ExecWithRetry(`
+        UPDATE transactions
+        SET type = ?, amount = ?, note = ?, created_at = ?, is_edited = ?, updated_at = ?
+        WHERE id = ? AND user_id = ? AND CAST(updated_at AS TEXT) = ?
+    `,
+		transaction.Type,
+		transaction.Amount,
+		transaction.Note,
+		transaction.CreatedAt.UTC(),
+		transaction.IsEdited,
+		transaction.UpdatedAt.UTC(),
+		transaction.ID,
+		transaction.UserID,
+		storedUpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revert transaction: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrTransactionConflict
+	}
+	return nil
+}
+
+// DeleteVersion deletes a transaction only if it is still at
+// expectedUpdatedAt; otherwise, or when it is gone, ErrTransactionConflict
+// is returned.
+func (r *TransactionRepository) DeleteVersion(id, userID int, expectedUpdatedAt time.Time) error {
+	storedUpdatedAt, err := r.storedVersion(id, userID, expectedUpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrTransactionConflict
+	}
+	if err != nil {
+		return err
 	}
 
+	result, err := r.db.ExecWithRetry(
+		"DELETE FROM transactions WHERE id = ? AND user_id = ? AND CAST(updated_at AS TEXT) = ?",
+		id, userID, storedUpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete transaction: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrTransactionConflict
+	}
 	return nil
 }
 
+// CountAll returns the number of transactions across all users
+func (r *TransactionRepository) CountAll() (int, error) {
+	var count int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM transactions").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count transactions: %w", err)
+	}
+	return count, nil
+}
+
 // GetStats retrieves transaction statistics for a user
 func (r *TransactionRepository) GetStats(userID int) (*models.TransactionStats, error) {
+	return r.GetStatsInRange(userID, time.Time{}, time.Time{})
+}
+
+// GetStatsInRange retrieves statistics over transactions created in
+// [from, to); a zero bound leaves that side open
+func (r *TransactionRepository) GetStatsInRange(userID int, from, to time.Time) (*models.TransactionStats, error) {
+	rangeClause, args := createdAtRange(from, to)
 	query := `
 		SELECT 
 			COALESCE(SUM(CASE WHEN type = 'deposit' THEN amount ELSE 0 END), 0) as total_deposit,
@@ -302,11 +671,10 @@ func (r *TransactionRepository) GetStats(userID int) (*models.TransactionStats,
 			COALESCE(SUM(CASE WHEN type = 'expense' THEN amount ELSE 0 END), 0) as total_expense,
 			COUNT(*) as transactions
 		FROM transactions 
-		WHERE user_id = ?
-	`
+		WHERE user_id = ?` + rangeClause
 
 	stats := &models.TransactionStats{}
-	err := r.db.QueryRow(query, userID).Scan(
+	err := r.db.QueryRow(query, append([]interface{}{userID}, args...)...).Scan(
 		&stats.TotalDeposit,
 		&stats.TotalWithdraw,
 		&stats.TotalExpense,
@@ -321,3 +689,20 @@ func (r *TransactionRepository) GetStats(userID int) (*models.TransactionStats,
 
 	return stats, nil
 }
+
+// createdAtRange builds the AND-clause for a created_at range. created_at is
+// written by the driver with a zone offset, so it is normalized with
+// datetime() before comparing against UTC bounds.
+func createdAtRange(from, to time.Time) (string, []interface{}) {
+	clause := ""
+	var args []interface{}
+	if !from.IsZero() {
+		clause += " AND datetime(created_at) >= ?"
+		args = append(args, formatTimestamp(from))
+	}
+	if !to.IsZero() {
+		clause += " AND datetime(created_at) < ?"
+		args = append(args, formatTimestamp(to))
+	}
+	return clause, args
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"Monex/internal/models"
+)
+
+// TestFullTextSearchMatchesLike needs FTS5: go test -tags sqlite_fts5
+func TestFullTextSearchMatchesLike(t *testing.T) {
+	db := newTestDB(t)
+	if !db.FTSEnabled {
+		t.Skip("built without -tags sqlite_fts5")
+	}
+	users := NewUserRepository(db)
+	transactions := NewTransactionRepository(db)
+
+	var owners [2]int
+	for i, name := range []string{"alice", "bob"} {
+		user := &models.User{Username: name, Email: name + "@example.com", Role: models.RoleUser, Active: true, Password: "x"}
+		if err := users.Create(user); err != nil {
+			t.Fatalf("Create %s: %v", name, err)
+		}
+		owners[i] = user.ID
+	}
+
+	notes := []string{"coffee with Sara", "grocery shopping", "Coffee beans", "rent March", "coffee machine repair", "خرید نان", ""}
+	for i, note := range notes {
+		tx := &models.Transaction{UserID: owners[0], Type: "expense", Amount: 100 + i, Note: note, CreatedAt: time.Now().Add(-time.Duration(i) * time.Hour)}
+		if err := transactions.Create(tx); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if err := transactions.Create(&models.Transaction{UserID: owners[1], Type: "expense", Amount: 1, Note: "coffee", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	search := func(query string, fts bool) []int {
+		t.Helper()
+		list, total, err := transactions.List(owners[0], 100, 0, map[string]interface{}{"search": query, "fts": fts})
+		if err != nil {
+			t.Fatalf("List(%q, fts=%t): %v", query, fts, err)
+		}
+		if total != len(list) {
+			t.Fatalf("List(%q, fts=%t): total %d for %d rows", query, fts, total, len(list))
+		}
+		ids := make([]int, len(list))
+		for i, tx := range list {
+			ids[i] = tx.ID
+		}
+		sort.Ints(ids)
+		return ids
+	}
+
+	for _, query := range []string{"coffee", "coff", "groc", "rent march", "خرید", "nothing"} {
+		fts, like := search(query, true), search(query, false)
+		if fmt.Sprint(fts) != fmt.Sprint(like) {
+			t.Errorf("search %q: FTS found %v, LIKE found %v", query, fts, like)
+		}
+	}
+	if got := search("coffee", true); len(got) != 3 {
+		t.Fatalf("FTS search for coffee found %v, want alice's 3 transactions", got)
+	}
+}
+
+func TestGetByIDsKeepsRequestOrderAndOwnership(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserRepository(db)
+	transactions := NewTransactionRepository(db)
+
+	var owners [2]int
+	for i, name := range []string{"alice", "bob"} {
+		user := &models.User{Username: name, Email: name + "@example.com", Role: models.RoleUser, Active: true, Password: "x"}
+		if err := users.Create(user); err != nil {
+			t.Fatalf("Create %s: %v", name, err)
+		}
+		owners[i] = user.ID
+	}
+
+	var alice, bob []int
+	for i := 0; i < 6; i++ {
+		owner := owners[i%2]
+		tx := &models.Transaction{UserID: owner, Type: "deposit", Amount: 100 + i, CreatedAt: time.Now().Add(-time.Duration(i) * time.Hour)}
+		if err := transactions.Create(tx); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if owner == owners[0] {
+			alice = append(alice, tx.ID)
+		} else {
+			bob = append(bob, tx.ID)
+		}
+	}
+
+	// alice asks for her own rows out of order, bob's rows, a missing ID and a repeat
+	requested := []int{alice[2], bob[0], alice[0], 99999, alice[1], bob[1], alice[2]}
+	list, err := transactions.GetByIDs(owners[0], requested)
+	if err != nil {
+		t.Fatalf("GetByIDs: %v", err)
+	}
+	got := make([]int, len(list))
+	for i, tx := range list {
+		if tx.UserID != owners[0] {
+			t.Fatalf("GetByIDs returned transaction %d of user %d", tx.ID, tx.UserID)
+		}
+		got[i] = tx.ID
+	}
+	if want := []int{alice[2], alice[0], alice[1]}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("GetByIDs returned %v, want %v", got, want)
+	}
+
+	if list, err := transactions.GetByIDs(owners[1], alice); err != nil || len(list) != 0 {
+		t.Fatalf("bob asking for alice's IDs got %d rows, err %v; want none", len(list), err)
+	}
+}
@@ -3,11 +3,12 @@ package repository
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"strconv"
 	"strings"
 	"time"
 
 	"Monex/internal/database"
+	"Monex/internal/logger"
 	"Monex/internal/models"
 )
 
@@ -22,11 +23,13 @@ func NewUserRepository(db *database.DB) *UserRepository {
 // Create creates a new user
 func (r *UserRepository) Create(user *models.User) error {
 	query := `
-		INSERT INTO users (username, email, password, role, active, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO users (username, email, password, role, active, email_verified, password_change_required, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	now := time.Now()
-	result, err := r.db.Exec(query, user.Username, user.Email, user.Password, user.Role, user.Active, now, now)
+	now := time.Now().UTC()
+	user.Email = models.NormalizeEmail(user.Email)
+	result, err := r.db.ExecWithRetry(query, user.Username, user.Email, user.Password, user.Role, user.Active, user.EmailVerified,
+		user.PasswordChangeRequired, now, now)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -46,7 +49,7 @@ func (r *UserRepository) Create(user *models.User) error {
 func (r *UserRepository) GetByID(id int) (*models.User, error) {
 	query := `SELECT 
 		id, username, email, password, role, active, 
-		locked, failed_attempts, temp_bans_count, locked_until, permanently_locked,
+		locked, failed_attempts, temp_bans_count, locked_until, permanently_locked, email_verified, COALESCE(password_change_required, 0),
 		created_at, updated_at 
 		FROM users WHERE id = ?`
 
@@ -55,12 +58,12 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 		&user.ID, &user.Username, &user.Email, &user.Password,
 		&user.Role, &user.Active,
 		&user.Locked, &user.FailedAttempts, &user.TempBansCount,
-		&user.LockedUntil, &user.PermanentlyLocked,
+		&user.LockedUntil, &user.PermanentlyLocked, &user.EmailVerified, &user.PasswordChangeRequired,
 		&user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("user %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
@@ -71,18 +74,18 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 // GetByUsername retrieves a user by username
 func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 	query := `SELECT id, username, email, password, role, active, locked, 
-	          failed_attempts, temp_bans_count, locked_until, permanently_locked,
+	          failed_attempts, temp_bans_count, locked_until, permanently_locked, email_verified, COALESCE(password_change_required, 0),
 	          created_at, updated_at 
 	          FROM users WHERE username = ?`
 	user := &models.User{}
 	err := r.db.QueryRow(query, username).Scan(
 		&user.ID, &user.Username, &user.Email, &user.Password,
 		&user.Role, &user.Active, &user.Locked, &user.FailedAttempts,
-		&user.TempBansCount, &user.LockedUntil, &user.PermanentlyLocked,
+		&user.TempBansCount, &user.LockedUntil, &user.PermanentlyLocked, &user.EmailVerified, &user.PasswordChangeRequired,
 		&user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("user %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
@@ -97,33 +100,192 @@ func (r *UserRepository) UpdateLockStatus(user *models.User) error {
 		    locked_until = ?, permanently_locked = ?, updated_at = ?
 		WHERE id = ?
 	`
-	now := time.Now()
-	_, err := r.db.Exec(query,
+	now := time.Now().UTC()
+	_, err := r.db.ExecWithRetry(query,
 		user.Locked, user.FailedAttempts, user.TempBansCount,
-		user.LockedUntil, user.PermanentlyLocked, now, user.ID,
+		utcOrNil(user.LockedUntil), user.PermanentlyLocked, now, user.ID,
 	)
 	return err
 }
 
+// LockPendingReview permanently locks the user until an admin unlocks them.
+// Locking the last active admin fails with ErrLastActiveAdmin.
+func (r *UserRepository) LockPendingReview(userID int) error {
+	result, err := r.db.ExecWithRetry(
+		"UPDATE users SET locked = 1, permanently_locked = 1, locked_until = NULL, updated_at = ? WHERE id = ? AND "+keepsActiveAdmin,
+		time.Now().UTC(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return r.guardFailure(userID)
+	}
+	return nil
+}
+
+// IncrementFailedAttempts adds one failed login to the user in a single
+// statement and returns the new count, so concurrent failures can't
+// overwrite each other's increments
+func (r *UserRepository) IncrementFailedAttempts(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		UPDATE users SET failed_attempts = failed_attempts + 1, updated_at = ?
+		WHERE id = ?
+		RETURNING failed_attempts
+	`, time.Now().UTC(), userID).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("user %w", ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment failed attempts: %w", err)
+	}
+	return count, nil
+}
+
+// LockAfterFailedAttempts locks the user for banDuration once they reach the
+// failed login limit, clearing the count and adding a temporary ban. The ban
+// that brings a non-admin to maxTempBans locks them permanently instead
+// (maxTempBans <= 0 never does). It reports whether the lock is permanent.
+func (r *UserRepository) LockAfterFailedAttempts(userID int, banDuration time.Duration, maxTempBans int) (bool, error) {
+	now := time.Now().UTC()
+	permanent := `role != '` + models.RoleAdmin + `' AND ? > 0 AND temp_bans_count + 1 >= ?`
+
+	var permanentlyLocked bool
+	err := r.db.QueryRow(`
+		UPDATE users SET
+			locked = 1,
+			failed_attempts = 0,
+			temp_bans_count = temp_bans_count + 1,
+			permanently_locked = CASE WHEN `+permanent+` THEN 1 ELSE permanently_locked END,
+			locked_until = CASE WHEN `+permanent+` THEN NULL ELSE ? END,
+			updated_at = ?
+		WHERE id = ?
+		RETURNING permanently_locked
+	`, maxTempBans, maxTempBans, maxTempBans, maxTempBans, now.Add(banDuration), now, userID).Scan(&permanentlyLocked)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("user %w", ErrNotFound)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock user: %w", err)
+	}
+	return permanentlyLocked, nil
+}
+
+// ResetFailedAttempts clears the user's failed login count
+func (r *UserRepository) ResetFailedAttempts(userID int) error {
+	_, err := r.db.ExecWithRetry(`
+		UPDATE users SET failed_attempts = 0, updated_at = ?
+		WHERE id = ? AND failed_attempts > 0
+	`, time.Now().UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset failed attempts: %w", err)
+	}
+	return nil
+}
+
+// AutoUnlockExpired clears temporary locks whose locked_until has passed and
+// returns how many users were unlocked. Permanent locks are left alone.
+func (r *UserRepository) AutoUnlockExpired() (int, error) {
+	rows, err := r.db.Query(`
+		SELECT id, locked_until FROM users
+		WHERE locked = 1 AND permanently_locked = 0 AND locked_until IS NOT NULL
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get locked users: %w", err)
+	}
+
+	// locked_until is compared in Go; the driver scans it as UTC
+	now := time.Now().UTC()
+	var expired []int
+	for rows.Next() {
+		var id int
+		var lockedUntil time.Time
+		if err := rows.Scan(&id, &lockedUntil); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan locked user: %w", err)
+		}
+		if now.After(lockedUntil) {
+			expired = append(expired, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	unlocked := 0
+	for _, id := range expired {
+		result, err := r.db.ExecWithRetry(`
+			UPDATE users SET locked = 0, locked_until = NULL, failed_attempts = 0, updated_at = ?
+			WHERE id = ? AND locked = 1 AND permanently_locked = 0
+		`, now, id)
+		if err != nil {
+			return unlocked, fmt.Errorf("failed to unlock user %d: %w", id, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			unlocked++
+		}
+	}
+	return unlocked, nil
+}
+
+// UpdatePassword stores a new password hash for a user
+func (r *UserRepository) UpdatePassword(userID int, passwordHash string) error {
+	query := `UPDATE users SET password = ?, updated_at = ? WHERE id = ?`
+	_, err := r.db.ExecWithRetry(query, passwordHash, time.Now().UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+// SetActive enables or disables a user's account without touching their data.
+// Disabling the last active admin fails with ErrLastActiveAdmin.
+func (r *UserRepository) SetActive(userID int, active bool) error {
+	result, err := r.db.ExecWithRetry(
+		"UPDATE users SET active = ?, updated_at = ? WHERE id = ? AND (? OR "+keepsActiveAdmin+")",
+		active, time.Now().UTC(), userID, active,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update active status: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return r.guardFailure(userID)
+	}
+	return nil
+}
+
+// MarkEmailVerified records that the user confirmed ownership of their email
+func (r *UserRepository) MarkEmailVerified(userID int) error {
+	query := `UPDATE users SET email_verified = 1, updated_at = ? WHERE id = ?`
+	_, err := r.db.ExecWithRetry(query, time.Now().UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+	return nil
+}
+
 // GetByEmail retrieves a user by email
 func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 	query := `SELECT 
 		id, username, email, password, role, active,
-		locked, failed_attempts, temp_bans_count, locked_until, permanently_locked,
+		locked, failed_attempts, temp_bans_count, locked_until, permanently_locked, email_verified, COALESCE(password_change_required, 0),
 		created_at, updated_at 
 		FROM users WHERE email = ?`
+	email = models.NormalizeEmail(email)
 
 	user := &models.User{}
 	err := r.db.QueryRow(query, email).Scan(
 		&user.ID, &user.Username, &user.Email, &user.Password,
 		&user.Role, &user.Active,
 		&user.Locked, &user.FailedAttempts, &user.TempBansCount,
-		&user.LockedUntil, &user.PermanentlyLocked,
+		&user.LockedUntil, &user.PermanentlyLocked, &user.EmailVerified, &user.PasswordChangeRequired,
 		&user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("user %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
@@ -154,6 +316,29 @@ func (r *UserRepository) List(limit, offset int, filters map[string]interface{})
 		args = append(args, searchPattern, searchPattern)
 	}
 
+	if role, ok := filters["role"].(string); ok && role != "" {
+		// ✅ Validate role enum
+		if role != models.RoleAdmin && role != models.RoleUser {
+			return nil, 0, fmt.Errorf("%w: role %q", ErrInvalidInput, role)
+		}
+		whereClauses = append(whereClauses, "role = ?")
+		args = append(args, role)
+	}
+
+	// active and locked are "true" or "false"
+	for _, column := range []string{"active", "locked"} {
+		value, ok := filters[column].(string)
+		if !ok || value == "" {
+			continue
+		}
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %s %q", ErrInvalidInput, column, value)
+		}
+		whereClauses = append(whereClauses, column+" = ?")
+		args = append(args, flag)
+	}
+
 	whereClause := ""
 	if len(whereClauses) > 0 {
 		whereClause = "WHERE " + strings.Join(whereClauses, " AND ")
@@ -189,7 +374,7 @@ func (r *UserRepository) List(limit, offset int, filters map[string]interface{})
 
 	query := fmt.Sprintf(`
 		SELECT id, username, email, password, role, active, 
-			locked, failed_attempts, temp_bans_count, locked_until, permanently_locked,
+			locked, failed_attempts, temp_bans_count, locked_until, permanently_locked, email_verified, COALESCE(password_change_required, 0),
 			created_at, updated_at 
 		FROM users 
 		%s
@@ -211,7 +396,7 @@ func (r *UserRepository) List(limit, offset int, filters map[string]interface{})
 			&user.ID, &user.Username, &user.Email, &user.Password,
 			&user.Role, &user.Active,
 			&user.Locked, &user.FailedAttempts, &user.TempBansCount,
-			&user.LockedUntil, &user.PermanentlyLocked,
+			&user.LockedUntil, &user.PermanentlyLocked, &user.EmailVerified, &user.PasswordChangeRequired,
 			&user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
@@ -234,15 +419,18 @@ func (r *UserRepository) Update(user *models.User) error {
 		UPDATE users 
 		SET username = ?, email = ?, password = ?, role = ?, active = ?,
 		    locked = ?, failed_attempts = ?, temp_bans_count = ?, 
-		    locked_until = ?, permanently_locked = ?, updated_at = ?
-		WHERE id = ?
+		    locked_until = ?, permanently_locked = ?, email_verified = ?,
+		    password_change_required = ?, updated_at = ?
+		WHERE id = ? AND (? OR ` + keepsActiveAdmin + `)
 	`
-	now := time.Now()
-	result, err := r.db.Exec(query,
+	now := time.Now().UTC()
+	user.Email = models.NormalizeEmail(user.Email)
+	result, err := r.db.ExecWithRetry(query,
 		user.Username, user.Email, user.Password, user.Role, user.Active,
 		user.Locked, user.FailedAttempts, user.TempBansCount,
-		user.LockedUntil, user.PermanentlyLocked, now,
-		user.ID,
+		utcOrNil(user.LockedUntil), user.PermanentlyLocked, user.EmailVerified,
+		user.PasswordChangeRequired, now,
+		user.ID, user.IsActiveAdmin(),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
@@ -254,15 +442,16 @@ func (r *UserRepository) Update(user *models.User) error {
 	}
 
 	if rows == 0 {
-		return fmt.Errorf("user not found")
+		return r.guardFailure(user.ID)
 	}
 
 	return nil
 }
 
-// Delete deletes a user
+// Delete deletes a user. Deleting the last active admin fails with
+// ErrLastActiveAdmin.
 func (r *UserRepository) Delete(id int) error {
-	result, err := r.db.Exec("DELETE FROM users WHERE id = ?", id)
+	result, err := r.db.ExecWithRetry("DELETE FROM users WHERE id = ? AND "+keepsActiveAdmin, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -273,12 +462,64 @@ func (r *UserRepository) Delete(id int) error {
 	}
 
 	if rows == 0 {
-		return fmt.Errorf("user not found")
+		return r.guardFailure(id)
 	}
 
 	return nil
 }
 
+// keepsActiveAdmin matches a user row only if it isn't the last admin who can
+// sign in (active and not permanently locked). Writes that could take that
+// away put it in their own WHERE clause: SQLite runs each statement under
+// the write lock, so the count and the write can't interleave with another
+// demotion the way a separate CountActiveAdmins check can.
+const keepsActiveAdmin = `NOT (role = '` + models.RoleAdmin + `' AND active = 1 AND permanently_locked = 0 AND
+	(SELECT COUNT(*) FROM users WHERE role = '` + models.RoleAdmin + `' AND active = 1 AND permanently_locked = 0) <= 1)`
+
+// guardFailure explains a guarded write to userID that changed no row
+func (r *UserRepository) guardFailure(userID int) error {
+	var exists int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check user: %w", err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+	return fmt.Errorf("user %d is the %w", userID, ErrLastActiveAdmin)
+}
+
+// CountByStatus returns the number of users in each account state
+func (r *UserRepository) CountByStatus() (*models.UserCounts, error) {
+	counts := &models.UserCounts{}
+	err := r.db.QueryRow(`
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN active = 1 AND locked = 0 AND permanently_locked = 0 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN active = 1 AND (locked = 1 OR permanently_locked = 1) THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN active = 0 THEN 1 ELSE 0 END), 0)
+		FROM users
+	`).Scan(&counts.Total, &counts.Active, &counts.Locked, &counts.Disabled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	return counts, nil
+}
+
+// CountActiveAdmins returns the number of admins who can still sign in:
+// active and not permanently locked
+func (r *UserRepository) CountActiveAdmins() (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM users WHERE role = ? AND active = 1 AND permanently_locked = 0",
+		models.RoleAdmin,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count admins: %w", err)
+	}
+	return count, nil
+}
+
 // ExistsByUsername checks if a username exists
 func (r *UserRepository) ExistsByUsername(username string) (bool, error) {
 	var count int
@@ -292,7 +533,7 @@ func (r *UserRepository) ExistsByUsername(username string) (bool, error) {
 // ExistsByEmail checks if an email exists
 func (r *UserRepository) ExistsByEmail(email string) (bool, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&count)
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", models.NormalizeEmail(email)).Scan(&count)
 	if err != nil {
 		return false, fmt.Errorf("failed to check email: %w", err)
 	}
@@ -326,7 +567,7 @@ func (r *UserRepository) IsUserValid(userID int) (bool, string) {
 // InvalidateUserSessions invalidates all active sessions for a user
 func (r *UserRepository) InvalidateUserSessions(userID int) error {
 	// This should be called when user is disabled
-	log.Printf("[SECURITY] Invalidating all sessions for user %d", userID)
+	logger.Security("Invalidating all sessions", "user_id", userID)
 
 	// Note: Actual invalidation is done in session repository
 	// This is just a marker function for documentation
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"Monex/internal/models"
+)
+
+func TestUserListFilters(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserRepository(db)
+
+	seed := []struct {
+		username, role string
+		active, locked bool
+	}{
+		{"alice", models.RoleUser, true, false},
+		{"bob", models.RoleUser, false, false},
+		{"carol", models.RoleAdmin, true, true},
+		{"dave", models.RoleUser, true, true},
+	}
+	for _, s := range seed {
+		user := &models.User{Username: s.username, Email: s.username + "@example.com", Role: s.role, Active: s.active}
+		if err := user.SetPassword("Str0ng!Passw0rd", 4); err != nil {
+			t.Fatalf("SetPassword: %v", err)
+		}
+		if err := users.Create(user); err != nil {
+			t.Fatalf("Create %s: %v", s.username, err)
+		}
+		if _, err := db.Exec("UPDATE users SET active = ?, locked = ? WHERE id = ?", s.active, s.locked, user.ID); err != nil {
+			t.Fatalf("update %s: %v", s.username, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		filters map[string]interface{}
+		want    []string
+	}{
+		{"no filters", nil, []string{"admin", "alice", "bob", "carol", "dave"}},
+		{"search username", map[string]interface{}{"search": "ali"}, []string{"alice"}},
+		{"search email", map[string]interface{}{"search": "example.com"}, []string{"alice", "bob", "carol", "dave"}},
+		{"role", map[string]interface{}{"role": models.RoleAdmin}, []string{"admin", "carol"}},
+		{"inactive", map[string]interface{}{"active": "false"}, []string{"bob"}},
+		{"locked", map[string]interface{}{"locked": "true"}, []string{"carol", "dave"}},
+		{"combined", map[string]interface{}{"search": "example.com", "role": models.RoleUser, "active": "true", "locked": "true"}, []string{"dave"}},
+		{"combined without match", map[string]interface{}{"role": models.RoleAdmin, "active": "false"}, []string{}},
+	}
+	for _, tt := range tests {
+		filters := map[string]interface{}{"sortField": "username", "sortOrder": "asc"}
+		for key, value := range tt.filters {
+			filters[key] = value
+		}
+		list, total, err := users.List(100, 0, filters)
+		if err != nil {
+			t.Fatalf("%s: List: %v", tt.name, err)
+		}
+		got := make([]string, len(list))
+		for i, user := range list {
+			got[i] = user.Username
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || total != len(tt.want) {
+			t.Errorf("%s: List() = %v (total %d), want %v", tt.name, got, total, tt.want)
+		}
+	}
+
+	for _, filters := range []map[string]interface{}{
+		{"role": "owner"},
+		{"active": "maybe"},
+		{"locked": "1x"},
+	} {
+		if _, _, err := users.List(10, 0, filters); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("List(%v) error = %v, want ErrInvalidInput", filters, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"Monex/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// selfSignedValidity is how long a generated certificate is valid
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// Ensure prepares the certificate files required by cfg.Mode:
+//   - disabled: nothing to do, the server speaks plain HTTP
+//   - provided: the files must exist and form a valid pair; they are never touched
+//   - auto: a usable pair is kept, otherwise a self-signed one is generated
+//   - acme: certificates come from NewACMEManager; only the cache dir is prepared
+func Ensure(cfg *config.TLSConfig) error {
+	switch cfg.Mode {
+	case config.TLSModeDisabled:
+		return nil
+
+	case config.TLSModeProvided:
+		if _, err := loadValid(cfg.CertFile, cfg.KeyFile); err != nil {
+			return fmt.Errorf("TLS_MODE=provided but the certificate is unusable (cert %s, key %s): %w",
+				cfg.CertFile, cfg.KeyFile, err)
+		}
+		return nil
+
+	case config.TLSModeAuto:
+		_, err := loadValid(cfg.CertFile, cfg.KeyFile)
+		if err == nil {
+			return nil
+		}
+		slog.Warn("TLS certificate missing or invalid, generating a self-signed one", "cert", cfg.CertFile, "reason", err)
+		return generateSelfSigned(cfg.CertFile, cfg.KeyFile, cfg.SelfSignedHosts)
+
+	case config.TLSModeACME:
+		if len(cfg.ACMEDomains) == 0 {
+			return fmt.Errorf("TLS_MODE=acme requires ACME_DOMAINS")
+		}
+		if err := os.MkdirAll(cfg.ACMECacheDir, 0700); err != nil {
+			return fmt.Errorf("failed to create ACME cache directory: %w", err)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown TLS mode %q", cfg.Mode)
+	}
+}
+
+// NewACMEManager returns the Let's Encrypt certificate manager for cfg, or
+// nil unless cfg.Mode is acme. Certificates are requested only for
+// ACMEDomains and renewed automatically before they expire.
+func NewACMEManager(cfg *config.TLSConfig) *autocert.Manager {
+	if cfg.Mode != config.TLSModeACME {
+		return nil
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+		Cache:      autocert.DirCache(cfg.ACMECacheDir),
+		Email:      cfg.ACMEEmail,
+	}
+}
+
+// loadValid loads the pair and rejects certificates that are not currently valid
+func loadValid(certFile, keyFile string) (*x509.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate is valid only from %s to %s",
+			leaf.NotBefore.Format(time.RFC3339), leaf.NotAfter.Format(time.RFC3339))
+	}
+	return leaf, nil
+}
+
+// generateSelfSigned writes a new ECDSA certificate for hosts, which may be
+// DNS names or IP addresses
+func generateSelfSigned(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Monex"}, CommonName: "Monex self-signed"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create certificate directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	slog.Info("Generated self-signed TLS certificate", "cert", certFile, "hosts", hosts, "expires", template.NotAfter.Format(time.RFC3339))
+	return nil
+}
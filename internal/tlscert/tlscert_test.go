@@ -0,0 +1,173 @@
+package tlscert
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Monex/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsConfig returns a config whose certificate files live in a fresh directory
+func tlsConfig(t *testing.T, mode string) *config.TLSConfig {
+	t.Helper()
+	dir := t.TempDir()
+	return &config.TLSConfig{
+		Mode:            mode,
+		CertFile:        filepath.Join(dir, "certs", "cert.pem"),
+		KeyFile:         filepath.Join(dir, "certs", "key.pem"),
+		SelfSignedHosts: []string{"localhost", "127.0.0.1"},
+		ACMECacheDir:    filepath.Join(dir, "acme"),
+	}
+}
+
+// readPair returns the certificate and key file contents
+func readPair(t *testing.T, cfg *config.TLSConfig) ([]byte, []byte) {
+	t.Helper()
+	cert, err := os.ReadFile(cfg.CertFile)
+	if err != nil {
+		t.Fatalf("read certificate: %v", err)
+	}
+	key, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		t.Fatalf("read key: %v", err)
+	}
+	return cert, key
+}
+
+func TestEnsureModes(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		cfg := tlsConfig(t, config.TLSModeDisabled)
+		if err := Ensure(cfg); err != nil {
+			t.Fatalf("Ensure: %v", err)
+		}
+		if _, err := os.Stat(cfg.CertFile); err == nil {
+			t.Fatal("certificate generated with TLS disabled")
+		}
+	})
+
+	t.Run("auto", func(t *testing.T) {
+		cfg := tlsConfig(t, config.TLSModeAuto)
+		if err := Ensure(cfg); err != nil {
+			t.Fatalf("Ensure: %v", err)
+		}
+		leaf, err := loadValid(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			t.Fatalf("generated pair unusable: %v", err)
+		}
+		if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "localhost" || len(leaf.IPAddresses) != 1 {
+			t.Errorf("certificate for %v and %v, want localhost and 127.0.0.1", leaf.DNSNames, leaf.IPAddresses)
+		}
+		info, err := os.Stat(cfg.KeyFile)
+		if err != nil {
+			t.Fatalf("stat key: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("key file permissions = %o, want 600", perm)
+		}
+
+		// A usable pair is kept
+		cert, key := readPair(t, cfg)
+		if err := Ensure(cfg); err != nil {
+			t.Fatalf("Ensure with a usable pair: %v", err)
+		}
+		if newCert, newKey := readPair(t, cfg); !bytes.Equal(cert, newCert) || !bytes.Equal(key, newKey) {
+			t.Fatal("usable pair regenerated")
+		}
+
+		// A broken one is replaced
+		if err := os.WriteFile(cfg.CertFile, []byte("not a certificate"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Ensure(cfg); err != nil {
+			t.Fatalf("Ensure with a broken pair: %v", err)
+		}
+		if _, err := loadValid(cfg.CertFile, cfg.KeyFile); err != nil {
+			t.Fatalf("broken pair not replaced: %v", err)
+		}
+	})
+
+	t.Run("provided", func(t *testing.T) {
+		cfg := tlsConfig(t, config.TLSModeProvided)
+		if err := Ensure(cfg); err == nil {
+			t.Fatal("missing certificate accepted")
+		}
+		if _, err := os.Stat(cfg.CertFile); err == nil {
+			t.Fatal("certificate generated for TLS_MODE=provided")
+		}
+
+		if err := generateSelfSigned(cfg.CertFile, cfg.KeyFile, cfg.SelfSignedHosts); err != nil {
+			t.Fatalf("generateSelfSigned: %v", err)
+		}
+		if err := Ensure(cfg); err != nil {
+			t.Fatalf("Ensure with a valid pair: %v", err)
+		}
+
+		// A broken provided certificate is reported, never overwritten
+		if err := os.WriteFile(cfg.CertFile, []byte("not a certificate"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Ensure(cfg); err == nil {
+			t.Fatal("broken certificate accepted")
+		}
+		if cert, _ := readPair(t, cfg); string(cert) != "not a certificate" {
+			t.Fatal("provided certificate overwritten")
+		}
+	})
+
+	t.Run("acme", func(t *testing.T) {
+		cfg := tlsConfig(t, config.TLSModeACME)
+		if err := Ensure(cfg); err == nil {
+			t.Fatal("acme without ACME_DOMAINS accepted")
+		}
+
+		cfg.ACMEDomains = []string{"monex.example.com"}
+		if err := Ensure(cfg); err != nil {
+			t.Fatalf("Ensure: %v", err)
+		}
+		if info, err := os.Stat(cfg.ACMECacheDir); err != nil || !info.IsDir() {
+			t.Fatalf("ACME cache directory not created: %v", err)
+		}
+		if _, err := os.Stat(cfg.CertFile); err == nil {
+			t.Fatal("self-signed certificate generated for acme")
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		if err := Ensure(tlsConfig(t, "letsencrypt")); err == nil {
+			t.Fatal("unknown TLS mode accepted")
+		}
+	})
+}
+
+func TestNewACMEManagerOnlyForACME(t *testing.T) {
+	for _, mode := range []string{config.TLSModeDisabled, config.TLSModeProvided, config.TLSModeAuto} {
+		if m := NewACMEManager(tlsConfig(t, mode)); m != nil {
+			t.Errorf("%s: got an ACME manager, want nil", mode)
+		}
+	}
+
+	cfg := tlsConfig(t, config.TLSModeACME)
+	cfg.ACMEDomains = []string{"monex.example.com"}
+	cfg.ACMEEmail = "ops@example.com"
+	m := NewACMEManager(cfg)
+	if m == nil {
+		t.Fatal("no ACME manager for TLS_MODE=acme")
+	}
+	if m.Email != cfg.ACMEEmail {
+		t.Errorf("Email = %q, want %q", m.Email, cfg.ACMEEmail)
+	}
+	if cache, ok := m.Cache.(autocert.DirCache); !ok || string(cache) != cfg.ACMECacheDir {
+		t.Errorf("Cache = %#v, want DirCache(%q)", m.Cache, cfg.ACMECacheDir)
+	}
+	if err := m.HostPolicy(context.Background(), "monex.example.com"); err != nil {
+		t.Errorf("configured domain refused: %v", err)
+	}
+	if err := m.HostPolicy(context.Background(), "other.example.com"); err == nil {
+		t.Error("certificate allowed for a domain outside ACME_DOMAINS")
+	}
+}
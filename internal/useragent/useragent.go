@@ -1,25 +1,33 @@
-package handlers
+// Package useragent derives a coarse device description from User-Agent headers
+package useragent
 
 import (
 	"strings"
 )
 
-type DeviceInfo struct {
+// Info is the device a User-Agent describes
+type Info struct {
 	DeviceName string
 	Browser    string
 	OS         string
 }
 
-// ParseUserAgent extracts device info from User-Agent header
-func ParseUserAgent(userAgent string) DeviceInfo {
+// Unknown values, used when the header doesn't reveal the OS or browser
+const (
+	UnknownBrowser = "Unknown Browser"
+	UnknownOS      = "Unknown OS"
+)
+
+// Parse extracts device info from User-Agent header
+func Parse(userAgent string) Info {
 	// Simple parser (install ua-parser-go for production)
 	// go get github.com/ua-parser/uap-go/v2
-	
+
 	// Fallback implementation (basic)
-	device := DeviceInfo{
+	device := Info{
 		DeviceName: "Unknown Device",
-		Browser:    "Unknown Browser",
-		OS:         "Unknown OS",
+		Browser:    UnknownBrowser,
+		OS:         UnknownOS,
 	}
 
 	ua := strings.ToLower(userAgent)
@@ -52,4 +60,4 @@ func ParseUserAgent(userAgent string) DeviceInfo {
 	device.DeviceName = device.Browser + " on " + device.OS
 
 	return device
-}
\ No newline at end of file
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"crypto/tls"
 	"embed"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -17,19 +19,24 @@ import (
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"Monex/config"
 	"Monex/internal/database"
 	"Monex/internal/handlers"
+	"Monex/internal/instancelock"
+	"Monex/internal/logger"
+	"Monex/internal/metrics"
 	"Monex/internal/middleware"
+	"Monex/internal/notifier"
 	"Monex/internal/repository"
+	"Monex/internal/tlscert"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	echomiddleware "github.com/labstack/echo/v4/middleware"
-	"golang.org/x/time/rate"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
@@ -92,8 +99,16 @@ func initLogger() error {
 		return fmt.Errorf("failed to get working directory: %v", err)
 	}
 
+	// Logs live under DATA_DIR when it is set
+	if dataDir := os.Getenv("DATA_DIR"); dataDir != "" {
+		if err := config.EnsureDataDir(dataDir); err != nil {
+			return fmt.Errorf("failed to create data directory: %v", err)
+		}
+		workDir = dataDir
+	}
+
 	logFileName := getEnvOrDefault("LOG_FILENAME", "monex.log")
-	logFilePath = filepath.Join(workDir, logFileName)
+	logFilePath = config.ResolveDataPath(workDir, logFileName)
 
 	maxSize, _ := strconv.Atoi(getEnvOrDefault("LOG_MAX_SIZE", "5"))
 	maxBackups, _ := strconv.Atoi(getEnvOrDefault("LOG_MAX_BACKUPS", "5"))
@@ -119,73 +134,80 @@ func initLogger() error {
 		logOutput = io.MultiWriter(os.Stdout, lumberjackLogger)
 	}
 
-	log.SetOutput(logOutput)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	log.Println("Logger initialized successfully using .env config")
+	logFormat := getEnvOrDefault("LOG_FORMAT", "text")
+	logLevel := getEnvOrDefault("LOG_LEVEL", "info")
+	logger.Setup(logOutput, logFormat, logLevel)
+	slog.Info("Logger initialized", "format", logFormat, "level", logLevel)
 	return nil
 }
 
 func logSystemInfo() {
-	log.Printf("\n%s ==========================================", icons.Chart)
-	log.Printf("%s  SYSTEM INFORMATION", icons.Chart)
-	log.Printf("%s ==========================================", icons.Chart)
-	log.Printf("Operating System: %s", runtime.GOOS)
-	log.Printf("Architecture: %s", runtime.GOARCH)
-	log.Printf("Go Version: %s", runtime.Version())
-	log.Printf("Number of CPUs: %d", runtime.NumCPU())
+	attrs := []any{
+		"os", runtime.GOOS,
+		"arch", runtime.GOARCH,
+		"go_version", runtime.Version(),
+		"cpus", runtime.NumCPU(),
+	}
 
 	exePath, err := os.Executable()
 	if err != nil {
-		log.Printf("%s Failed to get executable path: %v", icons.Warning, err)
+		slog.Warn("Failed to get executable path", "error", err)
 	} else {
-		log.Printf("Executable Path: %s", exePath)
-		log.Printf("Executable Directory: %s", filepath.Dir(exePath))
+		attrs = append(attrs, "executable", exePath, "executable_dir", filepath.Dir(exePath))
 	}
 
 	workDir, err := os.Getwd()
 	if err != nil {
-		log.Printf("%s Failed to get working directory: %v", icons.Warning, err)
+		slog.Warn("Failed to get working directory", "error", err)
 	} else {
-		log.Printf("Working Directory: %s", workDir)
+		attrs = append(attrs, "work_dir", workDir)
 	}
-	log.Printf("%s ==========================================\n", icons.Chart)
+	slog.Info(icons.Chart+" System information", attrs...)
 }
 
 func main() {
 	// 1. Initialize logger FIRST
 	if err := initLogger(); err != nil {
 		fmt.Fprintf(os.Stderr, "CRITICAL: Failed to initialize logger: %v\n", err)
-		log.SetOutput(os.Stdout)
+		logger.Setup(os.Stdout, getEnvOrDefault("LOG_FORMAT", "text"), getEnvOrDefault("LOG_LEVEL", "info"))
 	} else {
-		log.Printf("%s Log file created: %s", icons.Check, logFilePath)
+		slog.Info(icons.Check+" Log file created", "path", logFilePath)
 	}
 
 	// 2. Load configuration immediately to get the correct PORT
-	log.Printf("%s Loading configuration...", icons.Lock)
+	slog.Info(icons.Lock + " Loading configuration...")
 	cfg := config.Load()
-	log.Printf("%s Configuration loaded successfully", icons.Check)
+	slog.Info(icons.Check + " Configuration loaded successfully")
+	desktop := desktopBehaviorFor(cfg, runtime.GOOS)
 
 	// Wrap everything in recovery
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("\n%s PANIC RECOVERED: %v", icons.Stop, r)
 			buf := make([]byte, 4096)
 			n := runtime.Stack(buf, false)
-			log.Printf("%s", buf[:n])
-			if runtime.GOOS == "windows" {
-				log.Println("\nPress Enter to close...")
+			slog.Error(icons.Stop+" PANIC RECOVERED", "panic", r, "stack", string(buf[:n]))
+			if desktop.promptBeforeClose {
+				fmt.Println("\nPress Enter to close...")
 				fmt.Scanln()
 			}
 			os.Exit(1)
 		}
 	}()
 
-	// 4. Check if another instance is running
-	checkAddr := net.JoinHostPort("localhost", cfg.Server.Port)
-	conn, err := net.Dial("tcp", checkAddr)
-	if err == nil {
-		conn.Close()
-		notifyURL := fmt.Sprintf("http://%s/__activate", checkAddr)
+	// 4. Make sure this is the only instance using the data directory. The
+	// OS-level lock can't race the way probing the port did.
+	instanceLock, err := instancelock.Acquire(config.ResolveDataPath(cfg.DataDir, "monex.lock"))
+	if errors.Is(err, instancelock.ErrLocked) && cfg.Server.Headless {
+		slog.Error(icons.Stop+" Another instance is already using the data directory", "data_dir", cfg.DataDir)
+		os.Exit(1)
+	}
+	if errors.Is(err, instancelock.ErrLocked) && !desktop.activateRunning {
+		slog.Info(icons.Check+" Another instance is already running", "data_dir", cfg.DataDir)
+		os.Exit(0)
+	}
+	if errors.Is(err, instancelock.ErrLocked) {
+		// Ask the running instance to open the browser instead
+		notifyURL := fmt.Sprintf("%s://%s/__activate", serverScheme(&cfg.TLS), cfg.Server.LocalAddr())
 
 		tr := &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
@@ -196,63 +218,103 @@ func main() {
 		if err == nil {
 			io.Copy(io.Discard, resp.Body)
 			resp.Body.Close()
-			log.Printf("%s Notified running instance to activate browser. Exiting.", icons.Check)
+			slog.Info(icons.Check + " Notified running instance to activate browser. Exiting.")
 		} else {
-			log.Printf("%s Another instance is running but activation request failed: %v", icons.Warning, err)
+			slog.Warn(icons.Warning+" Another instance is running but activation request failed", "error", err)
 		}
 		os.Exit(0)
 	}
+	if err != nil {
+		slog.Error(icons.Stop+" Failed to acquire instance lock", "error", err)
+		os.Exit(1)
+	}
 
-	log.Printf("\n%s ==========================================", icons.Rocket)
-	log.Printf("%s  MONEX - Transaction Management System", icons.Chart)
-	log.Printf("%s ==========================================\n", icons.Rocket)
+	slog.Info(icons.Rocket + " MONEX - Transaction Management System")
 
 	logSystemInfo()
 
 	// Validate basic settings
 	if cfg.JWT.Secret == "" || len(cfg.JWT.Secret) < 32 {
-		log.Fatalf("%s CRITICAL: JWT_SECRET must be set and at least 32 characters long", icons.Stop)
+		slog.Error(icons.Stop + " CRITICAL: JWT_SECRET must be set and at least 32 characters long")
+		os.Exit(1)
+	}
+
+	// A configured admin password must satisfy the same policy as user passwords
+	if cfg.Database.AdminPassword != "" {
+		if err := handlers.ValidatePasswordStrength(cfg.Database.AdminPassword, &cfg.Security.PasswordPolicy); err != nil {
+			var policyErr *handlers.PasswordPolicyError
+			if errors.As(err, &policyErr) {
+				slog.Error(icons.Stop+" CRITICAL: ADMIN_PASSWORD does not meet the password policy", "violations", policyErr.Violations)
+			} else {
+				slog.Error(icons.Stop+" CRITICAL: ADMIN_PASSWORD could not be checked", "error", err)
+			}
+			os.Exit(1)
+		}
 	}
 
 	// Initialize database
-	log.Printf("%s Initializing database...", icons.Database)
+	slog.Info(icons.Database+" Initializing database...", "path", cfg.Database.Path)
 	dbDir := filepath.Dir(cfg.Database.Path)
 	if dbDir == "." || dbDir == "" {
 		dbDir, _ = os.Getwd()
 	}
 	_ = os.MkdirAll(dbDir, 0755)
 
-	db := database.New(&cfg.Database)
-	if db == nil {
-		log.Fatalf("%s CRITICAL: Database initialization returned nil", icons.Stop)
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		slog.Error(icons.Stop+" CRITICAL: Database initialization failed", "error", err)
+		os.Exit(1)
 	}
 	defer db.Close()
-	log.Printf("%s Database initialized successfully", icons.Check)
+	slog.Info(icons.Check+" Database initialized successfully", "fts", db.FTSEnabled)
+
+	// Background jobs stop when this context is cancelled during shutdown
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
 
-	middleware.Blacklist.StartCleanupRoutine(10 * time.Minute)
+	middleware.Blacklist.StartCleanupRoutine(backgroundCtx, cfg.Cleanup.BlacklistInterval)
+	handlers.ConfigureLoginTracker(cfg.Security.RateLimitEntryTTL, cfg.Security.RateLimitMaxEntries)
+	handlers.StartLoginTrackerCleanup(backgroundCtx, 15*time.Minute)
 
 	// Initialize Server
-	log.Printf("%s Initializing HTTP server...", icons.Globe)
+	slog.Info(icons.Globe + " Initializing HTTP server...")
 	e := echo.New()
 	e.HideBanner = true
 	e.Logger.SetOutput(io.Discard)
+	e.HTTPErrorHandler = middleware.HTTPErrorHandler
+
+	// Client IPs come from X-Forwarded-For only when the direct peer is a trusted proxy
+	trustedProxies, err := middleware.ParseCIDRList(cfg.Security.TrustedProxies)
+	if err != nil {
+		slog.Error(icons.Stop+" CRITICAL: Invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	e.IPExtractor = middleware.NewIPExtractor(trustedProxies)
 
 	// Middleware
+	e.Use(middleware.RequestIDMiddleware())
 	e.Use(echomiddleware.Logger())
 	e.Use(echomiddleware.Recover())
+	e.Use(metrics.Middleware())
 	e.Use(middleware.SecurityHeadersMiddleware())
 
 	// CORS Configuration
 	e.Use(echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
-		AllowOrigins:     []string{"http://localhost:3040", "http://localhost:3000"},
+		AllowOrigins:     cfg.Security.AllowedOrigins,
 		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderXRequestID, "Last-Event-ID", echo.HeaderCacheControl},
+		ExposeHeaders:    []string{echo.HeaderXRequestID, "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
 		AllowCredentials: true,
 		MaxAge:           86400,
 	}))
 
-	e.Use(echomiddleware.Gzip())
-	e.Use(echomiddleware.RateLimiter(echomiddleware.NewRateLimiterMemoryStore(rate.Limit(cfg.Security.RateLimit))))
+	e.Use(middleware.CompressionMiddleware(cfg.Server.GzipLevel, cfg.Server.GzipMinLength))
+	// RATE_LIMIT requests per second per IP, with the same burst; responses
+	// carry X-RateLimit-* headers
+	globalLimiter := middleware.NewEndpointRateLimiter(cfg.Security.RateLimit, time.Second)
+	globalLimiter.Configure(cfg.Security.RateLimitEntryTTL, cfg.Security.RateLimitMaxEntries)
+	globalLimiter.StartCleanupRoutine(backgroundCtx, 15*time.Minute)
+	e.Use(globalLimiter.Middleware("request", nil))
 
 	// Initialize Repositories & Handlers
 	userRepo := repository.NewUserRepository(db)
@@ -260,42 +322,93 @@ func main() {
 	auditRepo := repository.NewAuditRepository(db)
 	tokenBlacklistRepo := repository.NewTokenBlacklistRepository(db)
 	sessionRepo := repository.NewSessionRepository(db)
-
-	jwtManager := middleware.NewJWTManager(&cfg.JWT, tokenBlacklistRepo)
-	sessionHandler := handlers.NewSessionHandler(sessionRepo, auditRepo, tokenBlacklistRepo)
-	authHandler := handlers.NewAuthHandler(userRepo, auditRepo, sessionRepo, tokenBlacklistRepo, jwtManager, cfg)
-	profileHandler := handlers.NewProfileHandler(userRepo, &cfg.Security)
-	userHandler := handlers.NewUserHandler(userRepo, auditRepo, sessionRepo, tokenBlacklistRepo, cfg)
-	transactionHandler := handlers.NewTransactionHandler(transactionRepo, auditRepo)
+	notificationRepo := repository.NewNotificationRepository(db)
+	recurringRepo := repository.NewRecurringRepository(db)
+	loginAttemptRepo := repository.NewLoginAttemptRepository(db)
+	settingsRepo := repository.NewSettingsRepository(db)
+	passwordResetRepo := repository.NewPasswordResetRepository(db)
+	passwordHistoryRepo := repository.NewPasswordHistoryRepository(db)
+	handlers.GlobalNotificationHub.SetStore(notificationRepo)
+
+	metrics.RegisterDB(db.DB)
+	metrics.RegisterActiveSessions(sessionRepo.CountAllActiveSessions)
+	metrics.RegisterSlowQueries(db.SlowQueries)
+
+	jwtManager, err := middleware.NewJWTManager(&cfg.JWT, tokenBlacklistRepo)
+	if err != nil {
+		slog.Error(icons.Stop+" CRITICAL: JWT initialization failed", "error", err)
+		os.Exit(1)
+	}
+	if err := handlers.LoadTokensNotBefore(settingsRepo, jwtManager); err != nil {
+		slog.Warn(icons.Warning+" Failed to load global token revocation cutoff", "error", err)
+	}
+	securityNotifier := notifier.New(&cfg.Notify)
+	sessionHandler := handlers.NewSessionHandler(sessionRepo, auditRepo, tokenBlacklistRepo, cfg.Security.ActiveWindow, cfg.Security.SessionPollTimeout)
+	authHandler, err := handlers.NewAuthHandler(userRepo, auditRepo, sessionRepo, tokenBlacklistRepo, loginAttemptRepo, jwtManager, securityNotifier, cfg)
+	if err != nil {
+		slog.Error(icons.Stop+" CRITICAL: Auth handler initialization failed", "error", err)
+		os.Exit(1)
+	}
+	profileHandler := handlers.NewProfileHandler(userRepo, passwordHistoryRepo, sessionRepo, auditRepo, &cfg.Security)
+	passwordResetHandler := handlers.NewPasswordResetHandler(userRepo, passwordResetRepo, passwordHistoryRepo,
+		sessionRepo, tokenBlacklistRepo, auditRepo, securityNotifier, &cfg.Security)
+	userHandler := handlers.NewUserHandler(userRepo, auditRepo, sessionRepo, tokenBlacklistRepo, passwordHistoryRepo, securityNotifier, cfg)
+	transactionHandler := handlers.NewTransactionHandler(transactionRepo, auditRepo, &cfg.Security)
+	recurringHandler := handlers.NewRecurringHandler(recurringRepo, auditRepo, cfg.Security.MaxNoteLength)
+	dashboardHandler := handlers.NewDashboardHandler(userRepo, transactionRepo, sessionRepo)
 	auditHandler := handlers.NewAuditHandler(auditRepo)
-	sseHandler := handlers.NewSSEHandler(handlers.GlobalNotificationHub)
+	configHandler := handlers.NewConfigHandler(&cfg.Format)
+	adminSecurityHandler := handlers.NewAdminSecurityHandler(sessionRepo, tokenBlacklistRepo, settingsRepo, auditRepo, jwtManager)
+	dataExportHandler := handlers.NewDataExportHandler(userRepo, transactionRepo, sessionRepo, auditRepo)
+	loginStatsHandler := handlers.NewLoginStatsHandler(loginAttemptRepo)
+	adminOverviewHandler := handlers.NewAdminOverviewHandler(userRepo, transactionRepo, sessionRepo, auditRepo, db)
+	sseHandler := handlers.NewSSEHandler(handlers.GlobalNotificationHub, jwtManager, sessionRepo, cfg.Security.NotificationRecheck)
+	wsHandler := handlers.NewWebSocketHandler(handlers.GlobalNotificationHub, cfg.Security.AllowedOrigins,
+		jwtManager, sessionRepo, cfg.Security.NotificationRecheck)
 	securityWarningsHandler := handlers.NewSecurityWarningsHandler(auditRepo, userRepo)
 	healthHandler := handlers.NewHealthHandler(db)
-	auditLoggerMiddleware := middleware.NewAuditLoggerMiddleware(auditRepo)
+	auditLoggerMiddleware := middleware.NewAuditLoggerMiddleware(auditRepo, cfg.Security.AuditRedactFields)
 
 	// Setup Routes
 	api := e.Group("/api")
 
 	// Construct the App URL for internal usage
-	addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
-	browserURL := fmt.Sprintf("http://localhost:%s", cfg.Server.Port)
-
-	// Internal activation endpoint
-	e.GET("/__activate", func(c echo.Context) error {
-		host, _, _ := net.SplitHostPort(c.Request().RemoteAddr)
-		if host != "127.0.0.1" && host != "::1" {
-			return c.NoContent(http.StatusForbidden)
-		}
-		go func() {
-			openBrowser(browserURL)
-		}()
-		return c.JSON(http.StatusOK, map[string]string{"message": "activated"})
-	})
+	addr := cfg.Server.Addr()
+	browserURL := fmt.Sprintf("%s://%s", serverScheme(&cfg.TLS), cfg.Server.LocalAddr())
+
+	// Internal activation endpoint; a second desktop launch opens the browser through it
+	if desktop.activateEndpoint {
+		e.GET("/__activate", func(c echo.Context) error {
+			host, _, _ := net.SplitHostPort(c.Request().RemoteAddr)
+			if host != "127.0.0.1" && host != "::1" {
+				return c.NoContent(http.StatusForbidden)
+			}
+			go func() {
+				openBrowser(browserURL)
+			}()
+			return c.JSON(http.StatusOK, map[string]string{"message": "activated"})
+		})
+	}
 
 	// Public Routes
 	api.POST("/auth/login", authHandler.Login)
-	api.POST("/auth/register", authHandler.Register)
-	api.POST("/auth/refresh", authHandler.RefreshToken)
+	// Public endpoints beyond login get their own per-IP budgets
+	registerLimiter := middleware.NewEndpointRateLimiter(cfg.Security.RegisterLimit, cfg.Security.RegisterWindow)
+	refreshLimiter := middleware.NewEndpointRateLimiter(cfg.Security.RefreshLimit, cfg.Security.RefreshWindow)
+	registerLimiter.Configure(cfg.Security.RateLimitEntryTTL, cfg.Security.RateLimitMaxEntries)
+	registerLimiter.StartCleanupRoutine(backgroundCtx, 15*time.Minute)
+	refreshLimiter.Configure(cfg.Security.RateLimitEntryTTL, cfg.Security.RateLimitMaxEntries)
+	refreshLimiter.StartCleanupRoutine(backgroundCtx, 15*time.Minute)
+	forgotPasswordLimiter := middleware.NewEndpointRateLimiter(cfg.Security.ForgotPasswordLimit, cfg.Security.ForgotPasswordWindow)
+	forgotPasswordLimiter.Configure(cfg.Security.RateLimitEntryTTL, cfg.Security.RateLimitMaxEntries)
+	forgotPasswordLimiter.StartCleanupRoutine(backgroundCtx, 15*time.Minute)
+
+	api.POST("/auth/register", authHandler.Register, registerLimiter.Middleware("register", auditRepo))
+	api.POST("/auth/refresh", authHandler.RefreshToken, refreshLimiter.Middleware("refresh", auditRepo))
+	api.GET("/auth/verify-email", authHandler.VerifyEmail)
+	api.POST("/auth/forgot-password", passwordResetHandler.ForgotPassword, forgotPasswordLimiter.Middleware("forgot_password", auditRepo))
+	api.POST("/auth/reset-password", passwordResetHandler.ResetPassword)
+	api.GET("/config/formatting", configHandler.GetFormatting)
 
 	// Protected Routes
 	protected := api.Group("")
@@ -304,8 +417,9 @@ func main() {
 	protected.GET("/security/warnings", securityWarningsHandler.GetSecurityWarnings)
 	protected.GET("/security/status", securityWarningsHandler.GetAccountStatus)
 
-	protected.Use(middleware.UserStatusMiddleware(userRepo, tokenBlacklistRepo, sessionRepo))
-	protected.Use(middleware.SessionActivityMiddleware(sessionRepo))
+	protected.Use(middleware.UserStatusMiddleware(userRepo, tokenBlacklistRepo, sessionRepo, cfg.Login.AutoUnlockEnabled))
+	protected.Use(middleware.SessionFingerprintMiddleware(sessionRepo, tokenBlacklistRepo, auditRepo, &cfg.Security))
+	protected.Use(middleware.SessionActivityMiddleware(sessionRepo, tokenBlacklistRepo, cfg.Security.IdleTimeout))
 	e.Use(auditLoggerMiddleware.Middleware())
 
 	e.GET("/api/health", healthHandler.HealthCheck)
@@ -315,24 +429,42 @@ func main() {
 
 	// Session & Auth Management
 	protected.GET("/sessions", sessionHandler.GetSessions)
+	protected.GET("/sessions/current", sessionHandler.GetCurrentSession)
 	protected.GET("/sessions/:sessionId/validate", sessionHandler.ValidateSession)
 	protected.GET("/sessions/:sessionId/wait-invalidation", sessionHandler.WaitForSessionInvalidation)
 	protected.DELETE("/sessions/:id", sessionHandler.InvalidateSession)
 	protected.DELETE("/sessions/all", sessionHandler.InvalidateAllSessions)
 	protected.POST("/logout", authHandler.Logout)
+	protected.GET("/auth/introspect", authHandler.Introspect)
 
-	// App Data
+	// App Data (data changes need a verified email when REQUIRE_EMAIL_VERIFICATION is on)
+	requireVerified := middleware.RequireVerifiedEmail(userRepo, cfg.Security.RequireEmailVerification)
+	protected.GET("/me", profileHandler.GetMe)
 	protected.GET("/profile", profileHandler.GetProfile)
 	protected.PUT("/profile", profileHandler.UpdateProfile)
 	protected.POST("/profile/change-password", profileHandler.ChangePassword)
+	protected.GET("/profile/export", dataExportHandler.ExportUserData)
+	protected.GET("/profile/password-history", profileHandler.GetPasswordHistory)
+	protected.POST("/profile/resend-verification", authHandler.ResendVerification,
+		registerLimiter.Middleware("resend_verification", auditRepo))
 	protected.GET("/transactions", transactionHandler.ListTransactions)
-	protected.POST("/transactions", transactionHandler.CreateTransaction)
-	protected.PUT("/transactions/:id", transactionHandler.UpdateTransaction)
-	protected.DELETE("/transactions/:id", transactionHandler.DeleteTransaction)
+	protected.GET("/transactions/statement", transactionHandler.GetStatement)
+	protected.POST("/transactions", transactionHandler.CreateTransaction, requireVerified)
+	protected.POST("/transactions/undo", transactionHandler.UndoLastTransaction, requireVerified)
+	protected.POST("/transactions/batch-get", transactionHandler.BatchGetTransactions)
+	protected.PUT("/transactions/:id", transactionHandler.UpdateTransaction, requireVerified)
+	protected.DELETE("/transactions/:id", transactionHandler.DeleteTransaction, requireVerified)
+	protected.GET("/transactions/delete-all/preview", transactionHandler.PreviewDeleteAllTransactions)
 	protected.POST("/transactions/delete-all", func(c echo.Context) error {
 		return transactionHandler.DeleteAllTransactions(c, userRepo, &cfg.Security)
-	})
+	}, requireVerified)
 	protected.GET("/stats", transactionHandler.GetStats)
+	protected.GET("/dashboard", dashboardHandler.GetDashboard)
+	protected.GET("/recurring", recurringHandler.ListRecurring)
+	protected.POST("/recurring", recurringHandler.CreateRecurring, requireVerified)
+	protected.GET("/recurring/:id", recurringHandler.GetRecurring)
+	protected.PUT("/recurring/:id", recurringHandler.UpdateRecurring, requireVerified)
+	protected.DELETE("/recurring/:id", recurringHandler.DeleteRecurring, requireVerified)
 	protected.GET("/backup", handlers.BackupHandler(db))
 
 	protected.GET("/sessions/stream", func(c echo.Context) error {
@@ -368,37 +500,51 @@ func main() {
 		}
 	})
 
-	// Notifications
-	e.GET("/api/notifications/stream", func(c echo.Context) error {
-		tokenStr := c.QueryParam("token")
-		if tokenStr == "" {
-			return echo.NewHTTPError(http.StatusUnauthorized)
-		}
-		claims, err := jwtManager.ValidateToken(tokenStr)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusUnauthorized)
-		}
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
-		return sseHandler.HandleSSE(c)
-	})
+	// Notifications: clients may use SSE (stream) or WebSocket (ws); both
+	// authenticate via the token query param and carry the same events.
+	// reauth moves an open stream onto a refreshed token.
+	notificationAuth := jwtManager.QueryTokenAuthMiddleware()
+	e.GET("/api/notifications/stream", sseHandler.HandleSSE, notificationAuth)
+	e.GET("/api/notifications/ws", wsHandler.HandleWebSocket, notificationAuth)
+	protected.POST("/notifications/reauth", sseHandler.ReauthStream)
+
+	// Admin (IP allowlist is checked before the role)
+	adminNetworks, err := middleware.ParseCIDRList(cfg.Security.AdminIPAllowlist)
+	if err != nil {
+		slog.Error(icons.Stop+" CRITICAL: Invalid ADMIN_IP_ALLOWLIST", "error", err)
+		os.Exit(1)
+	}
+	adminIPAllowlist := middleware.AdminIPAllowlistMiddleware(adminNetworks, auditRepo)
 
-	// Admin
 	admin := protected.Group("/admin")
+	admin.Use(adminIPAllowlist)
 	admin.Use(middleware.RequireRole("admin"))
 	admin.GET("/users", userHandler.ListUsers)
 	admin.POST("/users", userHandler.CreateUser)
+	admin.POST("/users/import", userHandler.ImportUsers)
 	admin.GET("/users/:id", userHandler.GetUser)
 	admin.PUT("/users/:id", userHandler.UpdateUser)
 	admin.DELETE("/users/:id", userHandler.DeleteUser)
+	admin.POST("/users/:id/deactivate", userHandler.DeactivateUser)
+	admin.POST("/users/:id/reactivate", userHandler.ReactivateUser)
 	admin.POST("/users/:id/reset-password", userHandler.ResetUserPassword)
 	admin.POST("/users/:id/unlock", userHandler.UnlockUser)
+	admin.POST("/users/:id/lock", userHandler.LockUser)
+	admin.POST("/users/:id/unlock-permanent", userHandler.UnlockPermanentUser)
+	admin.GET("/users/:id/audit-logs", auditHandler.GetUserAuditLogs)
+	admin.GET("/users/:id/password-history", userHandler.GetUserPasswordHistory)
 	admin.GET("/audit-logs", auditHandler.GetAuditLogs)
 	admin.DELETE("/audit-logs/all", auditHandler.DeleteAllAuditLogs)
 	admin.GET("/audit-logs/export", auditHandler.ExportAuditLogs)
+	admin.GET("/stats/logins", loginStatsHandler.GetLoginStats)
+	admin.GET("/overview", adminOverviewHandler.GetOverview)
+	admin.POST("/security/revoke-all", adminSecurityHandler.RevokeAllTokens)
+	admin.GET("/blacklist", adminSecurityHandler.ListBlacklist)
+	admin.DELETE("/blacklist/:id", adminSecurityHandler.DeleteBlacklistEntry)
 
-	// Shutdown
+	// Shutdown; signals the graceful path below, which waits for backups and imports
+	quit := make(chan os.Signal, 1)
+	var shutdownByAPI atomic.Bool // no one may be at the console to answer a prompt
 	protected.POST("/shutdown", func(c echo.Context) error {
 		userID, _ := middleware.GetUserID(c)
 		role, _ := middleware.GetUserRole(c)
@@ -407,102 +553,149 @@ func main() {
 		}
 		auditRepo.LogAction(userID, "server_shutdown", "system", c.RealIP(), c.Request().Header.Get("User-Agent"), true, "Server shutdown by admin")
 		c.JSON(http.StatusOK, map[string]string{"message": "Server shutting down..."})
+		shutdownByAPI.Store(true)
 		go func() {
+			// Let the response go out before connections start draining
 			time.Sleep(500 * time.Millisecond)
-			os.Exit(0)
+			select {
+			case quit <- os.Interrupt:
+			default:
+			}
 		}()
 		return nil
-	}, middleware.RequireRole("admin"))
+	}, adminIPAllowlist, middleware.RequireRole("admin"))
 
 	// Periodic Cleanup
-	go func() {
-		ticker := time.NewTicker(1 * time.Hour)
-		defer ticker.Stop()
-		for range ticker.C {
-			sessionRepo.DeleteExpiredSessions()
-			tokenBlacklistRepo.CleanupExpired()
-		}
-	}()
+	handlers.InvalidationHub.Configure(cfg.Security.SessionMaxTracked, cfg.Security.SessionPollMaxWaiters)
+	handlers.InvalidationHub.StartCleanupRoutine(backgroundCtx, cfg.Cleanup.InvalidationInterval)
+
+	// Expired temporary locks are lifted even for users who never come back
+	if cfg.Login.AutoUnlockEnabled {
+		startAutoUnlock(backgroundCtx, userRepo, cfg.Cleanup.AutoUnlockInterval)
+	}
+
+	// Scheduled backups
+	if cfg.Backup.AutoInterval > 0 {
+		handlers.NewBackupScheduler(db, cfg.Backup.Dir, cfg.Backup.Keep).Start(backgroundCtx, cfg.Backup.AutoInterval)
+		slog.Info(icons.Database+" Automatic backups enabled", "interval", cfg.Backup.AutoInterval, "dir", cfg.Backup.Dir, "keep", cfg.Backup.Keep)
+	}
+
+	// Recurring transactions (catches up once on startup, then every minute)
+	handlers.NewRecurringScheduler(recurringRepo, transactionRepo, auditRepo, handlers.GlobalNotificationHub).
+		Start(backgroundCtx, time.Minute)
 
 	go func() {
-		ticker := time.NewTicker(1 * time.Hour)
+		ticker := time.NewTicker(cfg.Cleanup.SessionInterval)
 		defer ticker.Stop()
-		for range ticker.C {
-			// Cleanup expired sessions
-			sessionRepo.DeleteExpiredSessions()
+		for {
+			select {
+			case <-backgroundCtx.Done():
+				return
+			case <-ticker.C:
+				// Cleanup expired sessions
+				sessionRepo.DeleteExpiredSessions()
+
+				// Cleanup blacklisted tokens
+				tokenBlacklistRepo.CleanupExpired()
+
+				// Drop notifications too old to be worth replaying
+				notificationRepo.DeleteOlderThan(time.Now().Add(-7 * 24 * time.Hour))
+
+				// Login statistics cover at most the last year
+				loginAttemptRepo.DeleteOlderThan(time.Now().AddDate(-1, 0, 0))
 
-			// Cleanup blacklisted tokens
-			tokenBlacklistRepo.CleanupExpired()
+				// Reset tokens are useless once expired
+				passwordResetRepo.DeleteExpired(time.Now())
 
-			// Cleanup stale invalidation channels
-			handlers.InvalidationHub.StartCleanupRoutine(1 * time.Hour)
+				purgeAuditLogs(auditRepo, &cfg.Cleanup)
 
-			log.Println("[Cleanup] Periodic cleanup completed")
+				slog.Info("Periodic cleanup completed", "category", "cleanup")
+			}
 		}
 	}()
 
 	// Static Files
 	frontendSubFS, err := fs.Sub(staticFiles, "frontend/build")
 	if err != nil {
-		log.Printf("%s Warning: Could not load embedded frontend: %v", icons.Warning, err)
+		slog.Warn(icons.Warning+" Could not load embedded frontend", "error", err)
 	} else {
-		staticHandler := http.FileServer(http.FS(frontendSubFS))
-		e.GET("/static/*", echo.WrapHandler(http.StripPrefix("/", staticHandler)))
-		e.GET("/*", func(c echo.Context) error {
-			indexHTML, err := frontendSubFS.Open("index.html")
-			if err != nil {
-				return echo.NewHTTPError(http.StatusNotFound, "UI not found")
-			}
-			defer indexHTML.Close()
-			return c.Stream(http.StatusOK, "text/html; charset=utf-8", indexHTML)
-		})
+		var devURL *url.URL
+		if cfg.Server.FrontendDevURL != "" {
+			devURL, _ = url.Parse(cfg.Server.FrontendDevURL) // validated in config.Load
+			slog.Info(icons.Globe+" Proxying UI routes to frontend dev server", "url", cfg.Server.FrontendDevURL)
+		}
+		frontendHandler := handlers.NewFrontendHandler(frontendSubFS, devURL)
+		if devURL == nil && !frontendHandler.Embedded() {
+			slog.Warn(icons.Warning+" Embedded frontend has no index.html; serving a placeholder page",
+				"hint", "run npm run build in frontend/ or set FRONTEND_DEV_URL")
+		}
+		readOnly := []string{http.MethodGet, http.MethodHead}
+		e.Match(readOnly, "/static/*", frontendHandler.Static)
+		e.Match(readOnly, "/*", frontendHandler.Index)
 	}
 
-	log.Printf("%s Cleaning up resources...", icons.Stop)
-
-	// Close all SSE connections
-	handlers.GlobalNotificationHub.BroadcastToAll(handlers.NotificationEvent{
-		Type:      "server_shutdown",
-		Message:   "سرور در حال خاموش شدن است",
-		Severity:  "warning",
-		Timestamp: time.Now(),
-	})
-
-	// Wait briefly for messages to be sent
-	time.Sleep(500 * time.Millisecond)
-
 	// --- SERVER STARTUP ---
 
-	log.Printf("%s Starting http server at %s", icons.Rocket, browserURL)
+	// Fail before listening if TLS_MODE=provided and the certificate is unusable
+	if err := tlscert.Ensure(&cfg.TLS); err != nil {
+		slog.Error(icons.Stop+" TLS setup failed", "mode", cfg.TLS.Mode, "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info(icons.Rocket+" Starting "+serverScheme(&cfg.TLS)+" server", "url", browserURL, "addr", addr, "tls_mode", cfg.TLS.Mode, "headless", cfg.Server.Headless)
 
 	// Start Server in Goroutine
+	acmeManager := tlscert.NewACMEManager(&cfg.TLS)
+	var acmeChallengeServer *http.Server
+	if acmeManager != nil {
+		// HTTP-01 challenges; every other plain-HTTP request is redirected to HTTPS
+		acmeChallengeServer = &http.Server{Addr: cfg.TLS.ACMEHTTPAddr, Handler: acmeManager.HTTPHandler(nil)}
+		go func() {
+			if err := acmeChallengeServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error(icons.Warning+" ACME challenge listener error", "addr", cfg.TLS.ACMEHTTPAddr, "error", err)
+			}
+		}()
+		slog.Info(icons.Lock+" ACME certificates enabled", "domains", cfg.TLS.ACMEDomains, "cache", cfg.TLS.ACMECacheDir)
+	}
+
 	go func() {
-		if err := e.Start(addr); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("%s Server error: %v", icons.Stop, err)
+		var err error
+		if acmeManager != nil {
+			e.TLSServer.Addr = addr
+			e.TLSServer.TLSConfig = acmeManager.TLSConfig()
+			err = e.StartServer(e.TLSServer)
+		} else if cfg.TLS.Enabled() {
+			err = e.StartTLS(addr, cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			err = e.Start(addr)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			slog.Error(icons.Stop+" Server error", "error", err)
+			os.Exit(1)
 		}
 	}()
 
-	// Browser Waiter
-	go func() {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client := &http.Client{Transport: tr, Timeout: 1 * time.Second}
+	// Metrics listener is kept off the public port so it needs no auth
+	var metricsServer *http.Server
+	if cfg.Server.MetricsAddr != "off" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: cfg.Server.MetricsAddr, Handler: metricsMux}
 
-		// Poll until server responds
-		for {
-			resp, err := client.Get(browserURL)
-			if err == nil {
-				resp.Body.Close()
-				break
+		go func() {
+			slog.Info(icons.Chart+" Metrics available", "url", "http://"+cfg.Server.MetricsAddr+"/metrics")
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error(icons.Warning+" Metrics server error", "error", err)
 			}
-			time.Sleep(200 * time.Millisecond)
-		}
-		openBrowser(browserURL)
-	}()
+		}()
+	}
+
+	// Browser Waiter
+	if desktop.openBrowser {
+		go waitAndOpenBrowser(browserURL)
+	}
 
 	// Graceful Shutdown
-	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	var shutdownInitiated bool
@@ -512,30 +705,55 @@ func main() {
 		<-quit
 		shutdownMutex.Lock()
 		if shutdownInitiated {
-			log.Printf("\n%s Force quit requested - terminating immediately", icons.Stop)
+			slog.Warn(icons.Stop + " Force quit requested - terminating immediately")
 			os.Exit(1)
 		}
 		shutdownInitiated = true
 		shutdownMutex.Unlock()
 
-		log.Printf("\n%s ==========================================", icons.Stop)
-		log.Printf("%s  Shutting down server gracefully...", icons.Stop)
-		log.Printf("%s ==========================================", icons.Stop)
+		slog.Info(icons.Stop + " Shutting down server gracefully...")
 		quit <- os.Interrupt
 	}()
 
 	<-quit
 
+	// Let backups and imports finish writing before anything is torn down
+	if n := handlers.LongOperations.Running(); n > 0 {
+		slog.Info(icons.Stop+" Waiting for running operations to finish...", "operations", n)
+	}
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Server.DrainTimeout)
+	if err := handlers.LongOperations.Drain(drainCtx); err != nil {
+		slog.Warn(icons.Warning+" Stopping with operations still running", "error", err)
+	}
+	cancelDrain()
+
+	// A long drain must not eat into the time connections get to close
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
+	// Stop background jobs before draining HTTP connections
+	stopBackground()
+
+	// Notification streams never end on their own; close them so Shutdown doesn't wait out the timeout
+	slog.Info(icons.Stop + " Cleaning up resources...")
+	handlers.GlobalNotificationHub.Shutdown()
+
 	if err := e.Shutdown(ctx); err != nil {
-		log.Printf("%s Error during shutdown: %v", icons.Warning, err)
+		slog.Error(icons.Warning+" Error during shutdown", "error", err)
+	}
+	if acmeChallengeServer != nil {
+		acmeChallengeServer.Shutdown(ctx)
+	}
+	if err := instanceLock.Release(); err != nil {
+		slog.Warn(icons.Warning+" Failed to release instance lock", "error", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
 	}
 
-	log.Printf("%s Server stopped successfully", icons.Check)
-	if runtime.GOOS == "windows" {
-		log.Println("\nPress Enter to close this window...")
+	slog.Info(icons.Check + " Server stopped successfully")
+	if desktop.promptBeforeClose && !shutdownByAPI.Load() {
+		fmt.Println("\nPress Enter to close this window...")
 		fmt.Scanln()
 	}
 }
@@ -545,7 +763,7 @@ func broadcastSessionEvent(userID int, eventType string, data map[string]interfa
 	_ = map[string]interface{}{
 		"type":      eventType,
 		"data":      data,
-		"timestamp": time.Now(),
+		"timestamp": time.Now().UTC(),
 	}
 
 	// Broadcast to all connected clients for this user
@@ -558,9 +776,101 @@ func broadcastSessionEvent(userID int, eventType string, data map[string]interfa
 	})
 }
 
+// purgeAuditLogs applies the audit retention policy; critical entries have their own retention
+func purgeAuditLogs(auditRepo *repository.AuditRepository, cfg *config.CleanupConfig) {
+	if cfg.AuditRetentionDays > 0 {
+		purged, err := auditRepo.DeleteOlderThan(time.Now().AddDate(0, 0, -cfg.AuditRetentionDays))
+		if err != nil {
+			slog.Warn(icons.Warning+" Failed to purge audit logs", "error", err)
+		} else if purged > 0 {
+			slog.Info("Purged old audit logs", "category", "cleanup", "count", purged, "retention_days", cfg.AuditRetentionDays)
+		}
+	}
+
+	if cfg.AuditCriticalRetentionDays > 0 {
+		purged, err := auditRepo.DeleteCriticalOlderThan(time.Now().AddDate(0, 0, -cfg.AuditCriticalRetentionDays))
+		if err != nil {
+			slog.Warn(icons.Warning+" Failed to purge critical audit logs", "error", err)
+		} else if purged > 0 {
+			slog.Info("Purged old critical audit logs", "category", "cleanup", "count", purged, "retention_days", cfg.AuditCriticalRetentionDays)
+		}
+	}
+}
+
+// startAutoUnlock periodically clears temporary locks that have expired until ctx is cancelled
+func startAutoUnlock(ctx context.Context, userRepo *repository.UserRepository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				unlocked, err := userRepo.AutoUnlockExpired()
+				if err != nil {
+					slog.Warn(icons.Warning+" Failed to auto-unlock accounts", "error", err)
+				} else if unlocked > 0 {
+					slog.Info("Auto-unlocked accounts with expired locks", "category", "cleanup", "count", unlocked)
+				}
+			}
+		}
+	}()
+}
+
+// desktopBehavior lists the desktop conveniences a run uses; HEADLESS turns
+// them all off
+type desktopBehavior struct {
+	openBrowser       bool // open the UI once the server answers
+	activateEndpoint  bool // serve /__activate so a second launch can reuse this instance
+	activateRunning   bool // a second launch asks the running instance to open the browser
+	promptBeforeClose bool // wait for Enter so the console window stays readable
+}
+
+func desktopBehaviorFor(cfg *config.Config, goos string) desktopBehavior {
+	if cfg.Server.Headless {
+		return desktopBehavior{}
+	}
+	return desktopBehavior{
+		openBrowser:      true,
+		activateEndpoint: true,
+		// autocert only answers handshakes for the ACME domains, so a probe
+		// of https://localhost can never reach the running instance
+		activateRunning:   cfg.TLS.Mode != config.TLSModeACME,
+		promptBeforeClose: goos == "windows",
+	}
+}
+
+// serverScheme returns the URL scheme the main listener speaks
+func serverScheme(cfg *config.TLSConfig) string {
+	if cfg.Enabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// waitAndOpenBrowser opens the UI once the server answers
+func waitAndOpenBrowser(url string) {
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	client := &http.Client{Transport: tr, Timeout: 1 * time.Second}
+
+	// Poll until server responds
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	openBrowser(url)
+}
+
 func openBrowser(url string) {
 	var err error
-	log.Printf("%s Attempting to open browser...", icons.Globe)
+	slog.Info(icons.Globe+" Attempting to open browser...", "url", url)
 
 	switch runtime.GOOS {
 	case "linux":
@@ -574,9 +884,8 @@ func openBrowser(url string) {
 	}
 
 	if err != nil {
-		log.Printf("%s Failed to open browser automatically: %v", icons.Warning, err)
-		log.Printf("%s Please open your browser and go to: %s", icons.Globe, url)
+		slog.Warn(icons.Warning+" Failed to open browser automatically; please open it manually", "url", url, "error", err)
 	} else {
-		log.Printf("%s Browser opened successfully", icons.Check)
+		slog.Info(icons.Check + " Browser opened successfully")
 	}
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Monex/config"
+	"Monex/internal/database"
+	"Monex/internal/models"
+	"Monex/internal/repository"
+)
+
+func TestDesktopBehavior(t *testing.T) {
+	newConfig := func(headless bool, tlsMode string) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Headless: headless},
+			TLS:    config.TLSConfig{Mode: tlsMode},
+		}
+	}
+
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		goos string
+		want desktopBehavior
+	}{
+		{"headless windows", newConfig(true, config.TLSModeDisabled), "windows", desktopBehavior{}},
+		{"headless acme", newConfig(true, config.TLSModeACME), "linux", desktopBehavior{}},
+		{"windows desktop", newConfig(false, config.TLSModeAuto), "windows", desktopBehavior{
+			openBrowser: true, activateEndpoint: true, activateRunning: true, promptBeforeClose: true,
+		}},
+		{"linux desktop", newConfig(false, config.TLSModeDisabled), "linux", desktopBehavior{
+			openBrowser: true, activateEndpoint: true, activateRunning: true,
+		}},
+		{"acme desktop", newConfig(false, config.TLSModeACME), "darwin", desktopBehavior{
+			openBrowser: true, activateEndpoint: true,
+		}},
+	}
+	for _, tt := range tests {
+		if got := desktopBehaviorFor(tt.cfg, tt.goos); got != tt.want {
+			t.Errorf("%s: desktopBehaviorFor() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// openTestDB opens a fresh database under t.TempDir()
+func openTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.New(&config.DatabaseConfig{
+		Path:              filepath.Join(dir, "data.db"),
+		MaxOpenConns:      1,
+		MaxIdleConns:      1,
+		BusyTimeout:       5000,
+		AdminPasswordFile: filepath.Join(dir, ".admin-password.txt"),
+		AdminUsername:     "admin",
+		AdminEmail:        "admin@monex.local",
+	})
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestPurgeAuditLogs(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Exec("DELETE FROM audit_logs"); err != nil {
+		t.Fatalf("clear audit logs: %v", err)
+	}
+
+	seed := map[string]struct {
+		age      int // days
+		severity string
+	}{
+		"recent":           {10, "info"},
+		"expired":          {400, "warning"},
+		"recent critical":  {400, "critical"},
+		"expired critical": {800, "critical"},
+		"just kept":        {364, "info"},
+		"just expired":     {366, "info"},
+	}
+	for details, row := range seed {
+		createdAt := time.Now().AddDate(0, 0, -row.age).UTC().Format("2006-01-02 15:04:05")
+		if _, err := db.Exec(`INSERT INTO audit_logs (user_id, action, resource, success, details, severity, created_at)
+			VALUES (NULL, 'test', 'test', 1, ?, ?, ?)`, details, row.severity, createdAt); err != nil {
+			t.Fatalf("seed %s: %v", details, err)
+		}
+	}
+	remaining := func() map[string]bool {
+		t.Helper()
+		rows, err := db.Query("SELECT details FROM audit_logs")
+		if err != nil {
+			t.Fatalf("list audit logs: %v", err)
+		}
+		defer rows.Close()
+		left := map[string]bool{}
+		for rows.Next() {
+			var details string
+			if err := rows.Scan(&details); err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			left[details] = true
+		}
+		return left
+	}
+
+	// Critical rows outlive the normal retention while theirs is unset
+	auditRepo := repository.NewAuditRepository(db)
+	purgeAuditLogs(auditRepo, &config.CleanupConfig{AuditRetentionDays: 365})
+	left := remaining()
+	for _, details := range []string{"recent", "just kept", "recent critical", "expired critical"} {
+		if !left[details] {
+			t.Errorf("%s row purged", details)
+		}
+	}
+	for _, details := range []string{"expired", "just expired"} {
+		if left[details] {
+			t.Errorf("%s row kept", details)
+		}
+	}
+
+	purgeAuditLogs(auditRepo, &config.CleanupConfig{AuditRetentionDays: 365, AuditCriticalRetentionDays: 730})
+	left = remaining()
+	if left["expired critical"] || !left["recent critical"] || len(left) != 3 {
+		t.Fatalf("rows left after the critical retention: %v, want recent, just kept and recent critical", left)
+	}
+}
+
+func TestAutoUnlockClearsExpiredLocks(t *testing.T) {
+	users := repository.NewUserRepository(openTestDB(t))
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	seed := map[string]models.User{
+		"expired":   {Locked: true, LockedUntil: &past, FailedAttempts: 5},
+		"active":    {Locked: true, LockedUntil: &future, FailedAttempts: 5},
+		"permanent": {Locked: true, LockedUntil: &past, PermanentlyLocked: true},
+	}
+	for name, lock := range seed {
+		user := &models.User{Username: name, Email: name + "@example.com", Role: models.RoleUser, Active: true, Password: "x"}
+		if err := users.Create(user); err != nil {
+			t.Fatalf("Create %s: %v", name, err)
+		}
+		lock.ID = user.ID
+		if err := users.UpdateLockStatus(&lock); err != nil {
+			t.Fatalf("lock %s: %v", name, err)
+		}
+	}
+	locked := func(name string) *models.User {
+		t.Helper()
+		user, err := users.GetByUsername(name)
+		if err != nil {
+			t.Fatalf("GetByUsername %s: %v", name, err)
+		}
+		return user
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startAutoUnlock(ctx, users, 5*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for locked("expired").Locked {
+		if time.Now().After(deadline) {
+			t.Fatal("expired lock not cleared")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if user := locked("expired"); user.LockedUntil != nil || user.FailedAttempts != 0 {
+		t.Errorf("unlocked user kept locked_until %v and %d failed attempts", user.LockedUntil, user.FailedAttempts)
+	}
+	if !locked("active").Locked {
+		t.Error("lock that has not expired was cleared")
+	}
+	if !locked("permanent").Locked {
+		t.Error("permanent lock was cleared")
+	}
+}
+
+func TestLogFileUnderDataDir(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "monex-data")
+	t.Setenv("DATA_DIR", dataDir)
+	t.Setenv("LOG_FILENAME", "")
+	defaultLogger, logOutput, logFlags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		log.SetOutput(logOutput)
+		log.SetFlags(logFlags)
+	})
+
+	if err := initLogger(); err != nil {
+		t.Fatalf("initLogger: %v", err)
+	}
+	if want := filepath.Join(dataDir, "monex.log"); logFilePath != want {
+		t.Fatalf("log file at %s, want %s", logFilePath, want)
+	}
+	if _, err := os.Stat(logFilePath); err != nil {
+		t.Fatalf("log file not written: %v", err)
+	}
+}